@@ -0,0 +1,45 @@
+package firego
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const defaultAccept = "application/json"
+
+// setAccept sets the Accept header of req.
+func (fb *firebase) setAccept(req *http.Request) error {
+	if fb.codec != nil {
+		req.Header.Set("Accept", fb.codec.Accept())
+		return nil
+	}
+	if fb.accept == "" {
+		req.Header.Set("Accept", defaultAccept)
+		return nil
+	}
+
+	for _, r := range strings.Split(fb.accept, ",") {
+		if _, _, err := mime.ParseMediaType(r); err != nil {
+			return fmt.Errorf("invalid Accept header %q: %v", fb.accept, err)
+		}
+	}
+	req.Header.Set("Accept", fb.accept)
+	return nil
+}
+
+// checkContentType reports an error if the response to a read
+// made with a custom Accept header is not a JSON document. The responses
+// of a reference with a codec are decoded by the codec instead.
+func (fb *firebase) checkContentType(req *http.Request, resp *http.Response) error {
+	if fb.accept == "" || fb.codec != nil || req.Method != "GET" {
+		return nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if isJSON(contentType) {
+		return nil
+	}
+	return fmt.Errorf("response of content type %q to a request accepting %q is not JSON", contentType, fb.accept)
+}
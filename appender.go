@@ -0,0 +1,82 @@
+package firego
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Appender appends values as new children of a reference, for append-only
+// workloads such as event logs. Unlike Push, the keys of the new children
+// are generated locally, so no response has to be decoded, and the
+// connection to Firebase is kept alive across appends.
+//
+// An Appender is safe for concurrent use.
+type Appender struct {
+	ref *firebase
+}
+
+// Appender creates an Appender for the reference. If the reference
+// uses the client created by New, the Appender uses its own client that
+// keeps connections alive instead; the appender should be closed once
+// it is no longer needed to release them.
+func (fb *firebase) Appender() *Appender {
+	ref := fb.copy()
+	if fb.defaultClient {
+		ref.client = fb.keepAliveClient()
+	}
+	return &Appender{ref: ref}
+}
+
+// keepAliveClient creates a client configured like the one created by New
+// that keeps connections alive between requests.
+func (fb *firebase) keepAliveClient() *http.Client {
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: fb.clientTimeout,
+		}).DialContext,
+		ResponseHeaderTimeout: fb.clientTimeout,
+		MaxIdleConnsPerHost:   BatchConcurrency,
+	}
+	if fb.tlsConfig != nil {
+		tr.TLSClientConfig = fb.tlsConfig.Clone()
+	}
+	return &http.Client{
+		Transport:     tr,
+		CheckRedirect: redirectPreserveHeaders,
+	}
+}
+
+// Append writes v as a new child of the reference
+// and returns the key it was written to.
+//
+// The value is written the way Set writes it, so the options of the
+// reference, such as WithWriteQueue, WithDedupe and Silent, apply to it.
+// With a write queue the returned key is valid even when the error is
+// ErrQueued.
+func (a *Appender) Append(v interface{}) (string, error) {
+	bytes, err := a.ref.marshalPayload(v)
+	if err != nil {
+		return "", err
+	}
+
+	key := newPushID()
+	child := a.ref.copy()
+	child.url += "/" + key
+	if _, err := child.write(context.Background(), "PUT", bytes); err != nil {
+		if err == ErrQueued {
+			return key, err
+		}
+		return "", err
+	}
+	return key, nil
+}
+
+// Close releases the idle connections held by the Appender.
+func (a *Appender) Close() error {
+	if a.ref.defaultClient {
+		a.ref.client.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	return nil
+}
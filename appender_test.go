@@ -0,0 +1,110 @@
+package firego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestAppender(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	a := New(server.URL, nil).Child("logs").Appender()
+	defer a.Close()
+
+	var keys []string
+	for _, v := range []string{"one", "two", "three"} {
+		key, err := a.Append(v)
+		require.NoError(t, err)
+		assert.Len(t, key, 20)
+		assert.Equal(t, v, server.Get("logs/"+key))
+		keys = append(keys, key)
+	}
+	assert.True(t, sort.StringsAreSorted(keys), "keys are not chronologically ordered")
+}
+
+func TestAppenderWriteQueue(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	q := NewMemoryWriteQueue()
+	fb := New(server.URL, nil, WithWriteQueue(q))
+	a := fb.Child("logs").Appender()
+	defer a.Close()
+
+	// appends are queued like any other write
+	key, err := a.Append("offline")
+	assert.Equal(t, ErrQueued, err)
+	require.Len(t, key, 20)
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	atomic.StoreInt32(offline, 0)
+	require.NoError(t, fb.Flush(context.Background()))
+	assert.Equal(t, "offline", ft.Get("logs/"+key))
+}
+
+func TestAppenderReusesConnection(t *testing.T) {
+	t.Parallel()
+	conns := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conns[req.RemoteAddr] = true
+		w.Write([]byte("true"))
+	}))
+	defer server.Close()
+
+	a := New(server.URL, nil).Appender()
+	defer a.Close()
+	for i := 0; i < 5; i++ {
+		_, err := a.Append(true)
+		require.NoError(t, err)
+	}
+	assert.Len(t, conns, 1)
+}
+
+func BenchmarkPush(b *testing.B) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("logs")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fb.Push("entry"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppender(b *testing.B) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	a := New(server.URL, nil).Child("logs").Appender()
+	defer a.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := a.Append("entry"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+)
+
+// maxSparseLength is the longest array an object keyed by indexes is read
+// back as, so that a stray large key does not allocate a huge slice.
+const maxSparseLength = 1 << 20
+
+// SetArray writes elems at the reference, replacing its value.
+//
+// Firebase has no arrays: elems is stored as an object with one child per
+// element, keyed by its index in decimal ("0", "1", ...), and since a null
+// child does not exist, the nil elements are not stored at all. Writing
+// []interface{}{"a", nil, "c"} stores {"0": "a", "2": "c"}, and an elems
+// with no element other than nil removes the value, as Remove does.
+//
+// Value reads such an object back into a Go slice or array, at the top or
+// in a field, by placing each child at its index and leaving the missing
+// ones as the zero value of the element type, nil for []interface{} or a
+// slice of pointers, so that the example above reads back as
+// []interface{}{"a", nil, "c"}. The nil elements at the end of elems
+// can not be told apart from no element and are not read back: the slice
+// read is as long as the last non-nil element requires. Reading into an
+// interface{} keeps what the REST API returns, an array when more than
+// half of the indexes are present and an object otherwise.
+func (fb *firebase) SetArray(elems []interface{}) error {
+	children := make(map[string]interface{}, len(elems))
+	for i, elem := range elems {
+		if elem != nil {
+			children[strconv.Itoa(i)] = elem
+		}
+	}
+	return fb.Set(children)
+}
+
+// decodeArrays decodes data into v like decode does, reading objects keyed
+// by indexes into the slices and arrays of v when they are not already
+// arrays. The data is only rewritten once decoding it as is failed on one
+// of them, or up front for a lenient decode, which would otherwise skip
+// them.
+func (fb *firebase) decodeArrays(data []byte, v interface{}, decode func([]byte, interface{}) error) error {
+	if fb.lenientDecode {
+		if arrays, ok := sparseArrays(data, reflect.TypeOf(v)); ok {
+			data = arrays
+		}
+		return decode(data, v)
+	}
+
+	err := decode(data, v)
+	e, ok := err.(*json.UnmarshalTypeError)
+	if !ok || e.Value != "object" || (e.Type.Kind() != reflect.Slice && e.Type.Kind() != reflect.Array) {
+		return err
+	}
+	arrays, ok := sparseArrays(data, reflect.TypeOf(v))
+	if !ok {
+		return err
+	}
+	return decode(arrays, v)
+}
+
+// sparseArrays returns data with the objects keyed by indexes that are
+// decoded into a slice or an array of t replaced with arrays, along with
+// false when there were none.
+func sparseArrays(data []byte, t reflect.Type) ([]byte, bool) {
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, false
+	}
+	tree, ok := toArrays(tree, t)
+	if !ok {
+		return nil, false
+	}
+	data, err = json.Marshal(tree)
+	return data, err == nil
+}
+
+// toArrays replaces the objects keyed by indexes of tree, whose Go type is
+// t, that are decoded into a slice or an array with arrays holding null
+// at the missing indexes, and reports whether it replaced any.
+func toArrays(tree interface{}, t reflect.Type) (interface{}, bool) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return tree, false
+	}
+
+	var changed bool
+	convert := func(child interface{}, t reflect.Type) interface{} {
+		child, ok := toArrays(child, t)
+		changed = changed || ok
+		return child
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if m, ok := tree.(map[string]interface{}); ok {
+			elems, ok := indexed(m)
+			if !ok {
+				return tree, false
+			}
+			tree, changed = elems, true
+		}
+		if elems, ok := tree.([]interface{}); ok {
+			for i, elem := range elems {
+				elems[i] = convert(elem, t.Elem())
+			}
+		}
+	case reflect.Map:
+		if m, ok := tree.(map[string]interface{}); ok {
+			for k, child := range m {
+				m[k] = convert(child, t.Elem())
+			}
+		}
+	case reflect.Struct:
+		if m, ok := tree.(map[string]interface{}); ok {
+			fields := jsonFields(t)
+			for k, child := range m {
+				if f, ok := fieldByName(fields, k); ok {
+					m[k] = convert(child, f.typ)
+				}
+			}
+		}
+	}
+	return tree, changed
+}
+
+// indexed returns the children of m, which must all be keyed by an index,
+// as an array holding null at the missing indexes.
+func indexed(m map[string]interface{}) ([]interface{}, bool) {
+	length := 0
+	for k := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= maxSparseLength || strconv.Itoa(i) != k {
+			return nil, false
+		}
+		if i >= length {
+			length = i + 1
+		}
+	}
+	elems := make([]interface{}, length)
+	for k, child := range m {
+		i, _ := strconv.Atoi(k)
+		elems[i] = child
+	}
+	return elems, true
+}
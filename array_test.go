@@ -0,0 +1,82 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestSetArray(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/list", nil)
+	require.NoError(t, fb.SetArray([]interface{}{"a", nil, "c", nil}))
+	assert.Equal(t, map[string]interface{}{"0": "a", "2": "c"}, server.Get("list"))
+
+	// the gap is read back, the trailing nil is not
+	var elems []interface{}
+	require.NoError(t, fb.Value(&elems))
+	assert.Equal(t, []interface{}{"a", nil, "c"}, elems)
+
+	var strs []*string
+	require.NoError(t, fb.Value(&strs))
+	require.Len(t, strs, 3)
+	assert.Equal(t, "a", *strs[0])
+	assert.Nil(t, strs[1])
+	assert.Equal(t, "c", *strs[2])
+
+	var fixed [4]string
+	require.NoError(t, fb.Value(&fixed))
+	assert.Equal(t, [4]string{"a", "", "c", ""}, fixed)
+
+	// an interface{} keeps the object
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, map[string]interface{}{"0": "a", "2": "c"}, v)
+
+	// only nil elements remove the value
+	require.NoError(t, fb.SetArray([]interface{}{nil}))
+	assert.Nil(t, server.Get("list"))
+}
+
+func TestValueSparseArrayField(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type player struct {
+		Name   string            `json:"name"`
+		Scores []int             `json:"scores"`
+		Rounds map[string][]*int `json:"rounds"`
+	}
+	fb := New(server.URL+"/players", nil)
+	require.NoError(t, fb.Child("alice/scores").SetArray([]interface{}{nil, 3, nil, 5}))
+	server.Set("players/alice/name", "alice")
+	server.Set("players/alice/rounds/first", map[string]interface{}{"1": 2})
+	server.Set("players/bob", map[string]interface{}{"name": "bob", "scores": []interface{}{1, 2}})
+
+	var players map[string]player
+	require.NoError(t, fb.Value(&players))
+	assert.Equal(t, "alice", players["alice"].Name)
+	assert.Equal(t, []int{0, 3, 0, 5}, players["alice"].Scores)
+	require.Len(t, players["alice"].Rounds["first"], 2)
+	assert.Nil(t, players["alice"].Rounds["first"][0])
+	assert.Equal(t, 2, *players["alice"].Rounds["first"][1])
+	assert.Equal(t, []int{1, 2}, players["bob"].Scores)
+
+	// lenient decodes read the indexes too
+	var alice player
+	require.NoError(t, New(server.URL+"/players/alice", nil, WithLenientDecode(true)).Value(&alice))
+	assert.Equal(t, []int{0, 3, 0, 5}, alice.Scores)
+
+	// an object with keys other than indexes still fails
+	server.Set("players/carol", map[string]interface{}{"scores": map[string]interface{}{"best": 9}})
+	var scores []int
+	assert.Error(t, fb.Child("carol/scores").Value(&scores))
+}
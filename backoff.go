@@ -0,0 +1,97 @@
+package firego
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff decides how long to wait before retrying an operation that
+// failed. A Backoff set with WithBackoff is shared by every request and
+// stream of the reference, and of the references derived from it, so it
+// must be safe for concurrent use.
+type Backoff interface {
+	// NextDelay returns the delay to wait before the retry following the
+	// given number of failed attempts, starting from 0.
+	NextDelay(attempt int) time.Duration
+	// Reset is called once an operation that had to be retried succeeds.
+	Reset()
+}
+
+// WithBackoff makes the reference wait the delays returned by b before
+// retrying a request, in place of the doubling delays set with WithRetry,
+// and before reconnecting the stream of an event function set with
+// ChildAdded, ChildChanged or ChildRemoved. The number of retries is still
+// set with WithRetry and the number of reconnects with WithMaxReconnects.
+func WithBackoff(b Backoff) Option {
+	return func(fb *firebase) {
+		fb.backoff = b
+	}
+}
+
+// FullJitterBackoff is a Backoff waiting a random delay between 0 and an
+// exponentially growing ceiling, which spreads out the retries of clients
+// that failed at the same time.
+//
+// Reference https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type FullJitterBackoff struct {
+	// Base is the ceiling of the first delay, it doubles after every
+	// failed attempt.
+	Base time.Duration
+	// Max caps the ceiling, there is no cap if it is 0.
+	Max time.Duration
+}
+
+// NextDelay implements Backoff.
+func (b FullJitterBackoff) NextDelay(attempt int) time.Duration {
+	ceiling := exponentialBackoff{base: b.Base}.NextDelay(attempt)
+	if b.Max > 0 && ceiling > b.Max {
+		ceiling = b.Max
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Reset implements Backoff, FullJitterBackoff keeps no state.
+func (FullJitterBackoff) Reset() {}
+
+// maxBackoffDelay caps the delays of exponentialBackoff.
+const maxBackoffDelay = time.Duration(1 << 62)
+
+// exponentialBackoff doubles the delay after every failed attempt,
+// starting at base.
+type exponentialBackoff struct {
+	base time.Duration
+}
+
+func (b exponentialBackoff) NextDelay(attempt int) time.Duration {
+	d := b.base
+	for i := 0; i < attempt && d < maxBackoffDelay/2; i++ {
+		d *= 2
+	}
+	return d
+}
+
+func (exponentialBackoff) Reset() {}
+
+// retryBackoff returns the Backoff of the retries of requests.
+func (fb *firebase) retryBackoff() Backoff {
+	switch {
+	case fb.backoff != nil:
+		return fb.backoff
+	case fb.retryJitter:
+		return FullJitterBackoff{Base: fb.retryDelay}
+	}
+	return exponentialBackoff{base: fb.retryDelay}
+}
+
+// reconnectBackoff returns the Backoff of the reconnects of event
+// functions, which by default wait twice the heartbeat, doubling after
+// every failed reconnect.
+func (fb *firebase) reconnectBackoff() Backoff {
+	if fb.backoff != nil {
+		return fb.backoff
+	}
+	return exponentialBackoff{base: 2 * fb.watchHeartbeat}
+}
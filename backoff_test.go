@@ -0,0 +1,108 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingBackoff records the attempts it is asked the delay of.
+type recordingBackoff struct {
+	mtx      sync.Mutex
+	attempts []int
+	resets   int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.attempts = append(b.attempts, attempt)
+	return time.Millisecond
+}
+
+func (b *recordingBackoff) Reset() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.resets++
+}
+
+func (b *recordingBackoff) calls() ([]int, int) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return append([]int(nil), b.attempts...), b.resets
+}
+
+func TestFullJitterBackoff(t *testing.T) {
+	t.Parallel()
+	b := FullJitterBackoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for attempt := 0; attempt < 10; attempt++ {
+		ceiling := 10 * time.Millisecond << uint(attempt)
+		if ceiling > b.Max {
+			ceiling = b.Max
+		}
+		for i := 0; i < 20; i++ {
+			d := b.NextDelay(attempt)
+			assert.True(t, d >= 0 && d <= ceiling, "attempt %d: %s", attempt, d)
+		}
+	}
+	assert.Zero(t, FullJitterBackoff{}.NextDelay(3))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Parallel()
+	b := exponentialBackoff{base: time.Millisecond}
+	assert.Equal(t, time.Millisecond, b.NextDelay(0))
+	assert.Equal(t, 8*time.Millisecond, b.NextDelay(3))
+	assert.True(t, b.NextDelay(1000) > 0)
+}
+
+func TestWithBackoffRetry(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 2)
+	defer server.Close()
+
+	b := &recordingBackoff{}
+	fb := New(server.URL, nil, WithRetry(2, time.Hour), WithBackoff(b))
+	require.NoError(t, fb.Set(true))
+	assert.Len(t, *requests, 3)
+
+	attempts, resets := b.calls()
+	assert.Equal(t, []int{0, 1}, attempts)
+	assert.Equal(t, 1, resets)
+}
+
+func TestWithBackoffReconnect(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	b := &recordingBackoff{}
+	fb := New(server.URL, nil, WithBackoff(b), WithMaxReconnects(3))
+	fb.(*firebase).watchHeartbeat = time.Millisecond
+
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, fb.ChildAdded(fn))
+	defer fb.RemoveEventFunc(fn)
+
+	assert.Eventually(t, func() bool {
+		attempts, _ := b.calls()
+		return len(attempts) == 3
+	}, time.Second, 5*time.Millisecond)
+	attempts, _ := b.calls()
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+}
@@ -0,0 +1,190 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchConcurrency is the maximum number of requests a batch
+// operation, such as ValueFields, will have in flight at once.
+var BatchConcurrency = 8
+
+// BatchError is returned by batch operations when one or more of their
+// requests fail. The requests of a batch are independent of each other,
+// so every path that is not listed in Errors completed successfully and
+// only the failed subset needs to be retried. A path given more than once
+// is counted once, failed if any of its requests did.
+type BatchError struct {
+	// Errors maps the path of each failed request to its error.
+	Errors map[string]error
+	// Succeeded is the number of paths whose requests all completed
+	// successfully.
+	Succeeded int
+}
+
+func (e *BatchError) Error() string {
+	paths := make([]string, 0, len(e.Errors))
+	for path := range e.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %v", path, e.Errors[path])
+	}
+	return fmt.Sprintf("%d of %d paths failed: %s",
+		len(e.Errors), len(e.Errors)+e.Succeeded, strings.Join(msgs, "; "))
+}
+
+// batch calls fn for the index of every path using at most
+// BatchConcurrency goroutines. Every call is made regardless of the
+// others failing; if any of them do, a *BatchError keyed by path is
+// returned.
+func batch(paths []string, fn func(ctx context.Context, i int) error) error {
+	ctx := context.Background()
+
+	limit := BatchConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs = map[string]error{}
+		sem  = make(chan struct{}, limit)
+	)
+
+	for i := range paths {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(ctx, i); err != nil {
+				mtx.Lock()
+				errs[paths[i]] = err
+				mtx.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	distinct := map[string]bool{}
+	for _, path := range paths {
+		distinct[path] = true
+	}
+	return &BatchError{
+		Errors:    errs,
+		Succeeded: len(distinct) - len(errs),
+	}
+}
+
+// distinctPaths returns paths without the paths given more than once.
+func distinctPaths(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	distinct := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			distinct = append(distinct, path)
+		}
+	}
+	return distinct
+}
+
+// ValueFields gets the values of the given child paths and stores
+// them in dest keyed by the path that was requested. A path that does
+// not exist is stored as nil.
+//
+// Since the Firebase REST API has no way of selecting fields, every
+// path is fetched with its own request; at most BatchConcurrency of
+// them are made concurrently. This trades a higher request count for
+// a smaller payload and is only worth it when the requested fields
+// are a small part of a large node.
+//
+// A path given more than once is fetched once. If some of the requests
+// fail, the fields that were fetched are still stored in dest and a
+// *BatchError describing the failures is returned.
+func (fb *firebase) ValueFields(fields []string, dest map[string]interface{}) error {
+	fields = distinctPaths(fields)
+	values := make([]interface{}, len(fields))
+	ok := make([]bool, len(fields))
+	err := batch(fields, func(ctx context.Context, i int) error {
+		child := fb.Child(fields[i]).(*firebase)
+		bytes, err := child.doRequest(ctx, "GET", nil)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(bytes, &values[i]); err != nil {
+			return err
+		}
+		ok[i] = true
+		return nil
+	})
+
+	for i, field := range fields {
+		if ok[i] {
+			dest[field] = values[i]
+		}
+	}
+	return err
+}
+
+// collectTag is the struct tag naming the child path
+// Collect reads the value of a field from.
+const collectTag = "firebase"
+
+// Collect reads the values of several child paths into the fields of the
+// struct dest points to, the way Value reads them, each field tagged with
+// the path it is read from:
+//
+//	type Config struct {
+//		Flags   map[string]bool `firebase:"config/flags"`
+//		Limit   int             `firebase:"config/limits/requests"`
+//		Banner  string          `firebase:"content/banner"`
+//		Ignored string
+//	}
+//
+// Every path is fetched with its own request, at most BatchConcurrency of
+// them concurrently, the same way ValueFields fetches them. A path with no
+// value leaves its field as it was, unless the field is a pointer, a map
+// or a slice, which is set to nil. If some of the requests fail, the other
+// fields are still set and a *BatchError keyed by path is returned.
+func (fb *firebase) Collect(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Collect needs a pointer to a struct, not %T", dest)
+	}
+
+	var (
+		paths  []string
+		fields []reflect.Value
+	)
+	t := rv.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path, ok := f.Tag.Lookup(collectTag)
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		paths = append(paths, path)
+		fields = append(fields, rv.Elem().Field(i))
+	}
+
+	return batch(paths, func(ctx context.Context, i int) error {
+		return fb.Child(paths[i]).Value(fields[i].Addr().Interface())
+	})
+}
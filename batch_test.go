@@ -0,0 +1,187 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestBatchConcurrency(t *testing.T) {
+	var (
+		inFlight = new(int32)
+		max      = new(int32)
+	)
+
+	paths := make([]string, 4*BatchConcurrency)
+	for i := range paths {
+		paths[i] = strconv.Itoa(i)
+	}
+
+	err := batch(paths, func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			m := atomic.LoadInt32(max)
+			if n <= m || atomic.CompareAndSwapInt32(max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, atomic.LoadInt32(max) <= int32(BatchConcurrency))
+}
+
+func TestBatchError(t *testing.T) {
+	t.Parallel()
+	expected := errors.New("boom")
+
+	err := batch([]string{"a", "b", "c"}, func(ctx context.Context, i int) error {
+		if i == 1 {
+			return expected
+		}
+		return nil
+	})
+	require.IsType(t, (*BatchError)(nil), err)
+
+	bErr := err.(*BatchError)
+	assert.Equal(t, map[string]error{"b": expected}, bErr.Errors)
+	assert.Equal(t, 2, bErr.Succeeded)
+	assert.Equal(t, "1 of 3 paths failed: b: boom", bErr.Error())
+
+	// a path given twice is counted once
+	err = batch([]string{"a", "b", "b", "a"}, func(ctx context.Context, i int) error {
+		if i == 2 {
+			return expected
+		}
+		return nil
+	})
+	require.IsType(t, (*BatchError)(nil), err)
+	bErr = err.(*BatchError)
+	assert.Equal(t, map[string]error{"b": expected}, bErr.Errors)
+	assert.Equal(t, 1, bErr.Succeeded)
+}
+
+func TestValueFields(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("user", map[string]interface{}{
+		"name":  "gopher",
+		"age":   7,
+		"bio":   "a very long biography",
+		"likes": map[string]interface{}{"go": true},
+	})
+
+	fb := New(server.URL, nil).Child("user")
+	dest := map[string]interface{}{}
+	err := fb.ValueFields([]string{"name", "likes/go", "missing"}, dest)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"name":     "gopher",
+		"likes/go": true,
+		"missing":  nil,
+	}, dest)
+}
+
+func TestValueFieldsPartialFailure(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Permission denied"}`))
+			return
+		}
+		w.Write([]byte(`"public"`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	dest := map[string]interface{}{}
+	err := fb.ValueFields([]string{"name", "secret", "title", "secret"}, dest)
+	require.IsType(t, (*BatchError)(nil), err)
+
+	bErr := err.(*BatchError)
+	assert.Len(t, bErr.Errors, 1)
+	assert.Contains(t, bErr.Errors, "secret")
+	assert.Equal(t, 2, bErr.Succeeded)
+	assert.Equal(t, map[string]interface{}{"name": "public", "title": "public"}, dest)
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("config", map[string]interface{}{
+		"flags":  map[string]interface{}{"beta": true},
+		"limits": map[string]interface{}{"requests": 100},
+	})
+	server.Set("content/banner", "hello")
+
+	type config struct {
+		Flags   map[string]bool `firebase:"config/flags"`
+		Limit   int             `firebase:"/config/limits/requests"`
+		Banner  string          `firebase:"content/banner"`
+		Missing string          `firebase:"content/missing"`
+		Ignored string
+		private string `firebase:"content/banner"`
+	}
+	fb := New(server.URL, nil)
+	dest := config{Missing: "default", Ignored: "untouched"}
+	require.NoError(t, fb.Collect(&dest))
+	assert.Equal(t, config{
+		Flags:   map[string]bool{"beta": true},
+		Limit:   100,
+		Banner:  "hello",
+		Missing: "default",
+		Ignored: "untouched",
+	}, dest)
+
+	assert.Error(t, fb.Collect(dest))
+	assert.Error(t, fb.Collect((*config)(nil)))
+}
+
+func TestCollectPartialFailure(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Permission denied"}`))
+			return
+		}
+		w.Write([]byte(`"public"`))
+	}))
+	defer server.Close()
+
+	var dest struct {
+		Name   string `firebase:"name"`
+		Secret string `firebase:"secret"`
+		Count  int    `firebase:"count"`
+	}
+	err := New(server.URL, nil).Collect(&dest)
+	require.IsType(t, (*BatchError)(nil), err)
+
+	bErr := err.(*BatchError)
+	assert.Len(t, bErr.Errors, 2)
+	assert.Contains(t, bErr.Errors, "secret")
+	// values that do not fit their field fail too
+	assert.Contains(t, bErr.Errors, "count")
+	assert.Equal(t, 1, bErr.Succeeded)
+	assert.Equal(t, "public", dest.Name)
+}
@@ -0,0 +1,230 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxWriteSize is the largest write accepted by the REST API.
+	maxWriteSize = 256 << 20
+	// maxKeyLength is the longest key, in bytes, Firebase accepts.
+	maxKeyLength = 768
+)
+
+// ErrPayloadTooLarge is the error returned when a write is larger than
+// Firebase accepts in a single request, either when Firebase rejects it
+// or, for BulkImport, before it is sent. The write has to be split into
+// smaller ones, BulkImportStream does so on its own.
+type ErrPayloadTooLarge struct {
+	// Size is the size of the write, in bytes.
+	Size int64
+	// Limit is the largest write, in bytes, the REST API accepts.
+	Limit int64
+	// Err is the ErrHTTP of the response rejecting the write, nil when
+	// the write was not sent.
+	Err error
+}
+
+func (e ErrPayloadTooLarge) Error() string {
+	return fmt.Sprintf("write of %d bytes exceeds the %d bytes a single write may contain, split it into smaller writes", e.Size, e.Limit)
+}
+
+// Unwrap returns the ErrHTTP of the response rejecting the write.
+func (e ErrPayloadTooLarge) Unwrap() error {
+	return e.Err
+}
+
+// payloadTooLarge returns the ErrPayloadTooLarge of a write of size bytes
+// for err when it is Firebase rejecting the size of the write, err
+// otherwise. Firebase reports writes that are too large with a 413 or,
+// for some of them, with a 400 explaining so.
+func payloadTooLarge(err error, size int64) error {
+	e, ok := err.(ErrHTTP)
+	if !ok {
+		return err
+	}
+	if e.StatusCode != http.StatusRequestEntityTooLarge &&
+		(e.StatusCode != http.StatusBadRequest || !strings.Contains(e.Message, "exceeds the maximum size")) {
+		return err
+	}
+	return ErrPayloadTooLarge{Size: size, Limit: maxWriteSize, Err: e}
+}
+
+// ImportItem is a single child written by BulkImportStream.
+type ImportItem struct {
+	// Key of the child relative to the reference, it may contain
+	// slashes to write to a deeper descendant.
+	Key   string
+	Value interface{}
+}
+
+// BulkImport writes every item as a child of the reference, keyed by its
+// key, in a single request. Keys may contain slashes to write to deeper
+// descendants. Children of the reference that are not in items are left
+// untouched.
+//
+// The keys and the size of the write are validated before anything is
+// sent. The write is atomic, either every item is written or none is.
+func (fb *firebase) BulkImport(items map[string]interface{}) error {
+	for key := range items {
+		if err := validatePath(key); err != nil {
+			return err
+		}
+	}
+
+	bytes, err := fb.marshalPayload(items)
+	if err != nil {
+		return err
+	}
+	if len(bytes) > maxWriteSize {
+		return ErrPayloadTooLarge{Size: int64(len(bytes)), Limit: maxWriteSize}
+	}
+	_, err = fb.write(context.Background(), "PATCH", bytes)
+	return err
+}
+
+// BulkImportStream writes the items received from items as children of
+// the reference, in batches of at most batchSize items written with
+// BulkImport, until items is closed. After each batch progress, if not
+// nil, is called with the number of distinct keys written so far: an item
+// whose key was already received replaces the value written for it and
+// is not counted again.
+//
+// Each batch is atomic but the import as a whole is not, when an error is
+// returned the batches that were already written stay written and the
+// items of the failed batch are not written. The import is stopped, and
+// the in-flight batch aborted, once ctx is done.
+//
+// A batch that is too large to be written in a single request, which
+// fails with an ErrPayloadTooLarge, is split in two halves written one
+// after the other, down to single items.
+func (fb *firebase) BulkImportStream(ctx context.Context, items <-chan ImportItem, batchSize int, progress func(written int)) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	ref := fb.WithContext(ctx)
+	written := map[string]bool{}
+	var flush func(batch map[string]interface{}) error
+	flush = func(batch map[string]interface{}) error {
+		err := ref.BulkImport(batch)
+		if _, ok := err.(ErrPayloadTooLarge); ok && len(batch) > 1 {
+			first, second := splitBatch(batch)
+			if err := flush(first); err != nil {
+				return err
+			}
+			return flush(second)
+		}
+		if err != nil {
+			return err
+		}
+		for key := range batch {
+			written[key] = true
+		}
+		if progress != nil {
+			progress(len(written))
+		}
+		return nil
+	}
+
+	batch := make(map[string]interface{}, batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case item, ok := <-items:
+			if !ok {
+				if len(batch) == 0 {
+					return nil
+				}
+				return flush(batch)
+			}
+
+			// "a" and "/a" are the same child
+			batch[strings.Trim(item.Key, "/")] = item.Value
+			if len(batch) < batchSize {
+				continue
+			}
+			if err := flush(batch); err != nil {
+				return err
+			}
+			batch = make(map[string]interface{}, batchSize)
+		}
+	}
+}
+
+// splitBatch splits the items of batch in two halves.
+func splitBatch(batch map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	first := make(map[string]interface{}, len(batch)/2)
+	second := make(map[string]interface{}, len(batch)-len(batch)/2)
+	for key, value := range batch {
+		if len(first) < len(batch)/2 {
+			first[key] = value
+		} else {
+			second[key] = value
+		}
+	}
+	return first, second
+}
+
+// validatePath reports whether every key of path is accepted by Firebase.
+func validatePath(path string) error {
+	for _, key := range strings.Split(strings.Trim(path, "/"), "/") {
+		if err := validateKey(key); err != nil {
+			return fmt.Errorf("invalid key %q: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// validateUpdatePaths reports whether the keys of an update that are paths
+// are valid, and whether none of the keys is the ancestor of another one.
+// Keys that are not paths are left to Firebase, they may be the special
+// ".priority" or ".value" ones.
+func validateUpdatePaths(updates map[string]interface{}) error {
+	paths := make(map[string]bool, len(updates))
+	for key := range updates {
+		path := strings.Trim(key, "/")
+		if paths[path] {
+			return fmt.Errorf("invalid update: path %q is written twice", path)
+		}
+		paths[path] = true
+		if strings.Contains(path, "/") {
+			if err := validatePath(strings.TrimSuffix(path, "/"+priorityKey)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for path := range paths {
+		for i, c := range path {
+			if c == '/' && paths[path[:i]] {
+				return fmt.Errorf("invalid update: path %q is an ancestor of %q", path[:i], path)
+			}
+		}
+	}
+	return nil
+}
+
+// validateKey reports whether k can be used as a key in Firebase.
+//
+// Reference https://firebase.google.com/docs/database/usage/limits#data_tree
+func validateKey(k string) error {
+	switch {
+	case k == "":
+		return fmt.Errorf("keys can not be empty")
+	case len(k) > maxKeyLength:
+		return fmt.Errorf("keys can not be longer than %d bytes", maxKeyLength)
+	case strings.ContainsAny(k, ".$#[]"):
+		return fmt.Errorf("keys can not contain any of . $ # [ ]")
+	}
+	for _, r := range k {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("keys can not contain control characters")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestBulkImport(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/carol", "carol")
+
+	fb := New(server.URL, nil).Child("users")
+	err := fb.BulkImport(map[string]interface{}{
+		"alice":      "alice",
+		"bob/name":   "bob",
+		"dave/likes": map[string]interface{}{"go": true},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"alice": "alice",
+		"bob":   map[string]interface{}{"name": "bob"},
+		"carol": "carol",
+		"dave":  map[string]interface{}{"likes": map[string]interface{}{"go": true}},
+	}, server.Get("users"))
+}
+
+func TestBulkImportInvalidKeys(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	for _, key := range []string{"", "a//b", "a.b", "a$", "#", "a[0]", "tab\tkey", strings.Repeat("k", 769)} {
+		err := fb.BulkImport(map[string]interface{}{key: true, "valid": true})
+		assert.Error(t, err, "%q", key)
+	}
+	assert.Len(t, server.receivedReqs, 0)
+}
+
+func TestBulkImportStream(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	items := make(chan ImportItem)
+	go func() {
+		defer close(items)
+		for _, k := range []string{"a", "b", "c", "d", "e"} {
+			items <- ImportItem{Key: k, Value: k}
+		}
+	}()
+
+	var progress []int
+	fb := New(server.URL, nil).Child("items")
+	err := fb.BulkImportStream(context.Background(), items, 2, func(written int) {
+		progress = append(progress, written)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{2, 4, 5}, progress)
+	assert.Equal(t, map[string]interface{}{
+		"a": "a", "b": "b", "c": "c", "d": "d", "e": "e",
+	}, server.Get("items"))
+}
+
+func TestBulkImportStreamDuplicates(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	items := make(chan ImportItem)
+	go func() {
+		defer close(items)
+		for _, k := range []string{"a", "b", "/a", "c", "b"} {
+			items <- ImportItem{Key: k, Value: k}
+		}
+	}()
+
+	var progress []int
+	fb := New(server.URL, nil).Child("items")
+	err := fb.BulkImportStream(context.Background(), items, 2, func(written int) {
+		progress = append(progress, written)
+	})
+	require.NoError(t, err)
+
+	// the keys written again are not counted twice
+	assert.Equal(t, []int{2, 3, 3}, progress)
+	assert.Equal(t, map[string]interface{}{
+		"a": "/a", "b": "b", "c": "c",
+	}, server.Get("items"))
+}
+
+func TestBulkImportStreamCancel(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	items := make(chan ImportItem)
+	go func() {
+		items <- ImportItem{Key: "a", Value: "a"}
+	}()
+
+	// the import is cancelled once the first item is written,
+	// while it waits for the next one
+	fb := New(server.URL, nil).Child("items")
+	err := fb.BulkImportStream(ctx, items, 1, func(written int) {
+		assert.Equal(t, 1, written)
+		cancel()
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, map[string]interface{}{"a": "a"}, server.Get("items"))
+}
+
+// newSizeLimitServer returns a server rejecting the writes larger than
+// limit bytes the way Firebase does, and accepting the others, whose
+// keys are sent to written.
+func newSizeLimitServer(t *testing.T, limit int, status int, written func(keys []string)) *httptest.Server {
+	return newFaultServer(t, nil, func(w http.ResponseWriter, req *http.Request, _ http.Handler) {
+		body, err := ioutil.ReadAll(req.Body)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body) > limit {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error": "Data to write exceeds the maximum size that can be modified with a single request."}`))
+			return
+		}
+		var children map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(body, &children)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var keys []string
+		for key := range children {
+			keys = append(keys, key)
+		}
+		written(keys)
+		w.Write(body)
+	})
+}
+
+func TestPayloadTooLarge(t *testing.T) {
+	t.Parallel()
+	for _, status := range []int{http.StatusRequestEntityTooLarge, http.StatusBadRequest} {
+		server := newSizeLimitServer(t, 10, status, func([]string) {})
+		fb := New(server.URL, nil)
+
+		err := fb.Set(map[string]string{"key": "a value too large"})
+		require.IsType(t, ErrPayloadTooLarge{}, err, "%d", status)
+		e := err.(ErrPayloadTooLarge)
+		assert.EqualValues(t, len(`{"key":"a value too large"}`), e.Size)
+		assert.EqualValues(t, maxWriteSize, e.Limit)
+		require.IsType(t, ErrHTTP{}, e.Unwrap())
+		assert.Equal(t, status, e.Unwrap().(ErrHTTP).StatusCode)
+		server.Close()
+	}
+
+	// other errors are left untouched
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "Invalid data; couldn't parse JSON object."}`))
+	}))
+	defer server.Close()
+	err := New(server.URL, nil).Set(true)
+	assert.IsType(t, ErrHTTP{}, err)
+}
+
+func TestBulkImportStreamTooLarge(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var written []string
+	var writes int
+	// a single item fits in a write, any two do not
+	server := newSizeLimitServer(t, 15, http.StatusRequestEntityTooLarge, func(keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, keys...)
+		writes++
+	})
+	defer server.Close()
+
+	items := make(chan ImportItem)
+	go func() {
+		defer close(items)
+		for _, k := range []string{"a", "b", "c", "d", "e"} {
+			items <- ImportItem{Key: k, Value: "value"}
+		}
+	}()
+
+	var progress []int
+	fb := New(server.URL, nil)
+	err := fb.BulkImportStream(context.Background(), items, 4, func(n int) {
+		progress = append(progress, n)
+	})
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, written)
+	assert.Equal(t, 5, writes)
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, progress)
+
+	// an item too large on its own fails the import
+	items = make(chan ImportItem, 1)
+	items <- ImportItem{Key: "big", Value: "a value too large"}
+	close(items)
+	err = fb.BulkImportStream(context.Background(), items, 4, nil)
+	assert.IsType(t, ErrPayloadTooLarge{}, err)
+}
@@ -0,0 +1,215 @@
+package firego
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheResult tells whether a read was served by the read cache of a
+// reference created with WithReadCache.
+type CacheResult string
+
+const (
+	// CacheHit is logged for a read served from the cache, without a
+	// request being made.
+	CacheHit CacheResult = "hit"
+	// CacheMiss is logged for the request made by a read that could not
+	// be served from the cache.
+	CacheMiss CacheResult = "miss"
+)
+
+// CacheStats describes the effectiveness of the read cache of a reference
+// created with WithReadCache.
+type CacheStats struct {
+	// Hits is the number of reads served from the cache.
+	Hits int64
+	// Misses is the number of reads that had to be made to Firebase.
+	Misses int64
+	// Evictions is the number of values removed from the cache to make
+	// room for others, expired and invalidated values are not counted.
+	Evictions int64
+	// Size is the number of values currently cached.
+	Size int
+}
+
+// WithReadCache makes Value serve the reads of a value it read less than
+// ttl ago from memory instead of making a request. At most size values are
+// kept, the least recently read value being evicted to make room for a new
+// one, a size of 0 does not bound the cache. The cache is shared by the
+// reference and every reference derived from it, a value is cached for
+// the query parameters and credentials it was read with.
+//
+// A write made with a reference sharing the cache invalidates the values
+// cached for the location written, its ancestors and its descendants, but
+// writes made by other clients are only seen once the value expires, so
+// ttl is how stale a read can be. FreshValue and sessions never read from
+// the cache. CacheStats reports how effective the cache is, and the reads
+// served from it are logged at LogLevelDebug to the logger set with
+// WithLogger. A ttl of 0, the default, disables the cache.
+func WithReadCache(ttl time.Duration, size int) Option {
+	return func(fb *firebase) {
+		fb.readCache = nil
+		if ttl > 0 {
+			fb.readCache = &readCache{
+				ttl:     ttl,
+				size:    size,
+				entries: map[string]*list.Element{},
+				lru:     list.New(),
+			}
+		}
+	}
+}
+
+// CacheStats returns the statistics of the read cache of the reference,
+// the zero CacheStats if it was not created with WithReadCache.
+func (fb *firebase) CacheStats() CacheStats {
+	if fb.readCache == nil {
+		return CacheStats{}
+	}
+	return fb.readCache.stats()
+}
+
+// readCache holds the values read by Value, the most recently read first.
+type readCache struct {
+	ttl  time.Duration
+	size int
+
+	mtx     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// gen changes with every invalidation, a value read while it did
+	// may be stale and is not cached
+	gen    uint64
+	counts CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	path    string
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// cacheKey identifies the value read by req, which depends on its query
+// parameters, on the credentials and format it is read with and on whether
+// its ETag is asked for.
+func cacheKey(req *http.Request) string {
+	return strings.Join([]string{req.URL.String(), req.Header.Get("Authorization"), req.Header.Get("Accept"), req.Header.Get("X-Firebase-ETag")}, "\n")
+}
+
+// get returns a copy of the value cached for key and its ETag along with
+// the generation of the cache, counting a hit or a miss.
+func (c *readCache) get(key string) ([]byte, string, uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			c.counts.Hits++
+			return append([]byte(nil), entry.body...), entry.etag, c.gen, true
+		}
+		c.remove(e)
+	}
+	c.counts.Misses++
+	return nil, "", c.gen, false
+}
+
+// put caches a copy of the value read for key at path, with its ETag, if
+// the cache was not invalidated since generation gen.
+func (c *readCache) put(key, path string, body []byte, etag string, gen uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, path: path, body: append([]byte(nil), body...), etag: etag, expires: time.Now().Add(c.ttl)})
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.counts.Evictions++
+	}
+}
+
+// invalidate removes the values cached for path, its ancestors and its
+// descendants.
+func (c *readCache) invalidate(path string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.gen++
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		entry := e.Value.(*cacheEntry)
+		if isWithin(entry.path, path) || isWithin(path, entry.path) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *readCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry).key)
+}
+
+func (c *readCache) stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.counts
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// cachedValue reads the value of the reference through its read cache.
+func (fb *firebase) cachedValue(ctx context.Context) ([]byte, error) {
+	if fb.readCache == nil || fb.noCache {
+		return fb.doRequest(ctx, "GET", nil)
+	}
+
+	req, err := fb.newRequest(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(req)
+	body, etag, gen, ok := fb.readCache.get(key)
+	if ok {
+		fb.lastBody.set(body)
+		fb.lastETag.set(etag)
+		if fb.logger != nil {
+			fb.logger.LogRequest(LogLevelDebug, RequestInfo{
+				Method:     req.Method,
+				URL:        req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+				StatusCode: http.StatusOK,
+				BytesIn:    int64(len(body)),
+				Cache:      CacheHit,
+				Operation:  fb.operationName(req.Context()),
+			})
+		}
+		return body, nil
+	}
+
+	c := fb.copy()
+	c.cacheMiss = true
+	c.lastBody = fb.lastBody
+	if fb.lastETag != nil {
+		// the ETag of the response is cached along with its body
+		c.lastETag = &lastETag{}
+	}
+	if body, err = c.doRequest(ctx, "GET", nil); err != nil {
+		return nil, err
+	}
+	etag = c.lastETag.get()
+	fb.lastETag.set(etag)
+	fb.readCache.put(key, fb.path(), body, etag, gen)
+	return body, nil
+}
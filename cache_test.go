@@ -0,0 +1,165 @@
+package firego
+
+import (
+	"container/list"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestReadCache(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users/alice", "first")
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithReadCache(time.Minute, 0), WithLogger(l))
+	alice := fb.Child("users/alice")
+
+	var v interface{}
+	require.NoError(t, alice.Value(&v))
+	server.Set("users/alice", "changed elsewhere")
+	require.NoError(t, alice.Value(&v))
+	assert.Equal(t, "first", v)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Size: 1}, fb.CacheStats())
+
+	require.Len(t, l.requests, 2)
+	assert.Equal(t, CacheMiss, l.requests[0].Cache)
+	assert.Equal(t, LogLevelInfo, l.levels[0])
+	assert.Equal(t, CacheHit, l.requests[1].Cache)
+	assert.Equal(t, LogLevelDebug, l.levels[1])
+
+	// a write to an ancestor invalidates the value
+	require.NoError(t, fb.Child("users").Update(map[string]interface{}{"bob": "second"}))
+	require.NoError(t, alice.Value(&v))
+	assert.Equal(t, "changed elsewhere", v)
+	assert.Empty(t, l.requests[2].Cache)
+	assert.Equal(t, CacheMiss, l.requests[3].Cache)
+
+	// fresh reads bypass the cache
+	server.Set("users/alice", "fresh")
+	require.NoError(t, alice.FreshValue(&v))
+	assert.Equal(t, "fresh", v)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Size: 1}, fb.CacheStats())
+
+	// references created without a cache do not report one
+	assert.Equal(t, CacheStats{}, New(server.URL, nil).CacheStats())
+}
+
+func TestReadCacheEviction(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", 1)
+	server.Set("b", 2)
+	fb := New(server.URL, nil, WithReadCache(time.Minute, 1))
+
+	var v interface{}
+	require.NoError(t, fb.Child("a").Value(&v))
+	require.NoError(t, fb.Child("b").Value(&v))
+	require.NoError(t, fb.Child("b").Value(&v))
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3, Evictions: 2, Size: 1}, fb.CacheStats())
+
+	// queries are cached apart from the value
+	require.NoError(t, fb.Child("a").OrderBy("$key").Value(&v))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 4, Evictions: 3, Size: 1}, fb.CacheStats())
+}
+
+func TestReadCacheExpiry(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", 1)
+	fb := New(server.URL, nil, WithReadCache(10*time.Millisecond, 0))
+
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	time.Sleep(20 * time.Millisecond)
+	server.Set("a", 2)
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, map[string]interface{}{"a": 2.0}, v)
+	assert.Equal(t, CacheStats{Misses: 2, Size: 1}, fb.CacheStats())
+}
+
+func TestReadCacheConcurrent(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", 1)
+	fb := New(server.URL, nil, WithReadCache(time.Minute, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var v interface{}
+			assert.NoError(t, fb.Child("a").Value(&v))
+			if i%3 == 0 {
+				assert.NoError(t, fb.Child("a").Set(i))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := fb.CacheStats()
+	assert.EqualValues(t, 10, stats.Hits+stats.Misses)
+	assert.True(t, stats.Size <= 2)
+}
+
+func TestReadCacheETag(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("counter", 1)
+	fb := New(server.URL, nil, WithReadCache(time.Minute, 0), WithAlwaysETag(true))
+	first, second := fb.Child("counter"), fb.Child("counter")
+
+	var v interface{}
+	require.NoError(t, first.Value(&v))
+	etag := first.LastETag()
+	assert.NotEmpty(t, etag)
+
+	// the hit returns the ETag the value was read with
+	require.NoError(t, second.Value(&v))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Size: 1}, fb.CacheStats())
+	assert.Equal(t, etag, second.LastETag())
+
+	// reads that do not ask for the ETag are cached apart
+	plain := New(server.URL, nil, WithReadCache(time.Minute, 0))
+	require.NoError(t, plain.Value(&v))
+	assert.Empty(t, plain.LastETag())
+}
+
+func TestReadCacheCopies(t *testing.T) {
+	t.Parallel()
+	c := &readCache{ttl: time.Minute, entries: map[string]*list.Element{}, lru: list.New()}
+
+	body := []byte(`"first"`)
+	c.put("key", "/", body, "etag", 0)
+	body[1] = 'x'
+	got, etag, _, ok := c.get("key")
+	require.True(t, ok)
+	assert.Equal(t, `"first"`, string(got))
+	assert.Equal(t, "etag", etag)
+
+	got[1] = 'x'
+	got, _, _, ok = c.get("key")
+	require.True(t, ok)
+	assert.Equal(t, `"first"`, string(got))
+}
@@ -0,0 +1,89 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// writeChange holds whether the last write made by a reference created
+// with WithDetectChange changed the stored value.
+type writeChange struct {
+	mtx     sync.Mutex
+	changed bool
+}
+
+func (c *writeChange) set(changed bool) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	c.changed = changed
+	c.mtx.Unlock()
+}
+
+// WithDetectChange determines whether or not Set and Update find out if
+// they change the stored value, which LastWriteChanged then reports, for
+// example to only log or notify on real changes. The references derived
+// from it keep track of their own writes.
+//
+// Firebase does not report whether a write changed anything, so the value
+// is read before every write and compared to the one written. This costs
+// a read per write, and the comparison is not atomic with the write: a
+// concurrent write made between the two is not accounted for. A write is
+// not made if the read fails. Values holding a ServerValue placeholder or
+// a priority always count as a change.
+func WithDetectChange(v bool) Option {
+	return func(fb *firebase) {
+		fb.lastChange = nil
+		if v {
+			fb.lastChange = &writeChange{}
+		}
+	}
+}
+
+// LastWriteChanged reports whether the last Set or Update made with the
+// reference changed the stored value. It is always false if the write
+// failed or was queued, or if the reference was not created with
+// WithDetectChange.
+func (fb *firebase) LastWriteChanged() bool {
+	if fb.lastChange == nil {
+		return false
+	}
+	fb.lastChange.mtx.Lock()
+	defer fb.lastChange.mtx.Unlock()
+	return fb.lastChange.changed
+}
+
+// detectChange reports whether writing payload with the given method,
+// a PUT or a PATCH, changes the value of the reference.
+func (fb *firebase) detectChange(method string, payload []byte) (bool, error) {
+	if fb.lastChange == nil {
+		return false, nil
+	}
+
+	body, err := fb.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return false, err
+	}
+	var current, next interface{}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(payload, &next); err != nil {
+		return false, err
+	}
+	current = normalize(current)
+
+	if method == "PUT" {
+		return !reflect.DeepEqual(current, normalize(next)), nil
+	}
+	children, _ := next.(map[string]interface{})
+	for path, child := range children {
+		if !reflect.DeepEqual(lookup(current, splitPath(path)), normalize(child)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,48 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestDetectChange(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("user", map[string]interface{}{"name": "alice", "tags": []interface{}{"a", "b"}})
+	fb := New(server.URL+"/user", nil, WithDetectChange(true))
+	assert.False(t, fb.LastWriteChanged())
+
+	require.NoError(t, fb.Set(map[string]interface{}{"name": "alice", "tags": []string{"a", "b"}}))
+	assert.False(t, fb.LastWriteChanged())
+
+	require.NoError(t, fb.Update(map[string]interface{}{"name": "alice", "tags/1": "b"}))
+	assert.False(t, fb.LastWriteChanged())
+
+	require.NoError(t, fb.Update(map[string]interface{}{"name": "bob"}))
+	assert.True(t, fb.LastWriteChanged())
+	assert.Equal(t, "bob", server.Get("user/name"))
+
+	name := fb.Child("name")
+	require.NoError(t, name.Set("bob"))
+	assert.False(t, name.LastWriteChanged())
+	assert.True(t, fb.LastWriteChanged(), "children keep track of their own writes")
+
+	// an empty object is not stored, like a missing value
+	missing := fb.Child("missing")
+	require.NoError(t, missing.Set(map[string]interface{}{}))
+	assert.False(t, missing.LastWriteChanged())
+
+	require.NoError(t, fb.Set(nil))
+	assert.True(t, fb.LastWriteChanged())
+	assert.Nil(t, server.Get("user"))
+
+	plain := New(server.URL+"/user", nil)
+	require.NoError(t, plain.Set("value"))
+	assert.False(t, plain.LastWriteChanged())
+}
@@ -0,0 +1,369 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChildEventType identifies the change made to a child of a watched
+// reference.
+type ChildEventType string
+
+const (
+	// ChildEventAdded is sent when a child is added.
+	ChildEventAdded ChildEventType = "child_added"
+	// ChildEventChanged is sent when the value of a child changes,
+	// including changes made anywhere below it.
+	ChildEventChanged ChildEventType = "child_changed"
+	// ChildEventRemoved is sent when a child is removed.
+	ChildEventRemoved ChildEventType = "child_removed"
+	// ChildEventMoved is sent, after ChildEventChanged, when a child
+	// changes its position in the order of the children.
+	ChildEventMoved ChildEventType = "child_moved"
+)
+
+// ChildEvent represents a change made to a child of a watched reference.
+type ChildEvent struct {
+	// Type of change.
+	Type ChildEventType
+	// Key of the child.
+	Key string
+	// Value of the child after the change, or before it for removed
+	// children, decoded the same way as Event.Data.
+	Value interface{}
+	// PrevKey is the key of the child ordered before this one, or empty
+	// if it is the first child. It is not set for removed children.
+	PrevKey string
+}
+
+// WithIncrementalSnapshot determines whether or not ChildEvents decodes the
+// initial value of the reference one child at a time, sending the
+// ChildEventAdded of each child as soon as it has been decoded, instead of
+// decoding the whole value before sending the first of them. This spreads
+// the cost of decoding a large collection when the stream opens.
+//
+// Watch and the other ways of watching a reference are not affected, they
+// always receive the initial value as a single put event.
+func WithIncrementalSnapshot(v bool) Option {
+	return func(fb *firebase) {
+		fb.lazySnapshot = v
+	}
+}
+
+// ChildEvents watches the children of the reference and passes the
+// changes made to them over to the given chan as ChildEvents, starting
+// with a ChildEventAdded for every child of the current value.
+//
+// Events are sent in the order in which the database sent the changes.
+// The events synthesized from a single put or patch are sent with the
+// removed children first, then the added, changed and moved children in
+// their new order. Children are ordered the same way the database orders
+// query results: by the child or value set with OrderBy and then by key,
+// or by key only when OrderBy is not set or is "$key". Ordering by
+// priority is not supported and falls back to ordering by key.
+//
+// With WithIncrementalSnapshot, the children of the initial value are sent
+// in the order in which the database sent them, which is not necessarily
+// the order set with OrderBy, and their PrevKey is the key of the child
+// sent before them. Later events are ordered as described above.
+//
+// The chan is closed when the watch ends, which is done with
+// StopWatching the same way it is for Watch.
+func (fb *firebase) ChildEvents(ch chan ChildEvent) error {
+	events := make(chan Event)
+	if err := fb.startWatch(events, fb.lazySnapshot); err != nil {
+		return err
+	}
+
+	orderBy := strings.Trim(fb.params.Get(orderByParam), `"`)
+	stop := fb.watchStopped()
+	go func() {
+		defer close(ch)
+
+		m := &Mirror{}
+		var order []string
+		for event := range events {
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				continue
+			}
+			if event.snapshot != nil {
+				var ok bool
+				if event, ok = fb.sendSnapshot(m, event, ch, stop); !ok {
+					return
+				}
+				if event.snapshot == nil {
+					children, _ := m.value.(map[string]interface{})
+					order = orderChildren(children, orderBy)
+					continue
+				}
+			}
+
+			keys := changedKeys(event, m.value)
+			before := make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				// the mirror updates its value in place
+				before[key] = normalize(lookup(m.value, []string{key}))
+			}
+			if !m.Apply(event) {
+				continue
+			}
+
+			children, _ := m.value.(map[string]interface{})
+			newOrder := orderChildren(children, orderBy)
+			for _, e := range diffChildren(keys, before, children, order, newOrder) {
+				if !sendOrStop(ch, e, stop) {
+					return
+				}
+			}
+			order = newOrder
+		}
+	}()
+	return nil
+}
+
+// WatchChildren watches the children of the reference and runs a handler
+// for each of them. onChild is called in its own goroutine for every child
+// added, starting with the children of the current value, with a reference
+// to the child and the value it was added with. The context given to
+// onChild is canceled when the child is removed or when the watch ends,
+// which is the signal for its handler to stop; a child that is added again
+// after being removed gets a new handler.
+//
+// This turns a collection into a dynamic set of per-item subscriptions.
+// Later changes made to a child are not passed to its handler, which can
+// watch the child reference if it needs them. The child references do not
+// carry the query parameters of the reference, a query only selects which
+// children get a handler. The watch is stopped with StopWatching, the same
+// way it is for ChildEvents.
+func (fb *firebase) WatchChildren(onChild func(ctx context.Context, child Firebase, initial interface{})) error {
+	events := make(chan ChildEvent)
+	if err := fb.ChildEvents(events); err != nil {
+		return err
+	}
+
+	parent := fb.copy()
+	parent.clearQuery()
+	go func() {
+		handlers := map[string]context.CancelFunc{}
+		defer func() {
+			for _, stop := range handlers {
+				stop()
+			}
+		}()
+
+		for event := range events {
+			switch event.Type {
+			case ChildEventAdded:
+				if stop, ok := handlers[event.Key]; ok {
+					stop()
+				}
+				ctx, stop := context.WithCancel(fb.baseContext())
+				handlers[event.Key] = stop
+				go onChild(ctx, parent.Child(event.Key), event.Value)
+			case ChildEventRemoved:
+				if stop, ok := handlers[event.Key]; ok {
+					stop()
+					delete(handlers, event.Key)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// errWatchStopped ends the sending of a snapshot once the watch is
+// stopped.
+var errWatchStopped = errors.New("watch stopped")
+
+// sendSnapshot applies the children of the undecoded initial snapshot of
+// event to m one at a time, sending a ChildEventAdded for each of them. If
+// the snapshot has no children to send, it is decoded as a whole and
+// returned as a regular put event to be handled as such. It returns false
+// if stop was closed before every child could be sent.
+func (fb *firebase) sendSnapshot(m *Mirror, event Event, ch chan ChildEvent, stop <-chan struct{}) (Event, bool) {
+	var prevKey string
+	err := streamChildren(json.NewDecoder(bytes.NewReader(event.snapshot)), func(entry OrderedEntry) error {
+		var v interface{}
+		if err := json.Unmarshal(entry.Value, &v); err != nil {
+			return err
+		}
+		if !m.Apply(Event{Type: EventTypePut, Path: joinPath(event.Path, entry.Key), Data: v}) {
+			// an empty child
+			return nil
+		}
+
+		if !sendOrStop(ch, ChildEvent{Type: ChildEventAdded, Key: entry.Key, Value: normalize(v), PrevKey: prevKey}, stop) {
+			return errWatchStopped
+		}
+		prevKey = entry.Key
+		return nil
+	})
+	switch {
+	case err == nil:
+		return Event{Type: event.Type, Path: event.Path}, true
+	case err == errWatchStopped:
+		return Event{}, false
+	}
+
+	if m.value != nil {
+		// the children sent so far can not be taken back
+		fb.logStream(LogLevelError, StreamEvent{Type: StreamEventReceived, EventType: event.Type, Err: err})
+		return Event{Type: event.Type, Path: event.Path}, true
+	}
+	json.Unmarshal(event.snapshot, &event.Data)
+	event.snapshot = nil
+	return event, true
+}
+
+// diffChildren returns the events for the keys that may have changed,
+// given their values before the change and the children and their order
+// before and after it.
+func diffChildren(keys []string, before, children map[string]interface{}, oldOrder, newOrder []string) []ChildEvent {
+	changed := make(map[string]bool, len(keys))
+	candidates := make(map[string]bool, len(keys))
+	var events []ChildEvent
+	for _, key := range keys {
+		candidates[key] = true
+		old, current := before[key], children[key]
+		switch {
+		case old == nil && current == nil:
+		case current == nil:
+			events = append(events, ChildEvent{Type: ChildEventRemoved, Key: key, Value: old})
+		case old == nil || !reflect.DeepEqual(old, current):
+			changed[key] = true
+		}
+	}
+	if len(changed) == 0 {
+		return events
+	}
+
+	// a child moved if its rank changed among the children that
+	// existed both before and after the change
+	stable := func(order []string) map[string]int {
+		ranks := make(map[string]int, len(order))
+		for _, key := range order {
+			existed := !candidates[key] || before[key] != nil
+			if existed && children[key] != nil {
+				ranks[key] = len(ranks)
+			}
+		}
+		return ranks
+	}
+	oldRanks, newRanks := stable(oldOrder), stable(newOrder)
+
+	for i, key := range newOrder {
+		if !changed[key] {
+			continue
+		}
+		var prevKey string
+		if i > 0 {
+			prevKey = newOrder[i-1]
+		}
+		value := normalize(children[key])
+
+		if before[key] == nil {
+			events = append(events, ChildEvent{Type: ChildEventAdded, Key: key, Value: value, PrevKey: prevKey})
+			continue
+		}
+		events = append(events, ChildEvent{Type: ChildEventChanged, Key: key, Value: value, PrevKey: prevKey})
+		if oldRanks[key] != newRanks[key] {
+			events = append(events, ChildEvent{Type: ChildEventMoved, Key: key, Value: value, PrevKey: prevKey})
+		}
+	}
+	return events
+}
+
+// orderChildren returns the keys of children sorted the way the database
+// sorts query results ordered by orderBy.
+func orderChildren(children map[string]interface{}, orderBy string) []string {
+	keys := make([]string, 0, len(children))
+	for k := range children {
+		keys = append(keys, k)
+	}
+
+	var sortValue func(key string) interface{}
+	switch orderBy {
+	case "", "$key", "$priority":
+	case "$value":
+		sortValue = func(key string) interface{} { return children[key] }
+	default:
+		path := splitPath(orderBy)
+		sortValue = func(key string) interface{} { return lookup(children[key], path) }
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if sortValue != nil {
+			if c := compareValues(sortValue(keys[i]), sortValue(keys[j])); c != 0 {
+				return c < 0
+			}
+		}
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
+// compareKeys orders keys that are 32-bit integers numerically before
+// all other keys, which are ordered lexicographically.
+func compareKeys(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 32)
+	bi, bErr := strconv.ParseInt(b, 10, 32)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareFloats(float64(ai), float64(bi))
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareValues orders values the way the database does: null, false,
+// true, numbers, strings and then objects, which are ordered by key.
+func compareValues(a, b interface{}) int {
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case float64:
+		return compareFloats(av, b.(float64))
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+func valueRank(v interface{}) int {
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if val {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	}
+	return 5
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+package firego
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestOrderChildren(t *testing.T) {
+	t.Parallel()
+	children := map[string]interface{}{
+		"b":  map[string]interface{}{"score": 1.0},
+		"a":  map[string]interface{}{"score": "high"},
+		"10": map[string]interface{}{"score": 1.0},
+		"9":  map[string]interface{}{"score": true},
+		"c":  map[string]interface{}{},
+	}
+
+	assert.Equal(t, []string{"9", "10", "a", "b", "c"}, orderChildren(children, ""))
+	assert.Equal(t, []string{"9", "10", "a", "b", "c"}, orderChildren(children, "$key"))
+	assert.Equal(t, []string{"c", "9", "10", "b", "a"}, orderChildren(children, "score"))
+
+	values := map[string]interface{}{"a": "x", "b": 2.0, "c": false, "d": 1.0, "e": true}
+	assert.Equal(t, []string{"c", "e", "d", "b", "a"}, orderChildren(values, "$value"))
+}
+
+func TestDiffChildren(t *testing.T) {
+	t.Parallel()
+	before := map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0}
+	oldOrder := orderChildren(before, "$value")
+
+	// c drops below a, b is removed and d is added
+	children := map[string]interface{}{"a": 1.0, "c": 0.5, "d": 4.0}
+	events := diffChildren([]string{"b", "c", "d"}, before, children, oldOrder, orderChildren(children, "$value"))
+	assert.Equal(t, []ChildEvent{
+		{Type: ChildEventRemoved, Key: "b", Value: 2.0},
+		{Type: ChildEventChanged, Key: "c", Value: 0.5},
+		{Type: ChildEventMoved, Key: "c", Value: 0.5},
+		{Type: ChildEventAdded, Key: "d", Value: 4.0, PrevKey: "a"},
+	}, events)
+
+	// a change that keeps the order is not a move
+	events = diffChildren([]string{"a"}, map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 0.7, "c": 0.5, "d": 4.0}, []string{"c", "a", "d"}, []string{"c", "a", "d"})
+	assert.Equal(t, []ChildEvent{
+		{Type: ChildEventChanged, Key: "a", Value: 0.7, PrevKey: "c"},
+	}, events)
+}
+
+func TestChildEvents(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("items", map[string]interface{}{"b": "second", "a": "first"})
+
+	fb := New(server.URL+"/items", nil)
+	events := make(chan ChildEvent, 10)
+	require.NoError(t, fb.ChildEvents(events))
+
+	next := func() ChildEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(250 * time.Millisecond):
+			require.FailNow(t, "did not receive a child event")
+		}
+		return ChildEvent{}
+	}
+
+	assert.Equal(t, ChildEvent{Type: ChildEventAdded, Key: "a", Value: "first"}, next())
+	assert.Equal(t, ChildEvent{Type: ChildEventAdded, Key: "b", Value: "second", PrevKey: "a"}, next())
+
+	server.Set("items/c", map[string]interface{}{"name": "third"})
+	assert.Equal(t, ChildEvent{Type: ChildEventAdded, Key: "c", Value: map[string]interface{}{"name": "third"}, PrevKey: "b"}, next())
+
+	server.Set("items/c/name", "renamed")
+	assert.Equal(t, ChildEvent{Type: ChildEventChanged, Key: "c", Value: map[string]interface{}{"name": "renamed"}, PrevKey: "b"}, next())
+
+	server.Delete("items/a")
+	assert.Equal(t, ChildEvent{Type: ChildEventRemoved, Key: "a", Value: "first"}, next())
+
+	fb.StopWatching()
+	for range events {
+		// drain until the chan is closed
+	}
+}
+
+func TestChildEventsStopWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a", 1)
+	server.Set("b", 2)
+	fns := []string{"firego.(*firebase).ChildEvents.func", "firego.(*firebase).watch.func"}
+	assertStopWithoutReceiving(t, fns, func() (Firebase, interface{}) {
+		fb := New(server.URL, nil)
+		ch := make(chan ChildEvent)
+		require.NoError(t, fb.ChildEvents(ch))
+		return fb, ch
+	})
+}
+
+func TestChildEventsIncrementalSnapshot(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("items", map[string]interface{}{"b": "second", "a": map[string]interface{}{"name": "first"}})
+
+	fb := New(server.URL+"/items", nil, WithIncrementalSnapshot(true))
+	events := make(chan ChildEvent, 10)
+	require.NoError(t, fb.ChildEvents(events))
+	defer fb.StopWatching()
+
+	next := func() ChildEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(250 * time.Millisecond):
+			require.FailNow(t, "did not receive a child event")
+		}
+		return ChildEvent{}
+	}
+
+	assert.Equal(t, ChildEvent{Type: ChildEventAdded, Key: "a", Value: map[string]interface{}{"name": "first"}}, next())
+	assert.Equal(t, ChildEvent{Type: ChildEventAdded, Key: "b", Value: "second", PrevKey: "a"}, next())
+
+	server.Set("items/a/name", "renamed")
+	assert.Equal(t, ChildEvent{Type: ChildEventChanged, Key: "a", Value: map[string]interface{}{"name": "renamed"}}, next())
+}
+
+func TestSendSnapshot(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil).(*firebase)
+	ch := make(chan ChildEvent, 10)
+
+	m := &Mirror{}
+	event, ok := fb.sendSnapshot(m, Event{Type: EventTypePut, Path: "/", snapshot: []byte(`["x",null,{"y":{}},"z"]`)}, ch, nil)
+	assert.True(t, ok)
+	assert.Nil(t, event.snapshot)
+	assert.Nil(t, event.Data)
+	close(ch)
+	var sent []ChildEvent
+	for e := range ch {
+		sent = append(sent, e)
+	}
+	assert.Equal(t, []ChildEvent{
+		{Type: ChildEventAdded, Key: "0", Value: "x"},
+		{Type: ChildEventAdded, Key: "3", Value: "z", PrevKey: "0"},
+	}, sent)
+	assert.Equal(t, map[string]interface{}{"0": "x", "3": "z"}, m.value)
+
+	// values without children are handed back decoded
+	event, ok = fb.sendSnapshot(&Mirror{}, Event{Type: EventTypePut, Path: "/", snapshot: []byte(`42`)}, nil, nil)
+	assert.True(t, ok)
+	assert.Nil(t, event.snapshot)
+	assert.Equal(t, 42.0, event.Data)
+
+	// nobody receives the children of a stopped watch
+	stop := make(chan struct{})
+	close(stop)
+	_, ok = fb.sendSnapshot(&Mirror{}, Event{Type: EventTypePut, Path: "/", snapshot: []byte(`{"a":1}`)}, make(chan ChildEvent), stop)
+	assert.False(t, ok)
+}
+
+func TestWatchChildren(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("items", map[string]interface{}{"a": "first"})
+
+	type handler struct {
+		path    string
+		initial interface{}
+		ctx     context.Context
+	}
+	started := make(chan handler, 10)
+	fb := New(server.URL+"/items", nil).OrderBy("$key")
+	require.NoError(t, fb.WatchChildren(func(ctx context.Context, child Firebase, initial interface{}) {
+		started <- handler{child.String(), initial, ctx}
+	}))
+
+	next := func() handler {
+		select {
+		case h := <-started:
+			return h
+		case <-time.After(250 * time.Millisecond):
+			require.FailNow(t, "no handler was started")
+		}
+		return handler{}
+	}
+	isDone := func(ctx context.Context) bool {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-time.After(250 * time.Millisecond):
+			return false
+		}
+	}
+
+	a := next()
+	assert.Equal(t, server.URL+"/items/a/.json", a.path)
+	assert.Equal(t, "first", a.initial)
+
+	server.Set("items/b", map[string]interface{}{"name": "second"})
+	b := next()
+	assert.Equal(t, server.URL+"/items/b/.json", b.path)
+	assert.Equal(t, map[string]interface{}{"name": "second"}, b.initial)
+
+	server.Delete("items/a")
+	assert.True(t, isDone(a.ctx))
+	assert.NoError(t, b.ctx.Err())
+
+	fb.StopWatching()
+	assert.True(t, isDone(b.ctx))
+}
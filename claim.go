@@ -0,0 +1,114 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrNothingToClaim is returned by Claim when the queue holds no item
+// that is not claimed yet.
+var ErrNothingToClaim = errors.New("no unclaimed item to claim")
+
+const (
+	// claimedByField is the child Claim sets on the items it claims
+	// to the token of the claim.
+	claimedByField = "claimedBy"
+	// claimedAtField is the child Claim sets on the items it claims
+	// to the server time of the claim.
+	claimedAtField = "claimedAt"
+)
+
+// Claim claims the first item of the queue held by the reference that is
+// not claimed yet, and returns its key and its value as it was before
+// being claimed, decoded into an interface{}. Items are considered in the
+// order of the query of the reference, by key by default, which makes
+// push IDs a fit for their keys, or for example by a priority child with
+// OrderBy("priority").LimitToFirst(10). Items are objects, and an item is
+// claimed by setting its "claimedBy" child to a token unique to the claim
+// and its "claimedAt" child to the server time, with ServerTimestamp. Items
+// that have a "claimedBy" child are skipped. ErrNothingToClaim is returned
+// when no item is left to claim.
+//
+// The claim is atomic: it is written the way ReplaceIf writes, on the
+// condition that the item did not change since it was read, so that two
+// workers never claim the same item. A worker that loses the race for an
+// item moves on to the next one, which makes the order best-effort FIFO:
+// under contention, workers claim the first items in whatever order their
+// writes reach the database, and every claim costs a read of the query
+// and a conditional read and write of the item per attempt. Workers remove
+// the items they are done with; the items of workers that fail stay
+// claimed and are recovered by querying on "claimedAt".
+func (fb *firebase) Claim(ctx context.Context) (string, interface{}, error) {
+	queue := fb.WithContext(ctx).(*firebase)
+	body, err := queue.doRequest(ctx, "GET", nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	children := map[string]interface{}{}
+	err = streamChildren(json.NewDecoder(bytes.NewReader(body)), func(entry OrderedEntry) error {
+		var item interface{}
+		if err := json.Unmarshal(entry.Value, &item); err != nil {
+			return err
+		}
+		children[entry.Key] = item
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	items := queue.copy()
+	for _, param := range []string{orderByParam, limitToFirstParam, limitToLastParam, startAtParam, endAtParam, equalToParam} {
+		items.params.Del(param)
+	}
+	token := newPushID()
+	for _, key := range orderChildren(children, strings.Trim(fb.params.Get(orderByParam), `"`)) {
+		if err := ctx.Err(); err != nil {
+			return "", nil, err
+		}
+		if !claimable(children[key]) {
+			continue
+		}
+
+		var claimed interface{}
+		ok, err := items.Child(key).(*firebase).replaceIf(func(body []byte) ([]byte, error) {
+			if err := json.Unmarshal(body, &claimed); err != nil {
+				return nil, err
+			}
+			if !claimable(claimed) {
+				// claimed by another worker, or removed
+				return nil, nil
+			}
+			// numbers are kept as they were sent by the database
+			tree, err := decodeTree(body)
+			if err != nil {
+				return nil, err
+			}
+			item := tree.(map[string]interface{})
+			item[claimedByField] = token
+			item[claimedAtField] = ServerTimestamp
+			return json.Marshal(item)
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if ok {
+			return key, claimed, nil
+		}
+	}
+	return "", nil, ErrNothingToClaim
+}
+
+// claimable reports whether item is an object that is not claimed.
+func claimable(item interface{}) bool {
+	children, ok := item.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, claimed := children[claimedByField]
+	return !claimed
+}
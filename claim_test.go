@@ -0,0 +1,101 @@
+package firego
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestClaim(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("queue", map[string]interface{}{
+		"a": map[string]interface{}{"task": "first", "priority": 3},
+		"b": map[string]interface{}{"task": "second", "priority": 1, "claimedBy": "other"},
+		"c": map[string]interface{}{"task": "third", "priority": 2},
+	})
+	queue := New(server.URL, nil).Child("queue")
+
+	// in key order, skipping claimed items
+	key, value, err := queue.Claim(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "a", key)
+	assert.Equal(t, map[string]interface{}{"task": "first", "priority": 3.0}, value)
+
+	claimed := server.Get("queue/a").(map[string]interface{})
+	assert.NotEmpty(t, claimed[claimedByField])
+	assert.IsType(t, int64(0), claimed[claimedAtField], "the server time")
+	assert.Equal(t, "first", claimed["task"])
+
+	key, _, err = queue.Claim(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "c", key)
+	_, _, err = queue.Claim(context.Background())
+	assert.Equal(t, ErrNothingToClaim, err)
+
+	// in the order of the query
+	server.Set("ordered", map[string]interface{}{
+		"a": map[string]interface{}{"priority": 3},
+		"b": map[string]interface{}{"priority": 1},
+	})
+	key, _, err = New(server.URL, nil).Child("ordered").OrderBy("priority").Claim(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "b", key)
+	assert.NotContains(t, server.Get("ordered/a"), claimedByField)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = New(server.URL, nil).Child("ordered").Claim(ctx)
+	assert.Error(t, err)
+}
+
+func TestClaimContention(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	const items = 20
+	for i := 0; i < items; i++ {
+		server.Set("queue/"+newPushID(), map[string]interface{}{"n": i})
+	}
+
+	queue := New(server.URL, nil).Child("queue")
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		keys = map[string]int{}
+	)
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, _, err := queue.Claim(context.Background())
+				if err == ErrNothingToClaim {
+					return
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				mtx.Lock()
+				keys[key]++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every item was claimed exactly once
+	assert.Len(t, keys, items)
+	for key, n := range keys {
+		assert.Equal(t, 1, n, key)
+	}
+}
@@ -0,0 +1,103 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Codec encodes the bodies of the requests made, and decodes those of the
+// responses, in a format other than JSON, for gateways that speak the data
+// model of Firebase in a binary format such as MessagePack or CBOR to
+// reduce the size of the payloads. The codecs live apart from firego,
+// the firemsgpack package implements one for MessagePack.
+//
+// Codecs only deal with the values of the JSON data model: Encode is given
+// nil, bool, json.Number, string, []interface{} and
+// map[string]interface{} values, and Decode must return values that
+// encoding/json can encode the same way, such as int64 or float64 numbers.
+type Codec interface {
+	// ContentType returns the media type of the bodies Encode returns,
+	// sent as the Content-Type of writes.
+	ContentType() string
+	// Accept returns the Accept header of the requests made.
+	Accept() string
+	// Encode encodes a value of the JSON data model.
+	Encode(v interface{}) ([]byte, error)
+	// Decode decodes data into a value of the JSON data model.
+	Decode(data []byte) (interface{}, error)
+}
+
+// WithCodec makes the reference send the bodies of its writes encoded with
+// codec and decode the responses it receives with codec, unless the
+// response is a JSON document, as errors often are. It replaces the Accept
+// header set with WithAccept. By default bodies are JSON.
+//
+// Everything else works the same way it does with JSON: the bodies are
+// translated from and to JSON at the edge of the connection, so that the
+// values are encoded, decoded and compared the way they are for JSON, and
+// a codec that can not represent a value exactly, such as a float too
+// precise for its format, changes it the same way for every feature.
+// Streams are never encoded with codec: watches accept text/event-stream
+// and the data of their events is always read as JSON.
+func WithCodec(codec Codec) Option {
+	return func(fb *firebase) {
+		fb.codec = codec
+	}
+}
+
+// encodeBody encodes the JSON body of a write made with method with the
+// codec of the reference, if any.
+func (fb *firebase) encodeBody(method string, body io.Reader) (io.Reader, error) {
+	if fb.codec == nil || body == nil || !hasBody(method) {
+		return body, nil
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return bytes.NewReader(b), nil
+	}
+	tree, err := decodeTree(b)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	if b, err = fb.codec.Encode(tree); err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	return bytes.NewReader(b), nil
+}
+
+// decodeBody returns the JSON of body, the body of resp, decoding it with
+// the codec of the reference, if any, when it is not JSON already. The body
+// of an error response that can not be decoded, such as the HTML page of a
+// proxy, is returned as is.
+func (fb *firebase) decodeBody(resp *http.Response, body []byte) ([]byte, error) {
+	if fb.codec == nil || len(body) == 0 || isJSON(resp.Header.Get("Content-Type")) {
+		return body, nil
+	}
+	v, err := fb.codec.Decode(body)
+	if err == nil {
+		return json.Marshal(v)
+	}
+	if resp.StatusCode/200 != 1 {
+		return body, nil
+	}
+	return nil, err
+}
+
+// hasBody reports whether the requests made with method send a value.
+func hasBody(method string) bool {
+	return method == "PUT" || method == "PATCH" || method == "POST"
+}
+
+// isJSON reports whether contentType is that of a JSON document.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
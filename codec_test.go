@@ -0,0 +1,103 @@
+package firego
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reversedCodec encodes values as JSON written backwards.
+type reversedCodec struct{}
+
+func (reversedCodec) ContentType() string { return "application/x-reversed" }
+func (reversedCodec) Accept() string      { return "application/x-reversed, application/json" }
+
+func (reversedCodec) Encode(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	return reverse(b), err
+}
+
+func (reversedCodec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(reverse(data), &v)
+	return v, err
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+func TestWithCodec(t *testing.T) {
+	t.Parallel()
+	var (
+		stored      []byte
+		contentType string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "application/x-reversed, application/json", req.Header.Get("Accept"))
+		switch req.URL.Path {
+		case "/json/.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"json"}`))
+		case "/deep/.json":
+			w.Header().Set("Content-Type", "application/x-reversed")
+			w.Write(reverse([]byte(`{"a":{"b":{"c":1}}}`)))
+		case "/invalid/.json":
+			w.Header().Set("Content-Type", "application/x-reversed")
+			w.Write([]byte("{"))
+		case "/denied/.json":
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error":"Permission denied"}`, http.StatusUnauthorized)
+		case "/proxy/.json":
+			http.Error(w, "<html>502 Bad Gateway</html>", http.StatusBadGateway)
+		default:
+			if req.Method == "PUT" {
+				stored, _ = ioutil.ReadAll(req.Body)
+				contentType = req.Header.Get("Content-Type")
+			}
+			w.Header().Set("Content-Type", "application/x-reversed")
+			w.Write(stored)
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithCodec(reversedCodec{}), WithAccept("text/plain"))
+	require.NoError(t, fb.Set(map[string]interface{}{"name": "alice", "age": 30}))
+	assert.Equal(t, "application/x-reversed", contentType)
+	assert.Equal(t, reverse([]byte(`{"age":30,"name":"alice"}`)), stored)
+
+	var v struct {
+		Name string
+		Age  int
+	}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "alice", v.Name)
+	assert.Equal(t, 30, v.Age)
+
+	// JSON responses are read as JSON
+	require.NoError(t, fb.Child("json").Value(&v))
+	assert.Equal(t, "json", v.Name)
+	err := fb.Child("denied").Value(&v)
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, "Permission denied", err.(ErrHTTP).Message)
+	err = fb.Child("proxy").Value(&v)
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, http.StatusBadGateway, err.(ErrHTTP).StatusCode)
+
+	assert.Error(t, fb.Child("invalid").Value(&v))
+
+	// the depth is that of the decoded value
+	var m map[string]interface{}
+	assert.Equal(t, ErrMaxDepthExceeded, New(server.URL, nil, WithCodec(reversedCodec{}), WithMaxDepth(2)).Child("deep").Value(&m))
+	require.NoError(t, New(server.URL, nil, WithCodec(reversedCodec{}), WithMaxDepth(3)).Child("deep").Value(&m))
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1.0}}}, m)
+}
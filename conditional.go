@@ -0,0 +1,474 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// maxConditionalAttempts bounds the conditional writes ReplaceIf,
+// CompareAndSet and Transaction attempt before giving up on a value that
+// keeps changing, unless set with WithConditionalRetries.
+const maxConditionalAttempts = 25
+
+// ErrPreconditionFailed is returned when a conditional write is rejected
+// because the value changed since it was read.
+var ErrPreconditionFailed = errors.New("precondition failed, the value changed since it was read")
+
+var errMissingETag = errors.New("the response has no ETag")
+
+// etagState holds the ETags of the conditional requests made with a
+// reference it is set on.
+type etagState struct {
+	// ifMatch is sent as the ETag the value is expected to have
+	ifMatch string
+	// ifNoneMatch is sent as the ETag of a value already read
+	ifNoneMatch string
+	// etag and body are those of the last response
+	etag string
+	body []byte
+}
+
+// lastETag holds the ETag of the last value read
+// by a reference created with WithAlwaysETag.
+type lastETag struct {
+	mtx  sync.Mutex
+	etag string
+}
+
+func (l *lastETag) set(etag string) {
+	if l == nil {
+		return
+	}
+	l.mtx.Lock()
+	l.etag = etag
+	l.mtx.Unlock()
+}
+
+func (l *lastETag) get() string {
+	if l == nil {
+		return ""
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.etag
+}
+
+// WithAlwaysETag determines whether or not every read made with the
+// reference asks Firebase for the ETag of the value read, which is then
+// available from LastETag, for workflows where the writes following a read
+// are made conditional on the value not having changed since. The
+// references derived from it keep their own.
+//
+// Firebase computes the ETag of the whole value for every read that asks
+// for it, which is why reads do not ask for one by default.
+func WithAlwaysETag(v bool) Option {
+	return func(fb *firebase) {
+		fb.lastETag = nil
+		if v {
+			fb.lastETag = &lastETag{}
+		}
+	}
+}
+
+// WithConditionalRetries sets the number of times the read-modify-write
+// loops of Transaction, ReplaceIf, CompareAndSet and Derive write again
+// after a write rejected because the value changed since it was read,
+// before giving up with ErrPreconditionFailed. The default is 24, for 25
+// attempts in all, and 0 gives up on the first rejection.
+func WithConditionalRetries(n int) Option {
+	return func(fb *firebase) {
+		if n < 0 {
+			n = 0
+		}
+		fb.conditionalTries = n + 1
+	}
+}
+
+// maxAttempts returns the number of conditional writes a read-modify-write
+// loop of the reference attempts.
+func (fb *firebase) maxAttempts() int {
+	if fb.conditionalTries == 0 {
+		return maxConditionalAttempts
+	}
+	return fb.conditionalTries
+}
+
+// ValueWithETag gets the value of the reference into v the way Value
+// does, bypassing the read cache, and returns the ETag Firebase computed
+// for it, to be given to SetIfUnchanged or RemoveIfMatch for a write that
+// only goes through if the value did not change in the meantime. The ETag
+// is returned along with the error when the error is DecodeWarnings.
+func (fb *firebase) ValueWithETag(v interface{}) (string, error) {
+	c := fb.copy()
+	c.conditional = &etagState{}
+	body, err := c.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return "", err
+	}
+	if c.conditional.etag == "" {
+		return "", errMissingETag
+	}
+	err = fb.unmarshal(body, v)
+	if _, ok := err.(DecodeWarnings); err != nil && !ok {
+		return "", err
+	}
+	return c.conditional.etag, err
+}
+
+// SetIfUnchanged sets the value of the reference to v if its ETag is
+// still etag, typically the one returned by ValueWithETag.
+// ErrPreconditionFailed is returned, and nothing is written, if the value
+// changed since it had that ETag. Conditional writes are never queued by
+// WithWriteQueue.
+func (fb *firebase) SetIfUnchanged(v interface{}, etag string) error {
+	if etag == "" {
+		// never fall back to an unconditional write
+		return errMissingETag
+	}
+	b, err := fb.marshalPayload(v)
+	if err != nil {
+		return err
+	}
+	c := fb.copy()
+	c.conditional = &etagState{ifMatch: etag}
+	_, err = c.doRequest(context.Background(), "PUT", b)
+	if e, ok := err.(ErrHTTP); ok && e.StatusCode == http.StatusPreconditionFailed {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// Transaction sets the value of the reference to the value fn returns for
+// its current value, decoded into an interface{}, nil for a missing value.
+// The write is conditional on the value not having changed since it was
+// read: when it has, fn is called again with the new value and the write
+// attempted again, as many times as set with WithConditionalRetries, 24 by
+// default, after which ErrPreconditionFailed is returned. fn may be called
+// several times and should therefore have no side effects, such as
+// counting:
+//
+//	err := counter.Transaction(func(current interface{}) (interface{}, error) {
+//		n, _ := current.(float64)
+//		return n + 1, nil
+//	})
+//
+// A nil value returned by fn removes the value, and an error returned by
+// fn aborts the transaction with that error, nothing being written. Every
+// attempt writes the whole value, use ReplaceIf to skip the write when
+// there is nothing to change, and TransactionRaw to decode the value into
+// a type other than interface{}. Conditional writes are never queued by
+// WithWriteQueue.
+func (fb *firebase) Transaction(fn func(current interface{}) (interface{}, error)) error {
+	_, err := fb.replaceIf(func(body []byte) ([]byte, error) {
+		var current interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return nil, err
+		}
+		v, err := fn(current)
+		if err != nil {
+			return nil, err
+		}
+		return fb.marshalPayload(v)
+	})
+	return err
+}
+
+// TransactionRaw runs a transaction the way Transaction does, with fn
+// given the current value as the JSON Firebase sent, "null" for a missing
+// value, so that it can decode it into a type of its own:
+//
+//	err := ref.TransactionRaw(func(current json.RawMessage) (interface{}, error) {
+//		var account Account
+//		if err := json.Unmarshal(current, &account); err != nil {
+//			return nil, err
+//		}
+//		account.Balance += 10
+//		return account, nil
+//	})
+func (fb *firebase) TransactionRaw(fn func(current json.RawMessage) (interface{}, error)) error {
+	_, err := fb.replaceIf(func(body []byte) ([]byte, error) {
+		v, err := fn(json.RawMessage(bytes.TrimSpace(body)))
+		if err != nil {
+			return nil, err
+		}
+		return fb.marshalPayload(v)
+	})
+	return err
+}
+
+// LastETag returns the ETag of the last value successfully read by the
+// reference, empty if there was none, Firebase did not send one or the
+// reference was not created with WithAlwaysETag. A read served from the
+// cache set with WithReadCache returns the ETag the value was read with.
+func (fb *firebase) LastETag() string {
+	return fb.lastETag.get()
+}
+
+// ReplaceIf sets the value of the reference to newValue if pred returns
+// true for its current value, decoded into an interface{}, and
+// reports whether the value was written. The write is conditional on the
+// value not having changed since pred was called, when it has, pred is
+// called again with the new value, until the write goes through or pred
+// returns false. ErrPreconditionFailed is returned if the value keeps
+// changing.
+//
+// No write is made when pred returns false, which makes ReplaceIf cheaper
+// than reading and writing back the same value for a no-op, and makes it a
+// fit for state transitions such as moving a job from "pending" to
+// "active" only if no other worker did it first. Conditional writes are
+// never queued by WithWriteQueue.
+func (fb *firebase) ReplaceIf(pred func(current interface{}) bool, newValue interface{}) (bool, error) {
+	b, err := fb.marshalPayload(newValue)
+	if err != nil {
+		return false, err
+	}
+	return fb.replaceIf(func(body []byte) ([]byte, error) {
+		var current interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return nil, err
+		}
+		if !pred(current) {
+			return nil, nil
+		}
+		return b, nil
+	})
+}
+
+// CompareAndSet sets the value found at writePath to value if the value
+// found at conditionPath equals expected, and reports whether the value was
+// written. Both paths are relative to the reference, and expected is
+// compared to the current value the way they are stored by the database,
+// a nil expected matching a missing value. It is meant for lightweight
+// locks and guards, such as claiming "lock/owner" only while "lock/state"
+// is "free", without setting up security rules.
+//
+// The check and the write are atomic: CompareAndSet reads the value of the
+// closest common ancestor of the two paths and writes it back whole, on
+// the condition that it did not change in the meantime, retrying the way
+// ReplaceIf does when it has. This makes its cost that of reading and
+// writing the whole ancestor, which is the reference itself when the paths
+// share no key, so paths should be kept close together. Nothing outside of
+// the ancestor is covered by the guarantee.
+func (fb *firebase) CompareAndSet(conditionPath string, expected interface{}, writePath string, value interface{}) (bool, error) {
+	conditionPath, writePath = strings.Trim(conditionPath, "/"), strings.Trim(writePath, "/")
+	if err := validatePaths(conditionPath, writePath); err != nil {
+		return false, err
+	}
+
+	b, err := fb.marshalPayload(value)
+	if err != nil {
+		return false, err
+	}
+	newValue, err := decodeTree(b)
+	if err != nil {
+		return false, ErrInvalidPayload{err}
+	}
+	b, err = json.Marshal(expected)
+	if err != nil {
+		return false, ErrInvalidPayload{err}
+	}
+	var want interface{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		return false, ErrInvalidPayload{err}
+	}
+	want = normalize(want)
+
+	ancestor, conditionPath, writePath := fb.commonChild(conditionPath, writePath)
+	return ancestor.replaceIf(func(body []byte) ([]byte, error) {
+		var current interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(lookup(normalize(current), splitPath(conditionPath)), want) {
+			return nil, nil
+		}
+
+		// numbers are kept as they were sent by the database
+		tree, err := decodeTree(body)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(setPath(normalize(tree), splitPath(writePath), normalize(newValue)))
+	})
+}
+
+// Derive sets the value found at destPath to the value fn derives from the
+// value found at srcPath, both paths being relative to the reference, for
+// denormalized values that have to be kept consistent with their source,
+// such as setting "summary/count" to the number of children of "items".
+// fn is called with the source value decoded into an interface{}, nil for
+// a missing value, and no write is made when it derives the value already
+// stored, a nil derived value removing the destination.
+//
+// The read and the write are atomic, the way they are for CompareAndSet:
+// the value of the closest common ancestor of the two paths is read and
+// written back whole, on the condition that it did not change in the
+// meantime. When it did, fn is called again with the new source value,
+// until the write goes through, and ErrPreconditionFailed is returned if
+// the value keeps changing; fn should therefore have no side effects. The
+// cost is that of reading and writing the whole ancestor, the reference
+// itself when the paths share no key.
+func (fb *firebase) Derive(srcPath, destPath string, fn func(src interface{}) interface{}) error {
+	srcPath, destPath = strings.Trim(srcPath, "/"), strings.Trim(destPath, "/")
+	if err := validatePaths(srcPath, destPath); err != nil {
+		return err
+	}
+
+	ancestor, srcPath, destPath := fb.commonChild(srcPath, destPath)
+	_, err := ancestor.replaceIf(func(body []byte) ([]byte, error) {
+		var current interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return nil, err
+		}
+		current = normalize(current)
+		b, err := ancestor.marshalPayload(fn(lookup(current, splitPath(srcPath))))
+		if err != nil {
+			return nil, err
+		}
+		var derived interface{}
+		if err := json.Unmarshal(b, &derived); err != nil {
+			return nil, ErrInvalidPayload{err}
+		}
+		if reflect.DeepEqual(lookup(current, splitPath(destPath)), normalize(derived)) {
+			return nil, nil
+		}
+
+		// numbers are kept as they were sent by the database
+		tree, err := decodeTree(body)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeTree(b)
+		if err != nil {
+			return nil, ErrInvalidPayload{err}
+		}
+		return json.Marshal(setPath(normalize(tree), splitPath(destPath), normalize(value)))
+	})
+	return err
+}
+
+// validatePaths returns an error for the first of paths, relative to a
+// reference, that is not a valid path. Empty paths, naming the reference
+// itself, are valid.
+func validatePaths(paths ...string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commonChild returns the child of the reference at the closest common
+// ancestor of the paths a and b, relative to the reference, along with
+// a and b relative to that child.
+func (fb *firebase) commonChild(a, b string) (*firebase, string, string) {
+	common := commonAncestor(a, b)
+	if common == "" {
+		return fb, a, b
+	}
+	return fb.Child(common).(*firebase), relativePath(common, a), relativePath(common, b)
+}
+
+// RemoveIfMatch removes the value of the reference if its ETag is still
+// etag, typically the one returned by ValueWithETag, or by LastETag after
+// a read made with a reference created with WithAlwaysETag.
+// ErrPreconditionFailed is returned, and nothing is removed, if the value
+// changed since it had that ETag. Conditional removals are never queued
+// by WithWriteQueue.
+func (fb *firebase) RemoveIfMatch(etag string) error {
+	if etag == "" {
+		// never fall back to an unconditional removal
+		return errMissingETag
+	}
+	c := fb.copy()
+	c.conditional = &etagState{ifMatch: etag}
+	_, err := c.doRequest(context.Background(), "DELETE", nil)
+	if e, ok := err.(ErrHTTP); ok && e.StatusCode == http.StatusPreconditionFailed {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// replaceIf sets the value of the reference to the payload update returns
+// for its current value, retrying with the new value while it keeps
+// changing. No write is made when update returns a nil payload.
+func (fb *firebase) replaceIf(update func(current []byte) ([]byte, error)) (bool, error) {
+	c := fb.copy()
+	c.conditional = &etagState{}
+	body, err := c.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return false, err
+	}
+
+	for attempt := 0; attempt < fb.maxAttempts(); attempt++ {
+		b, err := update(body)
+		if err != nil || b == nil {
+			return false, err
+		}
+
+		if c.conditional.etag == "" {
+			// never fall back to an unconditional write
+			return false, errMissingETag
+		}
+		c.conditional.ifMatch = c.conditional.etag
+		_, err = c.doRequest(context.Background(), "PUT", b)
+		if err == nil {
+			return true, nil
+		}
+		if e, ok := err.(ErrHTTP); !ok || e.StatusCode != http.StatusPreconditionFailed {
+			return false, err
+		}
+		// the rejection holds the current value and its ETag
+		body = c.conditional.body
+	}
+	return false, ErrPreconditionFailed
+}
+
+// nullETag is the ETag Firebase gives a location holding no value.
+const nullETag = "null_etag"
+
+// CreateChild writes v as a new child of the reference, under a push ID
+// generated locally, and returns its key. Unlike Push, which has Firebase
+// generate the key with a POST, the write is a PUT conditional on the
+// child holding no value, so that it is guaranteed to have created the
+// child rather than overwritten one: ErrPreconditionFailed is returned, and
+// nothing is written, if a value already exists under the key.
+//
+// The key is returned along with the error when the write failed, which
+// makes CreateChild safe to follow up on: a write that failed without a
+// response from Firebase, for example on a timeout, may or may not have
+// created the child, which reading the child with the key tells, whereas a
+// Push failing the same way leaves no key to look for and retrying it may
+// create the child twice. Conditional writes are never queued by
+// WithWriteQueue.
+func (fb *firebase) CreateChild(v interface{}) (string, error) {
+	key := newPushID()
+	return key, fb.createChild(key, v)
+}
+
+// createChild writes v as the child key of the reference on the condition
+// that it holds no value.
+func (fb *firebase) createChild(key string, v interface{}) error {
+	b, err := fb.marshalPayload(v)
+	if err != nil {
+		return err
+	}
+	c := fb.copy()
+	c.url = fb.url + "/" + key
+	c.conditional = &etagState{ifMatch: nullETag}
+	_, err = c.doRequest(context.Background(), "PUT", b)
+	if e, ok := err.(ErrHTTP); ok && e.StatusCode == http.StatusPreconditionFailed {
+		return ErrPreconditionFailed
+	}
+	return err
+}
@@ -0,0 +1,454 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestReplaceIf(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("job", map[string]interface{}{"state": "pending"})
+	fb := New(server.URL+"/job", nil)
+
+	isPending := func(current interface{}) bool {
+		job, _ := current.(map[string]interface{})
+		return job["state"] == "pending"
+	}
+	ok, err := fb.ReplaceIf(isPending, map[string]string{"state": "active"})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"state": "active"}, server.Get("job"))
+
+	// the job is no longer pending
+	ok, err = fb.ReplaceIf(isPending, map[string]string{"state": "active"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestReplaceIfConflict(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("counter", 1)
+	fb := New(server.URL+"/counter", nil)
+
+	var seen []interface{}
+	ok, err := fb.ReplaceIf(func(current interface{}) bool {
+		seen = append(seen, current)
+		if len(seen) == 1 {
+			// another client writes between the read and the write
+			server.Set("counter", 2)
+		}
+		return true
+	}, 3)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{1.0, 2.0}, seen)
+	assert.Equal(t, 3.0, server.Get("counter"))
+}
+
+func TestReplaceIfShortCircuit(t *testing.T) {
+	t.Parallel()
+	var writes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			atomic.AddInt32(&writes, 1)
+		}
+		assert.Equal(t, "true", req.Header.Get("X-Firebase-ETag"))
+		w.Header().Set("ETag", "tag")
+		w.Write([]byte(`"active"`))
+	}))
+	defer server.Close()
+
+	ok, err := New(server.URL, nil).ReplaceIf(func(current interface{}) bool {
+		return current == "pending"
+	}, "active")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Zero(t, atomic.LoadInt32(&writes))
+}
+
+func TestReplaceIfExhausted(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("ETag", "tag")
+		if req.Method == "PUT" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+		w.Write([]byte(`"pending"`))
+	}))
+	defer server.Close()
+
+	ok, err := New(server.URL, nil).ReplaceIf(func(interface{}) bool { return true }, "active")
+	assert.Equal(t, ErrPreconditionFailed, err)
+	assert.False(t, ok)
+}
+
+func TestCompareAndSet(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("locks/build", map[string]interface{}{"state": "free"})
+	server.Set("other", "untouched")
+	fb := New(server.URL+"/locks", nil)
+
+	ok, err := fb.CompareAndSet("build/state", "free", "build/owner", "worker-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"state": "free", "owner": "worker-1"}, server.Get("locks/build"))
+
+	// the condition no longer holds
+	ok, err = fb.CompareAndSet("build/owner", nil, "build/owner", "worker-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "worker-1", server.Get("locks/build/owner"))
+
+	// removing the value written
+	ok, err = fb.CompareAndSet("build/state", "free", "build/owner", nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"state": "free"}, server.Get("locks/build"))
+	assert.Equal(t, "untouched", server.Get("other"))
+
+	_, err = fb.CompareAndSet("build/st.ate", "free", "build/owner", "worker-1")
+	assert.Error(t, err)
+}
+
+func TestCompareAndSetConflict(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("lock", map[string]interface{}{"state": "free"})
+	var gets int32
+	proxy := newFaultServer(t, server, func(w http.ResponseWriter, req *http.Request, forward http.Handler) {
+		if req.Method == "GET" && atomic.AddInt32(&gets, 1) == 1 {
+			// another client takes the lock between the read and the write
+			defer server.Set("lock/state", "taken")
+		}
+		forward.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	fb := New(proxy.URL, nil)
+	ok, err := fb.CompareAndSet("lock/state", "free", "lock/owner", "worker-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, map[string]interface{}{"state": "taken"}, server.Get("lock"))
+}
+
+func TestDerive(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("list", map[string]interface{}{
+		"items": map[string]interface{}{"a": true, "b": true},
+	})
+	server.Set("other", "untouched")
+	fb := New(server.URL, nil)
+	count := func(src interface{}) interface{} {
+		items, _ := src.(map[string]interface{})
+		return len(items)
+	}
+
+	require.NoError(t, fb.Derive("list/items", "/list/summary/count", count))
+	assert.Equal(t, 2.0, server.Get("list/summary/count"))
+	assert.Equal(t, "untouched", server.Get("other"))
+
+	server.Set("list/items/c", true)
+	require.NoError(t, fb.Child("list").Derive("items", "summary/count", count))
+	assert.Equal(t, 3.0, server.Get("list/summary/count"))
+
+	// nothing is written when the derived value is already stored
+	server.DrainHistory()
+	require.NoError(t, fb.Derive("list/items", "list/summary/count", count))
+	assert.Empty(t, server.DrainHistory())
+
+	// a missing source derives from nil, a nil value removes the destination
+	require.NoError(t, fb.Derive("list/missing", "list/summary", func(src interface{}) interface{} {
+		assert.Nil(t, src)
+		return nil
+	}))
+	assert.Nil(t, server.Get("list/summary"))
+
+	assert.Error(t, fb.Derive("list/it.ems", "list/summary/count", count))
+}
+
+func TestDeriveConflict(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("list/items", map[string]interface{}{"a": true})
+	var gets int32
+	proxy := newFaultServer(t, server, func(w http.ResponseWriter, req *http.Request, forward http.Handler) {
+		if req.Method == "GET" && atomic.AddInt32(&gets, 1) == 1 {
+			// another client adds an item between the read and the write
+			defer server.Set("list/items/b", true)
+		}
+		forward.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	var calls int
+	fb := New(proxy.URL, nil)
+	require.NoError(t, fb.Derive("list/items", "list/count", func(src interface{}) interface{} {
+		calls++
+		return len(src.(map[string]interface{}))
+	}))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, map[string]interface{}{
+		"items": map[string]interface{}{"a": true, "b": true},
+		"count": 2.0,
+	}, server.Get("list"))
+}
+
+func TestWithAlwaysETag(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("counter", 1)
+	fb := New(server.URL+"/counter", nil, WithAlwaysETag(true))
+	assert.Empty(t, fb.LastETag())
+
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	first := fb.LastETag()
+	assert.NotEmpty(t, first)
+
+	server.Set("counter", 2)
+	var buf bytes.Buffer
+	require.NoError(t, fb.ExportTo(&buf))
+	assert.NotEmpty(t, fb.LastETag())
+	assert.NotEqual(t, first, fb.LastETag())
+
+	// writes do not change the ETag of the last read
+	last := fb.LastETag()
+	require.NoError(t, fb.Set(3))
+	assert.Equal(t, last, fb.LastETag())
+
+	// the references derived from it keep their own
+	assert.Empty(t, fb.Child("x").LastETag())
+
+	// reads do not ask for ETags by default
+	plain := New(server.URL+"/counter", nil)
+	require.NoError(t, plain.Value(&v))
+	assert.Empty(t, plain.LastETag())
+}
+
+func TestRemoveIfMatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("jobs/1", "pending")
+	fb := New(server.URL+"/jobs/1", nil, WithAlwaysETag(true))
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	etag := fb.LastETag()
+
+	// another client writes between the read and the removal
+	server.Set("jobs/1", "active")
+	assert.Equal(t, ErrPreconditionFailed, fb.RemoveIfMatch(etag))
+	assert.Equal(t, "active", server.Get("jobs/1"))
+
+	require.NoError(t, fb.Value(&v))
+	require.NoError(t, fb.RemoveIfMatch(fb.LastETag()))
+	assert.Nil(t, server.Get("jobs/1"))
+
+	// a removal is never made unconditionally
+	server.Set("jobs/1", "pending")
+	assert.Error(t, fb.RemoveIfMatch(""))
+	assert.Equal(t, "pending", server.Get("jobs/1"))
+}
+
+func TestCreateChild(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/jobs", nil)
+	key, err := fb.CreateChild(map[string]interface{}{"state": "pending"})
+	require.NoError(t, err)
+	assert.Len(t, key, 20)
+	assert.Equal(t, map[string]interface{}{"state": "pending"}, server.Get("jobs/"+key))
+
+	other, err := fb.CreateChild("pending")
+	require.NoError(t, err)
+	assert.True(t, other > key, "keys sort chronologically")
+	assert.Equal(t, "pending", server.Get("jobs/"+other))
+}
+
+func TestCreateChildExisting(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("jobs/taken", "active")
+	fb := New(server.URL+"/jobs", nil).(*firebase)
+	assert.Equal(t, ErrPreconditionFailed, fb.createChild("taken", "pending"))
+	assert.Equal(t, "active", server.Get("jobs/taken"))
+
+	require.NoError(t, fb.createChild("free", "pending"))
+	assert.Equal(t, "pending", server.Get("jobs/free"))
+}
+
+func TestValueWithETag(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("counter", 1)
+	fb := New(server.URL+"/counter", nil)
+	var v int
+	etag, err := fb.ValueWithETag(&v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.NotEmpty(t, etag)
+
+	// another client writes between the read and the write
+	server.Set("counter", 2)
+	assert.Equal(t, ErrPreconditionFailed, fb.SetIfUnchanged(v+1, etag))
+	assert.Equal(t, 2, server.Get("counter"))
+
+	etag, err = fb.ValueWithETag(&v)
+	require.NoError(t, err)
+	require.NoError(t, fb.SetIfUnchanged(v+1, etag))
+	assert.Equal(t, 3.0, server.Get("counter"))
+
+	// a write is never made unconditionally
+	assert.Error(t, fb.SetIfUnchanged(10, ""))
+	assert.Equal(t, 3.0, server.Get("counter"))
+}
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("counter", 1)
+	fb := New(server.URL+"/counter", nil)
+	var seen []interface{}
+	increment := func(current interface{}) (interface{}, error) {
+		seen = append(seen, current)
+		if len(seen) == 1 {
+			// another client writes between the read and the write
+			server.Set("counter", 5)
+		}
+		n, _ := current.(float64)
+		return n + 1, nil
+	}
+	require.NoError(t, fb.Transaction(increment))
+	assert.Equal(t, []interface{}{1.0, 5.0}, seen)
+	assert.Equal(t, 6.0, server.Get("counter"))
+
+	// an error aborts it
+	errAbort := errors.New("abort")
+	err := fb.Transaction(func(interface{}) (interface{}, error) { return nil, errAbort })
+	assert.Equal(t, errAbort, err)
+	assert.Equal(t, 6.0, server.Get("counter"))
+
+	// nil removes the value, a missing value is nil
+	require.NoError(t, fb.Transaction(func(interface{}) (interface{}, error) { return nil, nil }))
+	assert.Nil(t, server.Get("counter"))
+	seen = nil
+	require.NoError(t, fb.Child("new").Transaction(func(current interface{}) (interface{}, error) {
+		seen = append(seen, current)
+		return "created", nil
+	}))
+	assert.Equal(t, []interface{}{nil}, seen)
+	assert.Equal(t, "created", server.Get("counter/new"))
+}
+
+func TestTransactionRaw(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type account struct {
+		Owner   string `json:"owner"`
+		Balance int    `json:"balance"`
+	}
+	server.Set("accounts/alice", map[string]interface{}{"owner": "alice", "balance": 10})
+	fb := New(server.URL+"/accounts", nil)
+
+	var seen []string
+	deposit := func(current json.RawMessage) (interface{}, error) {
+		seen = append(seen, string(current))
+		if len(seen) == 1 {
+			// another client writes between the read and the write
+			server.Set("accounts/alice/balance", 20)
+		}
+		var a account
+		if err := json.Unmarshal(current, &a); err != nil {
+			return nil, err
+		}
+		a.Balance += 5
+		return a, nil
+	}
+	require.NoError(t, fb.Child("alice").TransactionRaw(deposit))
+	assert.Equal(t, []string{`{"balance":10,"owner":"alice"}`, `{"balance":20,"owner":"alice"}`}, seen)
+	assert.Equal(t, map[string]interface{}{"owner": "alice", "balance": 25.0}, server.Get("accounts/alice"))
+
+	// a missing value is null
+	seen = nil
+	require.NoError(t, fb.Child("bob").TransactionRaw(func(current json.RawMessage) (interface{}, error) {
+		seen = append(seen, string(current))
+		return account{Owner: "bob"}, nil
+	}))
+	assert.Equal(t, []string{"null"}, seen)
+	assert.Equal(t, map[string]interface{}{"owner": "bob", "balance": 0.0}, server.Get("accounts/bob"))
+}
+
+func TestTransactionExhausted(t *testing.T) {
+	t.Parallel()
+	var writes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("ETag", "tag")
+		if req.Method == "PUT" {
+			atomic.AddInt32(&writes, 1)
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+		w.Write([]byte(`1`))
+	}))
+	defer server.Close()
+
+	increment := func(current interface{}) (interface{}, error) {
+		return current.(float64) + 1, nil
+	}
+	assert.Equal(t, ErrPreconditionFailed, New(server.URL, nil, WithConditionalRetries(2)).Transaction(increment))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&writes))
+
+	atomic.StoreInt32(&writes, 0)
+	assert.Equal(t, ErrPreconditionFailed, New(server.URL, nil).Transaction(increment))
+	assert.Equal(t, int32(maxConditionalAttempts), atomic.LoadInt32(&writes))
+}
@@ -0,0 +1,54 @@
+package firego
+
+import (
+	_url "net/url"
+	"strings"
+)
+
+// defaultDomain is the domain of the databases
+// created before regional databases were introduced.
+const defaultDomain = ".firebaseio.com"
+
+// NewFromConfig creates a Firebase reference to the root of the database
+// the databaseURL field of a Firebase configuration points at, using the
+// client New creates. The variety of forms found in such configurations
+// are accepted:
+//
+//	my-db                                        -> https://my-db.firebaseio.com
+//	my-db.firebaseio.com/                        -> https://my-db.firebaseio.com
+//	https://my-db.firebaseio.com/some/path       -> https://my-db.firebaseio.com
+//	my-db.europe-west1.firebasedatabase.app      -> https://my-db.europe-west1.firebasedatabase.app
+//	http://localhost:9000?ns=my-db               -> http://localhost:9000, namespace my-db
+//
+// The namespace given by the ns query parameter of an emulator URL is sent
+// with every request, the same way WithEmulator does.
+func NewFromConfig(databaseURL string, opts ...Option) Firebase {
+	root, ns := parseDatabaseURL(databaseURL)
+	if ns != "" {
+		opts = append([]Option{withNamespace(ns)}, opts...)
+	}
+	return New(root, nil, opts...)
+}
+
+// parseDatabaseURL returns the root URL of the database
+// databaseURL points at and the namespace it names, if any.
+func parseDatabaseURL(databaseURL string) (root string, ns string) {
+	root = sanitizeURL(databaseURL)
+	u, err := _url.Parse(root)
+	if err != nil || u.Host == "" {
+		return root, ""
+	}
+
+	host := u.Host
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		// a bare database name
+		host += defaultDomain
+	}
+	return u.Scheme + "://" + host, u.Query().Get(namespaceParam)
+}
+
+func withNamespace(ns string) Option {
+	return func(fb *firebase) {
+		fb.params.Set(namespaceParam, ns)
+	}
+}
@@ -0,0 +1,46 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		databaseURL string
+		expected    string
+		ns          string
+	}{
+		{databaseURL: URL, expected: URL},
+		{databaseURL: URL + "/", expected: URL},
+		{databaseURL: URL + "/some/path/", expected: URL},
+		{databaseURL: "somefirebaseapp.firebaseIO.com", expected: URL},
+		{databaseURL: "somefirebaseapp.firebaseIO.com/users", expected: URL},
+		{databaseURL: "somefirebaseapp", expected: "https://somefirebaseapp.firebaseio.com"},
+		{databaseURL: " https://somefirebaseapp/ ", expected: "https://somefirebaseapp.firebaseio.com"},
+		{
+			databaseURL: "my-db-default-rtdb.europe-west1.firebasedatabase.app",
+			expected:    "https://my-db-default-rtdb.europe-west1.firebasedatabase.app",
+		},
+		{
+			databaseURL: "HTTPS://my-db-default-rtdb.europe-west1.firebasedatabase.app//path",
+			expected:    "https://my-db-default-rtdb.europe-west1.firebasedatabase.app",
+		},
+		{databaseURL: "http://localhost:9000", expected: "http://localhost:9000"},
+		{databaseURL: "http://localhost", expected: "http://localhost"},
+		{databaseURL: "http://localhost:9000?ns=my-db", expected: "http://localhost:9000", ns: "my-db"},
+		{databaseURL: "http://127.0.0.1:9000/?ns=my-db", expected: "http://127.0.0.1:9000", ns: "my-db"},
+	} {
+		fb := NewFromConfig(test.databaseURL).(*firebase)
+		assert.Equal(t, test.expected, fb.url, "databaseURL: %s", test.databaseURL)
+		assert.Equal(t, test.ns, fb.params.Get(namespaceParam), "databaseURL: %s", test.databaseURL)
+	}
+}
+
+func TestNewFromConfigOptions(t *testing.T) {
+	t.Parallel()
+	fb := NewFromConfig("http://localhost:9000?ns=my-db", WithEmulator("localhost:9001", "other"))
+	assert.Equal(t, "http://localhost:9001/.json?ns=other", fb.String())
+}
@@ -0,0 +1,95 @@
+package firego
+
+import "context"
+
+// WithContext returns a copy of the reference whose operations, including
+// watching, are all bound to ctx. Once ctx is done, in-flight requests are
+// aborted and new ones fail immediately. The context is inherited by every
+// reference derived from the returned one.
+//
+// When an operation is also given its own context the request is aborted
+// as soon as either of them is done.
+func (fb *firebase) WithContext(ctx context.Context) Firebase {
+	c := fb.copy()
+	c.ctx = ctx
+	return c
+}
+
+// operationNameKey is the key of the name set with WithOperationName.
+type operationNameKey struct{}
+
+// WithOperationName returns a copy of ctx that names the logical operation
+// the requests made with it belong to, such as "loadUserProfile", so that
+// the Logger set with WithLogger can attribute them in the Operation of
+// their RequestInfo, for example to aggregate latencies by operation
+// rather than by path.
+//
+// The name flows from the context given to the methods that take one,
+// such as ValueStream, and from the context a reference is bound to with
+// WithContext, which names every operation of the methods that do not:
+//
+//	ref := fb.WithContext(firego.WithOperationName(ctx, "loadUserProfile"))
+//	err := ref.Child("profile").Value(&profile)
+//
+// The name of the context given to a method wins when both are named.
+func WithOperationName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, operationNameKey{}, name)
+}
+
+// operationName returns the name set with WithOperationName on the
+// context of a request, or on the base context of the reference.
+func (fb *firebase) operationName(ctx context.Context) string {
+	if name, ok := ctx.Value(operationNameKey{}).(string); ok {
+		return name
+	}
+	if name, ok := fb.baseContext().Value(operationNameKey{}).(string); ok {
+		return name
+	}
+	return ""
+}
+
+func (fb *firebase) baseContext() context.Context {
+	if fb.ctx == nil {
+		return context.Background()
+	}
+	return fb.ctx
+}
+
+// requestContext merges the base context of the reference with the
+// context of a single operation. The returned context is done when
+// either of them is done and carries the earliest of their deadlines.
+func (fb *firebase) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	base := fb.ctx
+	switch {
+	case base == nil || base == ctx:
+		return context.WithCancel(ctx)
+	case ctx == context.Background():
+		return context.WithCancel(base)
+	}
+
+	merged, cancel := context.WithCancel(ctx)
+	if d, ok := base.Deadline(); ok {
+		if cd, ok := ctx.Deadline(); !ok || d.Before(cd) {
+			var cancelDeadline context.CancelFunc
+			merged, cancelDeadline = context.WithDeadline(merged, d)
+			cancelMerged := cancel
+			cancel = func() {
+				cancelDeadline()
+				cancelMerged()
+			}
+		}
+	}
+
+	go func() {
+		select {
+		case <-base.Done():
+			if base.Err() != context.DeadlineExceeded {
+				cancel()
+			}
+			// otherwise the merged context carries the same deadline,
+			// it expires on its own and reports the right reason
+		case <-merged.Done():
+		}
+	}()
+	return merged, cancel
+}
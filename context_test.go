@@ -0,0 +1,173 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestWithContext(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fb := New(server.URL, nil)
+	child := fb.WithContext(ctx).Child("foo")
+	assert.Nil(t, fb.(*firebase).ctx)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	var v interface{}
+	err := child.Value(&v)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestOperationsWithContext(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		if req.URL.Path == "/fast/.json" {
+			w.Write([]byte(`{"a":1}`))
+			return
+		}
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+	fb := New(server.URL, &http.Client{})
+	slow := fb.Child("slow")
+
+	ops := map[string]func(ctx context.Context) error{
+		"value": func(ctx context.Context) error {
+			var v interface{}
+			return slow.ValueWithContext(ctx, &v)
+		},
+		"set":    func(ctx context.Context) error { return slow.SetWithContext(ctx, 1) },
+		"update": func(ctx context.Context) error { return slow.UpdateWithContext(ctx, map[string]int{"a": 1}) },
+		"remove": func(ctx context.Context) error { return slow.RemoveWithContext(ctx) },
+		"push": func(ctx context.Context) error {
+			_, err := slow.PushWithContext(ctx, 1)
+			return err
+		},
+	}
+	for name, op := range ops {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		err := op(ctx)
+		assert.True(t, errors.Is(err, context.Canceled), "%s: %v", name, err)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err = op(ctx)
+		cancel()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "%s: %v", name, err)
+		var timeout ErrTimeout
+		assert.True(t, errors.As(err, &timeout), "%s: %v", name, err)
+	}
+
+	// without a context
+	var v map[string]interface{}
+	require.NoError(t, fb.Child("fast").Value(&v))
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, v)
+	require.NoError(t, fb.Child("fast").ValueWithContext(context.Background(), &v))
+	require.NoError(t, fb.Child("fast").SetWithContext(context.Background(), 1))
+}
+
+func TestWatchWithContext(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.WatchWithContext(ctx, notifications))
+	event := <-notifications
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, event.Data)
+
+	cancel()
+	for range notifications {
+	}
+	assert.Equal(t, context.Canceled, fb.WatchErr())
+	assert.False(t, fb.IsWatching())
+
+	// a done context fails the watch at once
+	err := fb.WatchWithContext(ctx, make(chan Event))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, fb.IsWatching())
+
+	// the watch can be started again
+	notifications = make(chan Event)
+	require.NoError(t, fb.WatchWithContext(context.Background(), notifications))
+	<-notifications
+	fb.StopWatching()
+	for range notifications {
+	}
+	assert.NoError(t, fb.WatchErr())
+}
+
+func TestRequestContext(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no base", func(t *testing.T) {
+		fb := &firebase{}
+		ctx, cancel := fb.requestContext(context.Background())
+		defer cancel()
+		assert.NoError(t, ctx.Err())
+	})
+
+	t.Run("base cancelled", func(t *testing.T) {
+		base, cancelBase := context.WithCancel(context.Background())
+		fb := &firebase{ctx: base}
+		type key struct{}
+		ctx, cancel := fb.requestContext(context.WithValue(context.Background(), key{}, "v"))
+		defer cancel()
+
+		cancelBase()
+		<-ctx.Done()
+		assert.Equal(t, context.Canceled, ctx.Err())
+		assert.Equal(t, "v", ctx.Value(key{}))
+	})
+
+	t.Run("call cancelled", func(t *testing.T) {
+		fb := &firebase{ctx: context.Background()}
+		callCtx, cancelCall := context.WithCancel(context.Background())
+		ctx, cancel := fb.requestContext(callCtx)
+		defer cancel()
+
+		cancelCall()
+		<-ctx.Done()
+		assert.Equal(t, context.Canceled, ctx.Err())
+	})
+
+	t.Run("earliest deadline", func(t *testing.T) {
+		base, cancelBase := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelBase()
+		callCtx, cancelCall := context.WithTimeout(context.Background(), time.Hour)
+		defer cancelCall()
+
+		fb := &firebase{ctx: base}
+		ctx, cancel := fb.requestContext(callCtx)
+		defer cancel()
+
+		d, ok := ctx.Deadline()
+		require.True(t, ok)
+		bd, _ := base.Deadline()
+		assert.Equal(t, bd, d)
+
+		<-ctx.Done()
+		assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	})
+}
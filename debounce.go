@@ -0,0 +1,83 @@
+package firego
+
+import "time"
+
+// WatchDebounced watches the reference like Watch does but coalesces the
+// put and patch events received in quick succession. An event received
+// after quiet has elapsed without any other is passed over to the given
+// chan as soon as it arrives. The events following it within quiet of each
+// other are held back until quiet elapses with no new event, and are then
+// passed over as a single put event replacing the whole value of the
+// reference with its latest value.
+//
+// Consumers that only need the latest value, such as a UI, see every
+// isolated change as it happens and a single update per burst of changes.
+// Other events, such as errors, are passed over immediately, after the
+// held back changes. The watch is stopped with StopWatching, the same way
+// it is for Watch.
+func (fb *firebase) WatchDebounced(ch chan Event, quiet time.Duration) error {
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return err
+	}
+
+	go debounce(events, ch, fb.watchStopped(), quiet, time.After)
+	return nil
+}
+
+// debounce implements WatchDebounced, passing the events received on
+// events over to out and waiting for quiet to elapse with after. out is
+// closed once events is, or once stop is, whether or not the events held
+// back could be passed over.
+func debounce(events <-chan Event, out chan Event, stop <-chan struct{}, quiet time.Duration, after func(time.Duration) <-chan time.Time) {
+	defer close(out)
+
+	m := &Mirror{}
+	var (
+		// timer is set while a burst of events is being received
+		timer   <-chan time.Time
+		pending bool
+	)
+	send := func(event Event) bool {
+		return sendOrStop(out, event, stop)
+	}
+	flush := func() bool {
+		if !pending {
+			return true
+		}
+		pending = false
+		return send(newEvent(EventTypePut, "/", normalize(m.value)))
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				flush()
+				return
+			}
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				if !flush() || !send(event) {
+					return
+				}
+				continue
+			}
+
+			m.Apply(event)
+			if timer == nil {
+				if !send(event) {
+					return
+				}
+			} else {
+				pending = true
+			}
+			timer = after(quiet)
+
+		case <-timer:
+			if !flush() {
+				return
+			}
+			timer = nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package firego
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// fakeTimers hands out timers that only fire when told to.
+type fakeTimers struct {
+	timers chan chan time.Time
+}
+
+func (f *fakeTimers) after(time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	f.timers <- c
+	return c
+}
+
+func TestDebounce(t *testing.T) {
+	t.Parallel()
+	clock := &fakeTimers{timers: make(chan chan time.Time, 10)}
+	events, out := make(chan Event), make(chan Event, 10)
+	go debounce(events, out, nil, time.Second, clock.after)
+
+	received := func() Event {
+		select {
+		case event := <-out:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive an event")
+		}
+		return Event{}
+	}
+	fire := func() {
+		var last chan time.Time
+		for {
+			select {
+			case last = <-clock.timers:
+				continue
+			default:
+			}
+			break
+		}
+		require.NotNil(t, last)
+		last <- time.Now()
+	}
+
+	// an isolated event is delivered right away
+	events <- newEvent(EventTypePut, "/", map[string]interface{}{"a": 1.0})
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, received().Data)
+
+	// the rest of the burst is coalesced
+	events <- newEvent(EventTypePatch, "/", map[string]interface{}{"b": 2.0})
+	events <- newEvent(EventTypePut, "/a", 3.0)
+	select {
+	case event := <-out:
+		assert.Fail(t, "the burst was not held back", "%v", event)
+	default:
+	}
+	fire()
+	event := received()
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"a": 3.0, "b": 2.0}, event.Data)
+
+	// once quiet, events are delivered right away again
+	events <- newEvent(EventTypePut, "/b", nil)
+	assert.Equal(t, Event{Type: EventTypePut, Path: "/b", rawData: []byte(`{"data":null,"path":"/b"}`)}, received())
+
+	// other events flush the held back ones
+	events <- newEvent(EventTypePut, "/c", 4.0)
+	boom := errors.New("boom")
+	events <- Event{Type: EventTypeError, Data: boom}
+	assert.Equal(t, map[string]interface{}{"a": 3.0, "c": 4.0}, received().Data)
+	assert.Equal(t, boom, received().Data)
+
+	close(events)
+	_, ok := <-out
+	assert.False(t, ok, "out should be closed")
+}
+
+// assertRelayStops asserts that relay, passing the events it receives over
+// to out, returns and closes out once stop is closed while nobody receives
+// from out.
+func assertRelayStops(t *testing.T, relay func(events <-chan Event, out chan Event, stop <-chan struct{})) {
+	events, out, stop := make(chan Event), make(chan Event), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		relay(events, out, stop)
+		close(done)
+	}()
+
+	// nobody receives the event
+	events <- newEvent(EventTypePut, "/", 1.0)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the relay did not return once stopped")
+	}
+	_, ok := <-out
+	assert.False(t, ok, "out should be closed")
+}
+
+func TestDebounceStopped(t *testing.T) {
+	t.Parallel()
+	assertRelayStops(t, func(events <-chan Event, out chan Event, stop <-chan struct{}) {
+		debounce(events, out, stop, time.Second, time.After)
+	})
+}
+
+func TestWatchDebounced(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("foo", "bar")
+	fb := New(server.URL+"/foo", nil)
+	events := make(chan Event, 10)
+	require.NoError(t, fb.WatchDebounced(events, 100*time.Millisecond))
+
+	assert.Equal(t, "bar", (<-events).Data)
+	time.Sleep(200 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		server.Set("foo", i)
+	}
+
+	var received []interface{}
+	for len(received) == 0 || received[len(received)-1] != 4.0 {
+		select {
+		case event := <-events:
+			received = append(received, event.Data)
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive the latest value", "%v", received)
+		}
+	}
+	assert.True(t, len(received) < 5, "the burst was not coalesced: %v", received)
+
+	fb.StopWatching()
+	for range events {
+	}
+}
@@ -0,0 +1,48 @@
+package firego
+
+import "sync"
+
+// capturedBody holds the body of the last response
+// read by a reference created with WithCaptureLastBody.
+type capturedBody struct {
+	mtx sync.Mutex
+	b   []byte
+}
+
+func (c *capturedBody) set(b []byte) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	c.b = b
+	c.mtx.Unlock()
+}
+
+// WithCaptureLastBody determines whether or not the reference keeps the
+// raw body of the last response it read, available from
+// LastResponseBody, for example to see what Firebase sent when decoding
+// it failed. The references derived from it keep their own.
+//
+// This is a debugging aid: the whole body is held in memory until the next
+// response replaces it, which also means ValueStream buffers everything
+// it streams.
+func WithCaptureLastBody(v bool) Option {
+	return func(fb *firebase) {
+		fb.lastBody = nil
+		if v {
+			fb.lastBody = &capturedBody{}
+		}
+	}
+}
+
+// LastResponseBody returns the raw body of the last response read by the
+// reference, nil if there was none or the reference was not created with
+// WithCaptureLastBody. The returned slice must not be modified.
+func (fb *firebase) LastResponseBody() []byte {
+	if fb.lastBody == nil {
+		return nil
+	}
+	fb.lastBody.mtx.Lock()
+	defer fb.lastBody.mtx.Unlock()
+	return fb.lastBody.b
+}
@@ -0,0 +1,50 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureLastBody(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing/.json":
+			http.Error(w, `{"error":"not here"}`, http.StatusNotFound)
+		default:
+			w.Write([]byte(`{"name":42}`))
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithCaptureLastBody(true))
+	assert.Nil(t, fb.LastResponseBody())
+
+	var v struct{ Name string }
+	err := fb.Value(&v)
+	assert.IsType(t, &json.UnmarshalTypeError{}, err)
+	assert.Equal(t, `{"name":42}`, string(fb.LastResponseBody()))
+
+	missing := fb.Child("missing")
+	assert.Error(t, missing.Value(&v))
+	assert.Equal(t, "{\"error\":\"not here\"}\n", string(missing.LastResponseBody()))
+	assert.Equal(t, `{"name":42}`, string(fb.LastResponseBody()), "children keep their own body")
+
+	fresh := New(server.URL, nil, WithCaptureLastBody(true))
+	require.NoError(t, fresh.FreshValue(&map[string]interface{}{}))
+	assert.Equal(t, `{"name":42}`, string(fresh.LastResponseBody()))
+
+	stream := New(server.URL, nil, WithCaptureLastBody(true))
+	require.NoError(t, stream.ValueStream(context.Background(), make(chan OrderedEntry, 1)))
+	assert.Equal(t, `{"name":42}`, string(stream.LastResponseBody()))
+
+	disabled := New(server.URL, nil)
+	require.NoError(t, disabled.Value(&map[string]interface{}{}))
+	assert.Nil(t, disabled.LastResponseBody())
+}
@@ -0,0 +1,236 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DecodeWarning describes a field that was skipped by a lenient decode
+// because its value did not match the type of the Go value, or a key that
+// no field takes, reported by a reference created with
+// WithUnknownKeyWarnings.
+type DecodeWarning struct {
+	// Field is the dot separated path of the field, array elements are
+	// named by their index.
+	Field string
+	// Value is the kind of JSON value found, such as "string" or "number".
+	Value string
+	// Type is the Go type the value could not be stored in, the struct
+	// type for an unknown key.
+	Type reflect.Type
+	// Unknown is set when the field is a key that no field of the struct
+	// takes, whose value was ignored.
+	Unknown bool
+}
+
+func (w DecodeWarning) String() string {
+	if w.Unknown {
+		return fmt.Sprintf("%s: no field of %s takes the %s", w.Field, w.Type, w.Value)
+	}
+	return fmt.Sprintf("%s: cannot decode %s into %s", w.Field, w.Value, w.Type)
+}
+
+// DecodeWarnings is returned by Value on a reference created with
+// WithLenientDecode when fields had to be skipped, or with
+// WithUnknownKeyWarnings when keys were ignored. The value has been
+// decoded apart from the fields listed, which are sorted by Field.
+type DecodeWarnings []DecodeWarning
+
+func (w DecodeWarnings) Error() string {
+	msgs := make([]string, len(w))
+	for i, warning := range w {
+		msgs[i] = warning.String()
+	}
+	return fmt.Sprintf("skipped %d field(s) while decoding: %s", len(w), strings.Join(msgs, "; "))
+}
+
+// WithLenientDecode determines whether or not Value skips the fields whose
+// value does not match the type of the field it would be stored in,
+// instead of failing the read. The skipped fields are left untouched and
+// listed in the DecodeWarnings returned, the rest of the value is decoded.
+//
+// Lenient decoding keeps a service reading data whose schema is being
+// migrated, at the cost of handing it values with missing fields that it
+// has to be ready for. Strict decoding, the default, reports the first
+// mismatch and makes schema drift impossible to miss. A lenient decode
+// also costs an extra pass over the value for every mismatch found.
+func WithLenientDecode(v bool) Option {
+	return func(fb *firebase) {
+		fb.lenientDecode = v
+	}
+}
+
+// WithDisallowUnknownFields determines whether or not Value fails when the
+// value read holds a field that the struct it is decoded into does not
+// declare, the way json.Decoder.DisallowUnknownFields does, instead of
+// ignoring it. The error names the first unknown field found.
+//
+// This catches schema drift early, typically in tests that read data
+// written by another service. It is generally unsafe for production reads
+// of data whose schema evolves, since adding a field to the data breaks
+// every client that has not been updated, and should only be enabled on
+// purpose. It has no effect on a reference created with
+// WithLenientDecode, which favors decoding what it can.
+func WithDisallowUnknownFields(v bool) Option {
+	return func(fb *firebase) {
+		fb.strictFields = v
+	}
+}
+
+// unmarshal decodes data into v, leniently if the reference was created
+// with WithLenientDecode, rejecting unknown fields if it was created with
+// WithDisallowUnknownFields, converting epoch times if it was created
+// with WithEpochTimes, naming fields after the tag set with WithTagName
+// and collecting the keys no field takes in the fields tagged
+// `firego:"rest"`.
+func (fb *firebase) unmarshal(data []byte, v interface{}) error {
+	if fb.tagName != "" {
+		tree, err := decodeTree(data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(renameFields(tree, reflect.TypeOf(v), reflect.Value{}, fb.tagName, false)); err != nil {
+			return err
+		}
+	}
+	if fb.epochUnit != 0 {
+		var err error
+		if data, err = fb.epochToTimes(data, v); err != nil {
+			return err
+		}
+	}
+	if fb.unknownKeyWarnings || hasRestField(reflect.TypeOf(v)) {
+		return decodeUnknownKeys(data, v, fb.unknownKeyWarnings, fb.decode)
+	}
+	return fb.decode(data, v)
+}
+
+// decode decodes data into v, leniently or rejecting unknown fields
+// depending on the options of the reference. The objects keyed by indexes
+// decoded into slices are read as arrays, see SetArray.
+func (fb *firebase) decode(data []byte, v interface{}) error {
+	return fb.decodeArrays(data, v, fb.decodeAs)
+}
+
+// decodeAs decodes data into v as is, with the options of the reference.
+func (fb *firebase) decodeAs(data []byte, v interface{}) error {
+	switch {
+	case fb.lenientDecode:
+		return decodeLenient(data, v)
+	case fb.strictFields:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeLenient decodes data into v, skipping the fields that do not match
+// the type of v. Each failed attempt names the first mismatching field,
+// which is removed before decoding again into a fresh value until the
+// decode succeeds; only then is v written to.
+func decodeLenient(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return json.Unmarshal(data, v)
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+
+	var warnings DecodeWarnings
+	for {
+		err := json.Unmarshal(data, reflect.New(rv.Type().Elem()).Interface())
+		typeErr, ok := err.(*json.UnmarshalTypeError)
+		if !ok {
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		var removed bool
+		if typeErr.Field != "" {
+			tree, removed = removePath(tree, strings.Split(typeErr.Field, "."))
+		}
+		if !removed {
+			// the value as a whole does not match
+			return err
+		}
+		warnings = append(warnings, DecodeWarning{
+			Field: typeErr.Field,
+			Value: typeErr.Value,
+			Type:  typeErr.Type,
+		})
+
+		if data, err = json.Marshal(tree); err != nil {
+			return err
+		}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		sort.Slice(warnings, func(i, j int) bool { return warnings[i].Field < warnings[j].Field })
+		return warnings
+	}
+	return nil
+}
+
+// removePath removes the value found at path in v, indexing into objects
+// by key and into arrays by index.
+func removePath(v interface{}, path []string) (interface{}, bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		key, ok := objectKey(val, path[0])
+		if !ok {
+			return v, false
+		}
+		if len(path) == 1 {
+			delete(val, key)
+			return val, true
+		}
+		child, removed := removePath(val[key], path[1:])
+		val[key] = child
+		return val, removed
+
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(val) {
+			return v, false
+		}
+		if len(path) == 1 {
+			// keep the other elements at their index
+			val[i] = nil
+			return val, true
+		}
+		child, removed := removePath(val[i], path[1:])
+		val[i] = child
+		return val, removed
+	}
+	return v, false
+}
+
+// objectKey returns the key of m that a struct field named name is decoded
+// from, encoding/json matches keys to field names case-insensitively.
+func objectKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,114 @@
+package firego
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lenientUser struct {
+	Name    string            `json:"name"`
+	Age     int               `json:"age"`
+	Tags    []string          `json:"tags"`
+	Scores  map[string]int    `json:"scores"`
+	Friends []lenientUser     `json:"friends"`
+	Extra   map[string]string `json:"extra"`
+	Big     int64
+}
+
+func TestDecodeLenient(t *testing.T) {
+	t.Parallel()
+	data := []byte(`{
+		"name": "alice",
+		"age": "forty",
+		"tags": ["a", 2, "c"],
+		"scores": {"math": 10, "art": "A"},
+		"friends": [{"name": "bob", "age": 30}, {"name": 7, "age": 31}],
+		"big": 9007199254740993,
+		"unknown": true
+	}`)
+
+	v := lenientUser{Age: 99}
+	err := decodeLenient(data, &v)
+	require.IsType(t, DecodeWarnings{}, err)
+
+	assert.Equal(t, lenientUser{
+		Name:    "alice",
+		Age:     99,
+		Tags:    []string{"a", "", "c"},
+		Scores:  map[string]int{"math": 10},
+		Friends: []lenientUser{{Name: "bob", Age: 30}, {Age: 31}},
+		Big:     9007199254740993,
+	}, v)
+
+	warnings := err.(DecodeWarnings)
+	fields := make([]string, len(warnings))
+	for i, w := range warnings {
+		fields[i] = w.Field
+	}
+	assert.Equal(t, []string{"age", "friends.1.name", "scores.art", "tags.1"}, fields)
+	assert.Equal(t, DecodeWarning{Field: "age", Value: "string", Type: reflect.TypeOf(0)}, warnings[0])
+	assert.Contains(t, err.Error(), "skipped 4 field(s)")
+}
+
+func TestDecodeLenientErrors(t *testing.T) {
+	t.Parallel()
+	var v lenientUser
+	assert.NoError(t, decodeLenient([]byte(`{"name":"alice"}`), &v))
+
+	// the value as a whole has the wrong type
+	err := decodeLenient([]byte(`"alice"`), &v)
+	assert.IsType(t, &json.UnmarshalTypeError{}, err)
+
+	// invalid JSON is not tolerated
+	err = decodeLenient([]byte(`{"name":`), &v)
+	assert.Error(t, err)
+	assert.NotEqual(t, reflect.TypeOf(DecodeWarnings{}), reflect.TypeOf(err))
+}
+
+func TestWithLenientDecode(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"name":"alice","age":"forty"}`))
+	}))
+	defer server.Close()
+
+	var strict lenientUser
+	err := New(server.URL, nil).Value(&strict)
+	assert.IsType(t, &json.UnmarshalTypeError{}, err)
+
+	var lenient lenientUser
+	fb := New(server.URL, nil, WithLenientDecode(true))
+	err = fb.Child("users").Value(&lenient)
+	require.IsType(t, DecodeWarnings{}, err)
+	assert.Len(t, err.(DecodeWarnings), 1)
+	assert.Equal(t, "alice", lenient.Name)
+}
+
+func TestWithDisallowUnknownFields(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"name":"alice","age":30,"nickname":"al"}`))
+	}))
+	defer server.Close()
+
+	var v struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	require.NoError(t, New(server.URL, nil).Value(&v))
+
+	fb := New(server.URL, nil, WithDisallowUnknownFields(true))
+	err := fb.Child("users").Value(&v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown field "nickname"`)
+
+	// maps have no unknown fields
+	var m map[string]interface{}
+	assert.NoError(t, fb.Value(&m))
+}
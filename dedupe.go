@@ -0,0 +1,84 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// WithDedupe makes the writes of Set and Update apply at most once when
+// they are retried, including the writes that are not idempotent, such as
+// those holding server values that depend on the current value. Every
+// write is given an operation ID that is recorded under metadataPath, a
+// path from the root of the database, in the same multi-location update
+// as the write itself, so that the ID is there if and only if the write
+// was applied. Before being retried, a write whose outcome is unknown
+// checks for its ID and is not sent again if it was applied.
+//
+// This is heavier than a conditional write: every write becomes an update
+// of the closest common ancestor of the location written and metadataPath,
+// which is often the root of the database and must be allowed by the
+// security rules, and every retry costs an extra read. When the ID can not
+// be read the retry is abandoned and the write fails, since it may have
+// been applied. The IDs are stored with the time of the write and are
+// never removed by firego, they have to be pruned by the application.
+// A write to a location holding metadataPath can not be deduplicated and
+// fails. Deduplicated writes are never queued by WithWriteQueue.
+func WithDedupe(metadataPath string) Option {
+	return func(fb *firebase) {
+		fb.dedupePath = strings.Trim(metadataPath, "/")
+	}
+}
+
+// dedupeWrite applies a PUT or PATCH of body to the reference along with
+// the ID of the operation under the metadata path.
+func (fb *firebase) dedupeWrite(ctx context.Context, method string, body []byte) ([]byte, error) {
+	path := fb.path()
+	marker := joinPath(fb.dedupePath, newPushID())
+	ancestor := commonAncestor(path, marker)
+	if isWithin(marker, path) {
+		return nil, fmt.Errorf("can not deduplicate a write to %q, which holds %q", "/"+path, "/"+fb.dedupePath)
+	}
+
+	update := map[string]json.RawMessage{
+		relativePath(ancestor, marker): json.RawMessage(`{".sv":"timestamp"}`),
+	}
+	switch method {
+	case "PUT":
+		update[relativePath(ancestor, path)] = body
+	case "PATCH":
+		var children map[string]json.RawMessage
+		if err := json.Unmarshal(body, &children); err != nil {
+			return nil, ErrInvalidPayload{err}
+		}
+		for k, v := range children {
+			update[joinPath(relativePath(ancestor, path), k)] = v
+		}
+	}
+	b, err := json.Marshal(update)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+
+	url, err := fb.rootURL()
+	if err != nil {
+		return nil, err
+	}
+	root := fb.copy()
+	root.clearReadParams()
+	if root.url, err = joinURL(url, ancestor); err != nil {
+		return nil, err
+	}
+	markerRef := root.copy()
+	markerRef.url, _ = joinURL(url, marker)
+	root.applied = func(ctx context.Context) (bool, error) {
+		body, err := markerRef.doRequest(ctx, "GET", nil)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(bytes.TrimSpace(body), []byte("null")), nil
+	}
+	return root.doRequest(ctx, "PATCH", b)
+}
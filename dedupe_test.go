@@ -0,0 +1,98 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// newFlakyProxy forwards the requests made to it to server, failing the
+// first write with a server error, after forwarding it if forward is set.
+// It reports the number of writes forwarded.
+func newFlakyProxy(t *testing.T, server *firetest.Firetest, forward bool) (*httptest.Server, *int32) {
+	var writes, forwarded int32
+	return newFaultServer(t, server, func(w http.ResponseWriter, req *http.Request, proxy http.Handler) {
+		if req.Method == "GET" {
+			proxy.ServeHTTP(w, req)
+			return
+		}
+		if atomic.AddInt32(&writes, 1) == 1 {
+			if forward {
+				atomic.AddInt32(&forwarded, 1)
+				proxy.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(&forwarded, 1)
+		proxy.ServeHTTP(w, req)
+	}), &forwarded
+}
+
+func TestDedupe(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	// the first write is applied but its response is lost
+	proxy, forwarded := newFlakyProxy(t, server, true)
+	defer proxy.Close()
+
+	fb := New(proxy.URL, nil, WithRetry(2, time.Millisecond), WithDedupe("/_ops"))
+	require.NoError(t, fb.Child("users/alice").Set(map[string]string{"name": "alice"}))
+	assert.EqualValues(t, 1, atomic.LoadInt32(forwarded))
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, server.Get("users/alice"))
+
+	ops, ok := server.Get("_ops").(map[string]interface{})
+	require.True(t, ok)
+	assert.Len(t, ops, 1)
+	for _, timestamp := range ops {
+		// the server value was resolved
+		assert.IsType(t, int64(0), timestamp)
+	}
+}
+
+func TestDedupeRetry(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	// the first write never reaches the database
+	proxy, forwarded := newFlakyProxy(t, server, false)
+	defer proxy.Close()
+
+	server.Set("users/alice", map[string]interface{}{"name": "alice", "age": 30})
+	fb := New(proxy.URL, nil, WithRetry(2, time.Millisecond), WithDedupe("_ops"))
+	require.NoError(t, fb.Child("users/alice").Update(map[string]interface{}{"age": 31}))
+	assert.EqualValues(t, 1, atomic.LoadInt32(forwarded))
+	assert.Equal(t, map[string]interface{}{"name": "alice", "age": 31.0}, server.Get("users/alice"))
+	assert.Len(t, server.Get("_ops"), 1)
+
+	// writes to a location holding the IDs can not be deduplicated
+	assert.Error(t, fb.Set(true))
+}
+
+func TestDedupeQuery(t *testing.T) {
+	t.Parallel()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		queries = append(queries, req.URL.RawQuery)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	// the query of the reference is not part of the update
+	fb := New(server.URL, nil, WithDedupe("_ops")).Child("users").OrderBy("$key").LimitToFirst(1)
+	fb.Shallow(true)
+	require.NoError(t, fb.Child("alice").Set(true))
+	require.NoError(t, fb.Update(map[string]interface{}{"bob": true}))
+	assert.Equal(t, []string{"", ""}, queries)
+}
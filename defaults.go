@@ -0,0 +1,78 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ValueWithDefaults gets the value of the Firebase reference like Value
+// does, with the value of defaultsRef overlaid beneath it, so that the
+// fields missing from the value fall back to those of the defaults:
+//
+//	var cfg Config
+//	err := ref.Child("config/tenants/acme").ValueWithDefaults(ref.Child("config/defaults"), &cfg)
+//
+// The overlay is made by the client, Firebase has no notion of defaults:
+// both values are read, concurrently the way ValueFields reads its
+// fields, and merged before being decoded into v. The value of the
+// reference takes precedence at every level, objects being merged key by
+// key and anything else, arrays included, replacing the default
+// altogether. A reference with no value reads as
+// the defaults, and v is set to null when neither has a value.
+//
+// If either read fails, v is left as it was and a *BatchError keyed by
+// the path of the failed reads is returned.
+func (fb *firebase) ValueWithDefaults(defaultsRef Firebase, v interface{}) error {
+	refs := []Firebase{fb, defaultsRef}
+	paths := []string{fb.Path(), defaultsRef.Path()}
+	bodies := make([]json.RawMessage, len(refs))
+	err := batch(paths, func(ctx context.Context, i int) error {
+		if ref, ok := refs[i].(*firebase); ok {
+			body, err := ref.cachedValue(ctx)
+			bodies[i] = body
+			return err
+		}
+		return refs[i].Value(&bodies[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	var trees [2]interface{}
+	for i, body := range bodies {
+		if len(body) == 0 {
+			continue
+		}
+		if trees[i], err = decodeTree(body); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(overlay(trees[0], trees[1]))
+	if err != nil {
+		return err
+	}
+	return fb.unmarshal(b, v)
+}
+
+// overlay returns value merged over defaults, the values of value taking
+// precedence over those of defaults but for the keys of objects found in
+// both, which are merged the same way.
+func overlay(value, defaults interface{}) interface{} {
+	if value == nil {
+		return defaults
+	}
+	children, ok := value.(map[string]interface{})
+	defaultChildren, isObject := defaults.(map[string]interface{})
+	if !ok || !isObject {
+		return value
+	}
+
+	merged := make(map[string]interface{}, len(children)+len(defaultChildren))
+	for k, child := range defaultChildren {
+		merged[k] = child
+	}
+	for k, child := range children {
+		merged[k] = overlay(child, defaultChildren[k])
+	}
+	return merged
+}
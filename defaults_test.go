@@ -0,0 +1,81 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestValueWithDefaults(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("config/defaults", map[string]interface{}{
+		"theme":  "light",
+		"limits": map[string]interface{}{"requests": 100, "storage": 10},
+		"tags":   []interface{}{"a", "b"},
+		"beta":   map[string]interface{}{"enabled": false},
+	})
+	server.Set("config/tenants/acme", map[string]interface{}{
+		"theme":  "dark",
+		"limits": map[string]interface{}{"requests": 500},
+		"tags":   []interface{}{"c"},
+		"beta":   true,
+	})
+
+	type config struct {
+		Theme  string
+		Limits map[string]int
+		Tags   []string
+		Beta   interface{}
+	}
+	fb := New(server.URL+"/config", nil)
+	var cfg config
+	require.NoError(t, fb.Child("tenants/acme").ValueWithDefaults(fb.Child("defaults"), &cfg))
+	assert.Equal(t, config{
+		// the value takes precedence
+		Theme: "dark",
+		// objects are merged key by key
+		Limits: map[string]int{"requests": 500, "storage": 10},
+		// anything else replaces the default
+		Tags: []string{"c"},
+		Beta: true,
+	}, cfg)
+
+	// a missing value reads as the defaults
+	cfg = config{}
+	require.NoError(t, fb.Child("tenants/missing").ValueWithDefaults(fb.Child("defaults"), &cfg))
+	assert.Equal(t, config{
+		Theme:  "light",
+		Limits: map[string]int{"requests": 100, "storage": 10},
+		Tags:   []string{"a", "b"},
+		Beta:   map[string]interface{}{"enabled": false},
+	}, cfg)
+
+	// and missing defaults as the value
+	var m map[string]interface{}
+	require.NoError(t, fb.Child("tenants/acme/limits").ValueWithDefaults(fb.Child("missing"), &m))
+	assert.Equal(t, map[string]interface{}{"requests": 500.0}, m)
+	m = map[string]interface{}{"stale": true}
+	require.NoError(t, fb.Child("missing").ValueWithDefaults(fb.Child("missing"), &m))
+	assert.Nil(t, m)
+}
+
+func TestValueWithDefaultsFailure(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`{"theme":"dark"}`)
+	defer server.Close()
+	failing := newTestServer("")
+	failing.Close()
+
+	var m map[string]interface{}
+	err := New(server.URL, nil).ValueWithDefaults(New(failing.URL+"/defaults", nil), &m)
+	require.IsType(t, &BatchError{}, err)
+	assert.Contains(t, err.(*BatchError).Errors, "/defaults")
+	assert.Equal(t, 1, err.(*BatchError).Succeeded)
+	assert.Nil(t, m)
+}
@@ -0,0 +1,61 @@
+package firego
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrMaxDepthExceeded is returned by reads on a reference created with
+// WithMaxDepth when the value read is nested deeper than allowed.
+var ErrMaxDepthExceeded = errors.New("maximum depth exceeded")
+
+// WithMaxDepth limits how deeply nested the values read from Firebase may
+// be, an object or array is one level deep and every object or array
+// nested in it adds a level. The nesting is tracked while the response is
+// read, so a read exceeding the limit is aborted with ErrMaxDepthExceeded
+// without the rest of the value being downloaded. A limit of 0 disables it.
+//
+// Writes and the events of a watched reference are not limited.
+func WithMaxDepth(n int) Option {
+	return func(fb *firebase) {
+		fb.maxDepth = n
+	}
+}
+
+// depthReader is an io.Reader that fails with ErrMaxDepthExceeded once the
+// JSON document read through it is nested deeper than max.
+type depthReader struct {
+	r   io.Reader
+	max int
+
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func (d *depthReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, b := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString:
+			switch b {
+			case '\\':
+				d.escaped = true
+			case '"':
+				d.inString = false
+			}
+		case b == '"':
+			d.inString = true
+		case b == '{' || b == '[':
+			d.depth++
+			if d.depth > d.max {
+				return 0, ErrMaxDepthExceeded
+			}
+		case b == '}' || b == ']':
+			d.depth--
+		}
+	}
+	return n, err
+}
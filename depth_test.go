@@ -0,0 +1,66 @@
+package firego
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func nested(depth int) interface{} {
+	var v interface{} = "leaf"
+	for i := 0; i < depth; i++ {
+		v = map[string]interface{}{"child": v}
+	}
+	return v
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("shallow", nested(3))
+	server.Set("deep", nested(50))
+
+	fb := New(server.URL, nil, WithMaxDepth(3))
+
+	var v interface{}
+	require.NoError(t, fb.Child("shallow").Value(&v))
+	assert.Equal(t, nested(3), v)
+
+	err := fb.Child("deep").Value(&v)
+	assert.Equal(t, ErrMaxDepthExceeded, err)
+
+	// reading further down the tree is within the limit again
+	require.NoError(t, fb.Child("deep"+strings.Repeat("/child", 47)).Value(&v))
+	assert.Equal(t, nested(3), v)
+
+	// writes are not limited
+	require.NoError(t, fb.Child("written").Set(nested(10)))
+}
+
+func TestDepthReader(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		json string
+		max  int
+		err  error
+	}{
+		{json: `"leaf"`, max: 1},
+		{json: `{"a":[1,2,{"b":true}]}`, max: 3},
+		{json: `{"a":[1,2,{"b":true}]}`, max: 2, err: ErrMaxDepthExceeded},
+		{json: `{"a":"{[{[{[{["}`, max: 1},
+		{json: `{"a":"\"{[{["}`, max: 1},
+		{json: `[[],[],[]]`, max: 2},
+		{json: `[[[]]]`, max: 2, err: ErrMaxDepthExceeded},
+	} {
+		r := &depthReader{r: iotest.OneByteReader(strings.NewReader(tt.json)), max: tt.max}
+		_, err := ioutil.ReadAll(r)
+		assert.Equal(t, tt.err, err, tt.json)
+	}
+}
@@ -0,0 +1,76 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+)
+
+// DiffSince reads the children of the reference and compares them with
+// previous, the children the caller last knew of, returning the children
+// that were added, the ones whose value changed, both with their current
+// value, and the ones that were removed, with their value in previous.
+// The deltas are empty, never nil, when nothing changed. Values are
+// compared the way they are stored by the database, previous being
+// encoded as JSON first, so that for example an int and the float64 read
+// back for it are equal. A reference to a primitive value or to a location
+// without data has no children.
+//
+// This lets a poller apply incremental updates without a stream. The read
+// asks for the ETag of the collection and sends the one of the last read
+// made by DiffSince with the reference, not the references derived from
+// it, as If-None-Match: when it is unchanged, the deltas are empty without
+// the children being compared and, where the server answers with a 304 Not
+// Modified, without the collection being transferred. previous is
+// therefore expected to be the collection as of the last call, once its
+// deltas have been applied.
+func (fb *firebase) DiffSince(previous map[string]interface{}) (added, changed, removed map[string]interface{}, err error) {
+	added, changed, removed = map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
+
+	last := fb.diffETag.get()
+	c := fb.copy()
+	c.noCache = true
+	c.conditional = &etagState{ifNoneMatch: last}
+	body, err := c.doRequest(context.Background(), "GET", nil)
+	if e, ok := err.(ErrHTTP); ok && e.StatusCode == http.StatusNotModified {
+		return added, changed, removed, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if c.conditional.etag != "" && c.conditional.etag == last {
+		return added, changed, removed, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, nil, nil, err
+	}
+	current, _ := value.(map[string]interface{})
+	b, err := json.Marshal(previous)
+	if err != nil {
+		return nil, nil, nil, ErrInvalidPayload{err}
+	}
+	var before map[string]interface{}
+	if err := json.Unmarshal(b, &before); err != nil {
+		return nil, nil, nil, ErrInvalidPayload{err}
+	}
+
+	for key, v := range current {
+		old, ok := before[key]
+		switch {
+		case !ok || old == nil:
+			added[key] = v
+		case !reflect.DeepEqual(normalize(old), normalize(v)):
+			changed[key] = v
+		}
+	}
+	for key, old := range before {
+		if _, ok := current[key]; !ok && old != nil {
+			removed[key] = previous[key]
+		}
+	}
+	fb.diffETag.set(c.conditional.etag)
+	return added, changed, removed, nil
+}
@@ -0,0 +1,90 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestDiffSince(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"age": 30},
+		"bob":   map[string]interface{}{"age": 40},
+	})
+	fb := New(server.URL, nil).Child("users")
+
+	added, changed, removed, err := fb.DiffSince(nil)
+	require.NoError(t, err)
+	assert.Len(t, added, 2)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	// an unchanged collection is not sent again
+	previous := map[string]interface{}{
+		"alice": added["alice"],
+		"bob":   map[string]interface{}{"age": 40},
+	}
+	added, changed, removed, err = fb.DiffSince(previous)
+	require.NoError(t, err)
+	assert.NotNil(t, added)
+	assert.Empty(t, added)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	server.Set("users/alice/age", 31)
+	server.Delete("users/bob")
+	server.Set("users/carol", map[string]interface{}{"age": 20})
+	added, changed, removed, err = fb.DiffSince(previous)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"carol": map[string]interface{}{"age": 20.0}}, added)
+	assert.Equal(t, map[string]interface{}{"alice": map[string]interface{}{"age": 31.0}}, changed)
+	assert.Equal(t, map[string]interface{}{"bob": map[string]interface{}{"age": 40}}, removed)
+
+	// values are compared the way they are stored, and references keep
+	// the ETag of their own reads
+	added, changed, removed, err = fb.Child("").DiffSince(map[string]interface{}{
+		"alice": map[string]int{"age": 31},
+		"carol": map[string]interface{}{"age": 20},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, added)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	_, _, _, err = fb.Child("").DiffSince(map[string]interface{}{"bad": func() {}})
+	assert.IsType(t, ErrInvalidPayload{}, err)
+}
+
+func TestDiffSinceIgnoredIfNoneMatch(t *testing.T) {
+	t.Parallel()
+	var reqs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		w.Header().Set("ETag", "same")
+		w.Write([]byte(`{"a":1}`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	added, _, _, err := fb.DiffSince(nil)
+	require.NoError(t, err)
+	assert.Len(t, added, 1)
+
+	// the ETag tells the collection is unchanged
+	added, changed, removed, err := fb.DiffSince(nil)
+	require.NoError(t, err)
+	assert.Empty(t, added)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&reqs))
+}
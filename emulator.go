@@ -0,0 +1,41 @@
+package firego
+
+import (
+	_url "net/url"
+	"strings"
+)
+
+const (
+	namespaceParam = "ns"
+	emulatorOwner  = "owner"
+)
+
+// WithEmulator points the reference at the Firebase Realtime Database
+// Emulator listening on host, e.g. "localhost:9000". The emulator differs
+// from production in the following ways:
+//
+//   - requests are made over plain HTTP to host, the path of the URL given
+//     to New is kept but its host is only used to infer the namespace
+//   - the database is selected with the ns query parameter instead of the
+//     host, if namespace is empty the first label of the host given to New
+//     is used, e.g. "my-db" for https://my-db.firebaseio.com
+//   - requests are authenticated as the emulator's owner, which bypasses
+//     security rules, until Auth, AuthWithToken, AuthWithTokenSource or
+//     Unauth is called
+//
+// Reference https://firebase.google.com/docs/emulator-suite/connect_rtdb#rest
+func WithEmulator(host string, namespace string) Option {
+	return func(fb *firebase) {
+		u, err := _url.Parse(fb.url)
+		if err != nil {
+			return
+		}
+		if namespace == "" {
+			namespace = strings.SplitN(u.Host, ".", 2)[0]
+		}
+
+		fb.url = sanitizeURL("http://" + strings.TrimRight(host, "/") + u.Path)
+		fb.params.Set(namespaceParam, namespace)
+		fb.emulatorOwner = true
+	}
+}
@@ -0,0 +1,50 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithEmulator(t *testing.T) {
+	t.Parallel()
+	var req *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		w.Write([]byte("true"))
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	fb := New("https://my-db.firebaseio.com/users", nil, WithEmulator(host, ""))
+	assert.Equal(t, "http://"+host+"/users/.json?ns=my-db", fb.String())
+
+	var v bool
+	require.NoError(t, fb.Child("bob").Value(&v))
+	assert.Equal(t, "/users/bob/.json", req.URL.Path)
+	assert.Equal(t, "my-db", req.URL.Query().Get("ns"))
+	assert.Equal(t, "Bearer owner", req.Header.Get("Authorization"))
+
+	fb.Unauth()
+	require.NoError(t, fb.Value(&v))
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Equal(t, "my-db", req.URL.Query().Get("ns"))
+
+	fb.Auth("token")
+	require.NoError(t, fb.Value(&v))
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Equal(t, "token", req.URL.Query().Get("auth"))
+}
+
+func TestWithEmulatorNamespace(t *testing.T) {
+	t.Parallel()
+	fb := New("https://my-db.firebaseio.com", nil, WithEmulator("localhost:9000", "other"))
+	assert.Equal(t, "http://localhost:9000/.json?ns=other", fb.String())
+
+	ref, err := fb.Ref("users")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000/users/.json?ns=other", ref.String())
+}
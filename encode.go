@@ -0,0 +1,120 @@
+package firego
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+var (
+	marshalerType       = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// marshalPayload serializes the value given to a write.
+func marshalPayload(v interface{}) ([]byte, error) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	return bytes, nil
+}
+
+// marshalPayload serializes the value given to a write, converting epoch
+// times if the reference was created with WithEpochTimes, naming fields
+// after the tag set with WithTagName and formatting floats as set with
+// WithFloatFormat.
+func (fb *firebase) marshalPayload(v interface{}) ([]byte, error) {
+	b, err := marshalPayload(v)
+	if err != nil || (fb.epochUnit == 0 && fb.floatFormat == nil && fb.tagName == "") {
+		return b, err
+	}
+
+	tree, err := decodeTree(b)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	if fb.epochUnit != 0 {
+		tree = fb.timesToEpoch(tree, v)
+	}
+	if fb.tagName != "" {
+		tree = renameFields(tree, nil, reflect.ValueOf(v), fb.tagName, true)
+	}
+	if fb.floatFormat != nil {
+		tree = fb.floatFormat.apply(tree)
+	}
+	if b, err = json.Marshal(tree); err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	return b, nil
+}
+
+// decodeTree decodes data into an interface{}, keeping numbers as
+// json.Number so that they are encoded back unchanged.
+func decodeTree(data []byte) (interface{}, error) {
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err := dec.Decode(&tree)
+	return tree, err
+}
+
+type jsonField struct {
+	typ   reflect.Type
+	index []int
+}
+
+// jsonFields returns the fields of the struct type t by the name
+// encoding/json uses for them, including the promoted fields of embedded
+// structs.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, promoted := range jsonFields(ft) {
+				if _, ok := fields[k]; !ok {
+					promoted.index = append([]int{i}, promoted.index...)
+					fields[k] = promoted
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = jsonField{typ: f.Type, index: []int{i}}
+	}
+	return fields
+}
+
+// fieldByName finds the field a key is decoded into, encoding/json
+// matches keys to field names case-insensitively.
+func fieldByName(fields map[string]jsonField, key string) (jsonField, bool) {
+	if f, ok := fields[key]; ok {
+		return f, true
+	}
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
@@ -0,0 +1,143 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// WithEpochTimes makes the reference store time.Time values as the number
+// of units elapsed since the Unix epoch, the way Firebase stores its own
+// timestamps, instead of as RFC 3339 strings. unit is typically
+// time.Millisecond, which matches ServerTimestamp, or time.Second.
+//
+// Writes convert the time.Time fields of the value written to numbers and
+// Value converts the numbers read into time.Time fields back, strings are
+// still decoded as RFC 3339 times. Only fields whose Go type is time.Time or
+// *time.Time are converted, values decoded into an interface{} are left as
+// numbers, and types implementing their own JSON encoding are left to it.
+// A unit of 0, the default, disables the conversion.
+func WithEpochTimes(unit time.Duration) Option {
+	return func(fb *firebase) {
+		fb.epochUnit = unit
+	}
+}
+
+// timesToEpoch replaces the RFC 3339 strings of tree, encoded from v, that
+// encoding/json encoded time.Time fields to with epoch numbers.
+func (fb *firebase) timesToEpoch(tree interface{}, v interface{}) interface{} {
+	return convertTimes(tree, nil, reflect.ValueOf(v), func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return v
+		}
+		return t.UnixNano() / int64(fb.epochUnit)
+	})
+}
+
+// epochToTimes rewrites the epoch numbers found in data where v holds
+// time.Time fields into the RFC 3339 strings encoding/json decodes them from.
+func (fb *firebase) epochToTimes(data []byte, v interface{}) ([]byte, error) {
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, err
+	}
+	tree = convertTimes(tree, reflect.TypeOf(v), reflect.Value{}, func(v interface{}) interface{} {
+		n, ok := v.(json.Number)
+		if !ok {
+			return v
+		}
+		var nsec int64
+		if i, err := n.Int64(); err == nil {
+			nsec = i * int64(fb.epochUnit)
+		} else if f, err := n.Float64(); err == nil {
+			nsec = int64(f * float64(fb.epochUnit))
+		} else {
+			return v
+		}
+		return time.Unix(0, nsec).UTC().Format(time.RFC3339Nano)
+	})
+	return json.Marshal(tree)
+}
+
+// convertTimes replaces the values of tree that are, or are decoded into,
+// a time.Time with the result of convert. The Go type of tree is t, or
+// the type of v when v is valid, which allows following the values held
+// in interfaces when tree was encoded from v.
+func convertTimes(tree interface{}, t reflect.Type, v reflect.Value, convert func(interface{}) interface{}) interface{} {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			t, v = v.Type(), reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() {
+		t = v.Type()
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == nil:
+		return tree
+	case t == timeType:
+		return convert(tree)
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType):
+		// the type decides how it is encoded
+		return tree
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return tree
+		}
+		fields := jsonFields(t)
+		for k, child := range obj {
+			field, ok := fieldByName(fields, k)
+			if !ok {
+				continue
+			}
+			var fv reflect.Value
+			if v.IsValid() {
+				// an error leaves fv invalid, for a nil embedded pointer
+				fv, _ = v.FieldByIndexErr(field.index)
+			}
+			obj[k] = convertTimes(child, field.typ, fv, convert)
+		}
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return tree
+		}
+		for k, child := range obj {
+			var ev reflect.Value
+			if v.IsValid() && t.Key().Kind() == reflect.String {
+				ev = v.MapIndex(reflect.ValueOf(k).Convert(t.Key()))
+			}
+			obj[k] = convertTimes(child, t.Elem(), ev, convert)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return tree
+		}
+		for i, child := range arr {
+			var ev reflect.Value
+			if v.IsValid() && i < v.Len() {
+				ev = v.Index(i)
+			}
+			arr[i] = convertTimes(child, t.Elem(), ev, convert)
+		}
+	}
+	return tree
+}
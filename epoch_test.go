@@ -0,0 +1,103 @@
+package firego
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+type epochBase struct {
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type epochRecord struct {
+	epochBase
+	Name      string               `json:"name"`
+	UpdatedAt *time.Time           `json:"updatedAt,omitempty"`
+	History   []time.Time          `json:"history"`
+	ByUser    map[string]time.Time `json:"byUser"`
+	Raw       json.RawMessage      `json:"raw,omitempty"`
+	Count     int64                `json:"count"`
+}
+
+func TestEpochTimesWrite(t *testing.T) {
+	t.Parallel()
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ = ioutil.ReadAll(req.Body)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	created := time.Unix(1600000000, 123456789)
+	updated := created.Add(time.Second)
+	fb := New(server.URL, http.DefaultClient, WithEpochTimes(time.Millisecond))
+
+	require.NoError(t, fb.Set(epochRecord{
+		epochBase: epochBase{CreatedAt: created},
+		Name:      "2020-09-13T12:26:40Z",
+		UpdatedAt: &updated,
+		History:   []time.Time{created},
+		ByUser:    map[string]time.Time{"bob": updated},
+		Count:     9007199254740993,
+	}))
+	assert.JSONEq(t, `{
+		"createdAt": 1600000000123,
+		"name": "2020-09-13T12:26:40Z",
+		"updatedAt": 1600000001123,
+		"history": [1600000000123],
+		"byUser": {"bob": 1600000001123},
+		"count": 9007199254740993
+	}`, string(body))
+	assert.Contains(t, string(body), "9007199254740993")
+
+	// times held in interfaces are converted too
+	require.NoError(t, fb.Update(map[string]interface{}{"at": created, "name": "x"}))
+	assert.JSONEq(t, `{"at": 1600000000123, "name": "x"}`, string(body))
+
+	// unless the conversion is off
+	require.NoError(t, New(server.URL, http.DefaultClient).Set(map[string]interface{}{"at": created.UTC()}))
+	assert.JSONEq(t, `{"at": "2020-09-13T12:26:40.123456789Z"}`, string(body))
+}
+
+func TestEpochTimesRead(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("record", map[string]interface{}{
+		"createdAt": 1600000000,
+		"updatedAt": "2020-09-13T12:26:41Z",
+		"history":   []interface{}{1600000000.5},
+		"byUser":    map[string]interface{}{"bob": 1600000001},
+		"count":     42,
+	})
+
+	fb := New(server.URL, nil, WithEpochTimes(time.Second)).Child("record")
+	var r epochRecord
+	require.NoError(t, fb.Value(&r))
+
+	assert.True(t, time.Unix(1600000000, 0).Equal(r.CreatedAt), r.CreatedAt.String())
+	require.NotNil(t, r.UpdatedAt)
+	assert.True(t, time.Unix(1600000001, 0).Equal(*r.UpdatedAt), r.UpdatedAt.String())
+	require.Len(t, r.History, 1)
+	assert.True(t, time.Unix(1600000000, 5e8).Equal(r.History[0]), r.History[0].String())
+	assert.True(t, time.Unix(1600000001, 0).Equal(r.ByUser["bob"]))
+	assert.Equal(t, int64(42), r.Count)
+
+	// values decoded into an interface are left as numbers
+	var m map[string]interface{}
+	require.NoError(t, fb.Value(&m))
+	assert.Equal(t, 1600000000.0, m["createdAt"])
+
+	// without the option the numbers can not be decoded into times
+	assert.Error(t, New(server.URL, nil).Child("record").Value(&r))
+}
@@ -5,11 +5,44 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/zabawaba99/firego/sync"
 )
 
+// ErrMaxReconnects is the error a watch reconnecting on its own gives up
+// with after the number of reconnect attempts set with WithMaxReconnects.
+// GetAndWatch, and Watch with WithWatchReconnect, pass it over in a last
+// error event before closing their chan, wrapping the error the last
+// connection failed with, which errors.Is and errors.As find both. The
+// event functions set with ChildAdded, ChildChanged and ChildRemoved,
+// which have no chan, are removed and log it instead.
+var ErrMaxReconnects = errors.New("maximum reconnect attempts exceeded")
+
+// maxReconnectsError is the ErrMaxReconnects a watch gives up with, err
+// being the error its last connection failed with.
+type maxReconnectsError struct {
+	err error
+}
+
+func (e maxReconnectsError) Error() string {
+	if e.err == nil {
+		return ErrMaxReconnects.Error()
+	}
+	return ErrMaxReconnects.Error() + ": " + e.err.Error()
+}
+
+// Is reports whether target is ErrMaxReconnects.
+func (e maxReconnectsError) Is(target error) bool {
+	return target == ErrMaxReconnects
+}
+
+// Unwrap returns the error the last connection failed with.
+func (e maxReconnectsError) Unwrap() error {
+	return e.err
+}
+
 // ChildEventFunc is the type of function that is called for every
 // new child added under a firebase reference. The snapshot argument
 // contains the data that was added. The previousChildKey argument
@@ -128,14 +161,14 @@ func (fn ChildEventFunc) childChanged(db *sync.Database, prevKey *string, notifi
 					continue
 				}
 
-				db.Update(newPath, node)
+				db.Add(newPath, node)
 				fn(newSnapshot(node), *prevKey)
 				*prevKey = k
 			}
 			continue
 		}
 
-		db.Update(path, node)
+		db.Add(path, node)
 		fn(newSnapshot(db.Get(child)), *prevKey)
 		*prevKey = child
 	}
@@ -172,12 +205,6 @@ func (fn ChildEventFunc) childRemoved(db *sync.Database, prevKey *string, notifi
 
 		path := strings.Trim(event.Path, "/")
 		node := sync.NewNode(path, event.Data)
-
-		if event.Type == EventTypePatch {
-			db.Update(path, node)
-			continue
-		}
-
 		if event.Data != nil {
 			db.Add(path, node)
 			continue
@@ -206,9 +233,19 @@ func (fn ChildEventFunc) childRemoved(db *sync.Database, prevKey *string, notifi
 			continue
 		}
 
-		node = db.Get(path)
-		fn(newSnapshot(node), "")
+		child := strings.Split(path, "/")[0]
+		node = db.Get(child)
+		if node == nil {
+			// nothing to remove
+			continue
+		}
+		snapshot := newSnapshot(node)
 		db.Del(path)
+		if db.Get(child) == nil {
+			// only the removal of the child itself, or of the last
+			// value under it, removes the child
+			fn(snapshot, "")
+		}
 	}
 	return nil
 }
@@ -226,48 +263,100 @@ func (fb *firebase) addEventFunc(fn ChildEventFunc, handleSSE handleSSEFunc) err
 	}
 
 	fb.eventFuncs[key] = stop
-	notifications, err := fb.watch(stop)
+	conn := &connState{}
+	ctx := withConnState(fb.baseContext(), conn)
+	notifications, err := fb.watch(ctx, stop, false)
 	if err != nil {
 		return err
 	}
 
 	db := sync.NewDB()
 	prevKey := new(string)
-	var run func(notifications chan Event, backoff time.Duration)
-	run = func(notifications chan Event, backoff time.Duration) {
+	removed := func() bool {
+		fb.eventMtx.Lock()
+		defer fb.eventMtx.Unlock()
+		_, ok := fb.eventFuncs[key]
+		return !ok
+	}
+
+	w := fb.watchers.register(fb.Path(), conn, func() {
+		fb.eventMtx.Lock()
+		defer fb.eventMtx.Unlock()
+		if s, ok := fb.eventFuncs[key]; ok && s == stop {
+			delete(fb.eventFuncs, key)
+			close(stop)
+		}
+	})
+
+	// giveUp removes the func, logging why its stream was closed
+	giveUp := func(err error) {
 		fb.eventMtx.Lock()
-		if _, ok := fb.eventFuncs[key]; !ok {
-			fb.eventMtx.Unlock()
+		if stop, ok := fb.eventFuncs[key]; ok {
+			delete(fb.eventFuncs, key)
+			close(stop)
+		}
+		fb.eventMtx.Unlock()
+		fb.logStream(LogLevelError, StreamEvent{Type: StreamClosed, Err: err})
+	}
+
+	backoff := fb.reconnectBackoff()
+	var run func(notifications chan Event, failures int)
+	run = func(notifications chan Event, failures int) {
+		if removed() {
 			// the func has been removed
 			return
 		}
-		fb.eventMtx.Unlock()
 
-		if err := handleSSE(db, prevKey, notifications); err == nil {
+		var received int64
+		done := make(chan struct{})
+		err := handleSSE(db, prevKey, expandPatches(notifications, done, func(e Event) {
+			atomic.AddInt64(&received, 1)
+			w.received(e)
+		}))
+		close(done)
+		if err == nil {
 			// we returned gracefully
 			return
 		}
-
-		// give firebase some time
-		backoff *= 2
-		time.Sleep(backoff)
+		if atomic.LoadInt64(&received) > 0 && failures > 0 {
+			// the last reconnect worked
+			failures = 0
+			backoff.Reset()
+		}
 
 		// try and reconnect
-		for notifications, err = fb.watch(stop); err != nil; time.Sleep(backoff) {
-			fb.eventMtx.Lock()
-			if _, ok := fb.eventFuncs[key]; !ok {
-				fb.eventMtx.Unlock()
+		for {
+			if fb.maxReconnects > 0 && failures >= fb.maxReconnects {
+				giveUp(maxReconnectsError{err})
+				return
+			}
+			// give firebase some time
+			fb.logStream(LogLevelInfo, StreamEvent{Type: StreamReconnecting})
+			time.Sleep(backoff.NextDelay(failures))
+			failures++
+
+			if removed() {
 				// func has been removed
 				return
 			}
-			fb.eventMtx.Unlock()
+			if notifications, err = fb.watch(ctx, stop, false); err == nil {
+				break
+			}
+			if isDatabaseUnavailable(err) {
+				// reconnecting would never work
+				giveUp(err)
+				return
+			}
 		}
 
 		// give this another shot
-		run(notifications, backoff)
+		run(notifications, failures)
 	}
 
-	go run(notifications, fb.watchHeartbeat)
+	go func() {
+		run(notifications, 0)
+		fb.watchers.unregister(w)
+	}()
 	return nil
 }
 
@@ -287,6 +376,50 @@ func (fb *firebase) RemoveEventFunc(fn ChildEventFunc) {
 	close(stop)
 }
 
+// expandPatches passes the events received on notifications over to the
+// returned chan until done is closed, turning every patch event into a put
+// event per value it sets so that the handlers only have to deal with the
+// replace semantics of puts. The events other than errors are passed to
+// received as they arrive.
+func expandPatches(notifications chan Event, done chan struct{}, received func(Event)) chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for e := range notifications {
+			if e.Type != EventTypeError {
+				received(e)
+			}
+			for _, event := range expandPatch(e) {
+				select {
+				case events <- event:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// expandPatch returns the put events, in key order, equivalent to a patch
+// event. Other events are returned as they are.
+func expandPatch(event Event) []Event {
+	if event.Type != EventTypePatch {
+		return []Event{event}
+	}
+
+	data, _ := event.Data.(map[string]interface{})
+	events := make([]Event, 0, len(data))
+	for _, k := range sortedKeys(data) {
+		events = append(events, Event{
+			Type: EventTypePut,
+			Path: "/" + strings.Trim(joinPath(event.Path, k), "/"),
+			Data: data[k],
+		})
+	}
+	return events
+}
+
 func sortedKeys(m map[string]interface{}) []string {
 	orderedKeys := make([]string, len(m))
 	var i int
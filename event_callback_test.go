@@ -1,6 +1,7 @@
 package firego
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -104,6 +105,43 @@ func TestChildAddedReconnect(t *testing.T) {
 	}
 }
 
+func TestMaxReconnects(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			// the database is gone
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l), WithMaxReconnects(2))
+	fb.(*firebase).watchHeartbeat = time.Millisecond
+
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, fb.ChildAdded(fn))
+	defer fb.RemoveEventFunc(fn)
+
+	assert.Eventually(t, func() bool {
+		for _, e := range l.streamEvents() {
+			if e.event.Type == StreamClosed && errors.Is(e.event.Err, ErrMaxReconnects) {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	fb.(*firebase).eventMtx.Lock()
+	assert.Empty(t, fb.(*firebase).eventFuncs)
+	fb.(*firebase).eventMtx.Unlock()
+}
+
 func TestChildAdded(t *testing.T) {
 	server := firetest.New()
 	server.Start()
@@ -294,6 +332,58 @@ func TestChildChanged(t *testing.T) {
 	}
 }
 
+func TestExpandPatch(t *testing.T) {
+	t.Parallel()
+	put := Event{Type: EventTypePut, Path: "/users/42", Data: "a"}
+	assert.Equal(t, []Event{put}, expandPatch(put))
+
+	patch := Event{Type: EventTypePatch, Path: "/users", Data: map[string]interface{}{"43": nil, "42/name": "b"}}
+	assert.Equal(t, []Event{
+		{Type: EventTypePut, Path: "/users/42/name", Data: "b"},
+		{Type: EventTypePut, Path: "/users/43", Data: nil},
+	}, expandPatch(patch))
+
+	patch = Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"a": 1.0}}
+	assert.Equal(t, []Event{{Type: EventTypePut, Path: "/a", Data: 1.0}}, expandPatch(patch))
+}
+
+func TestChildChangedPatch(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users/42", map[string]interface{}{"name": "a", "age": 1})
+	fb := New(server.URL, nil)
+
+	changed := make(chan DataSnapshot)
+	fn := func(snapshot DataSnapshot, previousChildKey string) {
+		changed <- snapshot
+	}
+	require.NoError(t, fb.ChildChanged(fn))
+	defer fb.RemoveEventFunc(fn)
+
+	next := func() DataSnapshot {
+		select {
+		case snapshot := <-changed:
+			return snapshot
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive a change")
+		}
+		return DataSnapshot{}
+	}
+
+	// the patch is merged into the existing user
+	require.NoError(t, fb.Child("users/42").Update(map[string]interface{}{"name": "b"}))
+	snapshot := next()
+	assert.Equal(t, "users", snapshot.Key)
+	assert.Equal(t, map[string]interface{}{"42": map[string]interface{}{"name": "b", "age": 1.0}}, snapshot.Value)
+
+	// while a put replaces it
+	require.NoError(t, fb.Child("users/42").Set(map[string]interface{}{"name": "c"}))
+	snapshot = next()
+	assert.Equal(t, map[string]interface{}{"42": map[string]interface{}{"name": "c"}}, snapshot.Value)
+}
+
 func TestChildRemoved(t *testing.T) {
 	server := firetest.New()
 	server.Start()
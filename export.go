@@ -0,0 +1,348 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	priorityKey = ".priority"
+	valueKey    = ".value"
+)
+
+// ExportedValue is a node read in the export format, which carries the
+// priority of the node and of every one of its descendants. In that
+// format objects have their priority under a ".priority" key next to
+// their children, and primitives with a priority are wrapped in an object
+// holding the primitive under ".value" and its priority under ".priority":
+//
+//	{
+//	  ".priority": 1,
+//	  "name": {".value": "alice", ".priority": "a"},
+//	  "age": 30
+//	}
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-format
+type ExportedValue struct {
+	// Value is the primitive value of the node, nil for objects.
+	Value interface{}
+	// Priority of the node, a string, a number or nil.
+	Priority interface{}
+	// Children of the node keyed by name, nil for primitives.
+	Children map[string]*ExportedValue
+}
+
+// UnmarshalJSON decodes a node in the export format.
+func (e *ExportedValue) UnmarshalJSON(b []byte) error {
+	*e = ExportedValue{}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return json.Unmarshal(b, &e.Value)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	if p, ok := obj[priorityKey]; ok {
+		if err := json.Unmarshal(p, &e.Priority); err != nil {
+			return err
+		}
+		delete(obj, priorityKey)
+	}
+	if v, ok := obj[valueKey]; ok {
+		return json.Unmarshal(v, &e.Value)
+	}
+
+	e.Children = make(map[string]*ExportedValue, len(obj))
+	for k, raw := range obj {
+		child := &ExportedValue{}
+		if err := child.UnmarshalJSON(raw); err != nil {
+			return err
+		}
+		e.Children[k] = child
+	}
+	return nil
+}
+
+// MarshalJSON encodes the node in the export format it was decoded from,
+// so that writing it back with ImportValue restores the priorities it
+// holds.
+func (e ExportedValue) MarshalJSON() ([]byte, error) {
+	if e.Children != nil {
+		obj := make(map[string]interface{}, len(e.Children)+1)
+		for k, child := range e.Children {
+			obj[k] = child
+		}
+		if e.Priority != nil {
+			obj[priorityKey] = e.Priority
+		}
+		return json.Marshal(obj)
+	}
+	if e.Priority != nil {
+		return json.Marshal(map[string]interface{}{valueKey: e.Value, priorityKey: e.Priority})
+	}
+	return json.Marshal(e.Value)
+}
+
+// ExportValue gets the value of the Firebase reference in the export
+// format, which includes the priorities of the node and its descendants.
+// v can be an *ExportedValue to get the priorities decoded alongside the
+// values, or anything Value accepts to decode the format as is.
+func (fb *firebase) ExportValue(v interface{}) error {
+	c := fb.copy()
+	c.IncludePriority(true)
+	c.lastBody, c.lastETag = fb.lastBody, fb.lastETag
+	return c.Value(v)
+}
+
+// ExportTo writes the value of the Firebase reference in the export format,
+// the JSON document ExportValue reads, to w as it is received, without
+// holding it in memory, which makes it fit for backing up large subtrees
+// to a file or an upload. The export is aborted once the context of the
+// reference, set with WithContext, is done.
+//
+// An export that fails leaves what was received so far written to w, which
+// is not a valid document; the export has to be made again from the start.
+func (fb *firebase) ExportTo(w io.Writer) error {
+	c := fb.copy()
+	c.IncludePriority(true)
+	c.lastETag = fb.lastETag
+	return c.readStream(context.Background(), func(ctx context.Context, body io.Reader) error {
+		_, err := io.Copy(w, body)
+		return err
+	})
+}
+
+// ImportValue sets the value of the Firebase reference to v, a value in the
+// export format as read by ExportValue, such as an *ExportedValue or the
+// interface{} ExportValue decoded the format into, restoring the
+// priorities it holds along with the values. v is encoded with
+// encoding/json as is, without the conversions, such as those of
+// WithTagName or WithEpochTimes, applied to the values written by Set.
+//
+// A value exported and imported this way reproduces the exported tree:
+// its values, its priorities, and its arrays, which Firebase keeps as
+// objects keyed by index and reads back as arrays either way, are kept.
+// Numbers are decoded by ExportValue as float64, the doubles Firebase
+// stores.
+func (fb *firebase) ImportValue(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ErrInvalidPayload{err}
+	}
+	return fb.SetJSON(bytes.NewReader(b))
+}
+
+// ImportFrom sets the value of the Firebase reference to the document in
+// the export format read from r, as written by ExportTo, restoring the
+// priorities it holds along with the values. The document is streamed to
+// Firebase as it is read the way SetJSON streams it.
+func (fb *firebase) ImportFrom(r io.Reader) error {
+	return fb.SetJSON(r)
+}
+
+// ExportEach reads the value of the reference in the export format, like
+// ExportValue does, pageSize children at a time, ordered by key, calling
+// fn with the key and the exported value of every child in turn, for trees
+// too large to be read, or held in memory, whole: only a page is held at a
+// time, and a page that fails is retried on its own, the way
+// ValueResumable reads pages. fn is also called with the ".priority" key
+// for the priority of the reference itself, if any, and a reference
+// holding a single value, rather than children, has it passed to fn with
+// an empty key. The export stops at the first error fn returns, which
+// ExportEach returns.
+//
+// Like ValueResumable, the export is not a snapshot: the changes made
+// while the pages are read are only seen for the children not read yet.
+func (fb *firebase) ExportEach(pageSize int, fn func(key string, value json.RawMessage) error) error {
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	pages := fb.resumablePages(pageSize)
+	pages.IncludePriority(true)
+
+	page := pages
+	for {
+		body, err := page.doRequest(context.Background(), "GET", nil)
+		if err != nil {
+			return err
+		}
+		var read map[string]json.RawMessage
+		if err := json.Unmarshal(body, &read); err != nil || read == nil {
+			if page != pages {
+				return err
+			}
+			if string(bytes.TrimSpace(body)) == "null" {
+				return nil
+			}
+			// the node is a single value
+			return fn("", bytes.TrimSpace(body))
+		}
+		if _, ok := read[valueKey]; ok && page == pages {
+			// the node is a single value with a priority
+			return fn("", bytes.TrimSpace(body))
+		}
+
+		keys := make(map[string]interface{}, len(read))
+		for key := range read {
+			if !strings.HasPrefix(key, ".") {
+				keys[key] = nil
+			}
+		}
+		if v, ok := read[priorityKey]; ok && page == pages {
+			if err := fn(priorityKey, v); err != nil {
+				return err
+			}
+		}
+		ordered := orderChildren(keys, "$key")
+		for _, key := range ordered {
+			if err := fn(key, read[key]); err != nil {
+				return err
+			}
+		}
+		if len(ordered) < pageSize {
+			return nil
+		}
+		page = pages.StartAfter(ordered[len(ordered)-1]).(*firebase)
+	}
+}
+
+// ExportPaged writes the value of the reference in the export format to
+// w, the document ExportTo writes, reading it pageSize children at a time
+// with ExportEach instead of in a single request, so that backing up a
+// tree too large to be read before the request times out only holds a page
+// in memory and only retries the pages that failed. The document is
+// written as the pages are read, an export that fails leaves what was
+// written so far, which is not a valid document.
+func (fb *firebase) ExportPaged(w io.Writer, pageSize int) error {
+	var written, single bool
+	err := fb.ExportEach(pageSize, func(key string, value json.RawMessage) error {
+		if key == "" {
+			single = true
+			_, err := w.Write(value)
+			return err
+		}
+
+		sep := ","
+		if !written {
+			sep, written = "{", true
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s%s:%s", sep, k, value)
+		return err
+	})
+	if err != nil || single {
+		return err
+	}
+
+	end := "}"
+	if !written {
+		end = "null"
+	}
+	_, err = io.WriteString(w, end)
+	return err
+}
+
+// ImportBatched restores the document in the export format read from r,
+// as written by ExportTo or ExportPaged, under the reference, for backups
+// too large to be written in a single request: the children of the
+// document are read one at a time with a streaming decoder and written
+// with BulkImportStream, batchSize children per update, so that neither
+// the document nor the write are held in memory whole. The priority of the
+// reference, if the document holds one, is written last.
+//
+// Unlike ImportFrom, the children of the reference missing from the
+// document are kept, and the import is not atomic: when an error is
+// returned the batches already written stay written. Remove the reference
+// first to restore it exactly. A document holding a single value, rather
+// than children, is written with a single Set.
+func (fb *firebase) ImportBatched(r io.Reader, batchSize int) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return ErrInvalidPayload{err}
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		// a single value
+		b, err := json.Marshal(tok)
+		if err != nil {
+			return ErrInvalidPayload{err}
+		}
+		return fb.SetJSON(bytes.NewReader(b))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := make(chan ImportItem)
+	done := make(chan struct{})
+	var importErr error
+	go func() {
+		defer close(done)
+		importErr = fb.BulkImportStream(ctx, items, batchSize, nil)
+	}()
+
+	special := map[string]interface{}{}
+	err = decodeImportItems(dec, delim, items, done, special)
+	close(items)
+	if err != nil {
+		cancel()
+	}
+	<-done
+	switch {
+	case err != nil:
+		return err
+	case importErr != nil:
+		return importErr
+	case special[valueKey] != nil:
+		// a single value with a priority
+		return fb.ImportValue(special)
+	case len(special) > 0:
+		return fb.Update(special)
+	}
+	return nil
+}
+
+// decodeImportItems sends the children of the object or array opened with
+// delim, and decoded from dec, to items until done is closed. The
+// children with a special key, such as ".priority", are added to special
+// instead.
+func decodeImportItems(dec *json.Decoder, delim json.Delim, items chan<- ImportItem, done <-chan struct{}, special map[string]interface{}) error {
+	for i := 0; dec.More(); i++ {
+		key := strconv.Itoa(i)
+		if delim == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return ErrInvalidPayload{err}
+			}
+			key, _ = tok.(string)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return ErrInvalidPayload{err}
+		}
+
+		if strings.HasPrefix(key, ".") {
+			special[key] = value
+			continue
+		}
+		select {
+		case items <- ImportItem{Key: key, Value: value}:
+		case <-done:
+			return nil
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return ErrInvalidPayload{err}
+	}
+	return nil
+}
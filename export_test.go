@@ -0,0 +1,223 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestExportedValueUnmarshal(t *testing.T) {
+	t.Parallel()
+	var v ExportedValue
+	err := json.Unmarshal([]byte(`{
+		".priority": 1,
+		"name": {".value": "alice", ".priority": "a"},
+		"age": 30,
+		"tags": {"go": true}
+	}`), &v)
+	require.NoError(t, err)
+
+	assert.Equal(t, ExportedValue{
+		Priority: 1.0,
+		Children: map[string]*ExportedValue{
+			"name": {Value: "alice", Priority: "a"},
+			"age":  {Value: 30.0},
+			"tags": {Children: map[string]*ExportedValue{"go": {Value: true}}},
+		},
+	}, v)
+}
+
+func TestExportValue(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{
+		".priority": 2,
+		"name":      map[string]interface{}{".value": "alice", ".priority": "a"},
+	})
+
+	fb := New(server.URL, nil).Child("users/alice")
+
+	var exported ExportedValue
+	require.NoError(t, fb.ExportValue(&exported))
+	assert.Equal(t, 2.0, exported.Priority)
+	assert.Equal(t, &ExportedValue{Value: "alice", Priority: "a"}, exported.Children["name"])
+
+	var plain map[string]interface{}
+	require.NoError(t, fb.Value(&plain))
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, plain)
+	assert.Empty(t, fb.(*firebase).params)
+}
+
+func TestExportToImportFrom(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	backup := map[string]interface{}{
+		".priority": 2.0,
+		"name":      map[string]interface{}{".value": "alice", ".priority": "a"},
+		"age":       30.0,
+	}
+	server.Set("users/alice", backup)
+
+	fb := New(server.URL, nil)
+	var buf bytes.Buffer
+	require.NoError(t, fb.Child("users/alice").ExportTo(&buf))
+
+	var exported map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &exported))
+	assert.Equal(t, backup, exported)
+
+	require.NoError(t, fb.Child("restored").ImportFrom(&buf))
+	assert.Equal(t, backup, server.Get("restored"))
+}
+
+func TestExportValueImportValue(t *testing.T) {
+	t.Parallel()
+	source := firetest.New()
+	source.Start()
+	defer source.Close()
+	tree := map[string]interface{}{
+		".priority": 1.0,
+		"name":      map[string]interface{}{".value": "alice", ".priority": "a"},
+		"tags":      []interface{}{"go", "rest"},
+		"scores":    []interface{}{map[string]interface{}{".value": 10.0, ".priority": 2.0}, 7.5},
+		"nested": map[string]interface{}{
+			"deep":  map[string]interface{}{".priority": "p", "flag": false, "list": []interface{}{0.0, "x"}},
+			"empty": "",
+		},
+	}
+	source.Set("users/alice", tree)
+	fb := New(source.URL+"/users/alice", nil)
+
+	for name, exported := range map[string]interface{}{
+		"ExportedValue": &ExportedValue{},
+		"interface":     new(interface{}),
+	} {
+		require.NoError(t, fb.ExportValue(exported), name)
+
+		target := firetest.New()
+		target.Start()
+		restored := New(target.URL+"/restored", nil)
+		require.NoError(t, restored.ImportValue(exported), name)
+
+		// the exact tree, priorities and arrays included
+		assert.Equal(t, source.Get("users/alice"), target.Get("restored"), name)
+
+		var before, after interface{}
+		require.NoError(t, fb.Value(&before), name)
+		require.NoError(t, restored.Value(&after), name)
+		target.Close()
+		assert.Equal(t, before, after, name)
+		assert.IsType(t, []interface{}{}, after.(map[string]interface{})["tags"], name)
+	}
+}
+
+func TestExportedValueMarshal(t *testing.T) {
+	t.Parallel()
+	doc := `{".priority":1,"name":{".value":"alice",".priority":"a"},"age":30,"tags":["a",{".value":"b",".priority":2}],"none":null}`
+	var v ExportedValue
+	require.NoError(t, json.Unmarshal([]byte(doc), &v))
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, doc, string(b))
+}
+
+func TestExportToCanceled(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "export", req.URL.Query().Get("format"))
+		w.Write([]byte(`{"a":`))
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	done := make(chan error)
+	go func() { done <- New(server.URL, nil).WithContext(ctx).ExportTo(&buf) }()
+	cancel()
+	assert.Error(t, <-done)
+}
+
+func TestExportPagedImportBatched(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	backup := map[string]interface{}{
+		".priority": 2.0,
+		"name":      map[string]interface{}{".value": "alice", ".priority": "a"},
+		"age":       30.0,
+		"tags":      map[string]interface{}{"go": true, "js": false},
+		"a":         "first",
+		"z":         "last",
+	}
+	server.Set("users/alice", backup)
+	fb := New(server.URL, nil)
+
+	var keys []string
+	require.NoError(t, fb.Child("users/alice").ExportEach(2, func(key string, value json.RawMessage) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{".priority", "a", "age", "name", "tags", "z"}, keys)
+
+	var buf bytes.Buffer
+	require.NoError(t, fb.Child("users/alice").ExportPaged(&buf, 2))
+	var exported map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &exported), buf.String())
+	assert.Equal(t, backup, exported)
+
+	server.Set("restored/kept", true)
+	require.NoError(t, fb.Child("restored").ImportBatched(&buf, 2))
+	restored := server.Get("restored").(map[string]interface{})
+	assert.Equal(t, true, restored["kept"])
+	delete(restored, "kept")
+	assert.Equal(t, backup, restored)
+
+	// single values, arrays and missing values
+	for _, test := range []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"value", "alice", `"alice"`},
+		{"value with priority", map[string]interface{}{".value": 1.0, ".priority": 2.0}, `{".priority":2,".value":1}`},
+		{"missing", nil, `null`},
+		{"array", []interface{}{"a", "b"}, `["a","b"]`},
+	} {
+		ref := fb.Child("single")
+		server.Set("single", test.value)
+		buf.Reset()
+		require.NoError(t, ref.ExportPaged(&buf, 1), test.name)
+		assert.JSONEq(t, test.want, buf.String(), test.name)
+
+		server.Delete("single")
+		require.NoError(t, ref.ImportBatched(&buf, 1), test.name)
+		var got json.RawMessage
+		require.NoError(t, ref.ExportValue(&got), test.name)
+		if test.name == "array" {
+			// the test server reads arrays back as objects
+			test.want = `{"0":"a","1":"b"}`
+		}
+		assert.JSONEq(t, test.want, string(got), test.name)
+	}
+
+	stop := errors.New("stop")
+	assert.Equal(t, stop, fb.Child("users/alice").ExportEach(1, func(string, json.RawMessage) error { return stop }))
+
+	// last, the connection of the cancelled import is not reused
+	assert.Error(t, fb.ImportBatched(bytes.NewBufferString(`{"a": 1,`), 1))
+}
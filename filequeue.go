@@ -0,0 +1,214 @@
+package firego
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileWriteQueue is a WriteQueue that keeps writes in a file, as returned
+// by NewFileWriteQueue.
+type FileWriteQueue struct {
+	mtx    sync.Mutex
+	path   string
+	f      *os.File
+	closed bool
+	writes []QueuedWrite
+	// dequeued is the number of writes dequeued since the file was last
+	// compacted, each recorded by a line of the file
+	dequeued int
+}
+
+// fileRecord is a line of the file of a FileWriteQueue: a queued write, or
+// the record of the dequeue of the write at the front of the queue.
+type fileRecord struct {
+	QueuedWrite
+	Dequeued bool `json:",omitempty"`
+}
+
+// dequeueRecord is the line recording a dequeue.
+var dequeueRecord = []byte("{\"Dequeued\":true}\n")
+
+// NewFileWriteQueue creates a WriteQueue that keeps writes in the file at
+// path, one JSON object per line, so that the writes queued while Firebase
+// could not be reached survive the process exiting, for agents running
+// where the network comes and goes. The file is created if it does not
+// exist, and the writes already in it, queued by a previous process, are
+// queued again, in order.
+//
+// A write is synced to the file before Enqueue returns, and so is the
+// record of a Dequeue, appended to the file instead of rewriting it. Once
+// the writes dequeued outnumber the writes left, the file is compacted,
+// replaced atomically with a rename by one holding only the writes left,
+// so the file always holds either the queue before or after an operation,
+// even when the process crashes in the middle of it, and draining the
+// queue costs time linear in the number of writes. The file must not be
+// used by more than one queue at a time, and is closed with Close, after
+// which the queue returns ErrQueueClosed.
+func NewFileWriteQueue(path string) (*FileWriteQueue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &FileWriteQueue{path: path, f: f}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxWriteSize*2)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r fileRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid write queue %s: %v", path, err)
+		}
+		if !r.Dequeued {
+			q.writes = append(q.writes, r.QueuedWrite)
+		} else if len(q.writes) > 0 {
+			q.writes = q.writes[1:]
+			q.dequeued++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Enqueue appends w to the back of the queue, and to the file.
+func (q *FileWriteQueue) Enqueue(w QueuedWrite) error {
+	line, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := q.append(append(line, '\n')); err != nil {
+		return err
+	}
+	q.writes = append(q.writes, w)
+	return nil
+}
+
+// Peek returns the write at the front of the queue without removing it.
+func (q *FileWriteQueue) Peek() (QueuedWrite, bool, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return QueuedWrite{}, false, ErrQueueClosed
+	}
+	if len(q.writes) == 0 {
+		return QueuedWrite{}, false, nil
+	}
+	return q.writes[0], true, nil
+}
+
+// Dequeue removes the write at the front of the queue, recording it in the
+// file.
+func (q *FileWriteQueue) Dequeue() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if len(q.writes) == 0 {
+		return nil
+	}
+
+	if err := q.append(dequeueRecord); err != nil {
+		return err
+	}
+	q.writes = q.writes[1:]
+	q.dequeued++
+	if q.dequeued <= len(q.writes) {
+		return nil
+	}
+	// a failed compaction is tried again with the next dequeue
+	return q.compact()
+}
+
+// Len returns the number of writes in the queue.
+func (q *FileWriteQueue) Len() (int, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	return len(q.writes), nil
+}
+
+// Close closes the file of the queue, which returns ErrQueueClosed
+// afterwards, Close included.
+func (q *FileWriteQueue) Close() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.closed = true
+	return q.f.Close()
+}
+
+// append appends line to the file and syncs it. It must be called while
+// holding the queue's lock.
+func (q *FileWriteQueue) append(line []byte) error {
+	if _, err := q.f.Write(line); err != nil {
+		return err
+	}
+	return q.f.Sync()
+}
+
+// compact atomically replaces the file with one holding only the writes
+// left in the queue, and reopens it. It must be called while holding the
+// queue's lock.
+func (q *FileWriteQueue) compact() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, w := range q.writes {
+		if err := enc.Encode(w); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(q.path), filepath.Base(q.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(q.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	q.f.Close()
+	q.f = f
+	q.dequeued = 0
+	// the writes held before the compaction are not needed anymore
+	q.writes = append([]QueuedWrite(nil), q.writes...)
+	return nil
+}
@@ -0,0 +1,120 @@
+package firego
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriteQueue(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	q, err := NewFileWriteQueue(path)
+	require.NoError(t, err)
+	writes := []QueuedWrite{
+		{Method: "PUT", URL: "https://example.firebaseio.com/a", Body: []byte(`1`)},
+		{Method: "PATCH", URL: "https://example.firebaseio.com/b", Body: []byte(`{"c":true}`)},
+		{Method: "DELETE", URL: "https://example.firebaseio.com/d"},
+	}
+	for _, w := range writes {
+		require.NoError(t, q.Enqueue(w))
+	}
+	require.NoError(t, q.Dequeue())
+	require.NoError(t, q.Close())
+
+	// the queue survives being reopened
+	q, err = NewFileWriteQueue(path)
+	require.NoError(t, err)
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for _, want := range writes[1:] {
+		w, ok, err := q.Peek()
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, want.URL, w.URL)
+		assert.Equal(t, want.Method, w.Method)
+		assert.Equal(t, string(want.Body), string(w.Body))
+		require.NoError(t, q.Dequeue())
+	}
+	_, ok, err := q.Peek()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, q.Dequeue())
+
+	require.NoError(t, q.Enqueue(writes[0]))
+	require.NoError(t, q.Close())
+	q, err = NewFileWriteQueue(path)
+	require.NoError(t, err)
+	n, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, q.Close())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("not json\n"), 0600))
+	_, err = NewFileWriteQueue(path)
+	assert.Error(t, err)
+}
+
+func TestFileWriteQueueCompaction(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	q, err := NewFileWriteQueue(path)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		w := QueuedWrite{Method: "PUT", URL: fmt.Sprintf("https://example.firebaseio.com/%d", i)}
+		require.NoError(t, q.Enqueue(w))
+	}
+	lines := func() int {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return bytes.Count(b, []byte("\n"))
+	}
+
+	// dequeues are appended until they outnumber the writes left
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Dequeue())
+	}
+	assert.Equal(t, 15, lines())
+	require.NoError(t, q.Dequeue())
+	assert.Equal(t, 4, lines())
+
+	// the queue reads back the same, compacted or not
+	require.NoError(t, q.Dequeue())
+	require.NoError(t, q.Close())
+	q, err = NewFileWriteQueue(path)
+	require.NoError(t, err)
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	w, ok, err := q.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.firebaseio.com/7", w.URL)
+
+	// the queue keeps working after a compaction
+	require.NoError(t, q.Enqueue(QueuedWrite{Method: "DELETE", URL: "https://example.firebaseio.com/10"}))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Dequeue())
+	}
+	assert.Equal(t, 0, lines())
+	require.NoError(t, q.Close())
+	assert.Equal(t, ErrQueueClosed, q.Enqueue(w))
+	_, err = q.Len()
+	assert.Equal(t, ErrQueueClosed, err)
+	assert.Equal(t, ErrQueueClosed, q.Close())
+}
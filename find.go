@@ -0,0 +1,43 @@
+package firego
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FindByChild reads the children of the reference whose child at the
+// given path, which may contain slashes, equals value, the way a query
+// ordered by child and limited with equalTo does, into v. value is sent
+// encoded according to its type, so that the string "1" and the number 1
+// find different children, and a nil value finds the children that do
+// not have child. v points to either a slice, filled the way ValueSlice
+// fills it, sorting the matches by key, or a map or any other value,
+// decoded the way Value decodes it. Other query parameters set on the
+// reference, such as LimitToFirst, apply as well.
+//
+// Firebase only runs such queries on children indexed on child, which
+// the rules of the database declare with ".indexOn":
+//
+//	{
+//	  "rules": {
+//	    "users": {
+//	      ".indexOn": ["email"]
+//	    }
+//	  }
+//	}
+//
+// Querying a child that is not indexed fails with an ErrHTTP reporting
+// the missing index.
+func (fb *firebase) FindByChild(child string, value interface{}, v interface{}) error {
+	if child == "" {
+		return fmt.Errorf("FindByChild needs the path of a child")
+	}
+	query := fb.OrderBy(child).(*firebase)
+	query.params.Set(equalToParam, encodeBound(value))
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Slice {
+		return query.ValueSlice(v)
+	}
+	return query.Value(v)
+}
@@ -0,0 +1,56 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestFindByChild(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"carol": map[string]interface{}{"team": "red", "level": 1, "address": map[string]interface{}{"city": "Oslo"}},
+		"alice": map[string]interface{}{"team": "red", "level": "1"},
+		"bob":   map[string]interface{}{"team": "blue", "level": 2, "address": map[string]interface{}{"city": "Oslo"}},
+		"dave":  map[string]interface{}{"level": 1},
+	})
+	fb := New(server.URL, nil).Child("users")
+
+	type user struct {
+		Name string `json:"-" firego:"key"`
+		Team string `json:"team"`
+	}
+	var users []user
+	require.NoError(t, fb.FindByChild("team", "red", &users))
+	assert.Equal(t, []user{{Name: "alice", Team: "red"}, {Name: "carol", Team: "red"}}, users)
+
+	// values are matched by type
+	var byKey map[string]interface{}
+	require.NoError(t, fb.FindByChild("level", 1, &byKey))
+	assert.Len(t, byKey, 2)
+	assert.Contains(t, byKey, "carol")
+	assert.Contains(t, byKey, "dave")
+	byKey = nil
+	require.NoError(t, fb.FindByChild("level", "1", &byKey))
+	assert.Len(t, byKey, 1)
+	assert.Contains(t, byKey, "alice")
+
+	// children are found by deeper paths, and by missing children
+	require.NoError(t, fb.FindByChild("address/city", "Oslo", &users))
+	assert.Len(t, users, 2)
+	require.NoError(t, fb.FindByChild("team", nil, &users))
+	require.Len(t, users, 1)
+	assert.Equal(t, "dave", users[0].Name)
+
+	// other query parameters apply
+	require.NoError(t, fb.LimitToFirst(1).FindByChild("team", "red", &users))
+	assert.Len(t, users, 1)
+
+	assert.Error(t, fb.FindByChild("", "red", &users))
+}
@@ -5,16 +5,24 @@ package firego
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	_url "net/url"
+	"reflect"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"golang.org/x/oauth2"
 )
 
 // TimeoutDuration is the length of time any request will have to establish
@@ -25,17 +33,129 @@ var TimeoutDuration = 30 * time.Second
 var defaultRedirectLimit = 30
 
 // ErrTimeout is an error type is that is returned if a request
-// exceeds the TimeoutDuration configured.
+// exceeds the TimeoutDuration configured, or the deadline of the context
+// it was made with, in which case it wraps context.DeadlineExceeded.
 type ErrTimeout struct {
 	error
 }
 
+// Unwrap returns the error the request failed with.
+func (e ErrTimeout) Unwrap() error {
+	return e.error
+}
+
+// ErrInvalidPayload is an error type that is returned when the value
+// given to a write cannot be serialized to JSON, for example because it
+// contains a channel, a function or a cycle. No request is made when
+// this error is returned.
+type ErrInvalidPayload struct {
+	error
+}
+
+func (e ErrInvalidPayload) Error() string {
+	return "invalid payload: " + e.error.Error()
+}
+
+// Unwrap returns the underlying serialization error.
+func (e ErrInvalidPayload) Unwrap() error {
+	return e.error
+}
+
+// maxErrorBodyLength is the number of bytes of a
+// response body kept in an ErrHTTP.
+const maxErrorBodyLength = 512
+
+// ErrHTTP is an error type that is returned when Firebase responds to
+// a request with a status other than 2xx.
+type ErrHTTP struct {
+	// StatusCode is the status of the response.
+	StatusCode int
+	// Message is the error reported by Firebase in the JSON error object
+	// of the response or, when the response has no such object, as can be
+	// the case for the HTML pages returned by proxies, the body of the
+	// response.
+	Message string
+	// Body is the body of the response, truncated to 512 bytes.
+	Body string
+	// Path is the location Firebase reported the error for, such as the
+	// field that failed a validation rule, when the response tells, and
+	// empty otherwise. It is the path relative to the root of the
+	// database, starting with a slash.
+	Path string
+	// RetryAfter is the delay the Retry-After header of the response asked
+	// to wait before retrying, 0 when it has none.
+	RetryAfter time.Duration
+}
+
+func (e ErrHTTP) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newHTTPError builds the error returned for a response with the given
+// status and body. It never fails, whatever the body contains.
+func newHTTPError(status int, body []byte) ErrHTTP {
+	raw := string(body)
+	if len(raw) > maxErrorBodyLength {
+		// back off to the start of the rune the cut would split
+		cut := maxErrorBodyLength
+		for cut > 0 && !utf8.RuneStart(raw[cut]) {
+			cut--
+		}
+		raw = raw[:cut] + "..."
+	}
+	e := ErrHTTP{StatusCode: status, Message: strings.TrimSpace(raw), Body: raw}
+
+	var obj struct {
+		Error json.RawMessage `json:"error"`
+		Path  string          `json:"path"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil || len(obj.Error) == 0 {
+		return e
+	}
+	var msg string
+	if err := json.Unmarshal(obj.Error, &msg); err != nil {
+		msg = string(obj.Error)
+		var detail struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal(obj.Error, &detail) == nil && detail.Path != "" {
+			obj.Path = detail.Path
+		}
+	}
+	e.Message = msg
+	e.Path = errorPath(obj.Path, msg)
+	return e
+}
+
+// errorPathPattern matches the location named by the message of an error,
+// as in "Permission denied at /users/alice/age" or
+// "Validation failed for path '/users/alice/age'".
+var errorPathPattern = regexp.MustCompile(`(?:\bat|\bpath:?)\s+['"]?(/[^\s'"]*)`)
+
+// errorPath returns the location an error was reported for, the path
+// found in the error object when there is one, and otherwise the one its
+// message names, starting with a single slash.
+func errorPath(path, msg string) string {
+	if path == "" {
+		if m := errorPathPattern.FindStringSubmatch(msg); m != nil {
+			path = strings.TrimRight(m[1], ".,;:")
+		}
+	}
+	if path == "" {
+		return ""
+	}
+	return "/" + strings.TrimLeft(path, "/")
+}
+
 // query parameter constants
 const (
 	authParam         = "auth"
+	accessTokenParam  = "access_token"
 	shallowParam      = "shallow"
 	formatParam       = "format"
 	formatVal         = "export"
+	printParam        = "print"
+	silentVal         = "silent"
 	orderByParam      = "orderBy"
 	limitToFirstParam = "limitToFirst"
 	limitToLastParam  = "limitToLast"
@@ -44,41 +164,148 @@ const (
 	equalToParam      = "equalTo"
 )
 
+// queryParams are the query parameters selecting the children of a
+// reference, which its children and the other references made from it
+// with Child and Ref do not carry.
+var queryParams = []string{orderByParam, limitToFirstParam, limitToLastParam, startAtParam, endAtParam, equalToParam}
+
 const defaultHeartbeat = 2 * time.Minute
 
 // Firebase represents a location in the cloud.
 type Firebase interface {
 	Auth(token string)
+	AuthWithToken(accessToken string)
+	AuthWithTokenSource(ts oauth2.TokenSource)
 	Unauth()
+	Public() Firebase
 	Ref(path string) (Firebase, error)
+	WithHost(host string) (Firebase, error)
 	SetURL(url string)
 	Push(v interface{}) (Firebase, error)
+	PushWithContext(ctx context.Context, v interface{}) (Firebase, error)
+	PushOrdered(v interface{}) (string, error)
+	PushWithID(id string, v interface{}) (Firebase, error)
+	Claim(ctx context.Context) (string, interface{}, error)
+	ReplaceIf(pred func(current interface{}) bool, newValue interface{}) (bool, error)
+	CompareAndSet(conditionPath string, expected interface{}, writePath string, value interface{}) (bool, error)
+	Derive(srcPath, destPath string, fn func(src interface{}) interface{}) error
+	Move(dest Firebase) error
+	Appender() *Appender
+	Batch() *WriteBatch
 	Remove() error
+	RemoveWithContext(ctx context.Context) error
+	RemoveIfMatch(etag string) error
+	SetIfUnchanged(v interface{}, etag string) error
+	Transaction(fn func(current interface{}) (interface{}, error)) error
+	TransactionRaw(fn func(current json.RawMessage) (interface{}, error)) error
+	CreateChild(v interface{}) (string, error)
 	Set(v interface{}) error
+	SetWithContext(ctx context.Context, v interface{}) error
+	SetArray(elems []interface{}) error
+	SetJSON(r io.Reader) error
 	Update(v interface{}) error
+	UpdateWithContext(ctx context.Context, v interface{}) error
+	Sync(local interface{}) error
+	Touch(field string) error
+	BulkImport(items map[string]interface{}) error
+	BulkImportStream(ctx context.Context, items <-chan ImportItem, batchSize int, progress func(written int)) error
 	Value(v interface{}) error
+	ValueWithContext(ctx context.Context, v interface{}) error
+	FreshValue(v interface{}) error
+	ValueOr(v interface{}, defaultValue interface{}) error
+	Typed(factory func() interface{}) *TypedRef
+	AssertWritten(v interface{}) error
+	SetVerified(v interface{}) error
+	ExportValue(v interface{}) error
+	ExportTo(w io.Writer) error
+	ExportEach(pageSize int, fn func(key string, value json.RawMessage) error) error
+	ExportPaged(w io.Writer, pageSize int) error
+	ImportBatched(r io.Reader, batchSize int) error
+	ImportFrom(r io.Reader) error
+	ImportValue(v interface{}) error
+	ValueStream(ctx context.Context, ch chan<- OrderedEntry) error
+	ValueSlice(v interface{}) error
+	Run() ([]OrderedEntry, error)
+	FindByChild(child string, value interface{}, v interface{}) error
+	ValueSnapshot() (Snapshot, error)
+	ValueFields(fields []string, dest map[string]interface{}) error
+	Collect(dest interface{}) error
+	ValueWithDefaults(defaultsRef Firebase, v interface{}) error
+	Flatten() (map[string]interface{}, error)
+	ValueResumable(v interface{}) error
+	Pages(pageSize int) *Iterator
 	String() string
+	Path() string
+	Key() string
+	Equal(other Firebase) bool
+	LastResponseBody() []byte
+	LastETag() string
+	ValueWithETag(v interface{}) (string, error)
+	LastWriteChanged() bool
+	DiffSince(previous map[string]interface{}) (added, changed, removed map[string]interface{}, err error)
 	Child(child string) Firebase
+	InfoRef(path string) Firebase
+	Clone() Firebase
+	Session() Firebase
+	Warmup(ctx context.Context) error
+	WithContext(ctx context.Context) Firebase
 	ChildAdded(fn ChildEventFunc) error
 	ChildChanged(fn ChildEventFunc) error
 	ChildRemoved(fn ChildEventFunc) error
 	RemoveEventFunc(fn ChildEventFunc)
 	Watch(notifications chan Event) error
+	WatchWithContext(ctx context.Context, notifications chan Event) error
+	GetAndWatch(notifications chan Event) error
+	WaitForValue(ctx context.Context, pred func(current interface{}) bool) error
+	Poll(interval time.Duration, ch chan Event) error
+	WatchDebounced(ch chan Event, quiet time.Duration) error
+	WatchRateLimited(ch chan Event, maxPerSec float64) error
+	Mirror(notifications chan Event, onlyChanges bool) (*Mirror, error)
+	MirrorPaths(notifications chan Event, onlyChanges bool, paths ...string) (*Mirror, error)
+	WatchJSONPatch(patches chan []PatchOperation) (*Mirror, error)
+	SubscribeTyped(factory func() interface{}, onChange func(key string, v interface{}, deleted bool)) error
+	StreamInto(ch interface{}, factory func() interface{}) error
+	ChildEvents(ch chan ChildEvent) error
+	WatchChildren(onChild func(ctx context.Context, child Firebase, initial interface{})) error
+	WatchManager() *WatchManager
+	WatchRaw(ctx context.Context) (io.ReadCloser, error)
 	StopWatching()
+	StopWatchingContext(ctx context.Context) error
+	IsWatching() bool
+	WatchErr() error
+	ActiveWatchers() []WatcherInfo
 
 	StartAt(value string) Firebase
 	StartAtValue(value interface{}) Firebase
 	EndAt(value string) Firebase
 	EndAtValue(value interface{}) Firebase
 	OrderBy(value string) Firebase
+	OrderByKey() Firebase
+	OrderByValue() Firebase
 	EqualTo(value string) Firebase
 	EqualToValue(value interface{}) Firebase
+	StartAfter(value interface{}) Firebase
+	EndBefore(value interface{}) Firebase
+	Between(order string, lo, hi interface{}) Firebase
+	BetweenExclusive(order string, lo, hi interface{}) Firebase
 	LimitToFirst(value int64) Firebase
 	LimitToLast(value int64) Firebase
 	Shallow(v bool)
+	Silent(v bool)
+	SetRetryPolicy(maxRetries int, baseDelay time.Duration)
 	IncludePriority(v bool)
 
 	Exists() (bool, error)
+	Head() (*http.Response, error)
+	Count() (int, error)
+	Sample(n int) ([]string, error)
+	EstimateSize() (int64, error)
+	CacheStats() CacheStats
+	InFlight() int
+
+	Flush(ctx context.Context) error
+	Pending() (int, error)
+	StopAutoFlush()
 }
 
 type firebase struct {
@@ -86,6 +313,82 @@ type firebase struct {
 	params        _url.Values
 	client        *http.Client
 	clientTimeout time.Duration
+	// defaultClient is set when client was created by New
+	defaultClient bool
+
+	forceContentLength bool
+	tlsConfig          *tls.Config
+	maxDepth           int
+	accept             string
+	codec              Codec
+	maxRetries         int
+	retryDelay         time.Duration
+	retryJitter        bool
+	retryStatuses      map[int]bool
+	retryHook          func(RetryInfo)
+	backoff            Backoff
+	maxReconnects      int
+	watchReconnect     bool
+	conditionalTries   int
+	lenientDecode      bool
+	strictFields       bool
+	unknownKeyWarnings bool
+	tagName            string
+	lazySnapshot       bool
+	epochUnit          time.Duration
+	floatFormat        *floatFormat
+	idempotentPush     bool
+	dedupePath         string
+	pathPrefix         string
+	transforms         []fieldTransform
+	signer             func(*http.Request) error
+	middleware         []Middleware
+
+	// pathErr is set when the reference was given an invalid path
+	pathErr error
+	// prefixErr is set when the reference was given an invalid prefix,
+	// which the references made with Ref keep
+	prefixErr error
+	// noCache is set on sessions and on the copies FreshValue reads with
+	noCache bool
+	// silent is set with Silent
+	silent bool
+	// lastBody is set when the last response body is captured
+	lastBody *capturedBody
+	// lastChange is set when writes detect whether they change the value
+	lastChange *writeChange
+	// conditional is set on the copies conditional writes are made with
+	conditional *etagState
+	// lastETag is set when reads ask for the ETag of the value
+	lastETag *lastETag
+	// diffETag is the ETag of the collection last read by DiffSince
+	diffETag *lastETag
+	// cacheMiss is set on the copies Value reads a missing cached value with
+	cacheMiss bool
+	// applied is set on the copies deduplicated writes are made with, it
+	// reports whether a write whose outcome is unknown was applied
+	applied func(ctx context.Context) (bool, error)
+
+	tokenSource  oauth2.TokenSource
+	bearerToken  string
+	authInHeader bool
+	maxURLLength int
+	appCheck     oauth2.TokenSource
+	// emulatorOwner is set when requests are made as the emulator's owner
+	emulatorOwner bool
+
+	// ctx is the base context every operation is bound to
+	ctx context.Context
+
+	writeQueue *writeQueue
+	logger     Logger
+	streams    *streamLimiter
+	requests   *requestLimiter
+	watchers   *watcherRegistry
+	readCache  *readCache
+
+	flushInterval time.Duration
+	writeConflict func(QueuedWrite, error) error
 
 	eventMtx   sync.Mutex
 	eventFuncs map[string]chan struct{}
@@ -93,36 +396,50 @@ type firebase struct {
 	watchMtx       sync.Mutex
 	watching       bool
 	watchHeartbeat time.Duration
-	stopWatching   chan struct{}
+	// watchDone, watchStop and watchAbort belong to the last watch
+	// started by Watch
+	watchDone  chan struct{}
+	watchStop  chan struct{}
+	watchAbort context.CancelFunc
+	// watchErr is the reason the last watch ended
+	watchErr error
 }
 
 // New creates a new Firebase reference,
 // if client is nil, http.DefaultClient is used.
-func New(url string, client *http.Client) Firebase {
+// The given options are applied to the reference
+// and inherited by every reference derived from it.
+func New(url string, client *http.Client, opts ...Option) Firebase {
 	fb := &firebase{
 		url:            sanitizeURL(url),
 		params:         _url.Values{},
 		clientTimeout:  TimeoutDuration,
-		stopWatching:   make(chan struct{}),
 		watchHeartbeat: defaultHeartbeat,
 		eventFuncs:     map[string]chan struct{}{},
+		requests:       &requestLimiter{},
+		watchers:       &watcherRegistry{},
+		diffETag:       &lastETag{},
+	}
+	for _, opt := range opts {
+		opt(fb)
 	}
 	if client == nil {
-		var tr *http.Transport
-		tr = &http.Transport{
+		tr := &http.Transport{
 			DisableKeepAlives: true, // https://code.google.com/p/go/issues/detail?id=3514
-			Dial: func(network, address string) (net.Conn, error) {
-				start := time.Now()
-				c, err := net.DialTimeout(network, address, fb.clientTimeout)
-				tr.ResponseHeaderTimeout = fb.clientTimeout - time.Since(start)
-				return c, err
-			},
+			DialContext: (&net.Dialer{
+				Timeout: fb.clientTimeout,
+			}).DialContext,
+			ResponseHeaderTimeout: fb.clientTimeout,
+		}
+		if fb.tlsConfig != nil {
+			tr.TLSClientConfig = fb.tlsConfig.Clone()
 		}
 
 		client = &http.Client{
 			Transport:     tr,
 			CheckRedirect: redirectPreserveHeaders,
 		}
+		fb.defaultClient = true
 	}
 
 	fb.client = client
@@ -130,23 +447,215 @@ func New(url string, client *http.Client) Firebase {
 }
 
 // Auth sets the custom Firebase token used to authenticate to Firebase.
+// It replaces any token source set with AuthWithTokenSource.
 func (fb *firebase) Auth(token string) {
+	fb.tokenSource = nil
+	fb.bearerToken = ""
+	fb.emulatorOwner = false
 	fb.params.Set(authParam, token)
 }
 
-// Unauth removes the current token being used to authenticate to Firebase.
+// AuthWithToken authenticates every request to Firebase with the OAuth2
+// access token given, such as one minted for a Google service account,
+// sent in an "Authorization: Bearer" header rather than as a query
+// parameter, the way projects with legacy database secrets disabled
+// require. The token is sent as is until replaced: a token that expires
+// has to be set again, use AuthWithTokenSource to have tokens refreshed.
+// It replaces any token set with Auth or token source set with
+// AuthWithTokenSource, and is inherited by the references derived from
+// the reference, such as its children or the ones Push returns.
+//
+// Reference https://firebase.google.com/docs/database/rest/auth#authenticate_with_an_access_token
+func (fb *firebase) AuthWithToken(accessToken string) {
+	fb.params.Del(authParam)
+	fb.tokenSource = nil
+	fb.emulatorOwner = false
+	fb.bearerToken = accessToken
+}
+
+// AuthWithTokenSource authenticates every request to Firebase with an
+// OAuth2 access token obtained from ts, such as the ones minted for a
+// Google service account. Tokens are reused until they expire, at which
+// point a new one is requested from ts. It replaces any token set with Auth.
+//
+// Reference https://firebase.google.com/docs/database/rest/auth#authenticate_with_an_access_token
+func (fb *firebase) AuthWithTokenSource(ts oauth2.TokenSource) {
+	fb.params.Del(authParam)
+	fb.bearerToken = ""
+	fb.emulatorOwner = false
+	fb.tokenSource = oauth2.ReuseTokenSource(nil, ts)
+}
+
+// accessToken returns the access token the token source set with
+// AuthWithTokenSource currently gives, empty without one or when it fails.
+func (fb *firebase) accessToken() string {
+	if fb.tokenSource == nil {
+		return ""
+	}
+	token, err := fb.tokenSource.Token()
+	if err != nil {
+		return ""
+	}
+	return token.AccessToken
+}
+
+// Unauth removes every mechanism used to authenticate to Firebase, the
+// token set with Auth or AuthWithToken, the token source set with
+// AuthWithTokenSource and the emulator owner set by WithEmulator, so that
+// the following requests are made unauthenticated.
 func (fb *firebase) Unauth() {
+	fb.tokenSource = nil
+	fb.bearerToken = ""
+	fb.emulatorOwner = false
 	fb.params.Del(authParam)
 }
 
-// Ref returns a copy of an existing Firebase reference with a new path.
+// Public returns a copy of the reference with every mechanism used to
+// authenticate to Firebase removed, the way Unauth removes them, for the
+// requests that must be made unauthenticated, such as reads of a public
+// path, without changing the authentication of a reference that is shared.
+// The URL, client, timeout and other options are kept, including the App
+// Check token source, which attests the app rather than the user.
+func (fb *firebase) Public() Firebase {
+	c := fb.copy()
+	c.Unauth()
+	return c
+}
+
+// authorize adds the credentials of the reference to req.
+func (fb *firebase) authorize(req *http.Request) error {
+	if fb.appCheck != nil {
+		token, err := fb.appCheck.Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Firebase-AppCheck", token.AccessToken)
+	}
+
+	if fb.emulatorOwner {
+		req.Header.Set("Authorization", "Bearer "+emulatorOwner)
+		return nil
+	}
+	if fb.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+fb.bearerToken)
+		return nil
+	}
+	if fb.tokenSource == nil {
+		return nil
+	}
+
+	token, err := fb.tokenSource.Token()
+	if err != nil {
+		return err
+	}
+
+	if fb.authInHeader {
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		return nil
+	}
+	q := req.URL.Query()
+	q.Set(accessTokenParam, token.AccessToken)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// Ref returns a copy of an existing Firebase reference with a new path,
+// without the query of the reference, as Child does. The new reference
+// does not keep the error of an invalid path given to the reference, its
+// path replacing it, only that of an invalid prefix set with
+// WithPathPrefix.
 func (fb *firebase) Ref(path string) (Firebase, error) {
 	newFB := fb.copy()
-	parsedURL, err := _url.Parse(fb.url)
+	newFB.clearQuery()
+	newFB.pathErr = newFB.prefixErr
+	root, err := fb.rootURL()
 	if err != nil {
 		return newFB, err
 	}
-	newFB.url = parsedURL.Scheme + "://" + parsedURL.Host + "/" + strings.Trim(path, "/")
+	url, err := joinURL(root, path)
+	if err != nil {
+		return newFB, err
+	}
+	newFB.url = url
+	return newFB, nil
+}
+
+// rootURL returns the url of the root of the database of the reference,
+// the prefixed node if it was created with WithPathPrefix.
+func (fb *firebase) rootURL() (string, error) {
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		return "", err
+	}
+	if fb.pathPrefix != "" {
+		return u.Scheme + "://" + u.Host + "/" + fb.pathPrefix, nil
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// joinURL appends path to the url of a reference. The empty segments of
+// path are ignored, so that leading, trailing and repeated slashes never
+// end up in a request URL, and segments that can not be part of a database
+// path are rejected.
+func joinURL(url, path string) (string, error) {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		if err := validateSegment(segment); err != nil {
+			return url, fmt.Errorf("invalid path %q: %v", path, err)
+		}
+		url += "/" + segment
+	}
+	return url, nil
+}
+
+// validateSegment reports whether segment can be used as one segment of
+// the path of a request. Unlike validateKey, it accepts the keys starting
+// with a dot that name special locations such as ".info".
+func validateSegment(segment string) error {
+	switch {
+	case segment == "." || segment == "..":
+		return fmt.Errorf("relative segments are not supported")
+	case strings.ContainsAny(segment, "?#$[]"):
+		return fmt.Errorf("segments can not contain any of ? # $ [ ]")
+	}
+	for _, r := range segment {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("segments can not contain control characters")
+		}
+	}
+	return nil
+}
+
+// WithHost returns a copy of an existing Firebase reference with the same
+// path, authentication and options pointing at the database served by
+// host instead, for example to route a path to one of several database
+// shards. The scheme of the reference is kept unless host has one.
+func (fb *firebase) WithHost(host string) (Firebase, error) {
+	current, err := _url.Parse(fb.url)
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL := strings.TrimSpace(host)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = current.Scheme + "://" + rawURL
+	}
+	u, err := _url.Parse(rawURL)
+	switch {
+	case err != nil:
+		return nil, err
+	case u.Host == "" || u.Hostname() == "":
+		return nil, fmt.Errorf("invalid host %q", host)
+	case strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil:
+		return nil, fmt.Errorf("invalid host %q: only a host and port are allowed", host)
+	case u.Scheme != "http" && u.Scheme != "https":
+		return nil, fmt.Errorf("invalid host %q: unsupported scheme %q", host, u.Scheme)
+	}
+
+	newFB := fb.copy()
+	newFB.url = u.Scheme + "://" + u.Host + current.Path
 	return newFB, nil
 }
 
@@ -160,18 +669,177 @@ func (fb *firebase) Exists() (bool, error) {
 	return data != nil, nil
 }
 
+// Count returns the number of direct children of the current reference.
+// It uses a shallow read so only the keys of the children are downloaded.
+// A reference to a primitive value or to a location without data has no
+// children. The count is a snapshot of the children at the time of the
+// request and may be outdated as soon as it is returned.
+func (fb *firebase) Count() (int, error) {
+	c := fb.copy()
+	c.Shallow(true)
+
+	var data interface{}
+	if err := c.Value(&data); err != nil {
+		return 0, err
+	}
+
+	children, ok := data.(map[string]interface{})
+	if !ok {
+		return 0, nil
+	}
+	return len(children), nil
+}
+
+// Sample returns the keys of up to n direct children of the current
+// reference, the first ones in key order, without downloading their
+// values. Fewer keys are returned when the reference has fewer children.
+//
+// Firebase does not accept a shallow read combined with other query
+// parameters, so Sample can not ask for n keys with limitToFirst: it reads
+// every key with a shallow read, the way Count does, and keeps the first n
+// of them. This is cheap compared to reading the values of the children,
+// but the keys of every child are still downloaded.
+func (fb *firebase) Sample(n int) ([]string, error) {
+	c := fb.copy()
+	c.Shallow(true)
+
+	var data interface{}
+	if err := c.Value(&data); err != nil {
+		return nil, err
+	}
+
+	children, _ := data.(map[string]interface{})
+	keys := orderChildren(children, "$key")
+	if n < len(keys) {
+		if n < 0 {
+			n = 0
+		}
+		keys = keys[:n]
+	}
+	return keys, nil
+}
+
+// EstimateSize returns the number of bytes of the JSON value of the
+// current reference, as it is read with the query parameters of the
+// reference. The value is streamed and discarded as it is received instead
+// of being held in memory or decoded, which makes it cheap enough for
+// admin tools reporting the size of nodes or deciding whether a full read
+// is safe.
+//
+// The size is a count of the bytes received over the wire, after any
+// transfer encoding was removed, and not the size Firebase accounts for
+// the node in its own usage and billing, which it does not expose.
+func (fb *firebase) EstimateSize() (int64, error) {
+	var size int64
+	err := fb.readStream(context.Background(), func(ctx context.Context, body io.Reader) error {
+		var err error
+		size, err = io.Copy(ioutil.Discard, body)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // SetURL changes the url for a firebase reference.
 func (fb *firebase) SetURL(url string) {
 	fb.url = sanitizeURL(url)
 }
 
 // Push creates a reference to an auto-generated child location.
+//
+// If the reference has a write queue or was created with
+// WithIdempotentPush, the key of the child is generated locally. With a
+// write queue the returned reference is valid even when the error is
+// ErrQueued.
+//
+// A Push that fails without a response from Firebase, for example on a
+// timeout, may or may not have created the child, see PushWithContext and
+// CreateChild.
 func (fb *firebase) Push(v interface{}) (Firebase, error) {
-	bytes, err := json.Marshal(v)
+	ref, err := fb.push(context.Background(), v)
+	if err != nil && err != ErrQueued {
+		return nil, err
+	}
+	return ref, err
+}
+
+// ErrPushUncertain is returned by PushWithContext when the push failed
+// without a response from Firebase, because its context was done or the
+// connection failed once the request may have been sent, so that the child
+// may or may not have been created.
+type ErrPushUncertain struct {
+	// Ref is the child the push may have created when its key was
+	// generated locally, see WithIdempotentPush, nil when Firebase was to
+	// generate it, in which case the child, if created, can not be found
+	// by its key.
+	Ref Firebase
+	// Err is the error the push failed with.
+	Err error
+}
+
+func (e ErrPushUncertain) Error() string {
+	return "push may or may not have created the child: " + e.Err.Error()
+}
+
+// Unwrap returns the error the push failed with.
+func (e ErrPushUncertain) Unwrap() error {
+	return e.Err
+}
+
+// PushWithContext pushes v the way Push does, aborting the request once
+// ctx is done. A ctx that is done before the push starts fails it with the
+// error of the context, nothing is sent. Once the request may have been
+// sent, a push that fails without a response from Firebase, such as one
+// aborted by ctx or one whose connection broke, returns an
+// ErrPushUncertain: Firebase may have created the child before the
+// failure, and a push made with a POST, whose key Firebase generates, can
+// not tell. A push that Firebase rejected, with an ErrHTTP, created
+// nothing.
+//
+// For an at-most-once creation, use a reference created with
+// WithIdempotentPush, whose pushes generate the key locally: the Ref of the
+// ErrPushUncertain then points to the child, which can be read to find out
+// whether it was created, or written again with Set, which overwrites it
+// with the same value instead of creating a duplicate.
+func (fb *firebase) PushWithContext(ctx context.Context, v interface{}) (Firebase, error) {
+	if err := ctx.Err(); err != nil {
+		// nothing was sent
+		return nil, err
+	}
+
+	ref, err := fb.push(ctx, v)
+	switch {
+	case err == nil || err == ErrQueued:
+		return ref, err
+	case isNetworkError(ctx, err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		e := ErrPushUncertain{Err: err}
+		if ref != nil {
+			e.Ref = ref
+		}
+		return nil, e
+	}
+	return nil, err
+}
+
+// push writes v as a new child of the reference. The reference to the
+// child is returned when its key is generated locally, even when the
+// write fails, and otherwise only when Firebase created it.
+func (fb *firebase) push(ctx context.Context, v interface{}) (*firebase, error) {
+	bytes, err := fb.marshalPayload(v)
 	if err != nil {
 		return nil, err
 	}
-	bytes, err = fb.doRequest("POST", bytes)
+
+	if fb.writeQueue != nil || fb.idempotentPush || fb.silent {
+		newRef := fb.copy()
+		newRef.url = fb.url + "/" + newPushID()
+		_, err = newRef.write(ctx, "PUT", bytes)
+		return newRef, err
+	}
+
+	bytes, err = fb.doRequest(ctx, "POST", bytes)
 	if err != nil {
 		return nil, err
 	}
@@ -181,12 +849,19 @@ func (fb *firebase) Push(v interface{}) (Firebase, error) {
 	}
 	newRef := fb.copy()
 	newRef.url = fb.url + "/" + m["name"]
-	return newRef, err
+	return newRef, nil
 }
 
 // Remove the Firebase reference from the cloud.
 func (fb *firebase) Remove() error {
-	_, err := fb.doRequest("DELETE", nil)
+	return fb.RemoveWithContext(context.Background())
+}
+
+// RemoveWithContext removes the value of the reference the way Remove
+// does, aborting the request once ctx is done with an error wrapping the
+// error of ctx, an ErrTimeout when its deadline passed.
+func (fb *firebase) RemoveWithContext(ctx context.Context) error {
+	_, err := fb.write(ctx, "DELETE", nil)
 	if err != nil {
 		return err
 	}
@@ -195,37 +870,198 @@ func (fb *firebase) Remove() error {
 
 // Set the value of the Firebase reference.
 func (fb *firebase) Set(v interface{}) error {
-	bytes, err := json.Marshal(v)
+	return fb.SetWithContext(context.Background(), v)
+}
+
+// SetWithContext sets the value of the reference the way Set does,
+// aborting the request once ctx is done with an error wrapping the error
+// of ctx, an ErrTimeout when its deadline passed. A write aborted once
+// sent may or may not have been applied.
+func (fb *firebase) SetWithContext(ctx context.Context, v interface{}) error {
+	bytes, err := fb.marshalPayload(v)
+	if err != nil {
+		return err
+	}
+	changed, err := fb.detectChange("PUT", bytes)
 	if err != nil {
 		return err
 	}
-	_, err = fb.doRequest("PUT", bytes)
+	_, err = fb.write(ctx, "PUT", bytes)
+	fb.lastChange.set(changed && err == nil)
+	return err
+}
+
+// SetJSON sets the value of the Firebase reference to the JSON
+// document read from r. The document is streamed to Firebase as it is
+// read using chunked transfer encoding, unless the reference was created
+// with WithForceContentLength(true).
+func (fb *firebase) SetJSON(r io.Reader) error {
+	_, err := fb.doReader(context.Background(), "PUT", r)
 	return err
 }
 
 // Update the specific child with the given value.
+//
+// The keys of a map[string]interface{} may be paths, relative to the
+// reference, to write to deep descendants in a single request, such as
+// {"users/alice/name": "Alice", "names/Alice": "alice"} for a fan-out:
+// the update is atomic, every path is written or none is. The paths are
+// validated before anything is sent, and an error is returned for an
+// invalid key or for a path that is the ancestor of another one, which
+// Firebase would reject.
 func (fb *firebase) Update(v interface{}) error {
-	bytes, err := json.Marshal(v)
+	return fb.UpdateWithContext(context.Background(), v)
+}
+
+// UpdateWithContext updates the reference with the children of v the way
+// Update does, aborting the request once ctx is done with an error
+// wrapping the error of ctx, an ErrTimeout when its deadline passed. A
+// write aborted once sent may or may not have been applied.
+func (fb *firebase) UpdateWithContext(ctx context.Context, v interface{}) error {
+	if m, ok := v.(map[string]interface{}); ok {
+		if err := validateUpdatePaths(m); err != nil {
+			return err
+		}
+	}
+	bytes, err := fb.marshalPayload(v)
+	if err != nil {
+		return err
+	}
+	changed, err := fb.detectChange("PATCH", bytes)
 	if err != nil {
 		return err
 	}
-	_, err = fb.doRequest("PATCH", bytes)
+	_, err = fb.write(ctx, "PATCH", bytes)
+	fb.lastChange.set(changed && err == nil)
 	return err
 }
 
-// Value gets the value of the Firebase reference.
+// Value gets the value of the Firebase reference. On a reference created
+// with WithLenientDecode, the error may be DecodeWarnings listing the
+// fields that were skipped while decoding the rest of the value into v.
 func (fb *firebase) Value(v interface{}) error {
-	bytes, err := fb.doRequest("GET", nil)
+	return fb.ValueWithContext(context.Background(), v)
+}
+
+// ValueWithContext gets the value of the reference into v the way Value
+// does, aborting the request once ctx is done with an error wrapping the
+// error of ctx, an ErrTimeout when its deadline passed.
+func (fb *firebase) ValueWithContext(ctx context.Context, v interface{}) error {
+	bytes, err := fb.cachedValue(ctx)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(bytes, v)
+	return fb.unmarshal(bytes, v)
+}
+
+// FreshValue gets the value of the Firebase reference like Value does,
+// but asks every HTTP cache between the client and Firebase not to serve
+// the read from a cached response.
+//
+// Firebase itself serves REST reads consistently with the writes it has
+// acknowledged, so a read made after a write returns reflects it. Proxies
+// and gateways that cache responses can break this guarantee, FreshValue
+// is a best-effort mitigation for reads that must see a preceding write.
+func (fb *firebase) FreshValue(v interface{}) error {
+	c := fb.copy()
+	c.noCache = true
+	c.lastBody, c.lastETag = fb.lastBody, fb.lastETag
+	return c.Value(v)
+}
+
+// ValueOr gets the value of the Firebase reference like Value does, but
+// sets v to defaultValue when there is no value at the reference, which
+// Firebase returns as null. A value that is present decodes into v even
+// when it is the zero value of v, such as 0, false or "".
+//
+// v must be a non-nil pointer. A defaultValue assignable to what v points
+// to is assigned to it, as is, maps and slices included; any other
+// defaultValue is encoded as JSON and decoded into v as if it had been
+// read, so that for example an int default can be given for a float64.
+func (fb *firebase) ValueOr(v interface{}, defaultValue interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("ValueOr needs a non-nil pointer, not %T", v)
+	}
+	body, err := fb.cachedValue(context.Background())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(body), []byte("null")) {
+		return fb.unmarshal(body, v)
+	}
+
+	elem := rv.Elem()
+	if defaultValue == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	if dv := reflect.ValueOf(defaultValue); dv.Type().AssignableTo(elem.Type()) {
+		elem.Set(dv)
+		return nil
+	}
+	raw, err := json.Marshal(defaultValue)
+	if err != nil {
+		return err
+	}
+	elem.Set(reflect.Zero(elem.Type()))
+	return fb.unmarshal(raw, v)
+}
+
+// Path returns the path of the Firebase reference from the root of the
+// database, such as "/users/42/name", without the host, query parameters
+// or .json suffix. The path of the root is "/". For a reference created
+// with WithPathPrefix, the path is relative to the prefix.
+func (fb *firebase) Path() string {
+	var segments []string
+	for _, segment := range strings.Split(fb.path(), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Key returns the last segment of the path of the Firebase reference, such
+// as "name" for "/users/42/name", or an empty string for the root.
+func (fb *firebase) Key() string {
+	path := fb.Path()
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// Equal reports whether the reference and other address the same node of
+// the same database, whatever the path they were created with: slashes,
+// the case of the scheme and host and a default port are ignored, and so
+// are queries and the other query parameters, but for the namespace of an
+// emulator. A reference with a path prefix addresses the node found at its
+// full path.
+func (fb *firebase) Equal(other Firebase) bool {
+	o, ok := other.(*firebase)
+	return ok && fb.node() == o.node()
+}
+
+// node identifies the node of the database the reference addresses.
+func (fb *firebase) node() string {
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		return fb.url
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if (scheme == "https" && strings.HasSuffix(host, ":443")) || (scheme == "http" && strings.HasSuffix(host, ":80")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	return scheme + "://" + host + "/" + strings.Trim(u.Path, "/") + "?" + fb.params.Get(namespaceParam)
 }
 
 // String returns the string representation of the
 // Firebase reference.
 func (fb *firebase) String() string {
 	path := fb.url + "/.json"
+	if isMetaPath(fb.url) {
+		// special locations are only served with the suffix
+		// appended to their last segment
+		path = fb.url + ".json"
+	}
 
 	if len(fb.params) > 0 {
 		path += "?" + fb.params.Encode()
@@ -234,42 +1070,198 @@ func (fb *firebase) String() string {
 }
 
 // Child creates a new Firebase reference for the requested
-// child with the same configuration as the parent.
+// child with the same configuration as the parent, except for the query
+// set with OrderBy, StartAt, EndAt, EqualTo, LimitToFirst and LimitToLast,
+// which only applies to the parent.
+//
+// Leading, trailing and repeated slashes in child are ignored, so that
+// Child("/a//b/") is the same reference as Child("a/b") and Child("") is a
+// copy of the parent without its query. If child holds a segment that can
+// not be part of a path, such as "..", "a?b" or "a#b", every operation
+// made with the reference, or with the references derived from it, fails
+// with an error describing it.
 func (fb *firebase) Child(child string) Firebase {
 	c := fb.copy()
-	c.url = c.url + "/" + child
+	c.clearQuery()
+	url, err := joinURL(c.url, child)
+	if err != nil && c.pathErr == nil {
+		c.pathErr = err
+	}
+	c.url = url
 	return c
 }
 
+// InfoRef returns a reference to the special location /.info/<path> of
+// the database, such as InfoRef("connected") or InfoRef("serverTimeOffset"),
+// wherever the reference points to and whatever prefix was set with
+// WithPathPrefix. It is the same reference as Child(".info/" + path) from
+// the root of the database.
+func (fb *firebase) InfoRef(path string) Firebase {
+	c := fb.copy()
+	c.clearQuery()
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		if c.pathErr == nil {
+			c.pathErr = err
+		}
+		return c
+	}
+	url, err := joinURL(u.Scheme+"://"+u.Host, ".info/"+path)
+	if err != nil && c.pathErr == nil {
+		c.pathErr = err
+	}
+	c.url = url
+	return c
+}
+
+// isMetaPath reports whether url points to a special location, whose
+// path has a segment starting with a dot such as ".info" or ".settings",
+// which keys stored in the database can not.
+func isMetaPath(url string) bool {
+	u, err := _url.Parse(url)
+	if err != nil {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns an independent copy of the Firebase reference with the same
+// url, client, authentication, timeout, query parameters and options.
+//
+// Like the references returned by Child and the query methods, a clone does
+// not share query state with the original once created, so either can be
+// changed, for example with Shallow or IncludePriority, without affecting the
+// other. A clone does not share watches or event functions either.
+func (fb *firebase) Clone() Firebase {
+	return fb.copy()
+}
+
+// clearQuery removes the query parameters of the reference, see
+// queryParams.
+func (fb *firebase) clearQuery() {
+	for _, param := range queryParams {
+		fb.params.Del(param)
+	}
+}
+
+// clearReadParams removes the query of the reference along with the
+// parameters shaping what its requests read and return, shallow, format
+// and print, keeping the others, such as the credentials or the namespace
+// of an emulator.
+func (fb *firebase) clearReadParams() {
+	fb.clearQuery()
+	for _, param := range []string{shallowParam, formatParam, printParam} {
+		fb.params.Del(param)
+	}
+}
+
 func (fb *firebase) copy() *firebase {
 	c := &firebase{
-		url:            fb.url,
-		params:         _url.Values{},
-		client:         fb.client,
-		clientTimeout:  fb.clientTimeout,
-		stopWatching:   make(chan struct{}),
-		watchHeartbeat: defaultHeartbeat,
-		eventFuncs:     map[string]chan struct{}{},
+		url:                fb.url,
+		params:             _url.Values{},
+		client:             fb.client,
+		clientTimeout:      fb.clientTimeout,
+		defaultClient:      fb.defaultClient,
+		forceContentLength: fb.forceContentLength,
+		maxDepth:           fb.maxDepth,
+		accept:             fb.accept,
+		codec:              fb.codec,
+		maxRetries:         fb.maxRetries,
+		conditionalTries:   fb.conditionalTries,
+		retryDelay:         fb.retryDelay,
+		retryJitter:        fb.retryJitter,
+		retryStatuses:      fb.retryStatuses,
+		retryHook:          fb.retryHook,
+		backoff:            fb.backoff,
+		maxReconnects:      fb.maxReconnects,
+		watchReconnect:     fb.watchReconnect,
+		lenientDecode:      fb.lenientDecode,
+		strictFields:       fb.strictFields,
+		unknownKeyWarnings: fb.unknownKeyWarnings,
+		tagName:            fb.tagName,
+		lazySnapshot:       fb.lazySnapshot,
+		epochUnit:          fb.epochUnit,
+		floatFormat:        fb.floatFormat,
+		idempotentPush:     fb.idempotentPush,
+		dedupePath:         fb.dedupePath,
+		pathPrefix:         fb.pathPrefix,
+		transforms:         fb.transforms,
+		signer:             fb.signer,
+		middleware:         fb.middleware,
+		tokenSource:        fb.tokenSource,
+		bearerToken:        fb.bearerToken,
+		authInHeader:       fb.authInHeader,
+		maxURLLength:       fb.maxURLLength,
+		appCheck:           fb.appCheck,
+		emulatorOwner:      fb.emulatorOwner,
+		ctx:                fb.ctx,
+		writeQueue:         fb.writeQueue,
+		flushInterval:      fb.flushInterval,
+		writeConflict:      fb.writeConflict,
+		logger:             fb.logger,
+		streams:            fb.streams,
+		requests:           fb.requests,
+		watchers:           fb.watchers,
+		readCache:          fb.readCache,
+		noCache:            fb.noCache,
+		silent:             fb.silent,
+		pathErr:            fb.pathErr,
+		prefixErr:          fb.prefixErr,
+		watchHeartbeat:     defaultHeartbeat,
+		eventFuncs:         map[string]chan struct{}{},
+		diffETag:           &lastETag{},
+	}
+	if fb.lastBody != nil {
+		c.lastBody = &capturedBody{}
+	}
+	if fb.lastChange != nil {
+		c.lastChange = &writeChange{}
+	}
+	if fb.lastETag != nil {
+		c.lastETag = &lastETag{}
 	}
 
 	// making sure to manually copy the map items into a new
 	// map to avoid modifying the map reference.
 	for k, v := range fb.params {
-		c.params[k] = v
+		c.params[k] = append([]string(nil), v...)
 	}
 	return c
 }
 
+// sanitizeURL normalizes the given database URL. It makes no assumption
+// about the host so that both the legacy <name>.firebaseio.com hosts and
+// the regional <name>.<region>.firebasedatabase.app hosts are supported.
+//
+//	my-db.europe-west1.firebasedatabase.app   -> https://my-db.europe-west1.firebasedatabase.app
+//	HTTPS://my-db.firebaseio.com/             -> https://my-db.firebaseio.com
+//	 http://localhost:9000//                  -> http://localhost:9000
 func sanitizeURL(url string) string {
-	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
-		url = "https://" + url
-	}
+	url = strings.TrimSpace(url)
 
-	if strings.HasSuffix(url, "/") {
-		url = url[:len(url)-1]
+	scheme := "https://"
+	switch lower := strings.ToLower(url); {
+	case strings.HasPrefix(lower, "https://"):
+		url = url[len("https://"):]
+	case strings.HasPrefix(lower, "http://"):
+		scheme = "http://"
+		url = url[len("http://"):]
 	}
 
-	return url
+	// repeated slashes in the path are collapsed
+	segments := strings.Split(url, "/")
+	url = segments[0]
+	for _, segment := range segments[1:] {
+		if segment != "" {
+			url += "/" + segment
+		}
+	}
+	return scheme + url
 }
 
 // Preserve headers on redirect.
@@ -292,18 +1284,219 @@ func redirectPreserveHeaders(req *http.Request, via []*http.Request) error {
 	return nil
 }
 
-func (fb *firebase) doRequest(method string, body []byte) ([]byte, error) {
-	req, err := http.NewRequest(method, fb.String(), bytes.NewReader(body))
+// newRequest builds a request against the reference. Bodies that are
+// already in memory are always sent with a Content-Length, any other
+// body is sent using chunked transfer encoding unless forceContentLength
+// is set, in which case it is read into memory first.
+func (fb *firebase) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	if fb.pathErr != nil {
+		return nil, fb.pathErr
+	}
+
+	length := int64(-1)
+	switch b := body.(type) {
+	case nil:
+		length = 0
+	case *bytes.Reader:
+		length = int64(b.Len())
+	default:
+		if fb.forceContentLength {
+			buf, err := ioutil.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(buf)
+			length = int64(len(buf))
+		}
+	}
+
+	req, err := http.NewRequest(method, fb.String(), body)
 	if err != nil {
 		return nil, err
 	}
+	if fb.silent && hasBody(method) && fb.conditional == nil {
+		q := req.URL.Query()
+		q.Set(printParam, silentVal)
+		req.URL.RawQuery = q.Encode()
+	}
+	if fb.noCache {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	}
+	if fb.conditional != nil || (fb.lastETag != nil && method == "GET") {
+		req.Header.Set("X-Firebase-ETag", "true")
+	}
+	if fb.conditional != nil && fb.conditional.ifMatch != "" {
+		req.Header.Set("if-match", fb.conditional.ifMatch)
+	}
+	if fb.conditional != nil && fb.conditional.ifNoneMatch != "" {
+		req.Header.Set("if-none-match", fb.conditional.ifNoneMatch)
+	}
+	if err := fb.setAccept(req); err != nil {
+		return nil, err
+	}
+	if fb.codec != nil && body != nil && hasBody(method) {
+		req.Header.Set("Content-Type", fb.codec.ContentType())
+	}
+	if err := fb.authorize(req); err != nil {
+		return nil, err
+	}
+	if err := fb.checkURLLength(req); err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	return req.WithContext(ctx), nil
+}
+
+func (fb *firebase) doRequest(ctx context.Context, method string, body []byte) ([]byte, error) {
+	return fb.doReader(ctx, method, bytes.NewReader(body))
+}
+
+func (fb *firebase) doReader(ctx context.Context, method string, body io.Reader) ([]byte, error) {
+	ctx, cancel := fb.requestContext(ctx)
+	defer cancel()
+
+	if fb.readCache != nil && method != "GET" {
+		// the write may be applied even if it fails
+		defer fb.readCache.invalidate(fb.path())
+	}
+	// sending an increment again would apply it twice
+	increments := false
+	if r, ok := body.(*bytes.Reader); ok && r.Len() > 0 {
+		b := make([]byte, r.Len())
+		r.ReadAt(b, 0)
+		increments = holdsIncrement(b)
+	}
+	body, err := fb.transformWrite(method, body)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = fb.encodeBody(method, body); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := fb.newRequest(ctx, method, body)
+		if err != nil {
+			return nil, err
+		}
+		if err := fb.requests.acquire(ctx); err != nil {
+			return nil, err
+		}
+		respBody, status, err := fb.do(req)
+		fb.requests.release()
+		if err == nil && attempt > 0 {
+			fb.retryBackoff().Reset()
+		}
+		if err == nil || increments || !fb.shouldRetry(ctx, method, body, attempt, status, err) {
+			return respBody, err
+		}
+		if err := fb.waitRetry(ctx, req, attempt, err); err != nil {
+			return nil, err
+		}
+		if fb.applied != nil {
+			if ok, err := fb.applied(ctx); ok || err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := body.(*bytes.Reader); ok {
+			r.Seek(0, io.SeekStart)
+		}
+	}
+}
 
-	resp, err := fb.client.Do(req)
+func (fb *firebase) do(req *http.Request) ([]byte, int, error) {
+	info := RequestInfo{
+		Method:    req.Method,
+		URL:       req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		Operation: fb.operationName(req.Context()),
+	}
+	out := countRequestBody(req)
+	start := time.Now()
+	respBody, err := fb.doHTTP(req, &info)
+	info.Duration = time.Since(start)
+	info.BytesOut = out.count()
+	err = payloadTooLarge(err, info.BytesOut)
+	err = urlTooLong(err, len(req.URL.String()))
+	err = databaseUnavailable(err)
+	info.Err = err
+	fb.logRequest(info)
+	return respBody, info.StatusCode, err
+}
+
+func (fb *firebase) doHTTP(req *http.Request, info *RequestInfo) ([]byte, error) {
+	resp, err := fb.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	info.StatusCode = resp.StatusCode
+	in := &countingReader{r: resp.Body}
+	var body io.Reader = in
+	limitDepth := fb.maxDepth > 0 && req.Method == "GET" && resp.StatusCode/200 == 1
+	if limitDepth && fb.codec == nil {
+		body = &depthReader{r: body, max: fb.maxDepth}
+	}
+	respBody, err := ioutil.ReadAll(body)
+	info.BytesIn = in.count()
+	fb.lastBody.set(respBody)
+	if err != nil {
+		return nil, err
+	}
+	if fb.codec != nil {
+		if respBody, err = fb.decodeBody(resp, respBody); err != nil {
+			return nil, err
+		}
+		if limitDepth {
+			// the depth is that of the decoded value
+			if _, err := ioutil.ReadAll(&depthReader{r: bytes.NewReader(respBody), max: fb.maxDepth}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if (req.Method == "GET" && resp.StatusCode/200 == 1) || resp.StatusCode == http.StatusPreconditionFailed {
+		// the body holds the value of the reference
+		if respBody, err = fb.transformRead(respBody); err != nil {
+			return nil, err
+		}
+	}
+	if fb.conditional != nil {
+		fb.conditional.etag, fb.conditional.body = resp.Header.Get("ETag"), respBody
+	}
+	if resp.StatusCode/200 != 1 {
+		e := newHTTPError(resp.StatusCode, respBody)
+		e.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+		return nil, e
+	}
+	if err := fb.checkContentType(req, resp); err != nil {
+		return nil, err
+	}
+	if req.Method == "GET" {
+		fb.lastETag.set(resp.Header.Get("ETag"))
+	}
+	return respBody, nil
+}
+
+// sign signs req with the signer set with WithRequestSigner, if any.
+func (fb *firebase) sign(req *http.Request) error {
+	if fb.signer == nil {
+		return nil
+	}
+	return fb.signer(req)
+}
+
+// send sends req, reporting the timeouts of the client as ErrTimeout.
+func (fb *firebase) send(req *http.Request) (*http.Response, error) {
+	if err := fb.sign(req); err != nil {
+		return nil, err
+	}
+	resp, err := fb.doer().Do(req)
 	switch err := err.(type) {
 	default:
 		return nil, err
 	case nil:
-		// carry on
+		return resp, nil
 
 	case *_url.Error:
 		// `http.Client.Do` will return a `url.Error` that wraps a `net.Error`
@@ -324,14 +1517,4 @@ func (fb *firebase) doRequest(method string, body []byte) ([]byte, error) {
 
 		return nil, err
 	}
-
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode/200 != 1 {
-		return nil, errors.New(string(respBody))
-	}
-	return respBody, nil
 }
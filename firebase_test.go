@@ -1,16 +1,25 @@
 package firego
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/zabawaba99/firego/internal/firetest"
+	"golang.org/x/oauth2"
 )
 
 const URL = "https://somefirebaseapp.firebaseIO.com"
@@ -29,6 +38,24 @@ func newTestServer(response string) *TestServer {
 	return ts
 }
 
+// newFaultServer returns the server the tests inject failures with: it
+// hands every request to handle along with forward, which passes the
+// request on to target, or answers it with a 502 when target is nil.
+// handle runs in the goroutine of the server and must not use require.
+func newFaultServer(t *testing.T, target *firetest.Firetest, handle func(w http.ResponseWriter, req *http.Request, forward http.Handler)) *httptest.Server {
+	forward := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	if target != nil {
+		u, err := url.Parse(target.URL)
+		require.NoError(t, err)
+		forward = httputil.NewSingleHostReverseProxy(u)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handle(w, req, forward)
+	}))
+}
+
 func TestNew(t *testing.T) {
 	t.Parallel()
 	testURLs := []string{
@@ -44,6 +71,68 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_RegionalHosts(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		url      string
+		expected string
+	}{
+		{
+			url:      "my-db.europe-west1.firebasedatabase.app",
+			expected: "https://my-db.europe-west1.firebasedatabase.app",
+		},
+		{
+			url:      "https://my-db.europe-west1.firebasedatabase.app/",
+			expected: "https://my-db.europe-west1.firebasedatabase.app",
+		},
+		{
+			url:      "my-db-default-rtdb.asia-southeast1.firebasedatabase.app//",
+			expected: "https://my-db-default-rtdb.asia-southeast1.firebasedatabase.app",
+		},
+		{
+			url:      " HTTPS://my-db-default-rtdb.asia-southeast1.firebasedatabase.app/ ",
+			expected: "https://my-db-default-rtdb.asia-southeast1.firebasedatabase.app",
+		},
+		{
+			url:      "http://localhost:9000/",
+			expected: "http://localhost:9000",
+		},
+	} {
+		fb := New(test.url, nil)
+		assert.Equal(t, test.expected, fb.(*firebase).url, "givenURL: %s", test.url)
+
+		ref, err := fb.Ref("users/1")
+		require.NoError(t, err)
+		assert.Equal(t, test.expected+"/users/1", ref.(*firebase).url, "givenURL: %s", test.url)
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	t.Parallel()
+	fb := New(URL+"/users/1", nil)
+	fb.Auth("token")
+
+	for _, test := range []struct {
+		host     string
+		expected string
+	}{
+		{host: "shard-2.firebaseio.com", expected: "https://shard-2.firebaseio.com/users/1/.json?auth=token"},
+		{host: " shard-2.firebaseio.com ", expected: "https://shard-2.firebaseio.com/users/1/.json?auth=token"},
+		{host: "https://shard-2.firebaseio.com/", expected: "https://shard-2.firebaseio.com/users/1/.json?auth=token"},
+		{host: "http://localhost:9000", expected: "http://localhost:9000/users/1/.json?auth=token"},
+	} {
+		shard, err := fb.WithHost(test.host)
+		require.NoError(t, err, test.host)
+		assert.Equal(t, test.expected, shard.String(), test.host)
+	}
+	assert.Equal(t, URL+"/users/1/.json?auth=token", fb.String())
+
+	for _, host := range []string{"", "shard-2.firebaseio.com/path", "shard-2.firebaseio.com?ns=a", "ftp://shard-2", "user@shard-2", ":9000"} {
+		_, err := fb.WithHost(host)
+		assert.Error(t, err, host)
+	}
+}
+
 func TestNewWithProvidedHttpClient(t *testing.T) {
 	t.Parallel()
 
@@ -92,6 +181,100 @@ func TestUnauth(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAuthWithTokenSource(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.AuthWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	require.NoError(t, fb.Child("foo").Set(true))
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, accessTokenParam+"=token", server.receivedReqs[0].URL.RawQuery)
+
+	fb.Auth("secret")
+	require.NoError(t, fb.Set(true))
+	require.Len(t, server.receivedReqs, 2)
+	assert.Equal(t, authParam+"=secret", server.receivedReqs[1].URL.RawQuery)
+}
+
+func TestAuthWithToken(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireBearerToken("token")
+	fb := New(server.URL, nil)
+	assert.Error(t, fb.Set(true))
+
+	fb.AuthWithToken("token")
+	require.NoError(t, fb.Child("foo").Set(true))
+	ref, err := fb.Child("items").Push("a")
+	require.NoError(t, err)
+	require.NoError(t, ref.Set("b"))
+	assert.Equal(t, "b", server.Get("items/"+ref.Key()))
+
+	// sent in the header only
+	recorder := newTestServer("")
+	defer recorder.Close()
+	other := New(recorder.URL, nil)
+	other.Auth("secret")
+	other.AuthWithToken("token")
+	require.NoError(t, other.Child("foo").Set(true))
+	require.Len(t, recorder.receivedReqs, 1)
+	assert.Equal(t, "Bearer token", recorder.receivedReqs[0].Header.Get("Authorization"))
+	assert.Empty(t, recorder.receivedReqs[0].URL.RawQuery)
+
+	fb.Unauth()
+	assert.Error(t, fb.Set(true))
+	fb.AuthWithToken("token")
+	fb.Auth("secret")
+	assert.Error(t, fb.Set(true))
+}
+
+func TestUnauthTokenSource(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("null")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.AuthWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	fb.Unauth()
+
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	require.NoError(t, fb.Child("foo").Set(true))
+	require.Len(t, server.receivedReqs, 2)
+	for _, req := range server.receivedReqs {
+		assert.Empty(t, req.URL.RawQuery)
+		assert.Empty(t, req.Header.Get("Authorization"))
+	}
+}
+
+func TestPublic(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("null")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.AuthWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	fb.(*firebase).params.Set(authParam, "secret")
+
+	var v interface{}
+	require.NoError(t, fb.Public().Value(&v))
+	require.NoError(t, fb.Value(&v))
+	require.Len(t, server.receivedReqs, 2)
+	assert.Empty(t, server.receivedReqs[0].URL.RawQuery)
+	assert.Empty(t, server.receivedReqs[0].Header.Get("Authorization"))
+
+	// the original keeps its authentication
+	query := server.receivedReqs[1].URL.Query()
+	assert.Equal(t, "token", query.Get(accessTokenParam))
+	assert.Equal(t, "secret", query.Get(authParam))
+}
+
 func TestExists(t *testing.T) {
 	t.Parallel()
 	server := firetest.New()
@@ -113,6 +296,66 @@ func TestExists(t *testing.T) {
 
 }
 
+func TestCount(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"1": map[string]interface{}{"name": "one"},
+		"2": map[string]interface{}{"name": "two"},
+		"3": map[string]interface{}{"name": "three"},
+	})
+	server.Set("leaf", "value")
+
+	fb := New(server.URL, nil)
+	for _, test := range []struct {
+		path     string
+		expected int
+	}{
+		{path: "users", expected: 3},
+		{path: "users/1", expected: 1},
+		{path: "leaf", expected: 0},
+		{path: "missing", expected: 0},
+	} {
+		n, err := fb.Child(test.path).Count()
+		require.NoError(t, err, test.path)
+		assert.Equal(t, test.expected, n, test.path)
+	}
+}
+
+func TestSample(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"10":    map[string]interface{}{"name": "ten"},
+		"2":     map[string]interface{}{"name": "two"},
+		"alice": map[string]interface{}{"name": "alice"},
+	})
+	server.Set("leaf", "value")
+
+	fb := New(server.URL, nil)
+	for _, test := range []struct {
+		path     string
+		n        int
+		expected []string
+	}{
+		{path: "users", n: 2, expected: []string{"2", "10"}},
+		{path: "users", n: 5, expected: []string{"2", "10", "alice"}},
+		{path: "users", n: 0, expected: []string{}},
+		{path: "leaf", n: 2, expected: []string{}},
+		{path: "missing", n: 2, expected: []string{}},
+	} {
+		keys, err := fb.Child(test.path).Sample(test.n)
+		require.NoError(t, err, test.path)
+		assert.Equal(t, test.expected, keys, test.path)
+	}
+}
+
 func TestPush(t *testing.T) {
 	t.Parallel()
 	var (
@@ -136,6 +379,60 @@ func TestPush(t *testing.T) {
 	assert.Equal(t, payload, m, childRef.String())
 }
 
+func TestPushWithContext(t *testing.T) {
+	t.Parallel()
+	var reqs int32
+	received := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		ioutil.ReadAll(req.Body)
+		received <- req
+		if strings.HasPrefix(req.URL.Path, "/rejected") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Permission denied"}`))
+			return
+		}
+		// the request is received but never answered
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	// a push that was never sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := New(server.URL, nil).PushWithContext(ctx, "v")
+	assert.Equal(t, context.Canceled, err)
+	assert.Zero(t, atomic.LoadInt32(&reqs))
+
+	// the key Firebase generates is unknown
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	_, err = New(server.URL, nil).PushWithContext(ctx, "v")
+	require.IsType(t, ErrPushUncertain{}, err)
+	assert.Nil(t, err.(ErrPushUncertain).Ref)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// the key generated locally is known
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		req := <-received
+		assert.Equal(t, "PUT", req.Method)
+		cancel()
+	}()
+	_, err = New(server.URL, nil, WithIdempotentPush(true)).Child("items").PushWithContext(ctx, "v")
+	require.IsType(t, ErrPushUncertain{}, err)
+	ref := err.(ErrPushUncertain).Ref
+	require.NotNil(t, ref)
+	assert.True(t, strings.HasPrefix(ref.Path(), "/items/"), ref.Path())
+
+	// a push Firebase rejected created nothing
+	_, err = New(server.URL, nil).Child("rejected").PushWithContext(context.Background(), "v")
+	assert.IsType(t, ErrHTTP{}, err)
+}
+
 func TestRemove(t *testing.T) {
 	t.Parallel()
 	server := firetest.New()
@@ -186,6 +483,163 @@ func TestUpdate(t *testing.T) {
 	assert.Equal(t, payload, v)
 }
 
+func TestUpdateMultiPath(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{"name": "Al", "age": 30})
+
+	fb := New(server.URL, nil)
+	require.NoError(t, fb.Update(map[string]interface{}{
+		"users/alice/name": "Alice",
+		"/names/Alice/":    "alice",
+		"a-b":              true,
+		"a/b/.priority":    1,
+	}))
+	assert.Equal(t, "Alice", server.Get("users/alice/name"))
+	assert.EqualValues(t, 30, server.Get("users/alice/age"))
+	assert.Equal(t, "alice", server.Get("names/Alice"))
+
+	// nothing is sent for invalid updates
+	written := len(server.History())
+	for _, updates := range []map[string]interface{}{
+		{"users/alice": nil, "users/alice/name": "Bob"},
+		{"users": nil, "a-b": true, "users/bob/name": "Bob"},
+		{"users/alice": 1, "/users/alice/": 2},
+		{"users/al.ice/name": "Bob"},
+		{"users//name": "Bob"},
+	} {
+		assert.Error(t, fb.Update(updates), "%v", updates)
+	}
+	assert.Len(t, server.History(), written)
+}
+
+func TestInvalidPayload(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	cyclic := map[string]interface{}{}
+	cyclic["self"] = cyclic
+
+	fb := New(server.URL, nil)
+	for _, test := range []struct {
+		name    string
+		payload interface{}
+	}{
+		{name: "func", payload: map[string]interface{}{"fn": func() {}}},
+		{name: "cyclic", payload: cyclic},
+	} {
+		_, err := fb.Push(test.payload)
+		assert.IsType(t, ErrInvalidPayload{}, err, test.name)
+
+		err = fb.Set(test.payload)
+		assert.IsType(t, ErrInvalidPayload{}, err, test.name)
+
+		err = fb.Update(test.payload)
+		require.IsType(t, ErrInvalidPayload{}, err, test.name)
+		assert.Contains(t, err.Error(), "invalid payload: json: unsupported", test.name)
+	}
+	assert.Len(t, server.receivedReqs, 0)
+}
+
+func TestErrHTTP(t *testing.T) {
+	t.Parallel()
+	html := "<html><head><title>502 Bad Gateway</title></head><body>" + strings.Repeat("x", 1000) + "</body></html>"
+	for _, test := range []struct {
+		name    string
+		status  int
+		body    string
+		message string
+		path    string
+	}{
+		{
+			name:    "json",
+			status:  http.StatusUnauthorized,
+			body:    `{"error" : "Permission denied"}`,
+			message: "Permission denied",
+		},
+		{
+			name:    "json object",
+			status:  http.StatusBadRequest,
+			body:    `{"error":{"code":"invalid"}}`,
+			message: `{"code":"invalid"}`,
+		},
+		{
+			name:    "rule violation with a path",
+			status:  http.StatusBadRequest,
+			body:    `{"error":{"message":"Validation failed","path":"users/alice/age"}}`,
+			message: `{"message":"Validation failed","path":"users/alice/age"}`,
+			path:    "/users/alice/age",
+		},
+		{
+			name:    "path beside the error",
+			status:  http.StatusUnauthorized,
+			body:    `{"error":"Permission denied","path":"/users/alice/email"}`,
+			message: "Permission denied",
+			path:    "/users/alice/email",
+		},
+		{
+			name:    "path in the message",
+			status:  http.StatusUnauthorized,
+			body:    `{"error":"Permission denied at /users/alice/name."}`,
+			message: "Permission denied at /users/alice/name.",
+			path:    "/users/alice/name",
+		},
+		{
+			name:    "quoted path in the message",
+			status:  http.StatusBadRequest,
+			body:    `{"error":"Validation failed for path '/users/alice/age'"}`,
+			message: "Validation failed for path '/users/alice/age'",
+			path:    "/users/alice/age",
+		},
+		{
+			name:    "position in the message",
+			status:  http.StatusBadRequest,
+			body:    `{"error":"Invalid data; couldn't parse JSON object, array, or value at 1:2."}`,
+			message: "Invalid data; couldn't parse JSON object, array, or value at 1:2.",
+		},
+		{
+			name:    "plain text",
+			status:  http.StatusServiceUnavailable,
+			body:    "service unavailable\n",
+			message: "service unavailable",
+		},
+		{
+			name:    "html",
+			status:  http.StatusBadGateway,
+			body:    html,
+			message: html[:maxErrorBodyLength] + "...",
+		},
+		{
+			name:    "multibyte text",
+			status:  http.StatusBadGateway,
+			body:    "x" + strings.Repeat("é", 600),
+			message: "x" + strings.Repeat("é", 255) + "...",
+		},
+	} {
+		test := test
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+
+		var v interface{}
+		err := New(server.URL, nil).Value(&v)
+		server.Close()
+
+		require.IsType(t, ErrHTTP{}, err, test.name)
+		httpErr := err.(ErrHTTP)
+		assert.Equal(t, test.status, httpErr.StatusCode, test.name)
+		assert.Equal(t, test.message, httpErr.Message, test.name)
+		assert.Equal(t, test.path, httpErr.Path, test.name)
+		assert.True(t, strings.HasPrefix(test.body, strings.TrimSuffix(httpErr.Body, "...")), test.name)
+		assert.True(t, utf8.ValidString(httpErr.Body), test.name)
+		assert.Equal(t, fmt.Sprintf("%d %s: %s", test.status, http.StatusText(test.status), test.message), err.Error(), test.name)
+	}
+}
+
 func TestValue(t *testing.T) {
 	t.Parallel()
 	var (
@@ -205,6 +659,60 @@ func TestValue(t *testing.T) {
 	assert.Equal(t, response, v)
 }
 
+func TestFreshValue(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`"fresh"`)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	var v string
+	require.NoError(t, fb.FreshValue(&v))
+	assert.Equal(t, "fresh", v)
+	require.NoError(t, fb.Value(&v))
+
+	require.Len(t, server.receivedReqs, 2)
+	assert.Equal(t, "no-cache", server.receivedReqs[0].Header.Get("Cache-Control"))
+	assert.Equal(t, "no-cache", server.receivedReqs[0].Header.Get("Pragma"))
+	assert.Empty(t, server.receivedReqs[1].Header.Get("Cache-Control"))
+}
+
+func TestValueOr(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("config", map[string]interface{}{"zero": 0, "port": 9000, "name": ""})
+	fb := New(server.URL, nil).Child("config")
+
+	// missing
+	port := 1
+	require.NoError(t, fb.Child("missing").ValueOr(&port, 8080))
+	assert.Equal(t, 8080, port)
+	var timeout float64
+	require.NoError(t, fb.Child("missing").ValueOr(&timeout, 30))
+	assert.Equal(t, 30.0, timeout)
+	require.NoError(t, fb.Child("missing").ValueOr(&port, nil))
+	assert.Equal(t, 0, port)
+	var tags []string
+	require.NoError(t, fb.Child("missing").ValueOr(&tags, []interface{}{"a"}))
+	assert.Equal(t, []string{"a"}, tags)
+
+	// present but zero
+	require.NoError(t, fb.Child("zero").ValueOr(&port, 8080))
+	assert.Equal(t, 0, port)
+	name := "set"
+	require.NoError(t, fb.Child("name").ValueOr(&name, "default"))
+	assert.Equal(t, "", name)
+
+	// present
+	require.NoError(t, fb.Child("port").ValueOr(&port, 8080))
+	assert.Equal(t, 9000, port)
+
+	assert.Error(t, fb.ValueOr(port, 8080))
+	assert.Error(t, fb.Child("missing").ValueOr(&port, "not a number"))
+}
+
 func TestChild(t *testing.T) {
 	t.Parallel()
 	var (
@@ -216,6 +724,172 @@ func TestChild(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%s/%s", parent.(*firebase).url, childNode), child.(*firebase).url)
 }
 
+func TestPath(t *testing.T) {
+	t.Parallel()
+	root := New(URL, nil)
+
+	for _, tt := range []struct {
+		ref      Firebase
+		expected string
+	}{
+		{root, "/"},
+		{New(URL+"/", nil), "/"},
+		{root.Child("users"), "/users"},
+		{root.Child("users").Child("42").Child("name"), "/users/42/name"},
+		{root.Child("users/42/"), "/users/42"},
+		{root.Child("/users").Child("/42"), "/users/42"},
+		{root.Child("first name"), "/first name"},
+		{New(URL+"/users", nil).Child("42").OrderBy("name"), "/users/42"},
+	} {
+		assert.Equal(t, tt.expected, tt.ref.Path(), tt.ref.String())
+	}
+
+	ref, err := root.Child("users").Ref("/posts/1")
+	require.NoError(t, err)
+	assert.Equal(t, "/posts/1", ref.Path())
+	assert.Equal(t, "1", ref.Key())
+	assert.Equal(t, "", root.Key())
+}
+
+func TestEqual(t *testing.T) {
+	t.Parallel()
+	root := New(URL, nil)
+	users := root.Child("users")
+	fromRef, err := root.Child("posts/1").Ref("/users/42")
+	require.NoError(t, err)
+
+	for _, ref := range []Firebase{
+		users.Child("42"),
+		root.Child("/users/42/"),
+		fromRef,
+		New(URL+"/users/42/", nil),
+		New("HTTPS://somefirebaseapp.firebaseIO.com:443//users/42", nil),
+		New(URL+"/users", nil).Child("42").OrderBy("name").LimitToFirst(2),
+		New(URL, nil, WithPathPrefix("users")).Child("42"),
+	} {
+		assert.True(t, ref.Equal(users.Child("42")), ref.String())
+		assert.True(t, users.Child("42").Equal(ref), ref.String())
+	}
+
+	for _, ref := range []Firebase{
+		users,
+		users.Child("4"),
+		users.Child("42/name"),
+		root.Child("Users/42"),
+		New("http://somefirebaseapp.firebaseio.com/users/42", nil),
+		New("https://otherfirebaseapp.firebaseio.com/users/42", nil),
+	} {
+		assert.False(t, ref.Equal(users.Child("42")), ref.String())
+	}
+	assert.True(t, root.Equal(New(URL+"/", nil)))
+	assert.False(t, root.Equal(nil))
+
+	// emulators tell their databases apart with a namespace
+	emulator := New(URL, nil, WithEmulator("localhost:9000", "app-a"))
+	assert.True(t, emulator.Child("a").Equal(New(URL+"/a", nil, WithEmulator("localhost:9000/", "app-a"))))
+	assert.False(t, emulator.Child("a").Equal(New(URL+"/a", nil, WithEmulator("localhost:9000", "app-b"))))
+}
+
+func TestEstimateSize(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	users := map[string]interface{}{
+		"alice": map[string]interface{}{"name": "alice"},
+		"bob":   map[string]interface{}{"name": "bob"},
+	}
+	server.Set("users", users)
+
+	fb := New(server.URL, nil)
+	size, err := fb.Child("users").EstimateSize()
+	require.NoError(t, err)
+	b, err := json.Marshal(users)
+	require.NoError(t, err)
+	// the test server ends the values it sends with a newline
+	assert.EqualValues(t, len(b)+1, size)
+
+	size, err = fb.Child("missing").EstimateSize()
+	require.NoError(t, err)
+	assert.EqualValues(t, len("null\n"), size)
+
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer denied.Close()
+	_, err = New(denied.URL, nil).EstimateSize()
+	assert.Error(t, err)
+}
+
+func TestChildPaths(t *testing.T) {
+	t.Parallel()
+	root := New(URL, nil)
+
+	for _, tt := range []struct {
+		ref      Firebase
+		expected string
+	}{
+		{root, URL + "/.json"},
+		{root.Child(""), URL + "/.json"},
+		{root.Child("/"), URL + "/.json"},
+		{root.Child("a"), URL + "/a/.json"},
+		{root.Child("/a/"), URL + "/a/.json"},
+		{root.Child("a//b"), URL + "/a/b/.json"},
+		{root.Child("a").Child(""), URL + "/a/.json"},
+		{root.Child(".info/connected"), URL + "/.info/connected.json"},
+		{root.Child(".info").Child("connected"), URL + "/.info/connected.json"},
+		{root.Child(".settings/rules"), URL + "/.settings/rules.json"},
+		{root.Child("a").InfoRef("serverTimeOffset"), URL + "/.info/serverTimeOffset.json"},
+		{New(URL, nil, WithPathPrefix("tenant")).InfoRef("connected"), URL + "/.info/connected.json"},
+		{New(URL+"//a//b/", nil), URL + "/a/b/.json"},
+	} {
+		assert.Equal(t, tt.expected, tt.ref.String())
+		assert.NoError(t, tt.ref.(*firebase).pathErr, tt.expected)
+	}
+
+	info := root.InfoRef("connected")
+	info.Shallow(true)
+	assert.Equal(t, URL+"/.info/connected.json?shallow=true", info.String())
+	assert.Equal(t, "/.info/connected", info.Path())
+	assert.Equal(t, "connected", info.Key())
+	assert.Error(t, root.InfoRef("../a").(*firebase).pathErr)
+
+	ref, err := root.Child("a").Ref("")
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/.json", ref.String())
+	ref, err = root.Ref("//a//b")
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/a/b/.json", ref.String())
+}
+
+func TestChildInvalidPaths(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+	root := New(server.URL, nil)
+
+	for _, path := range []string{"..", "a/../b", "a?b", "a#b", "a[0]", "$key", "a\nb"} {
+		ref := root.Child(path)
+		var v interface{}
+		assert.Error(t, ref.Value(&v), path)
+		assert.Error(t, ref.Child("c").Set(true), path)
+		assert.Error(t, ref.Watch(make(chan Event)), path)
+
+		_, err := root.Ref(path)
+		assert.Error(t, err, path)
+
+		// a valid path replaces the invalid one
+		valid, err := ref.Ref("c")
+		require.NoError(t, err, path)
+		assert.NoError(t, valid.(*firebase).pathErr, path)
+	}
+	assert.Zero(t, atomic.LoadInt32(&requests))
+}
+
 func TestChild_Issue26(t *testing.T) {
 	t.Parallel()
 	parent := New(URL, nil)
@@ -226,6 +900,23 @@ func TestChild_Issue26(t *testing.T) {
 	assert.Len(t, child2.(*firebase).params, 0)
 }
 
+func TestClone(t *testing.T) {
+	t.Parallel()
+	original := New(URL+"/users", nil).OrderBy("name").LimitToFirst(10)
+	original.Auth("token")
+
+	clone := original.Clone()
+	assert.Equal(t, original.String(), clone.String())
+
+	clone.Shallow(true)
+	clone.(*firebase).params.Add(orderByParam, `"age"`)
+	clone.Unauth()
+
+	assert.Equal(t, URL+`/users/.json?auth=token&limitToFirst=10&orderBy=%22name%22`, original.String())
+	assert.Equal(t, []string{`"name"`}, original.(*firebase).params[orderByParam])
+	assert.Equal(t, URL+`/users/.json?limitToFirst=10&orderBy=%22name%22&orderBy=%22age%22&shallow=true`, clone.String())
+}
+
 func TestTimeoutDuration_Headers(t *testing.T) {
 	var fb Firebase
 	done := make(chan struct{})
@@ -235,29 +926,35 @@ func TestTimeoutDuration_Headers(t *testing.T) {
 	}))
 	defer server.Close()
 
-	fb = New(server.URL, nil)
-	fb.(*firebase).clientTimeout = time.Millisecond
+	fb = New(server.URL, nil, withClientTimeout(time.Millisecond))
 	err := fb.Value("")
 	<-done
 	assert.NotNil(t, err)
 	assert.IsType(t, ErrTimeout{}, err)
 
-	// ResponseHeaderTimeout should be TimeoutDuration less the time it took to dial, and should be positive
+	// ResponseHeaderTimeout should be the timeout of the reference
 	require.IsType(t, (*http.Transport)(nil), fb.(*firebase).client.Transport)
 	tr := fb.(*firebase).client.Transport.(*http.Transport)
-	assert.True(t, tr.ResponseHeaderTimeout < TimeoutDuration)
-	assert.True(t, tr.ResponseHeaderTimeout > 0)
+	assert.Equal(t, time.Millisecond, tr.ResponseHeaderTimeout)
 }
 
 func TestTimeoutDuration_Dial(t *testing.T) {
-	fb := New("http://dialtimeouterr.or/", nil)
-	fb.(*firebase).clientTimeout = time.Millisecond
+	fb := New("http://dialtimeouterr.or/", nil, withClientTimeout(time.Millisecond))
 
 	err := fb.Value("")
 	assert.NotNil(t, err)
 	assert.IsType(t, ErrTimeout{}, err)
 
-	// ResponseHeaderTimeout should be negative since the total duration was consumed when dialing
+	// the dial and the response headers share the timeout of the reference
 	require.IsType(t, (*http.Transport)(nil), fb.(*firebase).client.Transport)
-	assert.True(t, fb.(*firebase).client.Transport.(*http.Transport).ResponseHeaderTimeout < 0)
+	tr := fb.(*firebase).client.Transport.(*http.Transport)
+	assert.NotNil(t, tr.DialContext)
+	assert.Equal(t, time.Millisecond, tr.ResponseHeaderTimeout)
+}
+
+// withClientTimeout sets the timeout of the client created by New.
+func withClientTimeout(d time.Duration) Option {
+	return func(fb *firebase) {
+		fb.clientTimeout = d
+	}
 }
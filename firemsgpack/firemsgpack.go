@@ -0,0 +1,312 @@
+/*
+Package firemsgpack implements a firego.Codec encoding the values of
+Firebase in MessagePack (https://msgpack.org), for gateways that accept
+and return MessagePack instead of JSON:
+
+	ref := firego.New(url, nil, firego.WithCodec(firemsgpack.Codec{}))
+
+Only the types of the JSON data model are used: nil, booleans, integers,
+floats, strings, arrays and maps keyed by strings. Binary strings are
+decoded as strings, extensions are rejected.
+*/
+package firemsgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ContentType is the media type of MessagePack.
+const ContentType = "application/msgpack"
+
+var errTruncated = errors.New("msgpack: unexpected end of data")
+
+// Codec is the firego.Codec of MessagePack.
+type Codec struct{}
+
+// ContentType returns the media type of MessagePack.
+func (Codec) ContentType() string {
+	return ContentType
+}
+
+// Accept returns the media type of MessagePack.
+func (Codec) Accept() string {
+	return ContentType
+}
+
+// Encode encodes v, a value of the JSON data model, in MessagePack.
+// Integers are encoded in the fewest bytes that hold them and any other
+// number as a 64 bit float.
+func (Codec) Encode(v interface{}) ([]byte, error) {
+	return encode(nil, v)
+}
+
+// Decode decodes the MessagePack value data holds. Integers are decoded as
+// int64, or uint64 for those too large for an int64, and floats as
+// float64.
+func (Codec) Decode(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d bytes of data after the value", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+func encode(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return encodeInt(b, i), nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return appendUint(append(b, 0xcf), u, 8), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return encodeFloat(b, f), nil
+	case float64:
+		return encodeFloat(b, v), nil
+	case int:
+		return encodeInt(b, int64(v)), nil
+	case int64:
+		return encodeInt(b, v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return encodeInt(b, int64(v)), nil
+		}
+		return appendUint(append(b, 0xcf), v, 8), nil
+	case string:
+		return append(encodeLength(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb), v...), nil
+	case []interface{}:
+		b = encodeLength(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		var err error
+		for _, child := range v {
+			if b, err = encode(b, child); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// the same value is always encoded the same way
+		sort.Strings(keys)
+
+		b = encodeLength(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		var err error
+		for _, k := range keys {
+			b = append(encodeLength(b, len(k), 0xa0, 32, 0xd9, 0xda, 0xdb), k...)
+			if b, err = encode(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: can not encode %T", v)
+}
+
+func encodeInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return appendUint(append(b, 0xd1), uint64(uint16(int16(i))), 2)
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return appendUint(append(b, 0xd2), uint64(uint32(int32(i))), 4)
+	}
+	return appendUint(append(b, 0xd3), uint64(i), 8)
+}
+
+func encodeFloat(b []byte, f float64) []byte {
+	return appendUint(append(b, 0xcb), math.Float64bits(f), 8)
+}
+
+// encodeLength appends the header of a string, an array or a map of n
+// elements: the fix type when n is less than fixMax, and otherwise the
+// first of the 8, 16 and 32 bit types that holds it, arrays and maps
+// having no 8 bit type.
+func encodeLength(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && code8 != 0:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(b, code16), uint64(n), 2)
+	}
+	return appendUint(append(b, code32), uint64(n), 4)
+}
+
+func appendUint(b []byte, u uint64, size int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(b, buf[8-size:]...)
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var buf [8]byte
+	copy(buf[8-size:], b)
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *decoder) value() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.object(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.string(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return d.sized(1, d.string)
+	case 0xc5, 0xda:
+		return d.sized(2, d.string)
+	case 0xc6, 0xdb:
+		return d.sized(4, d.string)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xdc:
+		return d.sized(2, d.array)
+	case 0xdd:
+		return d.sized(4, d.array)
+	case 0xde:
+		return d.sized(2, d.object)
+	case 0xdf:
+		return d.sized(4, d.object)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+// sized decodes, with fn, a value whose length is held in the next size
+// bytes.
+func (d *decoder) sized(size int, fn func(n int) (interface{}, error)) (interface{}, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)) {
+		// every element takes at least a byte
+		return nil, errTruncated
+	}
+	return fn(int(n))
+}
+
+func (d *decoder) string(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) array(n int) (interface{}, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *decoder) object(n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key of type %T, keys must be strings", k)
+		}
+		if m[key], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
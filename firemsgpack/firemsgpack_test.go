@@ -0,0 +1,193 @@
+package firemsgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		value   interface{}
+		encoded []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{false, []byte{0xc2}},
+		{json.Number("7"), []byte{0x07}},
+		{json.Number("-1"), []byte{0xff}},
+		{json.Number("-33"), []byte{0xd0, 0xdf}},
+		{json.Number("200"), []byte{0xd1, 0x00, 0xc8}},
+		{json.Number("-70000"), []byte{0xd2, 0xff, 0xfe, 0xee, 0x90}},
+		{json.Number("5000000000"), []byte{0xd3, 0x00, 0x00, 0x00, 0x01, 0x2a, 0x05, 0xf2, 0x00}},
+		{json.Number("18446744073709551615"), []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{json.Number("1.5"), []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"hi", []byte{0xa2, 'h', 'i'}},
+		{strings.Repeat("a", 40), append([]byte{0xd9, 40}, strings.Repeat("a", 40)...)},
+		{strings.Repeat("a", 300), append([]byte{0xda, 0x01, 0x2c}, strings.Repeat("a", 300)...)},
+		{[]interface{}{json.Number("1"), "a"}, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{map[string]interface{}{"b": true, "a": nil}, []byte{0x82, 0xa1, 'a', 0xc0, 0xa1, 'b', 0xc3}},
+	} {
+		b, err := Codec{}.Encode(test.value)
+		require.NoError(t, err, "%v", test.value)
+		assert.Equal(t, test.encoded, b, "%v", test.value)
+	}
+
+	_, err := Codec{}.Encode(map[string]interface{}{"ch": make(chan int)})
+	assert.Error(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	long := make([]interface{}, 70000)
+	for i := range long {
+		long[i] = int64(i % 3)
+	}
+	for _, v := range []interface{}{
+		nil,
+		true,
+		int64(0),
+		int64(math.MinInt64),
+		int64(math.MaxInt64),
+		uint64(math.MaxUint64),
+		-0.25,
+		"",
+		strings.Repeat("é", 40000),
+		[]interface{}{},
+		long,
+		map[string]interface{}{},
+		map[string]interface{}{
+			"users": map[string]interface{}{
+				"alice": map[string]interface{}{"age": int64(30), "tags": []interface{}{"a", nil, 1.5}},
+			},
+		},
+	} {
+		b, err := Codec{}.Encode(v)
+		require.NoError(t, err)
+		decoded, err := Codec{}.Decode(b)
+		require.NoError(t, err)
+		assert.Equal(t, v, decoded)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	// types firemsgpack never encodes
+	v, err := Codec{}.Decode([]byte{0xca, 0x3f, 0xc0, 0, 0})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+	v, err = Codec{}.Decode([]byte{0xcc, 0xff})
+	require.NoError(t, err)
+	assert.Equal(t, int64(255), v)
+	v, err = Codec{}.Decode([]byte{0xc4, 0x02, 'h', 'i'})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", v)
+
+	for _, data := range [][]byte{
+		{},
+		{0xa3, 'h', 'i'},
+		{0x92, 0x01},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0x81, 0x01, 0x02},
+		{0xd4, 0x01, 0x02},
+		{0x01, 0x02},
+	} {
+		_, err := Codec{}.Decode(data)
+		assert.Error(t, err, "% x", data)
+	}
+}
+
+// gateway serves the database of server in MessagePack.
+func gateway(t *testing.T, server *firetest.Firetest) *httptest.Server {
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode/200 != 1 {
+			// errors are sent as JSON
+			return nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return err
+		}
+		if body, err = (Codec{}).Encode(v); err != nil {
+			return err
+		}
+		resp.Header.Set("Content-Type", ContentType)
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = int64(len(body))
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, ContentType, req.Header.Get("Accept"))
+		if req.ContentLength > 0 {
+			assert.Equal(t, ContentType, req.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			v, err := Codec{}.Decode(body)
+			if err != nil {
+				http.Error(w, `{"error":"invalid msgpack"}`, http.StatusBadRequest)
+				return
+			}
+			body, err = json.Marshal(v)
+			require.NoError(t, err)
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+}
+
+func TestCodec(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	gw := gateway(t, server)
+	defer gw.Close()
+
+	type user struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+	fb := firego.New(gw.URL, nil, firego.WithCodec(Codec{}))
+	alice := user{Name: "alice", Age: 30, Tags: []string{"admin"}}
+	require.NoError(t, fb.Child("users/alice").Set(alice))
+	assert.Equal(t, map[string]interface{}{"name": "alice", "age": 30.0, "tags": []interface{}{"admin"}}, server.Get("users/alice"))
+
+	var read user
+	require.NoError(t, fb.Child("users/alice").Value(&read))
+	assert.Equal(t, alice, read)
+
+	require.NoError(t, fb.Child("users/alice").Update(map[string]interface{}{"age": 31}))
+	bob, err := fb.Child("users").Push(user{Name: "bob"})
+	require.NoError(t, err)
+	var users map[string]user
+	require.NoError(t, fb.Child("users").Value(&users))
+	assert.Equal(t, map[string]user{
+		"alice":   {Name: "alice", Age: 31, Tags: []string{"admin"}},
+		bob.Key(): {Name: "bob"},
+	}, users)
+}
@@ -0,0 +1,50 @@
+/*
+Package fireproto stores protocol buffer messages in Firebase using their
+canonical JSON mapping (https://protobuf.dev/programming-guides/json/), so
+that the values written follow the same field name and enum conventions as
+the other services speaking proto JSON. It lives apart from firego so that
+only the applications using it depend on protobuf.
+*/
+package fireproto
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/zabawaba99/firego"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// MarshalOptions are the options SetProto serializes messages with. By
+// default fields are named in lowerCamelCase and enums by their name.
+var MarshalOptions = protojson.MarshalOptions{}
+
+// UnmarshalOptions are the options ValueProto parses messages with. By
+// default the fields that m does not know of are ignored, since the values
+// written by other clients may hold more than m.
+var UnmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// SetProto replaces the value of ref with the proto JSON representation of
+// m, the way Set replaces it with the JSON representation of a Go value.
+func SetProto(ref firego.Firebase, m proto.Message) error {
+	b, err := MarshalOptions.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ref.SetJSON(bytes.NewReader(b))
+}
+
+// ValueProto reads the value of ref into m, which is reset first. A
+// reference with no value leaves m empty.
+func ValueProto(ref firego.Firebase, m proto.Message) error {
+	var raw json.RawMessage
+	if err := ref.Value(&raw); err != nil {
+		return err
+	}
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		proto.Reset(m)
+		return nil
+	}
+	return UnmarshalOptions.Unmarshal(raw, m)
+}
@@ -0,0 +1,65 @@
+package fireproto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/internal/firetest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestSetProto(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := firego.New(server.URL+"/apis/library", nil)
+	api := &apipb.Api{
+		Name:    "library",
+		Version: "v1",
+		Methods: []*apipb.Method{{Name: "GetBook", RequestTypeUrl: "type.googleapis.com/GetBookRequest"}},
+		Syntax:  typepb.Syntax_SYNTAX_PROTO3,
+	}
+	require.NoError(t, SetProto(fb, api))
+
+	// the proto JSON conventions are followed
+	assert.Equal(t, map[string]interface{}{
+		"name":    "library",
+		"version": "v1",
+		"methods": []interface{}{
+			map[string]interface{}{"name": "GetBook", "requestTypeUrl": "type.googleapis.com/GetBookRequest"},
+		},
+		"syntax": "SYNTAX_PROTO3",
+	}, server.Get("apis/library"))
+
+	var read apipb.Api
+	require.NoError(t, ValueProto(fb, &read))
+	assert.True(t, proto.Equal(api, &read))
+}
+
+func TestValueProto(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	// fields unknown to the message are ignored
+	server.Set("apis/library", map[string]interface{}{"name": "library", "owner": "books-team"})
+	fb := firego.New(server.URL+"/apis/library", nil)
+	api := &apipb.Api{Version: "v2"}
+	require.NoError(t, ValueProto(fb, api))
+	assert.True(t, proto.Equal(&apipb.Api{Name: "library"}, api))
+
+	// a missing value resets the message
+	require.NoError(t, ValueProto(firego.New(server.URL+"/apis/missing", nil), api))
+	assert.True(t, proto.Equal(&apipb.Api{}, api))
+
+	// values that are not messages fail
+	server.Set("apis/library", "library")
+	assert.Error(t, ValueProto(fb, api))
+}
@@ -0,0 +1,73 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// Flatten reads the value of the reference and returns its leaves keyed by
+// their path relative to the reference, the keys of every level joined
+// with slashes and the elements of arrays keyed by their index, for
+// feeding tabular systems:
+//
+//	{"user": {"address": {"zip": 12345}, "tags": ["a", "b"]}}
+//
+// flattens to
+//
+//	{"user/address/zip": 12345, "user/tags/0": "a", "user/tags/1": "b"}
+//
+// Numbers are float64, as they are when decoded into an interface{}. A
+// reference holding a single value flattens to that value under the empty
+// key and one holding no value to an empty map. Unflatten is the inverse.
+func (fb *firebase) Flatten() (map[string]interface{}, error) {
+	body, err := fb.cachedValue(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+
+	flat := map[string]interface{}{}
+	flatten(flat, "", v)
+	return flat, nil
+}
+
+func flatten(flat map[string]interface{}, path string, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, child := range v {
+			flatten(flat, joinPath(path, k), child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(flat, joinPath(path, strconv.Itoa(i)), child)
+		}
+	default:
+		flat[path] = v
+	}
+}
+
+// Unflatten returns the value flat, a map returned by Flatten, is the
+// flattened form of. Arrays come back as objects keyed by index, which
+// Firebase stores the same way, so that setting the value Unflatten
+// returns writes back the value that was flattened. When both a path and
+// one of its descendants are keys of flat, the descendant is kept.
+func Unflatten(flat map[string]interface{}) interface{} {
+	paths := make([]string, 0, len(flat))
+	for path := range flat {
+		paths = append(paths, path)
+	}
+	// ancestors come first
+	sort.Strings(paths)
+
+	var v interface{}
+	for _, path := range paths {
+		v = setPath(v, splitPath(path), flat[path])
+	}
+	return v
+}
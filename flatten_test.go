@@ -0,0 +1,79 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users/alice", map[string]interface{}{
+		"name": "alice",
+		"address": map[string]interface{}{
+			"zip":  12345,
+			"city": "Springfield",
+		},
+		"tags":   []interface{}{"admin", "ops"},
+		"scores": []interface{}{map[string]interface{}{"game": "chess", "points": 3}, 5},
+		"active": true,
+	})
+	server.Set("count", 42)
+	fb := New(server.URL, nil)
+
+	expected := map[string]interface{}{
+		"name":            "alice",
+		"address/zip":     12345.0,
+		"address/city":    "Springfield",
+		"tags/0":          "admin",
+		"tags/1":          "ops",
+		"scores/0/game":   "chess",
+		"scores/0/points": 3.0,
+		"scores/1":        5.0,
+		"active":          true,
+	}
+	flat, err := fb.Child("users/alice").Flatten()
+	require.NoError(t, err)
+	assert.Equal(t, expected, flat)
+
+	flat, err = fb.Child("count").Flatten()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"": 42.0}, flat)
+
+	flat, err = fb.Child("missing").Flatten()
+	require.NoError(t, err)
+	assert.Empty(t, flat)
+
+	// writing back the unflattened value round trips
+	require.NoError(t, fb.Child("copy").Set(Unflatten(expected)))
+	flat, err = fb.Child("copy").Flatten()
+	require.NoError(t, err)
+	assert.Equal(t, expected, flat)
+}
+
+func TestUnflatten(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, map[string]interface{}{
+		"user": map[string]interface{}{
+			"address": map[string]interface{}{"zip": 12345},
+			"tags":    map[string]interface{}{"0": "a", "1": "b"},
+		},
+	}, Unflatten(map[string]interface{}{
+		"user/address/zip": 12345,
+		"user/tags/0":      "a",
+		"/user/tags/1/":    "b",
+	}))
+
+	// descendants win over their ancestors
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 2}},
+		Unflatten(map[string]interface{}{"a": 1, "a/b": 2}))
+
+	assert.Equal(t, 42, Unflatten(map[string]interface{}{"": 42}))
+	assert.Nil(t, Unflatten(map[string]interface{}{}))
+}
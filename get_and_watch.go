@@ -0,0 +1,121 @@
+package firego
+
+import (
+	"context"
+	"time"
+)
+
+// GetAndWatch watches the reference like Watch does, with the guarantee
+// that the first event passed over to the given chan is a put event at "/"
+// holding the current value of the reference, and that every change made
+// after that snapshot is passed over after it, so that nothing is missed
+// between reading the value and watching it. Reading the value with Value
+// before calling Watch does not guarantee it, the changes made in between
+// are lost.
+//
+// When the connection breaks, GetAndWatch reconnects after the delays of
+// WithBackoff, or twice the heartbeat doubling after every failed attempt,
+// and the first event of the new connection is a fresh snapshot of the
+// value, which replaces the value held by the consumer along with the
+// changes it missed while disconnected. It gives up after the number of
+// consecutive failed reconnects set with WithMaxReconnects, if any,
+// passing over an ErrMaxReconnects, or as soon as Firebase responds with
+// an ErrDatabaseUnavailable, or denies the stream with a 401 or a 403,
+// passing over the error the last connection failed with, and closes the
+// chan. A cancel or auth_revoked event ends the watch, the same way it
+// ends Watch. The watch is stopped with StopWatching.
+func (fb *firebase) GetAndWatch(notifications chan Event) error {
+	return fb.startEvents(notifications, fb.reconnectingWatch(false))
+}
+
+// reconnectingWatch returns the eventSource of GetAndWatch or, if managed
+// is set, of Watch with WithWatchReconnect.
+func (fb *firebase) reconnectingWatch(managed bool) eventSource {
+	return func(ctx context.Context, stop chan struct{}) (chan Event, error) {
+		token := fb.accessToken()
+		events, err := fb.watch(ctx, stop, false)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan Event)
+		go fb.reconnectWatch(ctx, stop, events, out, managed, token)
+		return out, nil
+	}
+}
+
+// reconnectWatch passes the events of a watch over to out, opening a new
+// watch whenever the connection of the last one breaks, until stop is
+// closed. out is closed once the last watch has been torn down. A managed
+// watch, whose connection was opened with token, also passes over a
+// reconnected event before the first event of every new connection, and
+// reconnects after an auth_revoked event once the token source of the
+// reference gives a new token.
+func (fb *firebase) reconnectWatch(ctx context.Context, stop chan struct{}, events chan Event, out chan Event, managed bool, token string) {
+	defer close(out)
+
+	backoff := fb.reconnectBackoff()
+	var failures int
+	var cause interface{}
+	for {
+		var received, broken bool
+		var last Event
+		for event := range events {
+			if event.Type == EventTypeError {
+				broken, last = true, event
+				continue
+			}
+			if managed && event.Type == EventTypeAuthRevoked && fb.tokenSource != nil && fb.accessToken() != token {
+				// the token expired and has been refreshed since
+				broken, last = true, Event{Type: EventTypeError, Data: ErrAuthRevoked}
+				continue
+			}
+			if managed && !received && cause != nil {
+				out <- Event{Type: EventTypeReconnected, Data: cause}
+			}
+			received = true
+			out <- event
+		}
+		if !broken {
+			// stopped or ended by Firebase
+			return
+		}
+		if e, ok := last.Data.(ErrHTTP); ok && isPermanentStreamError(e.StatusCode) {
+			// reconnecting would be denied again
+			out <- last
+			return
+		}
+		if received && failures > 0 {
+			// the last reconnect worked
+			failures = 0
+			backoff.Reset()
+		}
+		cause = last.Data
+
+		for events = nil; events == nil; {
+			if fb.maxReconnects > 0 && failures >= fb.maxReconnects {
+				err, _ := last.Data.(error)
+				out <- Event{Type: EventTypeError, Data: maxReconnectsError{err}}
+				return
+			}
+			fb.logStream(LogLevelInfo, StreamEvent{Type: StreamReconnecting})
+			select {
+			case <-time.After(backoff.NextDelay(failures)):
+			case <-stop:
+				return
+			}
+			failures++
+
+			var err error
+			token = fb.accessToken()
+			if events, err = fb.watch(ctx, stop, false); err != nil {
+				last = Event{Type: EventTypeError, Data: err}
+			}
+			if isDatabaseUnavailable(err) {
+				// reconnecting would never work
+				out <- last
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestGetAndWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", 1)
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.GetAndWatch(notifications))
+	defer fb.StopWatching()
+
+	// the snapshot comes first
+	event := <-notifications
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, event.Data)
+
+	// followed by every change made after it
+	server.Set("b", 2)
+	event = <-notifications
+	assert.Equal(t, "/b", event.Path)
+	assert.Equal(t, 2.0, event.Data)
+}
+
+func TestGetAndWatchReconnect(t *testing.T) {
+	t.Parallel()
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&connections, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if n > 3 {
+			// the database is unreachable
+			return
+		}
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":{\"v\":%d}}\n\n", n)
+		if n == 1 {
+			fmt.Fprint(w, "event: put\ndata: {\"path\":\"/v\",\"data\":10}\n\n")
+		}
+		// the connection breaks
+	}))
+	defer server.Close()
+
+	b := &recordingBackoff{}
+	fb := New(server.URL, nil, WithBackoff(b), WithMaxReconnects(2))
+	notifications := make(chan Event)
+	require.NoError(t, fb.GetAndWatch(notifications))
+	defer fb.StopWatching()
+
+	var events []Event
+	for event := range notifications {
+		events = append(events, event)
+	}
+	require.Len(t, events, 5)
+	assert.Equal(t, map[string]interface{}{"v": 1.0}, events[0].Data)
+	assert.Equal(t, "/v", events[1].Path)
+	// every reconnect starts with a fresh snapshot
+	for i, event := range events[2:4] {
+		assert.Equal(t, EventTypePut, event.Type)
+		assert.Equal(t, "/", event.Path)
+		assert.Equal(t, map[string]interface{}{"v": float64(i + 2)}, event.Data)
+	}
+	assert.Equal(t, EventTypeError, events[4].Type)
+	err, ok := events[4].Data.(error)
+	require.True(t, ok)
+	assert.True(t, errors.Is(err, ErrMaxReconnects), "%v", err)
+	assert.IsType(t, ErrServerClosed{}, fb.WatchErr())
+	assert.True(t, errors.Is(fb.WatchErr(), ErrMaxReconnects))
+
+	// the reconnects that received a snapshot did not count as failures
+	attempts, resets := b.calls()
+	assert.Equal(t, []int{0, 0, 0, 1}, attempts)
+	assert.Equal(t, 2, resets)
+	assert.EqualValues(t, 5, atomic.LoadInt32(&connections))
+}
+
+func TestGetAndWatchStop(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: put\ndata: {\"path\":\"/\",\"data\":null}\n\n")
+	}))
+	defer server.Close()
+
+	// a stopped watch does not reconnect
+	fb := New(server.URL, nil, WithBackoff(constantBackoff(time.Hour)))
+	notifications := make(chan Event)
+	require.NoError(t, fb.GetAndWatch(notifications))
+	<-notifications
+	fb.StopWatching()
+	select {
+	case _, ok := <-notifications:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the watch was not stopped")
+	}
+	assert.NoError(t, fb.WatchErr())
+}
+
+// constantBackoff always waits the same delay.
+type constantBackoff time.Duration
+
+func (b constantBackoff) NextDelay(int) time.Duration { return time.Duration(b) }
+
+func (constantBackoff) Reset() {}
@@ -0,0 +1,61 @@
+package firego
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Head makes the lightest request the REST API answers at the reference,
+// a shallow read, and returns its response without the body, for probing
+// whether the location can be read, or holds anything, without
+// downloading its value. The REST API does not answer HEAD requests, so
+// Head sends a GET asking for the keys of the children only, without the
+// query parameters of the reference, which can not be combined with a
+// shallow read.
+//
+// The body is read to the end and closed before Head returns, so that the
+// connection can be reused, and the Body of the response returned is
+// empty. Any response is returned along with a nil error, its status code
+// telling how the request went, 401 for a read the security rules deny
+// for instance; an error is only returned when no response was received.
+func (fb *firebase) Head() (*http.Response, error) {
+	c := fb.copy()
+	c.noCache = true
+	c.clearReadParams()
+	c.params.Set(shallowParam, "true")
+
+	ctx, cancel := c.requestContext(context.Background())
+	defer cancel()
+	req, err := c.newRequest(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.requests.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.requests.release()
+
+	info := RequestInfo{
+		Method:    req.Method,
+		URL:       req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		Operation: c.operationName(req.Context()),
+	}
+	start := time.Now()
+	resp, err := c.send(req)
+	if err == nil {
+		info.StatusCode = resp.StatusCode
+		info.BytesIn, err = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		resp.Body = http.NoBody
+	}
+	info.Duration = time.Since(start)
+	info.Err = err
+	c.logRequest(info)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
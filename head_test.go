@@ -0,0 +1,67 @@
+package firego
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHead(t *testing.T) {
+	t.Parallel()
+	var conns int32
+	var requests []*http.Request
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		if req.URL.Query().Get(authParam) != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Permission denied"}`))
+			return
+		}
+		w.Header().Set("X-Served-By", "test")
+		w.Write([]byte(`{"alice":true,"bob":true}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	fb := New(server.URL+"/users", client, withNamespace("db"))
+	fb.Auth("token")
+	resp, err := fb.OrderBy("name").LimitToFirst(1).Head()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "test", resp.Header.Get("X-Served-By"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// a shallow read, without the query
+	require.Len(t, requests, 1)
+	assert.Equal(t, "GET", requests[0].Method)
+	assert.Equal(t, "/users/.json", requests[0].URL.Path)
+	assert.Equal(t, "true", requests[0].URL.Query().Get(shallowParam))
+	assert.Empty(t, requests[0].URL.Query().Get(orderByParam))
+	assert.Equal(t, "db", requests[0].URL.Query().Get(namespaceParam))
+
+	// a denied read is a response, not an error
+	fb.Unauth()
+	resp, err = fb.Head()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// the connection is reused
+	_, err = fb.Head()
+	require.NoError(t, err)
+	assert.Len(t, requests, 3)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
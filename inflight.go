@@ -0,0 +1,75 @@
+package firego
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// WithMaxInFlight limits the number of requests, made by Value, Set and
+// every other method but the streams opened by Watch, that the reference
+// and every reference derived from it may have in flight at the same time
+// to n. A request that would exceed the limit waits for one of them to
+// complete, or for its context to be done, in which case it fails with
+// the error of the context, an ErrTimeout when its deadline passed.
+// Retries wait for a new slot, their delay does not hold one.
+//
+// The limit bounds the concurrency of an application rather than its rate,
+// WithMaxConcurrentStreams limits the streams. A value of 0, the default,
+// does not limit the requests.
+func WithMaxInFlight(n int) Option {
+	return func(fb *firebase) {
+		fb.requests = &requestLimiter{}
+		if n > 0 {
+			fb.requests.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// InFlight returns the number of requests in flight on the reference and
+// every reference sharing its root, the ones waiting for a slot of
+// WithMaxInFlight excluded.
+func (fb *firebase) InFlight() int {
+	return fb.requests.count()
+}
+
+// requestLimiter counts the requests in flight and bounds their number
+// when it has slots, a nil requestLimiter does neither.
+type requestLimiter struct {
+	slots    chan struct{}
+	inFlight int64
+}
+
+func (l *requestLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return ErrTimeout{ctx.Err()}
+			}
+			return ctx.Err()
+		}
+	}
+	atomic.AddInt64(&l.inFlight, 1)
+	return nil
+}
+
+func (l *requestLimiter) release() {
+	if l == nil {
+		return
+	}
+	atomic.AddInt64(&l.inFlight, -1)
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *requestLimiter) count() int {
+	if l == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&l.inFlight))
+}
@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	t.Parallel()
+	var current, max int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		<-release
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	root := New(server.URL, nil, WithMaxInFlight(2))
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := root.Child("a")
+			if i%2 == 0 {
+				assert.NoError(t, child.Set(i))
+				return
+			}
+			var v interface{}
+			assert.NoError(t, child.Value(&v))
+		}(i)
+	}
+	assert.Eventually(t, func() bool {
+		return root.InFlight() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// requests waiting for a slot give up with their context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var v interface{}
+	assert.Equal(t, ErrTimeout{context.DeadlineExceeded}, root.WithContext(ctx).Value(&v))
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	assert.Equal(t, context.Canceled, root.WithContext(ctx).Value(&v))
+
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&max))
+	assert.Equal(t, 0, root.InFlight())
+
+	// references with no limit count their requests
+	unlimited := New(server.URL, nil)
+	require.NoError(t, unlimited.Value(&v))
+	assert.Equal(t, 0, unlimited.InFlight())
+}
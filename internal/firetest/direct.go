@@ -3,6 +3,7 @@ package firetest
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"sync/atomic"
@@ -20,6 +21,17 @@ func (ft *Firetest) RequireAuth(v bool) {
 	atomic.StoreInt32(ft.requireAuth, val)
 }
 
+// RequireBearerToken determines whether or not a Firetest server will
+// require that each request carry the OAuth2 access token given, in an
+// "Authorization: Bearer" header or in the access_token query parameter,
+// the way Firebase authenticates service accounts. Requests without it are
+// answered with a 401. An empty token stops requiring one.
+func (ft *Firetest) RequireBearerToken(token string) {
+	ft.authMtx.Lock()
+	defer ft.authMtx.Unlock()
+	ft.bearerToken = token
+}
+
 // Create generates a new child under the given location
 // using a unique name and returns the name
 //
@@ -48,16 +60,40 @@ func (ft *Firetest) Delete(path string) {
 // and will leave others untouched. Note that the update function is equivalent
 // to calling Set() on the named children; it does not recursively update children
 // if they are objects. Passing null as a value for a child is equivalent to
-// calling remove() on that child.
+// calling remove() on that child. Children may be named by a path relative
+// to the location to update several locations at once.
 //
 // Reference https://www.firebase.com/docs/rest/api/#section-patch
 func (ft *Firetest) Update(path string, v interface{}) {
 	path = sanitizePath(path)
 	if v == nil {
 		ft.db.del(path)
-	} else {
-		ft.db.update(path, sync.NewNode("", v))
+		return
+	}
+
+	if m, ok := v.(map[string]interface{}); ok && isMultiPath(m) {
+		for k, child := range m {
+			childPath := strings.Trim(path+"/"+strings.Trim(k, "/"), "/")
+			if child == nil {
+				ft.db.del(childPath)
+			} else {
+				ft.db.add(childPath, sync.NewNode("", child))
+			}
+		}
+		return
+	}
+	ft.db.update(path, sync.NewNode("", v))
+}
+
+// isMultiPath reports whether an update names children by
+// path or removes children, which can not be merged in one step.
+func isMultiPath(m map[string]interface{}) bool {
+	for k, v := range m {
+		if v == nil || strings.Contains(strings.Trim(k, "/"), "/") {
+			return true
+		}
 	}
+	return false
 }
 
 // Set writes data to at the given location.
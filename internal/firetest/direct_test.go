@@ -1,11 +1,13 @@
 package firetest
 
 import (
+	"net/http"
 	"strings"
 	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zabawaba99/firego/sync"
 )
 
@@ -21,6 +23,33 @@ func TestRequireAuth(t *testing.T) {
 	}
 }
 
+func TestRequireBearerToken(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+
+	get := func(header, query string) int {
+		req, err := http.NewRequest("GET", ft.URL+"/.json"+query, nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	ft.RequireBearerToken("token")
+	assert.Equal(t, http.StatusUnauthorized, get("", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer other", ""))
+	assert.Equal(t, http.StatusOK, get("Bearer token", ""))
+	assert.Equal(t, http.StatusOK, get("", "?access_token=token"))
+
+	ft.RequireBearerToken("")
+	assert.Equal(t, http.StatusOK, get("", ""))
+}
+
 func TestCreate(t *testing.T) {
 	var (
 		ft = New()
@@ -96,6 +125,24 @@ func TestUpdateNil(t *testing.T) {
 	assert.Nil(t, ft.db.get(path+"/3"))
 }
 
+func TestUpdateMultiPath(t *testing.T) {
+	var (
+		ft   = New()
+		path = "foo"
+	)
+	ft.Set(path+"/bar/1", "one")
+	ft.Set(path+"/bar/2", "two")
+
+	ft.Update(path, map[string]interface{}{
+		"bar/1":   nil,
+		"baz/1/a": "one",
+	})
+
+	assert.Nil(t, ft.Get(path+"/bar/1"))
+	assert.Equal(t, "two", ft.Get(path+"/bar/2"))
+	assert.Equal(t, "one", ft.Get(path+"/baz/1/a"))
+}
+
 func TestSet(t *testing.T) {
 	var (
 		ft   = New()
@@ -0,0 +1,127 @@
+package firetest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FaultSpec describes a way the server misbehaves on the requests it
+// matches, for testing how clients cope with errors, slow responses and
+// dropped streams:
+//
+//	ft.InjectFault(firetest.FaultSpec{Status: 500, Times: 3}) // three 500s, then success
+//	ft.InjectFault(firetest.FaultSpec{Status: 401, Times: 1}) // a 401 once
+//	ft.InjectFault(firetest.FaultSpec{Latency: time.Second})  // every request a second late
+//	ft.InjectFault(firetest.FaultSpec{DropAfter: 2})          // streams closed after two events
+//
+// A fault only applies to the requests matching its Method and Path, and
+// only to streaming requests when DropAfter is set.
+type FaultSpec struct {
+	// Method is the HTTP method of the requests the fault applies to,
+	// any method when empty.
+	Method string
+	// Path is the location the fault applies to, along with its
+	// descendants, such as "users/alice", any location when empty.
+	Path string
+
+	// Latency delays the requests before they are answered.
+	Latency time.Duration
+	// Status answers the requests with the status code instead of serving
+	// them, when not 0.
+	Status int
+	// Body is the body of the responses with Status, a JSON error naming
+	// the status when empty.
+	Body string
+	// DropAfter closes the event streams once they have sent as many
+	// events, after the initial put, when not 0.
+	DropAfter int
+
+	// Times is the number of requests the fault applies to before it is
+	// removed, every request until ResetFaults when 0.
+	Times int
+}
+
+// fault is a FaultSpec injected into a server.
+type fault struct {
+	spec FaultSpec
+	left int
+}
+
+func (f *fault) matches(req *http.Request, path string, stream bool) bool {
+	if f.spec.Method != "" && !strings.EqualFold(f.spec.Method, req.Method) {
+		return false
+	}
+	if f.spec.DropAfter > 0 && !stream {
+		return false
+	}
+	p := sanitizePath(f.spec.Path)
+	return p == "" || path == p || strings.HasPrefix(path, p+"/")
+}
+
+// InjectFault makes the server misbehave as f describes on the requests it
+// matches. Faults apply in the order they were injected, and only the
+// first matching one applies to a request. The faults are kept until
+// they have applied Times times or until ResetFaults is called: a server
+// shared by several tests should be reset between them.
+func (ft *Firetest) InjectFault(f FaultSpec) {
+	ft.faultsMtx.Lock()
+	defer ft.faultsMtx.Unlock()
+	ft.faults = append(ft.faults, &fault{spec: f, left: f.Times})
+}
+
+// ResetFaults removes the faults injected with InjectFault, so that the
+// server serves every request normally again.
+func (ft *Firetest) ResetFaults() {
+	ft.faultsMtx.Lock()
+	defer ft.faultsMtx.Unlock()
+	ft.faults = nil
+}
+
+// takeFault returns the fault applying to req, if any, and counts the
+// request against its Times.
+func (ft *Firetest) takeFault(req *http.Request) (FaultSpec, bool) {
+	path := sanitizePath(req.URL.Path)
+	stream := req.Method == "GET" && req.Header.Get("Accept") == "text/event-stream"
+
+	ft.faultsMtx.Lock()
+	defer ft.faultsMtx.Unlock()
+	for i, f := range ft.faults {
+		if !f.matches(req, path, stream) {
+			continue
+		}
+		if f.left > 0 {
+			if f.left--; f.left == 0 {
+				ft.faults = append(ft.faults[:i], ft.faults[i+1:]...)
+			}
+		}
+		return f.spec, true
+	}
+	return FaultSpec{}, false
+}
+
+// applyFault delays req as the fault applying to it requires, and answers
+// it when the fault has a Status, in which case it returns true. It
+// returns the number of events the stream of req is dropped after, 0 for
+// no limit.
+func (ft *Firetest) applyFault(w http.ResponseWriter, req *http.Request) (dropAfter int, answered bool) {
+	f, ok := ft.takeFault(req)
+	if !ok {
+		return 0, false
+	}
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	if f.Status == 0 {
+		return f.DropAfter, false
+	}
+
+	body := f.Body
+	if body == "" {
+		body = fmt.Sprintf(`{"error":%q}`, http.StatusText(f.Status))
+	}
+	w.WriteHeader(f.Status)
+	w.Write([]byte(body))
+	return 0, true
+}
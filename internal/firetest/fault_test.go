@@ -0,0 +1,119 @@
+package firetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectFault(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+	ft.Set("users/alice", "alice")
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ft.URL + "/" + path + ".json")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	// N consecutive errors, then success
+	ft.InjectFault(FaultSpec{Status: http.StatusInternalServerError, Times: 2})
+	for i := 0; i < 2; i++ {
+		status, body := get("users/alice")
+		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.Equal(t, `{"error":"Internal Server Error"}`, body)
+	}
+	status, body := get("users/alice")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `"alice"`, body)
+
+	// restricted to a method and a location
+	ft.InjectFault(FaultSpec{Method: "PUT", Path: "users", Status: http.StatusUnauthorized, Body: `{"error":"denied"}`, Times: 1})
+	status, _ = get("users/alice")
+	assert.Equal(t, http.StatusOK, status)
+	req, err := http.NewRequest("PUT", ft.URL+"/other.json", strings.NewReader(`1`))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	req, err = http.NewRequest("PUT", ft.URL+"/users/bob.json", strings.NewReader(`"bob"`))
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body2, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `{"error":"denied"}`, string(body2))
+	assert.Nil(t, ft.Get("users/bob"))
+
+	// latency until reset
+	ft.InjectFault(FaultSpec{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	get("users/alice")
+	get("users/alice")
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	ft.ResetFaults()
+	start = time.Now()
+	get("users/alice")
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+}
+
+func TestInjectFaultDropStream(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+
+	// plain reads do not take the fault
+	ft.InjectFault(FaultSpec{DropAfter: 2, Times: 1})
+	resp, err := http.Get(ft.URL + "/doc.json")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	events, stop := readEvents(t, ft.URL+"/doc.json")
+	defer stop()
+	for ft.db.watchersCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, v := range []float64{1, 2} {
+		ft.Apply(Mutation{Type: "put", Path: "/doc", Data: v})
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			require.FailNow(t, "no event received")
+		}
+	}
+
+	// the stream ends after the second event
+	select {
+	case event, ok := <-events:
+		assert.False(t, ok, "unexpected event %s", event)
+	case <-time.After(time.Second):
+		require.FailNow(t, "stream not dropped")
+	}
+
+	// the next stream is not dropped
+	events, stop = readEvents(t, ft.URL+"/doc.json")
+	defer stop()
+	for ft.db.watchersCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, v := range []float64{4, 5, 6} {
+		ft.Apply(Mutation{Type: "put", Path: "/doc", Data: v})
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			require.FailNow(t, "no event received")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package firetest
+
+import (
+	_sync "sync"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// Mutation is a write applied to the data of the server, in the form of
+// the event streamed to the watchers of its location.
+type Mutation struct {
+	// Type is "put" or "patch", the type of the event.
+	Type string
+	// Path is the location written, relative to the root and starting
+	// with a slash.
+	Path string
+	// Data is the value written, nil for a removal. The data of a patch
+	// is the object of the children written.
+	Data interface{}
+}
+
+// history records the mutations applied to a notifyDB.
+type history struct {
+	mtx       _sync.Mutex
+	mutations []Mutation
+}
+
+func (h *history) record(name, path string, n *sync.Node) {
+	m := Mutation{Type: name, Path: "/" + path}
+	if n != nil {
+		m.Data = n.Objectify()
+	}
+	h.mtx.Lock()
+	h.mutations = append(h.mutations, m)
+	h.mtx.Unlock()
+}
+
+// History returns the mutations applied to the data of the server so far,
+// oldest first, whether they were made with requests or with the methods
+// of the server, such as Set. A multi-path update is recorded as one put
+// per location written.
+func (ft *Firetest) History() []Mutation {
+	ft.db.history.mtx.Lock()
+	defer ft.db.history.mtx.Unlock()
+	return append([]Mutation(nil), ft.db.history.mutations...)
+}
+
+// DrainHistory returns the mutations History returns and clears them, so
+// that the next call only returns the mutations applied in between.
+func (ft *Firetest) DrainHistory() []Mutation {
+	ft.db.history.mtx.Lock()
+	defer ft.db.history.mtx.Unlock()
+	mutations := ft.db.history.mutations
+	ft.db.history.mutations = nil
+	return mutations
+}
+
+// Apply applies m to the data of the server and records it. Unlike the
+// writes made with requests or with Set and the other methods, whose
+// watchers are notified in the background, Apply only returns once every
+// stream watching the location has taken the event of the mutation, so
+// that mutations applied one after the other are streamed in order.
+//
+// A patch whose Data is not an object, or a put whose Data is nil,
+// removes the location.
+func (ft *Firetest) Apply(m Mutation) {
+	path := sanitizePath(m.Path)
+	var n *sync.Node
+	if m.Data != nil {
+		n = sync.NewNode("", m.Data)
+	}
+	if _, ok := m.Data.(map[string]interface{}); m.Type == "patch" && !ok {
+		n = nil
+	}
+	ft.db.notify(ft.db.apply(m.Type, path, n))
+}
+
+// Replay steps through mutations applied to a server.
+//
+// A Replay is safe for concurrent use.
+type Replay struct {
+	ft        *Firetest
+	mtx       _sync.Mutex
+	mutations []Mutation
+}
+
+// Replay returns a Replay applying the given mutations, typically ones
+// recorded by History, to the server one at a time.
+func (ft *Firetest) Replay(mutations []Mutation) *Replay {
+	return &Replay{ft: ft, mutations: append([]Mutation(nil), mutations...)}
+}
+
+// Step applies the next mutation with Apply and returns it, along with
+// false if there was none left.
+func (r *Replay) Step() (Mutation, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.mutations) == 0 {
+		return Mutation{}, false
+	}
+	m := r.mutations[0]
+	r.mutations = r.mutations[1:]
+	r.ft.Apply(m)
+	return m, true
+}
+
+// Remaining returns the number of mutations left to apply.
+func (r *Replay) Remaining() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return len(r.mutations)
+}
+
+// All applies, in order, every mutation left.
+func (r *Replay) All() {
+	for {
+		if _, ok := r.Step(); !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package firetest
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	_sync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+
+	ft.Set("users/alice", map[string]interface{}{"name": "alice"})
+	ft.Update("users/alice", map[string]interface{}{"age": 30.0})
+	req, err := http.NewRequest("PUT", ft.URL+"/users/bob.json", strings.NewReader(`{"name":"bob"}`))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	ft.Delete("users/alice")
+
+	expected := []Mutation{
+		{Type: "put", Path: "/users/alice", Data: map[string]interface{}{"name": "alice"}},
+		{Type: "patch", Path: "/users/alice", Data: map[string]interface{}{"age": 30.0}},
+		{Type: "put", Path: "/users/bob", Data: map[string]interface{}{"name": "bob"}},
+		{Type: "put", Path: "/users/alice"},
+	}
+	assert.Equal(t, expected, ft.History())
+
+	// draining clears the history
+	assert.Equal(t, expected, ft.DrainHistory())
+	assert.Empty(t, ft.History())
+	ft.Set("a", 1.0)
+	assert.Equal(t, []Mutation{{Type: "put", Path: "/a", Data: 1.0}}, ft.DrainHistory())
+}
+
+func TestHistoryConcurrent(t *testing.T) {
+	ft := New()
+	var wg _sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				ft.Set("counter", float64(j))
+				ft.History()
+			}
+		}()
+	}
+	wg.Wait()
+
+	history := ft.History()
+	require.Len(t, history, 100)
+	// the last mutation recorded is the last one applied
+	assert.Equal(t, history[99].Data, ft.Get("counter"))
+}
+
+// watchersCount returns the number of watchers registered.
+func (db *notifyDB) watchersCount() int {
+	db.watchersMtx.RLock()
+	defer db.watchersMtx.RUnlock()
+	var n int
+	for _, listeners := range db.watchers {
+		n += len(listeners)
+	}
+	return n
+}
+
+// readEvents streams the events of the location at url, the initial
+// one excluded, into a chan.
+func readEvents(t *testing.T, url string) (chan string, func()) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	events := make(chan string, 100)
+	scanner := bufio.NewScanner(resp.Body)
+	var initial bool
+	go func() {
+		defer close(events)
+		var name string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: ") && !initial:
+				initial = true
+			case strings.HasPrefix(line, "data: "):
+				events <- name + " " + strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events, func() { resp.Body.Close() }
+}
+
+func TestReplay(t *testing.T) {
+	recorder := New()
+	recorder.Set("doc", map[string]interface{}{"title": "draft"})
+	recorder.Update("doc", map[string]interface{}{"title": "final", "tags": map[string]interface{}{"go": true}})
+	recorder.Set("doc/tags/go", false)
+	recorder.Delete("doc/tags")
+	recorder.Set("doc/views", 1.0)
+
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+	events, stop := readEvents(t, ft.URL+"/doc/.json")
+	defer stop()
+	// wait for the watch to be registered
+	for ft.db.watchersCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	replay := ft.Replay(recorder.History())
+	assert.Equal(t, 5, replay.Remaining())
+	next := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "no event received")
+		}
+		return ""
+	}
+
+	m, ok := replay.Step()
+	require.True(t, ok)
+	assert.Equal(t, Mutation{Type: "put", Path: "/doc", Data: map[string]interface{}{"title": "draft"}}, m)
+	assert.Equal(t, `put {"path":"/","data":{"title":"draft"}}`, next())
+	assert.Equal(t, map[string]interface{}{"title": "draft"}, ft.Get("doc"))
+
+	// one event per step, in order
+	replay.Step()
+	assert.Equal(t, `patch {"path":"/","data":{"tags":{"go":true},"title":"final"}}`, next())
+	replay.All()
+	assert.Equal(t, `put {"path":"/tags/go","data":false}`, next())
+	assert.Equal(t, `put {"path":"/tags","data":null}`, next())
+	assert.Equal(t, `put {"path":"/views","data":1}`, next())
+	assert.Zero(t, replay.Remaining())
+	_, ok = replay.Step()
+	assert.False(t, ok)
+
+	assert.Equal(t, recorder.Get("doc"), ft.Get("doc"))
+	assert.Equal(t, recorder.History(), ft.History())
+}
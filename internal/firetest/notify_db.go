@@ -28,7 +28,7 @@ func (ed eventData) MarshalJSON() ([]byte, error) {
 
 func newEvent(name, path string, n *sync.Node) event {
 	return event{
-		Name: "put",
+		Name: name,
 		Data: eventData{
 			Path: path,
 			Data: n,
@@ -39,6 +39,10 @@ func newEvent(name, path string, n *sync.Node) event {
 type notifyDB struct {
 	intDB *sync.Database
 
+	// writeMtx keeps the history in the order the writes are applied in
+	writeMtx _sync.Mutex
+	history  history
+
 	watchersMtx _sync.RWMutex
 	watchers    map[string][]chan event
 }
@@ -51,18 +55,33 @@ func newNotifyDB() *notifyDB {
 }
 
 func (db *notifyDB) add(path string, n *sync.Node) {
-	db.intDB.Add(path, n)
-	go db.notify(newEvent("put", path, n))
+	go db.notify(db.apply("put", path, n))
 }
 
 func (db *notifyDB) update(path string, n *sync.Node) {
-	db.intDB.Update(path, n)
-	go db.notify(newEvent("patch", path, n))
+	go db.notify(db.apply("patch", path, n))
 }
 
 func (db *notifyDB) del(path string) {
-	db.intDB.Del(path)
-	go db.notify(newEvent("put", path, nil))
+	go db.notify(db.apply("put", path, nil))
+}
+
+// apply applies the write the event named name streams, a nil node
+// removing the value at path, records it and returns its event.
+func (db *notifyDB) apply(name, path string, n *sync.Node) event {
+	db.writeMtx.Lock()
+	defer db.writeMtx.Unlock()
+	switch {
+	case n == nil:
+		name = "put"
+		db.intDB.Del(path)
+	case name == "patch":
+		db.intDB.Update(path, n)
+	default:
+		db.intDB.Add(path, n)
+	}
+	db.history.record(name, path, n)
+	return newEvent(name, path, n)
 }
 
 func (db *notifyDB) get(path string) *sync.Node {
@@ -72,18 +91,19 @@ func (db *notifyDB) get(path string) *sync.Node {
 func (db *notifyDB) notify(e event) {
 	db.watchersMtx.RLock()
 	for path, listeners := range db.watchers {
-		if !strings.HasPrefix(e.Data.Path, path) {
+		if path != "" && e.Data.Path != path && !strings.HasPrefix(e.Data.Path, path+"/") {
 			continue
 		}
 
 		// Make sure to not return full path when notifying
 		// only return the path relative to the watcher
-		e.Data.Path = strings.TrimPrefix(e.Data.Path, path)
-		e.Data.Path = sanitizePath(e.Data.Path)
+		relative := e
+		relative.Data.Path = strings.TrimPrefix(e.Data.Path, path)
+		relative.Data.Path = sanitizePath(relative.Data.Path)
 
 		for _, c := range listeners {
 			select {
-			case c <- e:
+			case c <- relative:
 			case <-time.After(250 * time.Millisecond):
 				continue
 			}
@@ -2,6 +2,7 @@ package firetest
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -84,3 +85,38 @@ func TestNotifyDBDel(t *testing.T) {
 	}
 	db.stopWatching("", notifications)
 }
+
+func TestNotifyDBNestedWatchers(t *testing.T) {
+	db := newNotifyDB()
+	watchers := map[string]string{
+		"":            "users/alice/age",
+		"users":       "alice/age",
+		"users/alice": "age",
+		"users/al":    "",
+	}
+
+	received := make(chan string, len(watchers))
+	for path := range watchers {
+		path, c := path, db.watch(path)
+		go func() {
+			select {
+			case n := <-c:
+				received <- path + ": " + n.Data.Path
+			case <-time.After(500 * time.Millisecond):
+				received <- path + ":"
+			}
+		}()
+	}
+
+	db.add("users/alice/age", sync.NewNode("", 31))
+
+	for range watchers {
+		select {
+		case r := <-received:
+			path := r[:strings.Index(r, ":")]
+			assert.Equal(t, strings.TrimSpace(path+": "+watchers[path]), r)
+		case <-time.After(time.Second):
+			assert.Fail(t, "watchers did not finish")
+		}
+	}
+}
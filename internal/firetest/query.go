@@ -0,0 +1,214 @@
+package firetest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errMissingOrderBy = errors.New("orderBy must be defined when other query parameters are defined")
+
+// query filters the children of v with the orderBy, startAt, endAt,
+// equalTo, limitToFirst and limitToLast parameters of a request, the way
+// Firebase filters them. The children are returned as an object, which
+// does not keep their order.
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-filtering
+func query(v interface{}, params url.Values) (interface{}, error) {
+	var filtered bool
+	for _, param := range []string{"startAt", "endAt", "equalTo", "limitToFirst", "limitToLast"} {
+		if params.Get(param) != "" {
+			filtered = true
+		}
+	}
+	if params.Get("orderBy") == "" {
+		if filtered {
+			return nil, errMissingOrderBy
+		}
+		return v, nil
+	}
+
+	var orderBy string
+	if err := json.Unmarshal([]byte(params.Get("orderBy")), &orderBy); err != nil {
+		return nil, err
+	}
+	children, ok := v.(map[string]interface{})
+	if !ok || !filtered {
+		return v, nil
+	}
+	if _, ok := children[".value"]; ok {
+		// a value with a priority has no children
+		return v, nil
+	}
+
+	bounds := map[string]interface{}{}
+	for _, param := range []string{"startAt", "endAt", "equalTo"} {
+		raw := params.Get(param)
+		if raw == "" {
+			continue
+		}
+		var bound interface{}
+		if err := json.Unmarshal([]byte(raw), &bound); err != nil {
+			return nil, err
+		}
+		bounds[param] = bound
+	}
+
+	sortValue := func(key string) interface{} {
+		switch orderBy {
+		case "$value":
+			return withoutPriorities(children[key])
+		case "$priority":
+			m, _ := children[key].(map[string]interface{})
+			return m[".priority"]
+		}
+		return lookup(withoutPriorities(children[key]), orderBy)
+	}
+	compare := func(key string, bound interface{}) int {
+		if orderBy == "$key" {
+			s, ok := bound.(string)
+			if f, isNumber := bound.(float64); !ok && isNumber {
+				s = strconv.FormatFloat(f, 'f', -1, 64)
+			}
+			return compareKeys(key, s)
+		}
+		return compareValues(sortValue(key), bound)
+	}
+
+	var keys []string
+	for key := range children {
+		if strings.HasPrefix(key, ".") {
+			// the priority of the node is not a child
+			continue
+		}
+		if b, ok := bounds["startAt"]; ok && compare(key, b) < 0 {
+			continue
+		}
+		if b, ok := bounds["endAt"]; ok && compare(key, b) > 0 {
+			continue
+		}
+		if b, ok := bounds["equalTo"]; ok && compare(key, b) != 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if orderBy != "$key" {
+			if c := compareValues(sortValue(keys[i]), sortValue(keys[j])); c != 0 {
+				return c < 0
+			}
+		}
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+
+	if n, err := strconv.Atoi(params.Get("limitToFirst")); err == nil && n < len(keys) {
+		keys = keys[:n]
+	}
+	if n, err := strconv.Atoi(params.Get("limitToLast")); err == nil && n < len(keys) {
+		keys = keys[len(keys)-n:]
+	}
+
+	out := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		out[key] = children[key]
+	}
+	if p, ok := children[".priority"]; ok {
+		out[".priority"] = p
+	}
+	return out, nil
+}
+
+// lookup returns the value found at the slash separated path in v.
+func lookup(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(strings.Trim(path, "/"), "/") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// compareKeys orders keys that are 32-bit integers numerically before
+// all other keys, which are ordered lexicographically.
+func compareKeys(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 32)
+	bi, bErr := strconv.ParseInt(b, 10, 32)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareFloats(float64(ai), float64(bi))
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareValues orders values the way Firebase does: null, false, true,
+// numbers, strings and then objects.
+func compareValues(a, b interface{}) int {
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	if ra == 3 {
+		return compareFloats(toFloat(a), toFloat(b))
+	}
+	return 0
+}
+
+func valueRank(v interface{}) int {
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if val {
+			return 2
+		}
+		return 1
+	case string:
+		return 4
+	case map[string]interface{}, []interface{}:
+		return 5
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return 3
+	}
+	return 5
+}
+
+// toFloat converts a number stored by Set, which may be of any numeric
+// type, to a float64.
+func toFloat(v interface{}) float64 {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	}
+	return rv.Float()
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
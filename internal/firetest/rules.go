@@ -0,0 +1,330 @@
+package firetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// permissionDenied is the body Firebase answers the requests the security
+// rules deny with.
+var permissionDenied = []byte(`{"error":"Permission denied"}`)
+
+// ruleNode holds the rules of a location of a rules document, along with
+// the rules of its children.
+type ruleNode struct {
+	read, write rule
+	children    map[string]*ruleNode
+	// wildcard is the name of the $variable matching the children not named
+	// in children, empty when there is none
+	wildcard string
+	wildNode *ruleNode
+}
+
+// rule evaluates a .read or .write rule for the auth variable and the
+// $variables of a location.
+type rule func(auth map[string]interface{}, vars map[string]string) bool
+
+// SetRules makes the server enforce the .read and .write rules of the
+// security rules document given, in the JSON form the Firebase console
+// edits:
+//
+//	ft.SetRules([]byte(`{"rules": {
+//		"public": {".read": true},
+//		"users": {"$uid": {".read": "auth != null", ".write": "auth.uid === $uid"}}
+//	}}`))
+//
+// As with Firebase, a read or a write is allowed when a rule of the
+// location or of one of its ancestors allows it, and denied otherwise,
+// with a 401. The writes of a multi-path update are checked at every path
+// written. The requests authenticated with the Secret of the server, or
+// with the access token required with RequireBearerToken, are made as an
+// administrator and are always allowed; the uid of the custom tokens,
+// signed with the Secret, is auth.uid.
+//
+// The rules are either booleans or expressions made of comparisons, with
+// ==, ===, != or !==, of auth, auth.uid, $variables, null and quoted
+// strings, combined with && and ||, such as "auth.uid === $uid || auth.uid
+// === 'admin'". Other expressions, and .validate and .indexOn rules, are
+// not supported and make SetRules return an error. A nil document stops
+// enforcing rules.
+func (ft *Firetest) SetRules(rules []byte) error {
+	var root *ruleNode
+	if rules != nil {
+		var doc struct {
+			Rules map[string]interface{} `json:"rules"`
+		}
+		if err := json.Unmarshal(rules, &doc); err != nil {
+			return fmt.Errorf("invalid rules: %v", err)
+		}
+		if doc.Rules == nil {
+			return fmt.Errorf(`invalid rules: missing "rules"`)
+		}
+		var err error
+		if root, err = parseRuleNode(doc.Rules, ""); err != nil {
+			return err
+		}
+	}
+
+	ft.rulesMtx.Lock()
+	defer ft.rulesMtx.Unlock()
+	ft.rules = root
+	return nil
+}
+
+func parseRuleNode(m map[string]interface{}, path string) (*ruleNode, error) {
+	n := &ruleNode{children: map[string]*ruleNode{}}
+	for k, v := range m {
+		location := path + "/" + k
+		switch {
+		case k == ".read" || k == ".write":
+			r, err := parseRule(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rules: %s: %v", location, err)
+			}
+			if k == ".read" {
+				n.read = r
+			} else {
+				n.write = r
+			}
+		case strings.HasPrefix(k, "."):
+			return nil, fmt.Errorf("invalid rules: %s: unsupported rule", location)
+		default:
+			child, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid rules: %s: not an object", location)
+			}
+			c, err := parseRuleNode(child, location)
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(k, "$") {
+				if n.wildcard != "" {
+					return nil, fmt.Errorf("invalid rules: %s: two $variables at the same level", location)
+				}
+				n.wildcard, n.wildNode = k, c
+				continue
+			}
+			n.children[k] = c
+		}
+	}
+	return n, nil
+}
+
+// parseRule compiles the value of a .read or .write rule.
+func parseRule(v interface{}) (rule, error) {
+	switch r := v.(type) {
+	case bool:
+		return func(map[string]interface{}, map[string]string) bool { return r }, nil
+	case string:
+		return parseExpression(r)
+	}
+	return nil, fmt.Errorf("rule %v is neither a boolean nor an expression", v)
+}
+
+// parseExpression compiles a rule expression, a disjunction of
+// conjunctions of comparisons.
+func parseExpression(expr string) (rule, error) {
+	var alternatives []rule
+	for _, conjunction := range strings.Split(expr, "||") {
+		var all []rule
+		for _, term := range strings.Split(conjunction, "&&") {
+			r, err := parseTerm(strings.TrimSpace(term))
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", expr, err)
+			}
+			all = append(all, r)
+		}
+		alternatives = append(alternatives, func(auth map[string]interface{}, vars map[string]string) bool {
+			for _, r := range all {
+				if !r(auth, vars) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return func(auth map[string]interface{}, vars map[string]string) bool {
+		for _, r := range alternatives {
+			if r(auth, vars) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseTerm compiles a boolean literal or a comparison of two operands.
+func parseTerm(term string) (rule, error) {
+	if b, err := strconv.ParseBool(term); err == nil {
+		return func(map[string]interface{}, map[string]string) bool { return b }, nil
+	}
+
+	for _, op := range []string{"!==", "===", "!=", "=="} {
+		i := strings.Index(term, op)
+		if i < 0 {
+			continue
+		}
+		a, err := parseOperand(strings.TrimSpace(term[:i]))
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseOperand(strings.TrimSpace(term[i+len(op):]))
+		if err != nil {
+			return nil, err
+		}
+		negate := op[0] == '!'
+		return func(auth map[string]interface{}, vars map[string]string) bool {
+			av, aok := a(auth, vars)
+			bv, bok := b(auth, vars)
+			return (aok == bok && (!aok || av == bv)) != negate
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported term %q", term)
+}
+
+// operand returns the value of an operand of a comparison, and false when
+// it is null.
+type operand func(auth map[string]interface{}, vars map[string]string) (string, bool)
+
+func parseOperand(s string) (operand, error) {
+	switch {
+	case s == "null":
+		return func(map[string]interface{}, map[string]string) (string, bool) { return "", false }, nil
+	case s == "auth":
+		return func(auth map[string]interface{}, _ map[string]string) (string, bool) {
+			// auth is only ever compared with null
+			return "auth", auth != nil
+		}, nil
+	case s == "auth.uid":
+		return func(auth map[string]interface{}, _ map[string]string) (string, bool) {
+			uid, ok := auth["uid"].(string)
+			return uid, ok
+		}, nil
+	case strings.HasPrefix(s, "$") && len(s) > 1:
+		return func(_ map[string]interface{}, vars map[string]string) (string, bool) {
+			v, ok := vars[s]
+			return v, ok
+		}, nil
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		lit := s[1 : len(s)-1]
+		return func(map[string]interface{}, map[string]string) (string, bool) { return lit, true }, nil
+	}
+	return nil, fmt.Errorf("unsupported operand %q", s)
+}
+
+// allowed reports whether the rules of n allow the read, or the write if
+// write is set, of path by auth: whether the rule of a location on the way
+// from n to path allows it.
+func (n *ruleNode) allowed(path string, write bool, auth map[string]interface{}) bool {
+	vars := map[string]string{}
+	var keys []string
+	if path != "" {
+		keys = strings.Split(path, "/")
+	}
+	for i := 0; n != nil; i++ {
+		r := n.read
+		if write {
+			r = n.write
+		}
+		if r != nil && r(auth, vars) {
+			return true
+		}
+		if i == len(keys) {
+			return false
+		}
+
+		key := keys[i]
+		if child, ok := n.children[key]; ok {
+			n = child
+			continue
+		}
+		if n.wildcard != "" {
+			vars[n.wildcard] = key
+		}
+		n = n.wildNode
+	}
+	return false
+}
+
+// checkRules answers req with a 401 and returns false when the rules set
+// with SetRules deny it.
+func (ft *Firetest) checkRules(w http.ResponseWriter, req *http.Request) bool {
+	ft.rulesMtx.Lock()
+	rules := ft.rules
+	ft.rulesMtx.Unlock()
+	if rules == nil {
+		return true
+	}
+
+	auth, admin := ft.requestAuth(req)
+	if admin {
+		return true
+	}
+
+	path := sanitizePath(req.URL.Path)
+	paths := []string{path}
+	if req.Method == "PATCH" {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var children map[string]json.RawMessage
+		if json.Unmarshal(body, &children) == nil && len(children) > 0 {
+			paths = paths[:0]
+			for k := range children {
+				paths = append(paths, sanitizePath(path+"/"+k))
+			}
+		}
+	}
+
+	write := req.Method != "GET"
+	for _, p := range paths {
+		if !rules.allowed(p, write, auth) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(permissionDenied)
+			return false
+		}
+	}
+	return true
+}
+
+// requestAuth returns the auth variable of the rules for req, nil for an
+// unauthenticated request, or true if req is made as an administrator,
+// with the Secret or the access token required with RequireBearerToken.
+func (ft *Firetest) requestAuth(req *http.Request) (map[string]interface{}, bool) {
+	ft.authMtx.Lock()
+	bearer := ft.bearerToken
+	ft.authMtx.Unlock()
+	if bearer != "" && ft.validBearer(req) {
+		return nil, true
+	}
+
+	token := req.URL.Query().Get("auth")
+	switch {
+	case token == "":
+		return nil, false
+	case token == ft.Secret:
+		return nil, true
+	case !strings.Contains(token, ".") || !ft.validJWT(token):
+		return nil, false
+	}
+
+	cb, err := decodeSegment(strings.Split(token, ".")[1])
+	if err != nil {
+		return nil, false
+	}
+	var claim struct {
+		D map[string]interface{} `json:"d"`
+	}
+	if err := json.Unmarshal(cb, &claim); err != nil {
+		return nil, false
+	}
+	return claim.D, false
+}
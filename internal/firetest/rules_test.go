@@ -0,0 +1,161 @@
+package firetest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// customToken returns a custom token of uid signed with secret.
+func customToken(secret, uid string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(fmt.Sprintf(`{"v":0,"d":{"uid":%q}}`, uid)))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestSetRules(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+	ft.Set("public/a", 1)
+	ft.Set("users/alice/name", "Alice")
+
+	require.NoError(t, ft.SetRules([]byte(`{"rules": {
+		"public": {".read": true},
+		"users": {
+			".read": "auth != null",
+			"$uid": {".write": "auth.uid === $uid || auth.uid == 'admin'"}
+		}
+	}}`)))
+
+	do := func(method, path, auth, body string) (int, string) {
+		url := ft.URL + "/" + path + ".json"
+		if auth != "" {
+			url += "?auth=" + auth
+		}
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+	alice := customToken(ft.Secret, "alice")
+	bob := customToken(ft.Secret, "bob")
+
+	for _, test := range []struct {
+		name               string
+		method, path, auth string
+		body               string
+		status             int
+	}{
+		{"public read", "GET", "public/a", "", "", http.StatusOK},
+		{"root read", "GET", "", "", "", http.StatusUnauthorized},
+		{"anonymous read", "GET", "users/alice", "", "", http.StatusUnauthorized},
+		{"authenticated read", "GET", "users/alice/name", bob, "", http.StatusOK},
+		{"forged token", "GET", "users/alice", customToken("other", "bob"), "", http.StatusUnauthorized},
+		{"public write", "PUT", "public/a", "", "2", http.StatusUnauthorized},
+		{"own write", "PUT", "users/alice/name", alice, `"Al"`, http.StatusOK},
+		{"other write", "PUT", "users/alice/name", bob, `"Bob"`, http.StatusUnauthorized},
+		{"admin write", "DELETE", "users/alice/name", customToken(ft.Secret, "admin"), "", http.StatusOK},
+		{"own update", "PATCH", "users", bob, `{"bob/name":"Bob"}`, http.StatusOK},
+		{"mixed update", "PATCH", "users", bob, `{"bob/name":"B","alice/name":"A"}`, http.StatusUnauthorized},
+		{"secret", "PUT", "public/a", ft.Secret, "3", http.StatusOK},
+	} {
+		status, body := do(test.method, test.path, test.auth, test.body)
+		assert.Equal(t, test.status, status, test.name)
+		if status == http.StatusUnauthorized {
+			assert.Equal(t, string(permissionDenied), body, test.name)
+		}
+	}
+	assert.Equal(t, "Bob", ft.Get("users/bob/name"))
+	assert.Nil(t, ft.Get("users/alice/name"))
+	assert.EqualValues(t, 3, ft.Get("public/a"))
+
+	require.NoError(t, ft.SetRules(nil))
+	status, _ := do("GET", "", "", "")
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestSetRulesBearerToken(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+	ft.Set("a", 1)
+	require.NoError(t, ft.SetRules([]byte(`{"rules": {".read": false}}`)))
+
+	get := func(header, query string) int {
+		req, err := http.NewRequest("GET", ft.URL+"/a.json"+query, nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// any token is not an administrator
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer token", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("", "?access_token=token"))
+
+	// the token required is
+	ft.RequireBearerToken("token")
+	assert.Equal(t, http.StatusOK, get("Bearer token", ""))
+	assert.Equal(t, http.StatusOK, get("", "?access_token=token"))
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer other", ""))
+}
+
+func TestSetRules_Invalid(t *testing.T) {
+	ft := New()
+	for _, rules := range []string{
+		`not json`,
+		`{}`,
+		`{"rules": {"a": 1}}`,
+		`{"rules": {".read": 1}}`,
+		`{"rules": {".read": "root.child('a').exists()"}}`,
+		`{"rules": {".validate": true}}`,
+		`{"rules": {"$a": {}, "$b": {}}}`,
+	} {
+		assert.Error(t, ft.SetRules([]byte(rules)), rules)
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	vars := map[string]string{"$uid": "alice"}
+	for _, test := range []struct {
+		expr string
+		auth map[string]interface{}
+		pass bool
+	}{
+		{"true", nil, true},
+		{"false", nil, false},
+		{"auth == null", nil, true},
+		{"auth == null", map[string]interface{}{}, false},
+		{"auth !== null", map[string]interface{}{}, true},
+		{"auth.uid == $uid", nil, false},
+		{"auth.uid == $uid", map[string]interface{}{"uid": "alice"}, true},
+		{"auth.uid != $uid", map[string]interface{}{"uid": "bob"}, true},
+		{"auth != null && auth.uid == \"bob\"", map[string]interface{}{"uid": "bob"}, true},
+		{"auth != null && auth.uid == \"bob\"", map[string]interface{}{"uid": "alice"}, false},
+		{"false || auth.uid == $uid", map[string]interface{}{"uid": "alice"}, true},
+	} {
+		r, err := parseExpression(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.pass, r(test.auth, vars), test.expr)
+	}
+}
@@ -6,6 +6,7 @@ package firetest
 
 import (
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
@@ -16,6 +17,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -38,6 +40,18 @@ type Firetest struct {
 	db       *notifyDB
 
 	requireAuth *int32
+
+	authMtx     sync.Mutex
+	bearerToken string
+
+	// writeMtx makes the ETag checks of conditional writes atomic
+	writeMtx sync.Mutex
+
+	faultsMtx sync.Mutex
+	faults    []*fault
+
+	rulesMtx sync.Mutex
+	rules    *ruleNode
 }
 
 // New creates a new Firetest server
@@ -87,6 +101,11 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	dropAfter, answered := ft.applyFault(w, req)
+	if answered {
+		return
+	}
+
 	if atomic.LoadInt32(ft.requireAuth) == 1 {
 		var authenticated bool
 		authHeader := req.URL.Query().Get("auth")
@@ -104,6 +123,24 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	if !ft.validBearer(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(invalidAuth)
+		return
+	}
+
+	if !ft.checkRules(w, req) {
+		return
+	}
+
+	if req.Method != "GET" {
+		ft.writeMtx.Lock()
+		defer ft.writeMtx.Unlock()
+		if !ft.checkETag(w, req) {
+			return
+		}
+	}
+
 	switch req.Method {
 	case "PUT":
 		ft.set(w, req)
@@ -114,7 +151,7 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	case "GET":
 		switch req.Header.Get("Accept") {
 		case "text/event-stream":
-			ft.sse(w, req)
+			ft.sse(w, req, dropAfter)
 		default:
 			ft.get(w, req)
 		}
@@ -126,6 +163,19 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// validBearer reports whether req carries the access token required with
+// RequireBearerToken, if any.
+func (ft *Firetest) validBearer(req *http.Request) bool {
+	ft.authMtx.Lock()
+	token := ft.bearerToken
+	ft.authMtx.Unlock()
+	if token == "" {
+		return true
+	}
+	return req.Header.Get("Authorization") == "Bearer "+token ||
+		req.URL.Query().Get("access_token") == token
+}
+
 func decodeSegment(seg string) ([]byte, error) {
 	if l := len(seg) % 4; l > 0 {
 		seg += strings.Repeat("=", 4-l)
@@ -215,6 +265,10 @@ func (ft *Firetest) set(w http.ResponseWriter, req *http.Request) {
 	if !ok {
 		return
 	}
+	if resolved, ok := resolveIncrements(v, sanitizePath(req.URL.Path), ft.Get); ok {
+		v = resolved
+		body, _ = json.Marshal(v)
+	}
 
 	ft.Set(req.URL.Path, v)
 	w.Write(body)
@@ -225,6 +279,10 @@ func (ft *Firetest) update(w http.ResponseWriter, req *http.Request) {
 	if !ok {
 		return
 	}
+	if resolved, ok := resolveIncrements(v, sanitizePath(req.URL.Path), ft.Get); ok {
+		v = resolved
+		body, _ = json.Marshal(v)
+	}
 	ft.Update(req.URL.Path, v)
 	w.Write(body)
 }
@@ -234,6 +292,8 @@ func (ft *Firetest) create(w http.ResponseWriter, req *http.Request) {
 	if !ok {
 		return
 	}
+	// the new child holds no value to increment
+	v, _ = resolveIncrements(v, "", func(string) interface{} { return nil })
 
 	name := ft.Create(req.URL.Path, v)
 	rtn := map[string]string{"name": name}
@@ -251,13 +311,116 @@ func (ft *Firetest) get(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 
 	v := ft.Get(req.URL.Path)
+	if req.Header.Get("X-Firebase-ETag") == "true" {
+		tag := etag(v)
+		w.Header().Set("ETag", tag)
+		if match := req.Header.Get("if-none-match"); match != "" && match == tag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	v, err := query(v, req.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if req.URL.Query().Get("format") != "export" {
+		v = withoutPriorities(v)
+	}
+	if req.URL.Query().Get("shallow") == "true" {
+		v = shallow(v)
+	}
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("Error encoding json: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
-func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
+// checkETag rejects the PUT and DELETE requests whose if-match header does
+// not match the ETag of the current value, responding with the current
+// value and its ETag, and reports whether the request may proceed.
+//
+// Reference https://firebase.google.com/docs/database/rest/save-data#section-conditional-requests
+func (ft *Firetest) checkETag(w http.ResponseWriter, req *http.Request) bool {
+	match := req.Header.Get("if-match")
+	if match == "" || (req.Method != "PUT" && req.Method != "DELETE") {
+		return true
+	}
+
+	v := ft.Get(req.URL.Path)
+	tag := etag(v)
+	if match == tag {
+		return true
+	}
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	if err := json.NewEncoder(w).Encode(withoutPriorities(v)); err != nil {
+		log.Printf("Error encoding json: %s", err)
+	}
+	return false
+}
+
+// etag returns the ETag of v, an opaque string that changes whenever v does.
+func etag(v interface{}) string {
+	if v == nil {
+		return "null_etag"
+	}
+	b, _ := json.Marshal(v)
+	sum := sha1.Sum(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// withoutPriorities removes the priorities stored in v, in the
+// ".priority" keys of objects and the {".value", ".priority"}
+// wrappers of primitives.
+func withoutPriorities(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	if val, ok := m[".value"]; ok {
+		return val
+	}
+
+	out := make(map[string]interface{}, len(m))
+	for k, child := range m {
+		if k != ".priority" {
+			out[k] = withoutPriorities(child)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// shallow truncates the children of v to true, leaving primitives as they are.
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#shallow
+func shallow(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]bool, len(val))
+		for k := range val {
+			m[k] = true
+		}
+		return m
+	case []interface{}:
+		m := make(map[string]bool, len(val))
+		for i, child := range val {
+			if child != nil {
+				m[fmt.Sprint(i)] = true
+			}
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request, dropAfter int) {
 	f, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
@@ -270,7 +433,7 @@ func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
 	c := ft.db.watch(path)
 	defer ft.db.stopWatching(path, c)
 
-	d := eventData{Path: path, Data: ft.db.get(path)}
+	d := eventData{Data: ft.db.get(path)}
 	s, err := json.Marshal(d)
 	if err != nil {
 		fmt.Printf("Error marshaling node %s\n", err)
@@ -279,7 +442,7 @@ func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
 	f.Flush()
 
 	httpCloser := w.(http.CloseNotifier).CloseNotify()
-	for {
+	for sent := 0; dropAfter == 0 || sent < dropAfter; {
 		select {
 		case <-httpCloser:
 			return
@@ -300,6 +463,7 @@ func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
 
 			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", n.Name, s)
 			f.Flush()
+			sent++
 		}
 	}
 }
@@ -332,5 +496,73 @@ func unmarshal(w http.ResponseWriter, r io.Reader) ([]byte, interface{}, bool) {
 		w.Write(invalidJSON)
 		return nil, nil, false
 	}
+
+	if resolved, ok := resolveServerValues(v, time.Now()); ok {
+		v = resolved
+		body, _ = json.Marshal(v)
+	}
 	return body, v, true
 }
+
+// resolveServerValues replaces the server value placeholders, such as
+// {".sv": "timestamp"}, found in v and reports whether there were any.
+func resolveServerValues(v interface{}, now time.Time) (interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, false
+	}
+	if sv, ok := m[".sv"]; ok && len(m) == 1 && sv == "timestamp" {
+		return now.UnixNano() / int64(time.Millisecond), true
+	}
+
+	var resolved bool
+	for k, child := range m {
+		if child, ok := resolveServerValues(child, now); ok {
+			m[k] = child
+			resolved = true
+		}
+	}
+	return m, resolved
+}
+
+// resolveIncrements replaces the increment placeholders, such as
+// {".sv": {"increment": 1}}, found in v written at path with the sum of
+// the delta and the current value get returns for their location, or with
+// the delta alone when that value is not a number, and reports whether
+// there were any. The writes are serialized, so the sum is atomic.
+func resolveIncrements(v interface{}, path string, get func(string) interface{}) (interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, false
+	}
+	if sv, ok := m[".sv"].(map[string]interface{}); ok && len(m) == 1 && len(sv) == 1 {
+		if delta, ok := sv["increment"].(float64); ok {
+			if current, ok := number(get(path)); ok {
+				return current + delta, true
+			}
+			return delta, true
+		}
+	}
+
+	var resolved bool
+	for k, child := range m {
+		if child, ok := resolveIncrements(child, strings.TrimPrefix(path+"/"+k, "/"), get); ok {
+			m[k] = child
+			resolved = true
+		}
+	}
+	return m, resolved
+}
+
+// number returns v as a float64 if it is a number.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -361,6 +362,91 @@ func TestServerGet(t *testing.T) {
 	assert.EqualValues(t, body, respBody)
 }
 
+func TestServerGetShallow(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+
+	ft.Set("leaf", "value")
+	ft.Set("node", map[string]interface{}{
+		"foo": "bar",
+		"bar": map[string]interface{}{"baz": true},
+		"arr": []interface{}{false, "lolz"},
+	})
+
+	for _, test := range []struct {
+		path     string
+		expected interface{}
+	}{
+		{path: "leaf", expected: "value"},
+		{path: "missing", expected: nil},
+		{path: "node", expected: map[string]interface{}{"foo": true, "bar": true, "arr": true}},
+		{path: "node/arr", expected: map[string]interface{}{"0": true, "1": true}},
+	} {
+		// ACT
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s.json?shallow=true", ft.URL, test.path), nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		// ASSERT
+		assert.Equal(t, http.StatusOK, resp.Code, test.path)
+		var respBody interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody), test.path)
+		assert.Equal(t, test.expected, respBody, test.path)
+	}
+}
+
+func TestServerGetQuery(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+
+	ft.Set("node", map[string]interface{}{
+		"a":  map[string]interface{}{"age": 30},
+		"b":  map[string]interface{}{"age": 20},
+		"c":  map[string]interface{}{"age": 30},
+		"10": map[string]interface{}{"age": "old"},
+	})
+
+	for _, test := range []struct {
+		query    string
+		status   int
+		expected interface{}
+	}{
+		{query: `orderBy="age"`, status: http.StatusOK, expected: 4},
+		{query: `orderBy="age"&startAt=25`, status: http.StatusOK, expected: []string{"a", "c", "10"}},
+		{query: `orderBy="age"&startAt=20&endAt=30`, status: http.StatusOK, expected: []string{"a", "b", "c"}},
+		{query: `orderBy="age"&equalTo=30&limitToLast=1`, status: http.StatusOK, expected: []string{"c"}},
+		{query: `orderBy="age"&limitToFirst=2`, status: http.StatusOK, expected: []string{"a", "b"}},
+		{query: `orderBy="$key"&startAt="a"&endAt="b"`, status: http.StatusOK, expected: []string{"a", "b"}},
+		{query: `orderBy="$key"&limitToFirst=1`, status: http.StatusOK, expected: []string{"10"}},
+		{query: `limitToFirst=1`, status: http.StatusBadRequest},
+	} {
+		// ACT
+		req, err := http.NewRequest("GET", ft.URL+"/node.json?"+strings.Replace(test.query, `"`, "%22", -1), nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		// ASSERT
+		require.Equal(t, test.status, resp.Code, test.query)
+		if test.status != http.StatusOK {
+			continue
+		}
+		var respBody map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody), test.query)
+		if n, ok := test.expected.(int); ok {
+			assert.Len(t, respBody, n, test.query)
+			continue
+		}
+		for _, key := range test.expected.([]string) {
+			assert.Contains(t, respBody, key, test.query)
+		}
+		assert.Len(t, respBody, len(test.expected.([]string)), test.query)
+	}
+}
+
 func TestSanitizePath(t *testing.T) {
 	for i, test := range []struct {
 		path     string
@@ -411,3 +497,154 @@ func TestUnmarshal_InvalidBody(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, []byte(invalidJSON), w.Body.Bytes())
 }
+
+func TestServerValues(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	// ACT
+	body := `{"name":"bob","meta":{"createdAt":{".sv":"timestamp"}}}`
+	req, err := http.NewRequest("PUT", ft.URL+"/user.json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	createdAt, ok := ft.Get("user/meta/createdAt").(int64)
+	require.True(t, ok, "server timestamp was not resolved")
+	assert.True(t, createdAt >= before)
+	assert.Equal(t, "bob", ft.Get("user/name"))
+	assert.NotContains(t, resp.Body.String(), ".sv")
+}
+
+func TestServerIncrements(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("post/views", 2)
+
+	// ACT
+	for _, write := range []struct{ method, path, body string }{
+		{"PATCH", "/post.json", `{"views":{".sv":{"increment":1}},"likes":{".sv":{"increment":1}}}`},
+		{"PUT", "/post/views.json", `{".sv":{"increment":1.5}}`},
+		{"POST", "/log.json", `{".sv":{"increment":1}}`},
+	} {
+		req, err := http.NewRequest(write.method, ft.URL+write.path, strings.NewReader(write.body))
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.NotContains(t, resp.Body.String(), ".sv")
+	}
+
+	// ASSERT
+	assert.Equal(t, 4.5, ft.Get("post/views"))
+	assert.Equal(t, 1.0, ft.Get("post/likes"))
+	for _, v := range ft.Get("log").(map[string]interface{}) {
+		assert.Equal(t, 1.0, v)
+	}
+}
+
+func TestServerGetPriorities(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	stored := map[string]interface{}{
+		".priority": 1.0,
+		"name":      map[string]interface{}{".value": "alice", ".priority": "a"},
+	}
+	ft.Set("user", stored)
+
+	for query, expected := range map[string]interface{}{
+		"":               map[string]interface{}{"name": "alice"},
+		"?format=export": stored,
+	} {
+		// ACT
+		req, err := http.NewRequest("GET", ft.URL+"/user.json"+query, nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		// ASSERT
+		assert.Equal(t, http.StatusOK, resp.Code, query)
+		var respBody interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody), query)
+		assert.Equal(t, expected, respBody, query)
+	}
+}
+
+func TestServerConditionalSet(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("foo", "bar")
+
+	req, err := http.NewRequest("GET", ft.URL+"/foo.json", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Firebase-ETag", "true")
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	tag := resp.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	// ACT
+	ft.Set("foo", "changed")
+	req, err = http.NewRequest("PUT", ft.URL+"/foo.json", strings.NewReader(`"baz"`))
+	require.NoError(t, err)
+	req.Header.Set("if-match", tag)
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, "\"changed\"\n", resp.Body.String())
+	assert.Equal(t, "changed", ft.Get("foo"))
+
+	// ACT
+	req, err = http.NewRequest("PUT", ft.URL+"/foo.json", strings.NewReader(`"baz"`))
+	require.NoError(t, err)
+	req.Header.Set("if-match", resp.Header().Get("ETag"))
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "baz", ft.Get("foo"))
+	assert.Equal(t, "null_etag", etag(ft.Get("missing")))
+}
+
+func TestServerConditionalGet(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("foo", "bar")
+
+	req, err := http.NewRequest("GET", ft.URL+"/foo.json", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Firebase-ETag", "true")
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	tag := resp.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	// ACT
+	req.Header.Set("if-none-match", tag)
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body.String())
+
+	// ACT
+	ft.Set("foo", "changed")
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "\"changed\"\n", resp.Body.String())
+}
@@ -0,0 +1,155 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrNoCurrentChild is returned by Iterator.Decode when called before
+// Next, or after Next returned false.
+var ErrNoCurrentChild = errors.New("no current child, Next must return true first")
+
+// Iterator iterates over the children of a reference ordered by key, a
+// page at a time, as returned by Pages:
+//
+//	it := ref.Pages(1000)
+//	for it.Next() {
+//		var user User
+//		if err := it.Decode(&user); err != nil {
+//			return err
+//		}
+//		fmt.Println(it.Key(), user.Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+//
+// An Iterator is not safe for concurrent use.
+type Iterator struct {
+	pages *firebase
+	size  int
+
+	cursor  string
+	started bool
+	keys    []string
+	values  map[string]json.RawMessage
+	last    bool
+	err     error
+}
+
+// Pages returns an Iterator over the children of the reference, ordered by
+// key, for collections too large to be read in one request: the children
+// are read pageSize at a time, each page starting after the last key of
+// the previous one, so that only a page is held in memory and a page that
+// fails is retried on its own, the way ValueResumable reads pages. The
+// queries of the reference are ignored.
+//
+// Like ValueResumable, the iteration is not a snapshot: a child added or
+// removed while iterating is only seen, or missed, if its key is after the
+// cursor. A reference holding a single value, or no value, has no
+// children to iterate over.
+func (fb *firebase) Pages(pageSize int) *Iterator {
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return &Iterator{pages: fb.resumablePages(pageSize), size: pageSize}
+}
+
+// Resume makes the iteration start after the child keyed cursor, a value
+// returned by Cursor, to carry on an iteration that was interrupted, by a
+// restart for instance, from where it stopped. It must be called before
+// the first call to Next and returns the Iterator.
+func (it *Iterator) Resume(cursor string) *Iterator {
+	if !it.started {
+		it.cursor = cursor
+	}
+	return it
+}
+
+// Next advances the iterator to the next child, reading the next page when
+// the current one has been iterated over. It returns false once every
+// child has been iterated over or reading a page failed, Err telling
+// which.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.started && len(it.keys) > 0 {
+		it.cursor = it.keys[0]
+		it.keys = it.keys[1:]
+	}
+	for len(it.keys) == 0 {
+		if it.last {
+			return false
+		}
+		if it.err = it.read(); it.err != nil {
+			return false
+		}
+	}
+	it.started = true
+	return true
+}
+
+// read reads the page after the cursor.
+func (it *Iterator) read() error {
+	page := it.pages
+	if it.cursor != "" {
+		page = it.pages.StartAfter(it.cursor).(*firebase)
+	}
+	body, err := page.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return err
+	}
+
+	var read map[string]json.RawMessage
+	if err := json.Unmarshal(body, &read); err != nil || read[valueKey] != nil {
+		// the node is a single value
+		it.last = true
+		return nil
+	}
+	keys := make(map[string]interface{}, len(read))
+	for key := range read {
+		if !strings.HasPrefix(key, ".") {
+			keys[key] = nil
+		}
+	}
+	it.keys, it.values = orderChildren(keys, "$key"), read
+	it.last = len(it.keys) < it.size
+	if len(it.keys) > 0 && it.keys[0] == it.cursor {
+		// the bound of the page included the last child of the
+		// previous one
+		it.keys = it.keys[1:]
+	}
+	return nil
+}
+
+// Key returns the key of the current child.
+func (it *Iterator) Key() string {
+	if len(it.keys) == 0 {
+		return ""
+	}
+	return it.keys[0]
+}
+
+// Decode decodes the value of the current child into v, the way Value
+// decodes values.
+func (it *Iterator) Decode(v interface{}) error {
+	if len(it.keys) == 0 {
+		return ErrNoCurrentChild
+	}
+	return it.pages.unmarshal(it.values[it.keys[0]], v)
+}
+
+// Cursor returns the key of the last child the iteration is done with,
+// the one before the current child, to be saved and passed to Resume. It
+// is the key of the last child once Next returned false without an error.
+func (it *Iterator) Cursor() string {
+	return it.cursor
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,107 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestPages(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	users := map[string]interface{}{
+		`o"brien`: map[string]interface{}{"age": 40},
+		"o'hara":  map[string]interface{}{"age": 41},
+		"2":       map[string]interface{}{"age": 2},
+		"10":      map[string]interface{}{"age": 10},
+	}
+	for i := 0; i < 21; i++ {
+		users[fmt.Sprintf("user-%02d", i)] = map[string]interface{}{"age": i}
+	}
+	server.Set("users", users)
+	server.Set("count", 25)
+
+	// the queries of the reference are ignored
+	fb := New(server.URL, nil).Child("users").OrderBy("age").LimitToLast(1)
+	var keys []string
+	it := fb.Pages(5)
+	assert.Equal(t, ErrNoCurrentChild, it.Decode(&struct{}{}))
+	for it.Next() {
+		var user struct{ Age int }
+		require.NoError(t, it.Decode(&user), it.Key())
+		assert.Equal(t, users[it.Key()].(map[string]interface{})["age"], user.Age, it.Key())
+		keys = append(keys, it.Key())
+	}
+	require.NoError(t, it.Err())
+	require.Len(t, keys, 25)
+	assert.Equal(t, []string{"2", "10", `o"brien`, "o'hara", "user-00"}, keys[:5])
+	assert.Equal(t, "user-20", it.Cursor())
+	assert.False(t, it.Next())
+	assert.Equal(t, "", it.Key())
+
+	// resuming from a saved cursor
+	it = fb.Pages(5)
+	for i := 0; i < 7 && it.Next(); i++ {
+	}
+	require.Equal(t, keys[6], it.Key())
+	cursor := it.Cursor()
+	assert.Equal(t, keys[5], cursor)
+	var rest []string
+	for it = fb.Pages(3).Resume(cursor); it.Next(); {
+		rest = append(rest, it.Key())
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, keys[6:], rest)
+
+	// single values and missing values have no children
+	for _, path := range []string{"count", "missing"} {
+		it = New(server.URL+"/"+path, nil).Pages(5)
+		assert.False(t, it.Next(), path)
+		assert.NoError(t, it.Err(), path)
+	}
+}
+
+func TestPagesBoundary(t *testing.T) {
+	t.Parallel()
+	// a server whose startAt includes the bound
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			fmt.Fprint(w, `{"a":1,"b":2}`)
+		case 2:
+			fmt.Fprint(w, `{"b":2,"c":3}`)
+		case 3:
+			fmt.Fprint(w, `{"c":3}`)
+		default:
+			http.Error(w, `{"error":"Internal server error."}`, http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var keys []string
+	it := New(server.URL, nil, WithRetry(0, time.Millisecond)).Pages(2)
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+	require.NoError(t, it.Err())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// errors stop the iteration
+	it = New(server.URL, nil, WithRetry(0, time.Millisecond)).Pages(2)
+	assert.False(t, it.Next())
+	require.IsType(t, ErrHTTP{}, it.Err())
+	assert.Equal(t, http.StatusInternalServerError, it.Err().(ErrHTTP).StatusCode)
+	assert.False(t, it.Next())
+}
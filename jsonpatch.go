@@ -0,0 +1,246 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JSON Patch operations, RFC 6902.
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+)
+
+// PatchOperation is an RFC 6902 JSON Patch operation, which encodes as
+// JSON the way the RFC defines it.
+type PatchOperation struct {
+	// Op is PatchOpAdd, PatchOpRemove or PatchOpReplace.
+	Op string
+	// Path is the JSON Pointer, RFC 6901, of the location the
+	// operation applies to, relative to the watched reference, empty for
+	// the whole document.
+	Path string
+	// Value is the value added or replacing the one at Path, decoded
+	// like the Data of an Event, unset for a removal.
+	Value interface{}
+}
+
+// MarshalJSON encodes the operation as a JSON Patch operation object.
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == PatchOpRemove {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+// WatchJSONPatch watches the reference like Mirror does and passes the
+// changes made to its value over to the given chan as RFC 6902 JSON Patch
+// operations, one slice per put or patch event that changed the mirrored
+// value, to be applied in order to a document starting as null. The first
+// slice adds the whole document, the value of the reference when the watch
+// started, unless the reference held no value then: nothing is sent until
+// a value is written. The chan is closed when the watch ends, the reason
+// being reported by WatchErr, and the watch is stopped with StopWatching.
+//
+// The document is the one held by the Mirror returned, and Firebase
+// semantics map to operations the following way:
+//   - a put or a child of a patch setting a location that holds no value
+//     adds it, along with the missing objects leading to it, with a single
+//     add of the topmost location missing;
+//   - one setting an object over an object adds, removes and replaces the
+//     children that differ, recursively, and one setting any other value
+//     over a value replaces it;
+//   - one setting null, Firebase deleting the location, removes it, along
+//     with the objects left empty by the removal, which Firebase does not
+//     keep, with a single remove of the topmost location left empty, and
+//     replaces the whole document with null when it is left empty;
+//   - a write that sets the values already held emits nothing.
+//
+// Arrays are held, and addressed, as objects keyed by their index, the way
+// the Mirror holds them, and the keys of a patch are applied in order.
+func (fb *firebase) WatchJSONPatch(patches chan []PatchOperation) (*Mirror, error) {
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return nil, err
+	}
+
+	m := &Mirror{}
+	stop := fb.watchStopped()
+	go func() {
+		defer close(patches)
+		for event := range events {
+			ops := m.ApplyJSONPatch(event)
+			if len(ops) == 0 {
+				continue
+			}
+			if !sendOrStop(patches, ops, stop) {
+				return
+			}
+		}
+	}()
+	return m, nil
+}
+
+// ApplyJSONPatch applies a put or patch event to the mirror the way Apply
+// does and returns the JSON Patch operations that turn the previously
+// mirrored value into the new one, as documented by WatchJSONPatch, none
+// when the value did not change. Other events are ignored.
+func (m *Mirror) ApplyJSONPatch(event Event) []PatchOperation {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	path := splitPath(event.Path)
+	var ops []PatchOperation
+	switch event.Type {
+	case EventTypePut:
+		ops = m.patch(path, event.Data)
+	case EventTypePatch:
+		children, ok := event.Data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		keys := make([]string, 0, len(children))
+		for k := range children {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ops = append(ops, m.patch(append(path[:len(path):len(path)], splitPath(k)...), children[k])...)
+		}
+	}
+	return ops
+}
+
+// patch sets the value at path to v and returns the operations doing so,
+// it must be called while holding the mirror's lock.
+func (m *Mirror) patch(path []string, v interface{}) []PatchOperation {
+	v, ok := m.scoped(path, v)
+	if !ok {
+		return nil
+	}
+	old := lookup(m.value, path)
+	if reflect.DeepEqual(old, v) {
+		return nil
+	}
+
+	var ops []PatchOperation
+	switch {
+	case v == nil:
+		ops = m.removeOps(path)
+	case old == nil:
+		ops = m.addOps(path, v)
+	default:
+		ops = diffOps(path, old, v)
+	}
+	m.value = setPath(m.value, path, v)
+	return ops
+}
+
+// addOps returns the operation setting v at path, which holds no value,
+// adding the topmost location missing, with the objects leading to path,
+// or replacing the value, not an object, held by one of its ancestors.
+func (m *Mirror) addOps(path []string, v interface{}) []PatchOperation {
+	if _, ok := m.value.(map[string]interface{}); !ok {
+		op := PatchOpAdd
+		if m.value != nil {
+			op = PatchOpReplace
+		}
+		return []PatchOperation{{Op: op, Path: "", Value: nest(path, v)}}
+	}
+	for i := 1; i <= len(path); i++ {
+		child := lookup(m.value, path[:i])
+		if _, ok := child.(map[string]interface{}); ok && i < len(path) {
+			continue
+		}
+		op := PatchOpAdd
+		if child != nil {
+			op = PatchOpReplace
+		}
+		return []PatchOperation{{Op: op, Path: jsonPointer(path[:i]), Value: nest(path[i:], v)}}
+	}
+	return nil
+}
+
+// removeOps returns the operation removing the value at path, along with
+// the objects it leaves empty.
+func (m *Mirror) removeOps(path []string) []PatchOperation {
+	i := len(path)
+	for i > 0 {
+		parent, _ := lookup(m.value, path[:i-1]).(map[string]interface{})
+		if len(parent) > 1 {
+			break
+		}
+		i--
+	}
+	if i == 0 {
+		return []PatchOperation{{Op: PatchOpReplace, Path: "", Value: nil}}
+	}
+	return []PatchOperation{{Op: PatchOpRemove, Path: jsonPointer(path[:i])}}
+}
+
+// diffOps returns the operations turning old into v, both normalized and
+// holding a value, at path.
+func diffOps(path []string, old, v interface{}) []PatchOperation {
+	oldObj, ok := old.(map[string]interface{})
+	obj, isObj := v.(map[string]interface{})
+	if !ok || !isObj {
+		return []PatchOperation{{Op: PatchOpReplace, Path: jsonPointer(path), Value: v}}
+	}
+
+	keys := make([]string, 0, len(oldObj)+len(obj))
+	for k := range oldObj {
+		keys = append(keys, k)
+	}
+	for k := range obj {
+		if _, ok := oldObj[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var ops []PatchOperation
+	for _, k := range keys {
+		childPath := append(path[:len(path):len(path)], k)
+		oldChild, newChild := oldObj[k], obj[k]
+		switch {
+		case newChild == nil:
+			ops = append(ops, PatchOperation{Op: PatchOpRemove, Path: jsonPointer(childPath)})
+		case oldChild == nil:
+			ops = append(ops, PatchOperation{Op: PatchOpAdd, Path: jsonPointer(childPath), Value: newChild})
+		case !reflect.DeepEqual(oldChild, newChild):
+			ops = append(ops, diffOps(childPath, oldChild, newChild)...)
+		}
+	}
+	return ops
+}
+
+// nest returns v wrapped in the objects leading to it from path.
+func nest(path []string, v interface{}) interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		v = map[string]interface{}{path[i]: v}
+	}
+	return v
+}
+
+// pointerEscaper escapes the segments of a JSON Pointer, RFC 6901.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns the JSON Pointer of path, empty for the root.
+func jsonPointer(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(segment))
+	}
+	return b.String()
+}
@@ -0,0 +1,220 @@
+package firego
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// applyPatch applies RFC 6902 operations, as encoded, to doc.
+func applyPatch(t *testing.T, doc interface{}, ops []PatchOperation) interface{} {
+	b, err := json.Marshal(ops)
+	require.NoError(t, err)
+	var decoded []map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+
+	for _, op := range decoded {
+		pointer := op["path"].(string)
+		if pointer == "" {
+			require.Contains(t, []string{"add", "replace"}, op["op"])
+			doc = op["value"]
+			continue
+		}
+		segments := strings.Split(pointer[1:], "/")
+		for i, s := range segments {
+			segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+		}
+		parent := doc
+		for _, s := range segments[:len(segments)-1] {
+			parent = parent.(map[string]interface{})[s]
+		}
+		obj, ok := parent.(map[string]interface{})
+		require.True(t, ok, "the parent of %s is not an object", pointer)
+		key := segments[len(segments)-1]
+		_, exists := obj[key]
+		switch op["op"] {
+		case "add":
+			assert.False(t, exists, "add of existing %s", pointer)
+			require.Contains(t, op, "value")
+			obj[key] = op["value"]
+		case "replace":
+			require.True(t, exists, "replace of missing %s", pointer)
+			require.Contains(t, op, "value")
+			obj[key] = op["value"]
+		case "remove":
+			require.True(t, exists, "remove of missing %s", pointer)
+			assert.NotContains(t, op, "value")
+			delete(obj, key)
+		default:
+			t.Fatalf("unexpected operation %v", op)
+		}
+	}
+	return doc
+}
+
+func TestMirrorApplyJSONPatch(t *testing.T) {
+	t.Parallel()
+	m := &Mirror{}
+
+	for _, tt := range []struct {
+		event Event
+		ops   []PatchOperation
+	}{
+		{
+			event: Event{Type: EventTypePut, Path: "/", Data: nil},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}}},
+			ops:   []PatchOperation{{Op: PatchOpAdd, Path: "", Value: map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}}}},
+		},
+		{
+			event: Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"a": 1.0}},
+		},
+		{
+			event: Event{Type: EventTypePatch, Path: "/b", Data: map[string]interface{}{"c": false, "d": "new"}},
+			ops: []PatchOperation{
+				{Op: PatchOpReplace, Path: "/b/c", Value: false},
+				{Op: PatchOpAdd, Path: "/b/d", Value: "new"},
+			},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/x/y/z", Data: 0.0},
+			ops:   []PatchOperation{{Op: PatchOpAdd, Path: "/x", Value: map[string]interface{}{"y": map[string]interface{}{"z": 0.0}}}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/a/n", Data: "nested"},
+			ops:   []PatchOperation{{Op: PatchOpReplace, Path: "/a", Value: map[string]interface{}{"n": "nested"}}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/x/y/z", Data: nil},
+			ops:   []PatchOperation{{Op: PatchOpRemove, Path: "/x"}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/b", Data: map[string]interface{}{"d": "new", "e": []interface{}{"l"}}},
+			ops: []PatchOperation{
+				{Op: PatchOpRemove, Path: "/b/c"},
+				{Op: PatchOpAdd, Path: "/b/e", Value: map[string]interface{}{"0": "l"}},
+			},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/b/d", Data: nil},
+			ops:   []PatchOperation{{Op: PatchOpRemove, Path: "/b/d"}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/a~/b", Data: map[string]interface{}{}},
+		},
+		{
+			event: Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"a": nil, "b": nil}},
+			ops: []PatchOperation{
+				{Op: PatchOpRemove, Path: "/a"},
+				{Op: PatchOpReplace, Path: "", Value: nil},
+			},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/", Data: "root"},
+			ops:   []PatchOperation{{Op: PatchOpAdd, Path: "", Value: "root"}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/k~ey", Data: 1.0},
+			ops:   []PatchOperation{{Op: PatchOpReplace, Path: "", Value: map[string]interface{}{"k~ey": 1.0}}},
+		},
+		{
+			event: Event{Type: EventTypePut, Path: "/k~ey", Data: 2.0},
+			ops:   []PatchOperation{{Op: PatchOpReplace, Path: "/k~0ey", Value: 2.0}},
+		},
+		{
+			event: Event{Type: eventTypeKeepAlive},
+		},
+	} {
+		assert.Equal(t, tt.ops, m.ApplyJSONPatch(tt.event), "%+v", tt.event)
+	}
+}
+
+func TestPatchOperationJSON(t *testing.T) {
+	t.Parallel()
+	b, err := json.Marshal([]PatchOperation{
+		{Op: PatchOpAdd, Path: "/a", Value: false},
+		{Op: PatchOpReplace, Path: "", Value: nil},
+		{Op: PatchOpRemove, Path: "/b~1c"},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "add", "path": "/a", "value": false},
+		{"op": "replace", "path": "", "value": null},
+		{"op": "remove", "path": "/b~1c"}
+	]`, string(b))
+}
+
+func TestWatchJSONPatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("doc", map[string]interface{}{"title": "draft", "tags": []interface{}{"a", "b"}})
+	fb := New(server.URL+"/doc", nil)
+	patches := make(chan []PatchOperation)
+	m, err := fb.WatchJSONPatch(patches)
+	require.NoError(t, err)
+
+	var doc interface{}
+	next := func() {
+		select {
+		case ops := <-patches:
+			doc = applyPatch(t, doc, ops)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no patch received")
+		}
+	}
+	check := func() {
+		var mirrored, read interface{}
+		require.NoError(t, m.Value(&mirrored))
+		require.NoError(t, fb.Value(&read))
+		assert.Equal(t, mirrored, doc)
+		assert.Equal(t, normalize(read), doc)
+	}
+
+	next()
+	check()
+
+	for _, write := range []func(){
+		func() { server.Set("doc/title", "final") },
+		func() {
+			server.Update("doc", map[string]interface{}{"meta": map[string]interface{}{"author": "alice"}, "subtitle": "wip"})
+		},
+		func() { server.Delete("doc/meta/author") },
+		func() { server.Set("doc/tags", map[string]interface{}{"1": "b", "2": "d"}) },
+		func() { server.Set("doc/title", map[string]interface{}{"en": "final"}) },
+		func() { server.Delete("doc") },
+		func() { server.Set("doc", "replaced") },
+	} {
+		write()
+		next()
+		check()
+	}
+
+	fb.StopWatching()
+	for range patches {
+	}
+}
+
+func TestWatchJSONPatchStopWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a", 1)
+	fns := []string{"firego.(*firebase).WatchJSONPatch.func", "firego.(*firebase).watch.func"}
+	assertStopWithoutReceiving(t, fns, func() (Firebase, interface{}) {
+		fb := New(server.URL, nil)
+		patches := make(chan []PatchOperation)
+		_, err := fb.WatchJSONPatch(patches)
+		require.NoError(t, err)
+		return fb, patches
+	})
+}
@@ -0,0 +1,209 @@
+package firego
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel is the severity of a logged event.
+type LogLevel int
+
+const (
+	// LogLevelTrace is used for very high frequency events, such as the
+	// keep-alives Firebase sends on an idle stream.
+	LogLevelTrace LogLevel = iota
+	// LogLevelDebug is used for high frequency events, such as
+	// the events received on a stream.
+	LogLevelDebug
+	// LogLevelInfo is used for requests and stream lifecycle changes.
+	LogLevelInfo
+	// LogLevelError is used for failed requests and streams.
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelTrace:
+		return "TRACE"
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives diagnostic information about the requests
+// and streams made by a reference configured with WithLogger.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	// LogRequest is called once a request has completed.
+	LogRequest(level LogLevel, info RequestInfo)
+	// LogStream is called for every lifecycle change of a stream.
+	LogStream(level LogLevel, event StreamEvent)
+}
+
+// RequestInfo describes a completed request.
+type RequestInfo struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// URL is the location the request was made to,
+	// without its query parameters.
+	URL string
+	// StatusCode is the HTTP status of the response,
+	// 0 if no response was received.
+	StatusCode int
+	// Duration is how long the request took.
+	Duration time.Duration
+	// BytesOut is the size of the request body that was sent.
+	BytesOut int64
+	// BytesIn is the size of the response body that was read.
+	BytesIn int64
+	// Err is the error the request failed with, if any.
+	Err error
+	// Cache tells whether a read made by a reference with a read cache
+	// was served from it, in which case no request was made, it is empty
+	// for the other requests.
+	Cache CacheResult
+	// Operation is the name of the operation the request was made for,
+	// set with WithOperationName, empty if none was set.
+	Operation string
+}
+
+// StreamEventType identifies a lifecycle change of a stream.
+type StreamEventType string
+
+const (
+	// StreamOpened is logged when a stream has been established.
+	StreamOpened StreamEventType = "opened"
+	// StreamEventReceived is logged for every event received on a stream.
+	StreamEventReceived StreamEventType = "event"
+	// StreamKeepAlive is logged for every keep-alive received on a stream.
+	StreamKeepAlive StreamEventType = "keep-alive"
+	// StreamReconnecting is logged when a stream that was lost is
+	// about to be established again.
+	StreamReconnecting StreamEventType = "reconnecting"
+	// StreamClosed is logged when a stream has ended.
+	StreamClosed StreamEventType = "closed"
+)
+
+// StreamEvent describes a lifecycle change of a stream.
+type StreamEvent struct {
+	// Type of lifecycle change.
+	Type StreamEventType
+	// URL is the location being streamed, without its query parameters.
+	URL string
+	// EventType is the type of the event received, for StreamEventReceived.
+	EventType string
+	// Err is the error that caused the change, if any.
+	Err error
+}
+
+// WithLogger sends information about every request and stream made by the
+// reference to l.
+func WithLogger(l Logger) Option {
+	return func(fb *firebase) {
+		fb.logger = l
+	}
+}
+
+// NewLogger creates a Logger that writes every event at or above the given
+// level to l. If l is nil, the standard logger is used.
+func NewLogger(l *log.Logger, level LogLevel) Logger {
+	if l == nil {
+		l = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return &stdLogger{l: l, level: level}
+}
+
+type stdLogger struct {
+	l     *log.Logger
+	level LogLevel
+}
+
+func (s *stdLogger) LogRequest(level LogLevel, info RequestInfo) {
+	if level < s.level {
+		return
+	}
+	msg := fmt.Sprintf("[%s] %s %s %d %s", level, info.Method, info.URL, info.StatusCode, info.Duration)
+	if info.Err != nil {
+		msg += ": " + info.Err.Error()
+	}
+	s.l.Println(msg)
+}
+
+func (s *stdLogger) LogStream(level LogLevel, event StreamEvent) {
+	if level < s.level {
+		return
+	}
+	msg := fmt.Sprintf("[%s] stream %s %s", level, event.Type, event.URL)
+	if event.EventType != "" {
+		msg += " " + event.EventType
+	}
+	if event.Err != nil {
+		msg += ": " + event.Err.Error()
+	}
+	s.l.Println(msg)
+}
+
+func (fb *firebase) logRequest(info RequestInfo) {
+	if fb.logger == nil {
+		return
+	}
+
+	if fb.cacheMiss {
+		info.Cache = CacheMiss
+	}
+	level := LogLevelInfo
+	if info.Err != nil {
+		level = LogLevelError
+	}
+	fb.logger.LogRequest(level, info)
+}
+
+func (fb *firebase) logStream(level LogLevel, event StreamEvent) {
+	if fb.logger == nil {
+		return
+	}
+
+	event.URL = fb.url
+	fb.logger.LogStream(level, event)
+}
+
+// countingReader counts the bytes read through it. The count may be read
+// while the transport is still reading a request body from another
+// goroutine.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// countRequestBody replaces the body of req with one that counts the
+// bytes sent.
+func countRequestBody(req *http.Request) *countingReader {
+	c := &countingReader{r: http.NoBody}
+	if req.Body != nil && req.Body != http.NoBody {
+		c.r = req.Body
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{c, req.Body}
+	}
+	return c
+}
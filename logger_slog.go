@@ -0,0 +1,73 @@
+//go:build go1.21
+// +build go1.21
+
+package firego
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger creates a Logger that writes every request and stream
+// event to l as a structured record, whose attributes are the fields of
+// the RequestInfo or StreamEvent, at the slog level matching its LogLevel,
+// LogLevelTrace being one step below slog.LevelDebug. If l is nil, the
+// default slog logger is used. It requires Go 1.21.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) LogRequest(level LogLevel, info RequestInfo) {
+	attrs := []slog.Attr{
+		slog.String("method", info.Method),
+		slog.String("url", info.URL),
+		slog.Int("status", info.StatusCode),
+		slog.Duration("duration", info.Duration),
+		slog.Int64("bytes_out", info.BytesOut),
+		slog.Int64("bytes_in", info.BytesIn),
+	}
+	if info.Cache != "" {
+		attrs = append(attrs, slog.String("cache", string(info.Cache)))
+	}
+	if info.Operation != "" {
+		attrs = append(attrs, slog.String("operation", info.Operation))
+	}
+	if info.Err != nil {
+		attrs = append(attrs, slog.String("error", info.Err.Error()))
+	}
+	s.l.LogAttrs(context.Background(), slogLevel(level), "firebase request", attrs...)
+}
+
+func (s slogLogger) LogStream(level LogLevel, event StreamEvent) {
+	attrs := []slog.Attr{
+		slog.String("type", string(event.Type)),
+		slog.String("url", event.URL),
+	}
+	if event.EventType != "" {
+		attrs = append(attrs, slog.String("event_type", event.EventType))
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+	s.l.LogAttrs(context.Background(), slogLevel(level), "firebase stream", attrs...)
+}
+
+// slogLevel returns the slog level of level.
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelTrace:
+		return slog.LevelDebug - 4
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	}
+	return slog.LevelError
+}
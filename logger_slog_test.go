@@ -0,0 +1,53 @@
+//go:build go1.21
+// +build go1.21
+
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSlogLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	l.LogRequest(LogLevelError, RequestInfo{
+		Method:     "GET",
+		URL:        "https://example.firebaseio.com/a.json",
+		StatusCode: 503,
+		Duration:   time.Second,
+		Operation:  "load",
+		Err:        errors.New("unavailable"),
+	})
+	l.LogStream(LogLevelTrace, StreamEvent{Type: StreamKeepAlive, URL: "https://example.firebaseio.com"})
+	l.LogStream(LogLevelDebug, StreamEvent{Type: StreamEventReceived, URL: "https://example.firebaseio.com", EventType: "put"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, "the trace record is below the level of the handler")
+	var request, stream map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &request))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &stream))
+
+	assert.Equal(t, "ERROR", request["level"])
+	assert.Equal(t, "firebase request", request["msg"])
+	assert.Equal(t, "GET", request["method"])
+	assert.Equal(t, 503.0, request["status"])
+	assert.Equal(t, float64(time.Second), request["duration"])
+	assert.Equal(t, "load", request["operation"])
+	assert.Equal(t, "unavailable", request["error"])
+	assert.NotContains(t, request, "cache")
+
+	assert.Equal(t, "DEBUG", stream["level"])
+	assert.Equal(t, "event", stream["type"])
+	assert.Equal(t, "put", stream["event_type"])
+}
@@ -0,0 +1,197 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+type loggedStreamEvent struct {
+	level LogLevel
+	event StreamEvent
+}
+
+type testLogger struct {
+	mtx      sync.Mutex
+	requests []RequestInfo
+	levels   []LogLevel
+	streams  []loggedStreamEvent
+}
+
+func (l *testLogger) LogRequest(level LogLevel, info RequestInfo) {
+	l.mtx.Lock()
+	l.requests = append(l.requests, info)
+	l.levels = append(l.levels, level)
+	l.mtx.Unlock()
+}
+
+func (l *testLogger) LogStream(level LogLevel, event StreamEvent) {
+	l.mtx.Lock()
+	l.streams = append(l.streams, loggedStreamEvent{level, event})
+	l.mtx.Unlock()
+}
+
+func (l *testLogger) streamEvents() []loggedStreamEvent {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return append([]loggedStreamEvent(nil), l.streams...)
+}
+
+func TestLogRequest(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireAuth(true)
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l))
+	fb.Auth(server.Secret)
+
+	require.NoError(t, fb.Child("foo").Set("bar"))
+	fb.Unauth()
+	assert.Error(t, fb.Child("foo").Remove())
+
+	require.Len(t, l.requests, 2)
+	assert.Equal(t, "PUT", l.requests[0].Method)
+	assert.Equal(t, server.URL+"/foo/.json", l.requests[0].URL)
+	assert.Equal(t, http.StatusOK, l.requests[0].StatusCode)
+	assert.NoError(t, l.requests[0].Err)
+	assert.Equal(t, LogLevelInfo, l.levels[0])
+
+	assert.Equal(t, "DELETE", l.requests[1].Method)
+	assert.Equal(t, http.StatusUnauthorized, l.requests[1].StatusCode)
+	assert.Error(t, l.requests[1].Err)
+	assert.Equal(t, LogLevelError, l.levels[1])
+}
+
+func TestLogRequestBytes(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"a":1,"b":2}`)
+	}))
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l))
+	require.NoError(t, fb.Set(map[string]string{"foo": "bar"}))
+	var v map[string]int
+	require.NoError(t, fb.Value(&v))
+	require.NoError(t, fb.ValueStream(context.Background(), make(chan OrderedEntry, 2)))
+
+	require.Len(t, l.requests, 3)
+	assert.Equal(t, int64(len(`{"foo":"bar"}`)), l.requests[0].BytesOut)
+	assert.Equal(t, int64(len(`{"a":1,"b":2}`)), l.requests[0].BytesIn)
+	for _, info := range l.requests[1:] {
+		assert.Equal(t, int64(0), info.BytesOut, info.Method)
+		assert.Equal(t, int64(len(`{"a":1,"b":2}`)), info.BytesIn, info.Method)
+	}
+}
+
+func TestLogRequestOperation(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l), WithReadCache(time.Minute, 10))
+	profile := fb.WithContext(WithOperationName(context.Background(), "loadUserProfile"))
+	var v interface{}
+	require.NoError(t, profile.Child("profile").Value(&v))
+	require.NoError(t, profile.Child("profile").Value(&v))
+
+	// the name given to a method wins over the one of the reference
+	ctx := WithOperationName(context.Background(), "exportUsers")
+	require.NoError(t, profile.ValueStream(ctx, make(chan OrderedEntry, 1)))
+	require.NoError(t, fb.Set(true))
+
+	require.Len(t, l.requests, 4)
+	assert.Equal(t, "loadUserProfile", l.requests[0].Operation)
+	assert.Equal(t, CacheHit, l.requests[1].Cache)
+	assert.Equal(t, "loadUserProfile", l.requests[1].Operation)
+	assert.Equal(t, "exportUsers", l.requests[2].Operation)
+	assert.Empty(t, l.requests[3].Operation)
+}
+
+func TestLogStream(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		fmt.Fprint(w, "event: keep-alive\ndata: null\n\n")
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	for range notifications {
+	}
+
+	events := l.streamEvents()
+	require.Len(t, events, 4)
+	assert.Equal(t, loggedStreamEvent{LogLevelInfo, StreamEvent{Type: StreamOpened, URL: server.URL}}, events[0])
+	assert.Equal(t, loggedStreamEvent{LogLevelDebug, StreamEvent{Type: StreamEventReceived, URL: server.URL, EventType: "put"}}, events[1])
+	assert.Equal(t, loggedStreamEvent{LogLevelTrace, StreamEvent{Type: StreamKeepAlive, URL: server.URL}}, events[2])
+	assert.Equal(t, StreamClosed, events[3].event.Type)
+	assert.Equal(t, LogLevelError, events[3].level)
+	assert.Error(t, events[3].event.Err)
+}
+
+func TestLogStreamReconnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l))
+	fb.(*firebase).watchHeartbeat = time.Millisecond
+
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, fb.ChildAdded(fn))
+	defer fb.RemoveEventFunc(fn)
+
+	assert.Eventually(t, func() bool {
+		for _, e := range l.streamEvents() {
+			if e.event.Type == StreamReconnecting {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := NewLogger(log.New(&buf, "", 0), LogLevelInfo)
+
+	l.LogStream(LogLevelTrace, StreamEvent{Type: StreamKeepAlive, URL: URL})
+	l.LogStream(LogLevelInfo, StreamEvent{Type: StreamOpened, URL: URL})
+	l.LogRequest(LogLevelError, RequestInfo{Method: "GET", URL: URL, Err: errors.New("boom")})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		"[INFO] stream opened " + URL,
+		"[ERROR] GET " + URL + " 0 0s: boom",
+	}, lines)
+}
@@ -0,0 +1,58 @@
+package firego
+
+import "net/http"
+
+// Doer sends HTTP requests, the way *http.Client does.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is a func used as a Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending the requests of a reference, to observe
+// or alter them.
+type Middleware func(next Doer) Doer
+
+// WithMiddleware makes every request of the reference, the reads and
+// writes as well as the requests opening streams, go through the given
+// middlewares, the first one being the outermost, before being sent with
+// the HTTP client. It is called once per attempt, after the request was
+// signed with WithRequestSigner, and sees the response as received, before
+// firego reads its body, so that it can measure latencies, count status
+// codes or propagate a trace:
+//
+//	firego.WithMiddleware(func(next firego.Doer) firego.Doer {
+//		return firego.DoerFunc(func(req *http.Request) (*http.Response, error) {
+//			ctx, span := tracer.Start(req.Context(), req.Method+" "+req.URL.Path)
+//			defer span.End()
+//			otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+//			return next.Do(req.WithContext(ctx))
+//		})
+//	})
+//
+// firego does not create OpenTelemetry spans itself, which would make every
+// application depend on OpenTelemetry: a middleware like the one above
+// creates them. The body of a streaming response is read while the stream
+// lasts, after the middleware returned. WithLogger and WithRetryHook
+// report the requests once complete and the retries.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(fb *firebase) {
+		fb.middleware = append(fb.middleware[:len(fb.middleware):len(fb.middleware)], mw...)
+	}
+}
+
+// doer returns the Doer sending the requests of the reference, its client
+// wrapped by its middlewares.
+func (fb *firebase) doer() Doer {
+	var d Doer = fb.client
+	for i := len(fb.middleware) - 1; i >= 0; i-- {
+		d = fb.middleware[i](d)
+	}
+	return d
+}
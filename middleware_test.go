@@ -0,0 +1,72 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	t.Parallel()
+	var (
+		mtx     sync.Mutex
+		headers []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		headers = append(headers, req.Header.Get("X-Trace"))
+		mtx.Unlock()
+		if req.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: put\ndata: {\"path\":\"/\",\"data\":1}\n\n"))
+			return
+		}
+		w.Write([]byte(`1`))
+	}))
+	defer server.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				req.Header.Set("X-Trace", req.Header.Get("X-Trace")+name)
+				resp, err := next.Do(req)
+				if err == nil {
+					calls = append(calls, name+" "+resp.Status)
+				}
+				return resp, err
+			})
+		}
+	}
+	fb := New(server.URL, nil, WithMiddleware(trace("a"), trace("b")))
+	var v int
+	require.NoError(t, fb.Child("x").Value(&v))
+	assert.Equal(t, []string{"a", "b", "b 200 OK", "a 200 OK"}, calls)
+
+	// derived references add to the middlewares of their parent only
+	derived := fb.Child("y").(*firebase)
+	WithMiddleware(trace("c"))(derived)
+	require.NoError(t, derived.Value(&v))
+	require.NoError(t, fb.Value(&v))
+	assert.Len(t, fb.(*firebase).middleware, 2)
+
+	// streams go through the middlewares too
+	events := make(chan Event)
+	require.NoError(t, fb.Watch(events))
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	fb.StopWatching()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, []string{"ab", "abc", "ab", "ab"}, headers)
+}
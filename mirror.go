@@ -0,0 +1,278 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mirror is a local copy of the value of a watched reference, kept up to
+// date by applying the put and patch events received for it.
+//
+// A Mirror is safe for concurrent use.
+type Mirror struct {
+	mtx   sync.RWMutex
+	value interface{}
+	// scope holds the patterns of the locations kept, all of them if
+	// empty.
+	scope [][]string
+}
+
+// NewMirror returns an empty Mirror, to which events are applied with
+// Apply, that only keeps the values found at the given paths, relative to
+// the reference the events are for, such as "users/$uid/status", whose
+// segments starting with a $ match any key. The values found elsewhere are
+// dropped when an event is applied, nothing is kept for them, so that a
+// mirror of a large subtree only holds the slice it tracks. Without paths
+// it keeps every value, the way the zero Mirror does.
+func NewMirror(paths ...string) *Mirror {
+	m := &Mirror{}
+	for _, path := range paths {
+		m.scope = append(m.scope, splitPath(path))
+	}
+	return m
+}
+
+// Mirror watches the reference and maintains a Mirror of its value,
+// passing the events received over to the given chan once they have been
+// applied to the mirror. If onlyChanges is set, put and patch events that
+// do not change the mirrored value, such as a patch setting a child to
+// the value it already had, are not passed on. This costs a deep
+// comparison of the changed values per event, in exchange for fewer
+// updates downstream.
+//
+// The watch is stopped with StopWatching, the same way it is for Watch.
+func (fb *firebase) Mirror(notifications chan Event, onlyChanges bool) (*Mirror, error) {
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return nil, err
+	}
+
+	return fb.startMirror(events, notifications, onlyChanges, &Mirror{}), nil
+}
+
+// MirrorPaths watches the reference and maintains a Mirror of its value
+// like Mirror does, keeping only the values found at the given paths, as
+// documented by NewMirror. The watch still receives every event for the
+// reference, those that change no value kept are not passed on when
+// onlyChanges is set.
+func (fb *firebase) MirrorPaths(notifications chan Event, onlyChanges bool, paths ...string) (*Mirror, error) {
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return nil, err
+	}
+	return fb.startMirror(events, notifications, onlyChanges, NewMirror(paths...)), nil
+}
+
+// startMirror applies the events of a watch to m, passing them over to
+// notifications.
+func (fb *firebase) startMirror(events, notifications chan Event, onlyChanges bool, m *Mirror) *Mirror {
+	stop := fb.watchStopped()
+	go func() {
+		defer close(notifications)
+		for event := range events {
+			changed := m.Apply(event)
+			isData := event.Type == EventTypePut || event.Type == EventTypePatch
+			if onlyChanges && isData && !changed {
+				continue
+			}
+			if !sendOrStop(notifications, event, stop) {
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// Apply applies a put or patch event to the mirror and reports whether it
+// changed the mirrored value. A put replaces the value at the path of the
+// event, a patch replaces only the children named in its data. Other
+// events are ignored.
+func (m *Mirror) Apply(event Event) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	path := splitPath(event.Path)
+	switch event.Type {
+	case EventTypePut:
+		return m.set(path, event.Data)
+	case EventTypePatch:
+		children, ok := event.Data.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		var changed bool
+		for k, v := range children {
+			if m.set(append(path[:len(path):len(path)], splitPath(k)...), v) {
+				changed = true
+			}
+		}
+		return changed
+	}
+	return false
+}
+
+// Value decodes the mirrored value into v the way json.Unmarshal does,
+// without a request to Firebase. The mirror holds the value as of the
+// last event applied to it, which lags behind the database by the latency
+// of the stream: a write, even one made through the same reference, is
+// only seen by Value once its event has been received and applied. Arrays
+// are held as objects keyed by their index and decode into maps, not
+// slices. A mirror that holds no value decodes as null.
+func (m *Mirror) Value(v interface{}) error {
+	m.mtx.RLock()
+	raw, err := json.Marshal(m.value)
+	m.mtx.RUnlock()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// set must be called while holding the mirror's lock.
+func (m *Mirror) set(path []string, v interface{}) bool {
+	v, ok := m.scoped(path, v)
+	if !ok {
+		return false
+	}
+	if reflect.DeepEqual(lookup(m.value, path), v) {
+		return false
+	}
+	m.value = setPath(m.value, path, v)
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// scoped returns the normalized part of v, the value set at path, that is
+// in the scope of the mirror, and whether path holds any location in the
+// scope.
+func (m *Mirror) scoped(path []string, v interface{}) (interface{}, bool) {
+	v = normalize(v)
+	if len(m.scope) == 0 {
+		return v, true
+	}
+	var below [][]string
+	for _, pattern := range m.scope {
+		switch {
+		case len(pattern) <= len(path) && matchSegments(pattern, path[:len(pattern)]):
+			// path is in the scope
+			return v, true
+		case len(pattern) > len(path) && matchSegments(pattern[:len(path)], path):
+			below = append(below, pattern[len(path):])
+		}
+	}
+	if len(below) == 0 {
+		return nil, false
+	}
+	return filterPatterns(v, below), true
+}
+
+// filterPatterns returns the part of v, normalized, found at patterns.
+func filterPatterns(v interface{}, patterns [][]string) interface{} {
+	children, ok := v.(map[string]interface{})
+	for _, pattern := range patterns {
+		if len(pattern) == 0 {
+			return v
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	filtered := map[string]interface{}{}
+	for k, child := range children {
+		var below [][]string
+		for _, pattern := range patterns {
+			if matchSegments(pattern[:1], []string{k}) {
+				below = append(below, pattern[1:])
+			}
+		}
+		if len(below) == 0 {
+			continue
+		}
+		if child = filterPatterns(child, below); child != nil {
+			filtered[k] = child
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+// lookup returns the value found at path in v.
+func lookup(v interface{}, path []string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// setPath sets the value found at path in root to v
+// and returns the resulting root.
+func setPath(root interface{}, path []string, v interface{}) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+
+	m, ok := root.(map[string]interface{})
+	if !ok {
+		if v == nil {
+			return root
+		}
+		m = map[string]interface{}{}
+	}
+	if child := setPath(m[path[0]], path[1:], v); child != nil {
+		m[path[0]] = child
+	} else {
+		delete(m, path[0])
+	}
+
+	if len(m) == 0 {
+		// Firebase does not keep empty nodes
+		return nil
+	}
+	return m
+}
+
+// normalize returns a copy of a value decoded from an event in the
+// representation kept by the mirror, arrays become objects keyed by index
+// and empty objects, which Firebase does not store, become nil.
+func normalize(v interface{}) interface{} {
+	var children map[string]interface{}
+	switch val := v.(type) {
+	case []interface{}:
+		children = make(map[string]interface{}, len(val))
+		for i, child := range val {
+			children[strconv.Itoa(i)] = child
+		}
+	case map[string]interface{}:
+		children = val
+	default:
+		return v
+	}
+
+	m := make(map[string]interface{}, len(children))
+	for k, child := range children {
+		if child = normalize(child); child != nil {
+			m[k] = child
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
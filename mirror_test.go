@@ -0,0 +1,304 @@
+package firego
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestMirrorApply(t *testing.T) {
+	t.Parallel()
+	m := &Mirror{}
+
+	for _, tt := range []struct {
+		event   Event
+		changed bool
+		value   interface{}
+	}{
+		{
+			event:   Event{Type: EventTypePut, Path: "/", Data: nil},
+			changed: false,
+			value:   nil,
+		},
+		{
+			event:   Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}}},
+			changed: true,
+			value:   map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}},
+		},
+		{
+			event:   Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"a": 1.0}},
+			changed: false,
+			value:   map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}},
+		},
+		{
+			event:   Event{Type: EventTypePatch, Path: "/b", Data: map[string]interface{}{"c": true, "d": "new"}},
+			changed: true,
+			value:   map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true, "d": "new"}},
+		},
+		{
+			event:   Event{Type: EventTypePut, Path: "/b/c", Data: nil},
+			changed: true,
+			value:   map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"d": "new"}},
+		},
+		{
+			event:   Event{Type: EventTypePut, Path: "/b/d", Data: nil},
+			changed: true,
+			value:   map[string]interface{}{"a": 1.0},
+		},
+		{
+			event:   Event{Type: EventTypePut, Path: "/x/y", Data: map[string]interface{}{}},
+			changed: false,
+			value:   map[string]interface{}{"a": 1.0},
+		},
+		{
+			event:   Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"l": []interface{}{"z"}}},
+			changed: true,
+			value:   map[string]interface{}{"a": 1.0, "l": map[string]interface{}{"0": "z"}},
+		},
+		{
+			event:   Event{Type: EventTypeAuthRevoked},
+			changed: false,
+			value:   map[string]interface{}{"a": 1.0, "l": map[string]interface{}{"0": "z"}},
+		},
+	} {
+		assert.Equal(t, tt.changed, m.Apply(tt.event), "%#v", tt.event)
+		assert.Equal(t, tt.value, m.value, "%#v", tt.event)
+	}
+}
+
+func TestMirrorPutAndPatch(t *testing.T) {
+	t.Parallel()
+	m := &Mirror{}
+
+	user := func(kv ...interface{}) map[string]interface{} {
+		u := map[string]interface{}{}
+		for i := 0; i < len(kv); i += 2 {
+			u[kv[i].(string)] = kv[i+1]
+		}
+		return u
+	}
+
+	for _, tt := range []struct {
+		event Event
+		value interface{}
+	}{
+		{
+			event: Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "a", "age", 1.0)}}},
+			value: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "a", "age", 1.0)}},
+		},
+		{
+			// a patch merges, leaving age untouched
+			event: Event{Type: EventTypePatch, Path: "/users/42", Data: user("name", "b")},
+			value: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "b", "age", 1.0)}},
+		},
+		{
+			// a put replaces, dropping age
+			event: Event{Type: EventTypePut, Path: "/users/42", Data: user("name", "c")},
+			value: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "c")}},
+		},
+		{
+			// patch keys may be paths relative to the event path
+			event: Event{Type: EventTypePatch, Path: "/users", Data: map[string]interface{}{"42/age": 2.0, "43": user("name", "d")}},
+			value: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "c", "age", 2.0), "43": user("name", "d")}},
+		},
+		{
+			event: Event{Type: EventTypePatch, Path: "/users", Data: map[string]interface{}{"43": nil}},
+			value: map[string]interface{}{"users": map[string]interface{}{"42": user("name", "c", "age", 2.0)}},
+		},
+	} {
+		m.Apply(tt.event)
+		assert.Equal(t, tt.value, m.value, "%#v", tt.event)
+	}
+}
+
+func TestMirrorValue(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users/42", map[string]interface{}{"name": "a", "tags": []interface{}{"x", "y"}})
+	fb := New(server.URL, nil).Child("users")
+	notifications := make(chan Event)
+	m, err := fb.Mirror(notifications, false)
+	require.NoError(t, err)
+	defer fb.StopWatching()
+	<-notifications
+
+	var byID map[string]struct {
+		Name string            `json:"name"`
+		Tags map[string]string `json:"tags"`
+	}
+	require.NoError(t, m.Value(&byID))
+	assert.Equal(t, "a", byID["42"].Name)
+	assert.Equal(t, map[string]string{"0": "x", "1": "y"}, byID["42"].Tags)
+
+	server.Set("users/42/name", "b")
+	<-notifications
+	var users map[string]map[string]interface{}
+	require.NoError(t, m.Value(&users))
+	assert.Equal(t, "b", users["42"]["name"])
+
+	// what is decoded is a copy of the mirrored value
+	users["42"]["name"] = "changed"
+	require.NoError(t, m.Value(&users))
+	assert.Equal(t, "b", users["42"]["name"])
+
+	var none *string
+	require.NoError(t, (&Mirror{}).Value(&none))
+	assert.Nil(t, none)
+}
+
+func TestMirrorOnlyChanges(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	_, err := fb.Mirror(notifications, true)
+	require.NoError(t, err)
+	defer fb.StopWatching()
+
+	next := func() Event {
+		select {
+		case event := <-notifications:
+			return event
+		case <-time.After(250 * time.Millisecond):
+			require.FailNow(t, "did not receive a notification")
+		}
+		return Event{}
+	}
+
+	server.Set("foo", map[string]interface{}{"a": 1.0, "b": 2.0})
+	event := next()
+	assert.Equal(t, "/foo", event.Path)
+
+	// the initial empty put and this patch leave the mirror unchanged
+	server.Update("foo", map[string]interface{}{"a": 1.0})
+	server.Set("foo/c", 3.0)
+	event = next()
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/foo/c", event.Path)
+
+	select {
+	case event := <-notifications:
+		assert.FailNow(t, "unexpected notification", "%#v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorScope(t *testing.T) {
+	t.Parallel()
+	m := NewMirror("users/$uid/status", "config/version")
+	users := map[string]interface{}{
+		"alice": map[string]interface{}{"status": "online", "bio": strings.Repeat("x", 1000)},
+		"bob":   map[string]interface{}{"bio": "no status"},
+	}
+
+	assert.True(t, m.Apply(Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{
+		"users":  users,
+		"config": map[string]interface{}{"version": 2.0, "flags": map[string]interface{}{"beta": true}},
+		"logs":   []interface{}{"a", "b"},
+	}}))
+	// only the values in scope are held
+	assert.Equal(t, map[string]interface{}{
+		"users":  map[string]interface{}{"alice": map[string]interface{}{"status": "online"}},
+		"config": map[string]interface{}{"version": 2.0},
+	}, m.value)
+
+	// events outside the scope are dropped
+	assert.False(t, m.Apply(Event{Type: EventTypePut, Path: "/logs/2", Data: "c"}))
+	assert.False(t, m.Apply(Event{Type: EventTypePut, Path: "/users/alice/bio", Data: "changed"}))
+	assert.False(t, m.Apply(Event{Type: EventTypePatch, Path: "/config", Data: map[string]interface{}{"flags": nil}}))
+
+	// and those inside it applied
+	assert.True(t, m.Apply(Event{Type: EventTypePut, Path: "/users/bob/status", Data: "away"}))
+	assert.True(t, m.Apply(Event{Type: EventTypePatch, Path: "/users", Data: map[string]interface{}{
+		"carol": map[string]interface{}{"status": "online", "bio": "new"},
+		"alice": nil,
+	}}))
+	assert.True(t, m.Apply(Event{Type: EventTypePut, Path: "/config", Data: map[string]interface{}{"flags": true}}))
+	assert.Equal(t, map[string]interface{}{
+		"users": map[string]interface{}{
+			"bob":   map[string]interface{}{"status": "away"},
+			"carol": map[string]interface{}{"status": "online"},
+		},
+	}, m.value)
+
+	var v map[string]map[string]map[string]string
+	require.NoError(t, m.Value(&v))
+	assert.Equal(t, "away", v["users"]["bob"]["status"])
+
+	// a put at a location holding scoped values replaces them
+	assert.True(t, m.Apply(Event{Type: EventTypePut, Path: "/users/bob", Data: map[string]interface{}{"bio": "b"}}))
+	assert.Equal(t, map[string]interface{}{
+		"users": map[string]interface{}{"carol": map[string]interface{}{"status": "online"}},
+	}, m.value)
+}
+
+func TestMirrorPaths(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"status": "online", "bio": "a"},
+		"bob":   map[string]interface{}{"status": "away", "bio": "b"},
+	})
+	fb := New(server.URL+"/users", nil)
+	notifications := make(chan Event)
+	m, err := fb.MirrorPaths(notifications, true, "$uid/status")
+	require.NoError(t, err)
+	defer fb.StopWatching()
+
+	next := func() Event {
+		select {
+		case event := <-notifications:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive a notification")
+		}
+		return Event{}
+	}
+	next()
+	assert.Equal(t, map[string]interface{}{
+		"alice": map[string]interface{}{"status": "online"},
+		"bob":   map[string]interface{}{"status": "away"},
+	}, m.value)
+
+	// the changes out of scope are not passed on
+	server.Set("users/alice/bio", "changed")
+	server.Set("users/bob/status", "offline")
+	event := next()
+	assert.Equal(t, "/bob/status", event.Path)
+
+	var status map[string]map[string]string
+	require.NoError(t, m.Value(&status))
+	assert.Equal(t, map[string]map[string]string{
+		"alice": {"status": "online"},
+		"bob":   {"status": "offline"},
+	}, status)
+}
+
+func TestMirrorStopWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fns := []string{"firego.(*firebase).startMirror.func", "firego.(*firebase).watch.func"}
+	assertStopWithoutReceiving(t, fns, func() (Firebase, interface{}) {
+		fb := New(server.URL, nil)
+		notifications := make(chan Event)
+		_, err := fb.Mirror(notifications, false)
+		require.NoError(t, err)
+		// nor this change
+		server.Set("foo", "bar")
+		return fb, notifications
+	})
+}
@@ -0,0 +1,115 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_url "net/url"
+	"strings"
+)
+
+// ErrNothingToMove is returned by Move when the source reference has no value.
+var ErrNothingToMove = errors.New("nothing to move")
+
+// Move moves the value of the reference to dest, leaving the reference empty.
+//
+// When both references belong to the same database, the value is written to
+// dest and removed from the reference with a single multi-path update at
+// their closest common ancestor, so either both changes are applied or
+// neither is. Otherwise the value is set on dest and then removed from the
+// reference, if the removal fails the value is left in both places.
+//
+// In both cases the value is read before it is written, changes made to the
+// reference between the read and the write are lost. A reference can not be
+// moved to itself, one of its ancestors or one of its descendants. The
+// query of the reference is ignored, the whole value is moved.
+func (fb *firebase) Move(dest Firebase) error {
+	// the whole value is moved, whatever the query of the reference
+	src := fb.copy()
+	src.clearReadParams()
+	var value json.RawMessage
+	if err := src.Value(&value); err != nil {
+		return err
+	}
+	if value == nil || string(value) == "null" {
+		return ErrNothingToMove
+	}
+
+	d, ok := dest.(*firebase)
+	if !ok || !fb.sameDatabase(d) {
+		if err := dest.Set(value); err != nil {
+			return err
+		}
+		return src.Remove()
+	}
+
+	srcPath, destPath := fb.path(), d.path()
+	ancestor := commonAncestor(srcPath, destPath)
+	if ancestor == srcPath || ancestor == destPath {
+		return fmt.Errorf("can not move %q to %q", "/"+srcPath, "/"+destPath)
+	}
+
+	url, err := fb.rootURL()
+	if err != nil {
+		return err
+	}
+	root := src.copy()
+	if root.url, err = joinURL(url, ancestor); err != nil {
+		return err
+	}
+
+	update := map[string]json.RawMessage{
+		strings.TrimPrefix(strings.TrimPrefix(destPath, ancestor), "/"): value,
+		strings.TrimPrefix(strings.TrimPrefix(srcPath, ancestor), "/"):  json.RawMessage("null"),
+	}
+	bytes, err := fb.marshalPayload(update)
+	if err != nil {
+		return err
+	}
+	_, err = root.write(context.Background(), "PATCH", bytes)
+	return err
+}
+
+// sameDatabase reports whether the references point at the same database,
+// with their paths relative to the same prefix.
+func (fb *firebase) sameDatabase(other *firebase) bool {
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		return false
+	}
+	o, err := _url.Parse(other.url)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == o.Scheme && u.Host == o.Host && fb.pathPrefix == other.pathPrefix &&
+		fb.params.Get(namespaceParam) == other.params.Get(namespaceParam)
+}
+
+// path returns the path of the reference without leading or trailing
+// slashes, relative to the prefix of the reference if it has one.
+func (fb *firebase) path() string {
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		return ""
+	}
+	path := strings.Trim(u.Path, "/")
+	switch {
+	case fb.pathPrefix == "":
+	case path == fb.pathPrefix:
+		path = ""
+	case strings.HasPrefix(path, fb.pathPrefix+"/"):
+		path = path[len(fb.pathPrefix)+1:]
+	}
+	return path
+}
+
+// commonAncestor returns the longest path shared by a and b.
+func commonAncestor(a, b string) string {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	var common []string
+	for i := 0; i < len(as) && i < len(bs) && as[i] == bs[i]; i++ {
+		common = append(common, as[i])
+	}
+	return strings.Join(common, "/")
+}
@@ -0,0 +1,88 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestMove(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/bob", map[string]interface{}{"name": "bob"})
+	server.Set("users/alice", map[string]interface{}{"name": "alice"})
+
+	fb := New(server.URL, nil)
+	require.NoError(t, fb.Child("users/bob").Move(fb.Child("archive/users/bob")))
+
+	assert.Nil(t, server.Get("users/bob"))
+	assert.Equal(t, map[string]interface{}{"name": "bob"}, server.Get("archive/users/bob"))
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, server.Get("users/alice"))
+}
+
+func TestMoveSingleUpdate(t *testing.T) {
+	t.Parallel()
+	var requests []*http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		if req.Method == "PATCH" {
+			body = make([]byte, req.ContentLength)
+			req.Body.Read(body)
+		}
+		w.Write([]byte(`{"name":"bob"}`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	src := fb.Child("users/bob").OrderBy("$key").LimitToFirst(1)
+	src.Shallow(true)
+	require.NoError(t, src.Move(fb.Child("users/robert")))
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "GET", requests[0].Method)
+	assert.Equal(t, "PATCH", requests[1].Method)
+	assert.Equal(t, "/users/.json", requests[1].URL.Path)
+	// the query of the reference is not part of either request
+	assert.Empty(t, requests[0].URL.RawQuery)
+	assert.Empty(t, requests[1].URL.RawQuery)
+	assert.JSONEq(t, `{"robert":{"name":"bob"},"bob":null}`, string(body))
+}
+
+func TestMoveOtherDatabase(t *testing.T) {
+	t.Parallel()
+	src := firetest.New()
+	src.Start()
+	defer src.Close()
+	dest := firetest.New()
+	dest.Start()
+	defer dest.Close()
+	src.Set("users/bob", "bob")
+
+	err := New(src.URL, nil).Child("users/bob").Move(New(dest.URL, nil).Child("users/bob"))
+	require.NoError(t, err)
+
+	assert.Nil(t, src.Get("users/bob"))
+	assert.Equal(t, "bob", dest.Get("users/bob"))
+}
+
+func TestMoveErrors(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/bob", "bob")
+	fb := New(server.URL, nil)
+
+	assert.Equal(t, ErrNothingToMove, fb.Child("users/alice").Move(fb.Child("archive/alice")))
+	assert.Error(t, fb.Child("users/bob").Move(fb.Child("users/bob/old")))
+	assert.Error(t, fb.Child("users/bob").Move(fb.Child("users")))
+	assert.Error(t, fb.Child("users/bob").Move(fb.Child("users/bob")))
+	assert.Equal(t, "bob", server.Get("users/bob"))
+}
@@ -0,0 +1,66 @@
+package firego
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// WithFloatFormat makes the writes of Go values serialize the numbers that
+// are not integers with strconv.FormatFloat(f, format, prec, 64) instead
+// of the shortest representation encoding/json picks, which switches to
+// scientific notation for very large and very small numbers. format is
+// one of 'e', 'E', 'f', 'g' and 'G', any other format is ignored. For
+// example, WithFloatFormat('f', 2) writes 0.1+0.2 as 0.30 and 1e21 as
+// 1000000000000000000000.00, and WithFloatFormat('f', -1) never uses
+// scientific notation. Integers, including float fields holding one, are
+// written the way encoding/json writes them.
+//
+// Firebase stores every number as a double, the representation sent does
+// not survive the write: a fixed number of decimals rounds the values
+// written, so that the values other clients wrote the same way compare
+// equal, but a value read back is serialized by Firebase however it
+// chooses. An orderBy value query, and EqualTo and the other bounds that
+// go with it, compares the doubles stored, so values rounded differently
+// by different clients neither match nor order the way they read. Writes
+// of raw JSON, such as SetJSON, are not reformatted.
+func WithFloatFormat(format byte, prec int) Option {
+	return func(fb *firebase) {
+		fb.floatFormat = nil
+		switch format {
+		case 'e', 'E', 'f', 'g', 'G':
+			fb.floatFormat = &floatFormat{format: format, prec: prec}
+		}
+	}
+}
+
+// floatFormat is the format set with WithFloatFormat.
+type floatFormat struct {
+	format byte
+	prec   int
+}
+
+// apply reformats the numbers of tree, decoded with decodeTree,
+// that are not integers.
+func (f *floatFormat) apply(tree interface{}) interface{} {
+	switch v := tree.(type) {
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			return v
+		}
+		n, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		return json.Number(strconv.FormatFloat(n, f.format, f.prec, 64))
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = f.apply(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = f.apply(child)
+		}
+	}
+	return tree
+}
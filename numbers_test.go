@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFloatFormat(t *testing.T) {
+	t.Parallel()
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ = ioutil.ReadAll(req.Body)
+		w.Write([]byte(`{"name":"-key"}`))
+	}))
+	defer server.Close()
+
+	type payment struct {
+		Amount float64 `json:"amount"`
+		Units  int64   `json:"units"`
+		Rate   float64 `json:"rate"`
+	}
+	tenth := 0.1
+	for _, test := range []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			// the value is sent as encoding/json serializes it
+			name:     "default",
+			expected: `{"amount":0.30000000000000004,"units":9007199254740993,"rate":1e+21}`,
+		},
+		{
+			name:     "fixed",
+			opts:     []Option{WithFloatFormat('f', 2)},
+			expected: `{"amount":0.30,"rate":1000000000000000000000.00,"units":9007199254740993}`,
+		},
+		{
+			name:     "decimal",
+			opts:     []Option{WithFloatFormat('f', -1)},
+			expected: `{"amount":0.30000000000000004,"rate":1000000000000000000000,"units":9007199254740993}`,
+		},
+		{
+			name:     "invalid",
+			opts:     []Option{WithFloatFormat('x', -1)},
+			expected: `{"amount":0.30000000000000004,"units":9007199254740993,"rate":1e+21}`,
+		},
+	} {
+		fb := New(server.URL, nil, test.opts...)
+		p := payment{Amount: tenth + 2*tenth, Units: 1<<53 + 1, Rate: 1e21}
+		require.NoError(t, fb.Set(p), test.name)
+		assert.Equal(t, test.expected, string(body), test.name)
+	}
+
+	// every write is reformatted
+	fb := New(server.URL, nil, WithFloatFormat('e', 1))
+	_, err := fb.Push([]interface{}{2.5, 3, "1.5"})
+	require.NoError(t, err)
+	assert.Equal(t, `[2.5e+00,3,"1.5"]`, string(body))
+
+	// other conversions still apply
+	fb = New(server.URL, nil, WithFloatFormat('f', 1), WithEpochTimes(time.Second))
+	require.NoError(t, fb.Update(map[string]interface{}{"at": time.Unix(10, 0), "price": 9.99}))
+	assert.Equal(t, `{"at":10,"price":10.0}`, string(body))
+}
@@ -0,0 +1,104 @@
+package firego
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// Option configures a Firebase reference when it is created with New.
+// Options are inherited by every reference derived from the one they
+// were applied to.
+type Option func(*firebase)
+
+// WithForceContentLength determines whether or not writes whose size
+// is not known up front, such as SetJSON, are read into memory so
+// they can be sent with a Content-Length header instead of using
+// chunked transfer encoding. Some proxies mishandle chunked requests.
+//
+// Writes of Go values are always serialized in memory first and
+// therefore always carry a Content-Length.
+func WithForceContentLength(v bool) Option {
+	return func(fb *firebase) {
+		fb.forceContentLength = v
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used by the client that New
+// creates when it is not given one, for example to pin certificates or to
+// trust the CA of a TLS-inspecting proxy. The connection and header
+// timeouts of the client are unaffected.
+//
+// The option is ignored when New is given a client, that client's
+// transport should be configured instead.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(fb *firebase) {
+		fb.tlsConfig = config
+	}
+}
+
+// WithAuthInHeader determines whether or not access tokens, such as the
+// ones obtained from the token source set with AuthWithTokenSource, are
+// sent in an "Authorization: Bearer" header instead of the access_token
+// query parameter, which keeps them out of the access logs of proxies.
+//
+// Database secrets set with Auth can only be sent as the auth query
+// parameter and are unaffected.
+func WithAuthInHeader(v bool) Option {
+	return func(fb *firebase) {
+		fb.authInHeader = v
+	}
+}
+
+// WithAccept sets the Accept header sent with every request but the
+// streaming ones, which always accept text/event-stream. By default
+// application/json is accepted.
+//
+// Since firego decodes every response as JSON, reads made with a custom
+// Accept header fail if the response is not a JSON document, and every
+// request fails if accept is not a valid media range.
+func WithAccept(accept string) Option {
+	return func(fb *firebase) {
+		fb.accept = accept
+	}
+}
+
+// WithAppCheckToken sends token as the App Check token of every request,
+// streams included, in the X-Firebase-AppCheck header that databases
+// enforcing App Check require. App Check tokens expire, long-running
+// clients should use WithAppCheck instead.
+//
+// Reference https://firebase.google.com/docs/app-check/custom-resource-backend
+func WithAppCheckToken(token string) Option {
+	return WithAppCheck(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+}
+
+// WithAppCheck sends an App Check token obtained from ts with every
+// request, the way WithAppCheckToken does. Tokens are reused until they
+// expire, as told by their Expiry, at which point a new one is requested
+// from ts, the same way the access tokens set with AuthWithTokenSource are
+// refreshed. The AccessToken of the tokens holds the App Check token.
+func WithAppCheck(ts oauth2.TokenSource) Option {
+	return func(fb *firebase) {
+		fb.appCheck = oauth2.ReuseTokenSource(nil, ts)
+	}
+}
+
+// WithRequestSigner calls sign with every request, streams included, right
+// before it is sent, once its headers, authentication included, and its
+// body are set, so that sign can add the headers an API gateway in front
+// of Firebase requires, such as an HMAC signature of the request. A
+// request for which sign returns an error is not sent and fails with it.
+// Every attempt of a retried request is signed anew, as is every
+// reconnection of a stream.
+//
+// The body of a write can be read, without consuming it, through the
+// GetBody func of the request, which is set whenever the request carries a
+// Content-Length: writes of Go values always do, writes of raw JSON, such
+// as SetJSON, do when WithForceContentLength is set.
+func WithRequestSigner(sign func(*http.Request) error) Option {
+	return func(fb *firebase) {
+		fb.signer = sign
+	}
+}
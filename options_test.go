@@ -0,0 +1,264 @@
+package firego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestWithForceContentLength(t *testing.T) {
+	t.Parallel()
+	const payload = `{"foo":"bar"}`
+
+	for _, test := range []struct {
+		name     string
+		force    bool
+		write    func(fb Firebase) error
+		length   int64
+		encoding []string
+	}{
+		{
+			name:   "set",
+			write:  func(fb Firebase) error { return fb.Set(map[string]string{"foo": "bar"}) },
+			length: int64(len(payload)),
+		},
+		{
+			name:     "set json",
+			write:    func(fb Firebase) error { return fb.SetJSON(io.MultiReader(strings.NewReader(payload))) },
+			length:   -1,
+			encoding: []string{"chunked"},
+		},
+		{
+			name:   "set json forced",
+			force:  true,
+			write:  func(fb Firebase) error { return fb.SetJSON(io.MultiReader(strings.NewReader(payload))) },
+			length: int64(len(payload)),
+		},
+	} {
+		var (
+			req  *http.Request
+			body []byte
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req = r
+			body, _ = ioutil.ReadAll(r.Body)
+		}))
+
+		fb := New(server.URL, nil, WithForceContentLength(test.force))
+		require.NoError(t, test.write(fb), test.name)
+		require.NotNil(t, req, test.name)
+
+		assert.Equal(t, test.length, req.ContentLength, test.name)
+		assert.Equal(t, test.encoding, req.TransferEncoding, test.name)
+		assert.Equal(t, payload, string(body), test.name)
+		server.Close()
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`"secure"`))
+	}))
+	defer server.Close()
+
+	// the server's self-signed certificate is not trusted by default
+	var v string
+	err := New(server.URL, nil).Value(&v)
+	assert.Error(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	fb := New(server.URL, nil, WithTLSConfig(&tls.Config{RootCAs: pool}))
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "secure", v)
+
+	// the timeouts are still in place
+	tr := fb.(*firebase).client.Transport.(*http.Transport)
+	assert.NotNil(t, tr.DialContext)
+	assert.Equal(t, TimeoutDuration, tr.ResponseHeaderTimeout)
+}
+
+func TestWithAuthInHeader(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithAuthInHeader(true))
+	fb.AuthWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	require.NoError(t, fb.Child("foo").Set(true))
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, "Bearer token", server.receivedReqs[0].Header.Get("Authorization"))
+	assert.Empty(t, server.receivedReqs[0].URL.RawQuery)
+
+	fb.Auth("secret")
+	require.NoError(t, fb.Set(true))
+	require.Len(t, server.receivedReqs, 2)
+	assert.Empty(t, server.receivedReqs[1].Header.Get("Authorization"))
+	assert.Equal(t, authParam+"=secret", server.receivedReqs[1].URL.RawQuery)
+}
+
+// countingTokenSource returns a new token, already expired, every time.
+type countingTokenSource struct {
+	n int32
+}
+
+func (ts *countingTokenSource) Token() (*oauth2.Token, error) {
+	n := atomic.AddInt32(&ts.n, 1)
+	return &oauth2.Token{AccessToken: fmt.Sprint("token", n), Expiry: time.Now().Add(-time.Second)}, nil
+}
+
+func TestWithAppCheck(t *testing.T) {
+	t.Parallel()
+	tokens := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tokens <- req.Header.Get("X-Firebase-AppCheck")
+		if req.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+			return
+		}
+		w.Write([]byte(`null`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithAppCheckToken("app-check"))
+	require.NoError(t, fb.Child("foo").Set(true))
+	assert.Equal(t, "app-check", <-tokens)
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	assert.Equal(t, "app-check", <-tokens, "streams carry the token too")
+	fb.StopWatching()
+
+	// expired tokens are refreshed
+	fb = New(server.URL, nil, WithAppCheck(&countingTokenSource{}))
+	require.NoError(t, fb.Value(new(interface{})))
+	require.NoError(t, fb.Value(new(interface{})))
+	assert.Equal(t, "token1", <-tokens)
+	assert.Equal(t, "token2", <-tokens)
+}
+
+func TestWithAccept(t *testing.T) {
+	t.Parallel()
+	var accept []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		accept = append(accept, req.Header.Get("Accept"))
+		switch req.URL.Path {
+		case "/html/.json":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		default:
+			w.Header().Set("Content-Type", "application/vnd.gateway+json")
+			w.Write([]byte("true"))
+		}
+	}))
+	defer server.Close()
+
+	var v bool
+	require.NoError(t, New(server.URL, nil).Value(&v))
+	require.NoError(t, New(server.URL, nil, WithAccept("application/vnd.gateway+json")).Value(&v))
+	assert.True(t, v)
+	assert.Equal(t, []string{"application/json", "application/vnd.gateway+json"}, accept)
+
+	err := New(server.URL, nil, WithAccept("application/vnd.gateway+json")).Child("html").Value(&v)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "text/html")
+
+	err = New(server.URL, nil, WithAccept("not a media type")).Value(&v)
+	assert.Error(t, err)
+	assert.Len(t, accept, 3)
+}
+
+func TestWithRequestSigner(t *testing.T) {
+	t.Parallel()
+	key := []byte("gateway key")
+	mac := func(method, path, timestamp string, body []byte) string {
+		h := hmac.New(sha256.New, key)
+		fmt.Fprintf(h, "%s\n%s\n%s\n", method, path, timestamp)
+		h.Write(body)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	var attempts int32
+	timestamps := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		timestamp := req.Header.Get("X-Timestamp")
+		if req.Header.Get("X-Signature") != mac(req.Method, req.URL.Path, timestamp, body) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		timestamps <- timestamp
+		if req.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+			return
+		}
+		if req.Method == "PUT" && atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	var clock int32
+	signer := func(req *http.Request) error {
+		var body []byte
+		if req.GetBody != nil {
+			r, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			if body, err = ioutil.ReadAll(r); err != nil {
+				return err
+			}
+		}
+		timestamp := fmt.Sprint(atomic.AddInt32(&clock, 1))
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Signature", mac(req.Method, req.URL.Path, timestamp, body))
+		return nil
+	}
+
+	// the retry is signed anew
+	fb := New(server.URL, nil, WithRequestSigner(signer), WithRetry(1, time.Millisecond))
+	require.NoError(t, fb.Child("foo").Set(map[string]string{"a": "b"}))
+	assert.Equal(t, "1", <-timestamps)
+	assert.Equal(t, "2", <-timestamps)
+
+	// and so are raw writes and streams
+	require.NoError(t, New(server.URL, nil, WithRequestSigner(signer), WithForceContentLength(true)).
+		SetJSON(strings.NewReader(`{"raw":true}`)))
+	assert.Equal(t, "3", <-timestamps)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications
+	assert.Equal(t, "4", <-timestamps)
+	fb.StopWatching()
+
+	// a request that can not be signed is not sent
+	fb = New(server.URL, nil, WithRequestSigner(func(*http.Request) error {
+		return fmt.Errorf("no key")
+	}))
+	assert.EqualError(t, fb.Set(true), "no key")
+	assert.EqualError(t, fb.Watch(make(chan Event)), "no key")
+	assert.Len(t, timestamps, 0)
+}
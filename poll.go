@@ -0,0 +1,106 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Poll emulates Watch for the environments where streaming is not
+// available, such as behind proxies that buffer or strip event streams.
+// It reads the value of the reference every interval and passes a put
+// event replacing the whole value over to the given chan whenever the
+// value changed, starting with the current value, so the events can be
+// consumed the same way the events of Watch are.
+//
+// Changes are detected with the ETag of the value, the whole value is
+// still read on every poll, and the changes made and undone between two
+// polls are missed. Poll shares its state with Watch: only one of them can
+// be running at a time and both are stopped with StopWatching. An error
+// event is sent, and the chan closed, when a read fails. The interval must
+// be positive.
+func (fb *firebase) Poll(interval time.Duration, ch chan Event) error {
+	if interval <= 0 {
+		return errors.New("the interval of the polls must be positive")
+	}
+	return fb.startEvents(ch, func(ctx context.Context, stop chan struct{}) (chan Event, error) {
+		return fb.poll(ctx, stop, interval)
+	})
+}
+
+// poll is the eventSource of Poll.
+func (fb *firebase) poll(ctx context.Context, stop chan struct{}, interval time.Duration) (chan Event, error) {
+	c := fb.copy()
+	c.conditional = &etagState{}
+	c.ctx = ctx
+
+	read := func() (Event, error) {
+		body, err := c.doRequest(context.Background(), "GET", nil)
+		if err != nil {
+			return Event{}, err
+		}
+		event := Event{Type: EventTypePut, Path: "/"}
+		if err := json.Unmarshal(body, &event.Data); err != nil {
+			return Event{}, err
+		}
+		event.rawData, err = json.Marshal(struct {
+			Path string          `json:"path"`
+			Data json.RawMessage `json:"data"`
+		}{event.Path, body})
+		return event, err
+	}
+
+	first, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make(chan Event)
+	send := func(event Event) bool {
+		return sendOrStop(notifications, event, stop)
+	}
+
+	go func() {
+		defer close(notifications)
+
+		if !send(first) {
+			return
+		}
+		etag, body := c.conditional.etag, c.conditional.body
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-stop:
+				return
+			}
+
+			event, err := read()
+			if err != nil {
+				select {
+				case <-stop:
+					// the poll was stopped on purpose
+				default:
+					send(Event{Type: EventTypeError, Data: err})
+				}
+				return
+			}
+			changed := c.conditional.etag != etag
+			if c.conditional.etag == "" {
+				// a proxy stripped the ETag
+				changed = !bytes.Equal(c.conditional.body, body)
+			}
+			if !changed {
+				continue
+			}
+			etag, body = c.conditional.etag, c.conditional.body
+			if !send(event) {
+				return
+			}
+		}
+	}()
+	return notifications, nil
+}
@@ -0,0 +1,84 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("foo", "bar")
+	fb := New(server.URL+"/foo", nil)
+	events := make(chan Event)
+	assert.Error(t, fb.Poll(0, events))
+	assert.False(t, fb.IsWatching())
+	require.NoError(t, fb.Poll(10*time.Millisecond, events))
+	assert.True(t, fb.IsWatching())
+
+	next := func() Event {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive an event")
+		}
+		return Event{}
+	}
+
+	event := next()
+	assert.Equal(t, Event{Type: EventTypePut, Path: "/", Data: "bar", rawData: event.rawData}, event)
+	var v string
+	require.NoError(t, event.Value(&v))
+	assert.Equal(t, "bar", v)
+
+	// unchanged values are not sent again
+	time.Sleep(50 * time.Millisecond)
+	server.Set("foo", map[string]interface{}{"baz": true})
+	assert.Equal(t, map[string]interface{}{"baz": true}, next().Data)
+
+	fb.StopWatching()
+	for range events {
+		// drain until the chan is closed
+	}
+	assert.False(t, fb.IsWatching())
+}
+
+func TestPollWithoutETag(t *testing.T) {
+	t.Parallel()
+	values := make(chan string, 3)
+	values <- `1`
+	values <- `1`
+	values <- `2`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case v := <-values:
+			w.Write([]byte(v))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	events := make(chan Event)
+	require.NoError(t, New(server.URL, nil).Poll(time.Millisecond, events))
+
+	var received []Event
+	for event := range events {
+		// the chan is closed after the error event
+		received = append(received, event)
+	}
+	require.Len(t, received, 3)
+	assert.Equal(t, 1.0, received[0].Data)
+	assert.Equal(t, 2.0, received[1].Data)
+	assert.Equal(t, EventTypeError, received[2].Type)
+}
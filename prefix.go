@@ -0,0 +1,38 @@
+package firego
+
+import "strings"
+
+// WithPathPrefix makes every path used by the reference relative to
+// prefix, for example "/tenants/42" for an application that keeps the
+// data of each tenant below its own node. The prefix is inserted before
+// the path of the URL given to New and before every path that is
+// otherwise relative to the root of the database, such as those given to
+// Ref, the metadata path of WithDedupe or the paths of Move, so that the
+// reads, writes and streams made with the reference and every reference
+// derived from it stay below the prefixed node.
+//
+// Path and Key report paths relative to the prefix, the prefixed node
+// itself being the root "/". A prefix that can not be part of a path makes
+// every operation fail the way Child does.
+func WithPathPrefix(prefix string) Option {
+	return func(fb *firebase) {
+		p, err := joinURL("", prefix)
+		if err != nil {
+			if fb.pathErr == nil {
+				fb.pathErr = err
+			}
+			if fb.prefixErr == nil {
+				fb.prefixErr = err
+			}
+			return
+		}
+
+		path := fb.path()
+		fb.pathPrefix = joinPath(fb.pathPrefix, strings.TrimPrefix(p, "/"))
+		root, err := fb.rootURL()
+		if err != nil {
+			return
+		}
+		fb.url, _ = joinURL(root, path)
+	}
+}
@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestWithPathPrefix(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("tenants/42/users/alice", "first")
+	fb := New(server.URL+"/users", nil, WithPathPrefix("/tenants/42/"))
+	assert.Equal(t, server.URL+"/tenants/42/users/.json", fb.String())
+	assert.Equal(t, "/users", fb.Path())
+	assert.Equal(t, "users", fb.Key())
+
+	// reads
+	alice := fb.Child("alice")
+	assert.Equal(t, "/users/alice", alice.Path())
+	assert.Equal(t, "alice", alice.Key())
+	var v interface{}
+	require.NoError(t, alice.Value(&v))
+	assert.Equal(t, "first", v)
+
+	// writes
+	require.NoError(t, fb.Child("bob").Set("second"))
+	assert.Equal(t, "second", server.Get("tenants/42/users/bob"))
+	require.NoError(t, alice.Move(fb.Child("carol")))
+	assert.Equal(t, map[string]interface{}{"bob": "second", "carol": "first"}, server.Get("tenants/42/users"))
+
+	// references from the prefixed root
+	root, err := fb.Ref("/")
+	require.NoError(t, err)
+	assert.Equal(t, "/", root.Path())
+	assert.Equal(t, "", root.Key())
+	settings, err := fb.Ref("settings")
+	require.NoError(t, err)
+	require.NoError(t, settings.Set(true))
+	assert.Equal(t, true, server.Get("tenants/42/settings"))
+	assert.Nil(t, server.Get("settings"))
+
+	// streams
+	events := make(chan Event, 10)
+	require.NoError(t, fb.Watch(events))
+	defer fb.StopWatching()
+	select {
+	case event := <-events:
+		assert.Equal(t, map[string]interface{}{"bob": "second", "carol": "first"}, event.Data)
+	case <-time.After(250 * time.Millisecond):
+		require.FailNow(t, "did not receive the initial value")
+	}
+}
+
+func TestWithPathPrefixInvalid(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil, WithPathPrefix("tenants/../42"))
+	var v interface{}
+	assert.Error(t, fb.Value(&v))
+
+	// the references made with Ref do not escape the prefix
+	ref, err := fb.Ref("users")
+	require.NoError(t, err)
+	assert.Error(t, ref.Value(&v))
+}
@@ -0,0 +1,100 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushChars are the characters push IDs are made of, in
+// ascending ASCII order so that IDs sort lexicographically.
+const pushChars = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+var pushID struct {
+	sync.Mutex
+	rnd      *rand.Rand
+	lastTime int64
+	lastRand [12]int
+}
+
+func init() {
+	pushID.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// GeneratePushID returns a new push ID, the 20 character key Firebase
+// gives the children created with Push, generated locally: IDs sort in the
+// order they were generated in, including the ones generated by Firebase
+// or by other clients whose clock is right. Use it with PushWithID, or
+// Child, to know the reference of a new child before writing it.
+func GeneratePushID() string {
+	return newPushID()
+}
+
+// PushWithID sets v as the child of the reference whose key is id, a push
+// ID from GeneratePushID, generating one when it is empty, and returns the
+// reference to the child. Unlike Push, the write is a PUT of the child:
+// the key is known before the write is sent, and when the write fails the
+// reference returned along with the error still points to the child,
+// which can be written again without creating a duplicate. An id that is
+// not a valid key, or holds a /, is rejected, and the queries of the
+// reference are not part of the write, as with Child.
+func (fb *firebase) PushWithID(id string, v interface{}) (Firebase, error) {
+	if id == "" {
+		id = newPushID()
+	}
+	if strings.Contains(id, "/") {
+		return nil, fmt.Errorf("invalid push ID %q: keys can not contain /", id)
+	}
+	if err := validateKey(id); err != nil {
+		return nil, fmt.Errorf("invalid push ID %q: %v", id, err)
+	}
+	b, err := fb.marshalPayload(v)
+	if err != nil {
+		return nil, err
+	}
+	ref := fb.Child(id).(*firebase)
+	_, err = ref.write(context.Background(), "PUT", b)
+	return ref, err
+}
+
+// newPushID generates a 20 character key the same way Firebase does
+// for new children created with a POST. The first 8 characters encode
+// the current time in milliseconds and the remaining 12 are random, so
+// keys sort chronologically. Keys generated within the same millisecond
+// increment the random part to preserve their order.
+//
+// Reference https://firebase.googleblog.com/2015/02/the-2120-ways-to-ensure-unique_68.html
+func newPushID() string {
+	pushID.Lock()
+	defer pushID.Unlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now == pushID.lastTime {
+		// increment the random part, carrying over as needed
+		i := len(pushID.lastRand) - 1
+		for ; i >= 0 && pushID.lastRand[i] == len(pushChars)-1; i-- {
+			pushID.lastRand[i] = 0
+		}
+		if i >= 0 {
+			pushID.lastRand[i]++
+		}
+	} else {
+		for i := range pushID.lastRand {
+			pushID.lastRand[i] = pushID.rnd.Intn(len(pushChars))
+		}
+	}
+	pushID.lastTime = now
+
+	var id [20]byte
+	for i := 7; i >= 0; i-- {
+		id[i] = pushChars[now%int64(len(pushChars))]
+		now /= int64(len(pushChars))
+	}
+	for i, r := range pushID.lastRand {
+		id[8+i] = pushChars[r]
+	}
+	return string(id[:])
+}
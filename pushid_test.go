@@ -0,0 +1,66 @@
+package firego
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestNewPushID(t *testing.T) {
+	t.Parallel()
+
+	ids := make([]string, 1000)
+	seen := map[string]bool{}
+	for i := range ids {
+		id := newPushID()
+		require.Len(t, id, 20)
+		for _, r := range id {
+			require.True(t, strings.ContainsRune(pushChars, r), "unexpected character %q", r)
+		}
+
+		assert.False(t, seen[id], "duplicate id %s", id)
+		seen[id] = true
+		ids[i] = id
+	}
+
+	assert.True(t, sort.StringsAreSorted(ids), "ids are not chronologically ordered")
+}
+
+func TestPushWithID(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil).Child("items")
+
+	id := GeneratePushID()
+	assert.Len(t, id, 20)
+	ref, err := fb.PushWithID(id, "first")
+	require.NoError(t, err)
+	assert.Equal(t, fb.Child(id).String(), ref.String())
+	assert.Equal(t, "first", server.Get("items/"+id))
+
+	ref, err = fb.PushWithID("", "second")
+	require.NoError(t, err)
+	generated := ref.Key()
+	assert.Len(t, generated, 20)
+	assert.True(t, generated > id)
+	assert.Equal(t, "second", server.Get("items/"+generated))
+
+	// the queries of the reference are not part of the write
+	ref, err = fb.OrderBy("$key").LimitToFirst(1).PushWithID("", "third")
+	require.NoError(t, err)
+	assert.Empty(t, ref.(*firebase).params)
+	assert.Equal(t, "third", server.Get("items/"+ref.Key()))
+
+	for _, id := range []string{"a/b", "..", "a.b", "a[0]"} {
+		_, err = fb.PushWithID(id, "invalid")
+		assert.Error(t, err, id)
+	}
+	assert.Nil(t, server.Get("a"))
+	assert.Nil(t, server.Get("items/a"))
+}
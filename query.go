@@ -1,7 +1,10 @@
 package firego
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -98,6 +101,13 @@ func (fb *firebase) EndAtValue(value interface{}) Firebase {
 //    OrderBy(`"foo"`) // -> orderBy="foo"
 //    OrderBy("$key")  // -> orderBy="$key"
 //
+// Firebase only filters ordered children: a query with StartAt, EndAt,
+// EqualTo, LimitToFirst or LimitToLast but no OrderBy is rejected with a
+// 400, returned as an ErrHTTP whose Message reads "orderBy must be defined
+// when other query parameters are defined". The query parameters only
+// apply to the reference they are set on, the references returned by
+// Child and Ref do not carry them.
+//
 // Reference https://firebase.google.com/docs/database/rest/retrieve-data#orderby
 func (fb *firebase) OrderBy(value string) Firebase {
 	c := fb.copy()
@@ -109,6 +119,22 @@ func (fb *firebase) OrderBy(value string) Firebase {
 	return c
 }
 
+// OrderByKey creates a new Firebase reference ordering the children by
+// their key, the same as OrderBy("$key").
+//
+//    OrderByKey() // -> orderBy="$key"
+func (fb *firebase) OrderByKey() Firebase {
+	return fb.OrderBy("$key")
+}
+
+// OrderByValue creates a new Firebase reference ordering the children by
+// their value, the same as OrderBy("$value").
+//
+//    OrderByValue() // -> orderBy="$value"
+func (fb *firebase) OrderByValue() Firebase {
+	return fb.OrderBy("$value")
+}
+
 // EqualTo sends the query string equalTo so that one can find nodes with
 // exactly matching values. The value that is passed in is automatically escaped
 // if it is a string value.
@@ -212,6 +238,22 @@ func (fb *firebase) Shallow(v bool) {
 	}
 }
 
+// Silent determines whether or not to ask Firebase not to send back the
+// value written by Set, Update and Push, with the print=silent query
+// parameter, which Firebase answers with a 204 No Content. This saves
+// transferring large values back for nothing. Reads, and conditional
+// writes, whose rejections hold the current value, are not affected.
+//
+// Firebase generates the key of a pushed child on its own and only tells
+// it in the body of its response: a silent Push therefore generates the
+// key locally instead, with a PUT, the way a reference created with
+// WithIdempotentPush does.
+//
+// Reference https://firebase.google.com/docs/reference/rest/database#section-param-print
+func (fb *firebase) Silent(v bool) {
+	fb.silent = v
+}
+
 // IncludePriority determines whether or not to ask Firebase
 // for the values priority. By default, the priority is not returned.
 //
@@ -223,3 +265,152 @@ func (fb *firebase) IncludePriority(v bool) {
 		fb.params.Del(formatParam)
 	}
 }
+
+// Between creates a new Firebase reference ordered by order, as with
+// OrderBy, that only includes the children whose ordered value lies
+// between lo and hi, both included. Like startAt and endAt, the bounds
+// are compared the way Firebase orders values: null, false, true,
+// numbers, strings and then objects, with keys compared as integers when
+// both keys are 32-bit integers. Numeric strings are preserved as
+// strings.
+//
+//    Between("age", 18, 65)       // -> orderBy="age"&startAt=18&endAt=65
+//    Between("$key", "a", "m")    // -> orderBy="$key"&startAt="a"&endAt="m"
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-filtering
+func (fb *firebase) Between(order string, lo, hi interface{}) Firebase {
+	c := fb.OrderBy(order).(*firebase)
+	c.params.Set(startAtParam, encodeBound(lo))
+	c.params.Set(endAtParam, encodeBound(hi))
+	return c
+}
+
+// BetweenExclusive is like Between but leaves out the children whose
+// ordered value is lo or hi, see StartAfter and EndBefore for how the
+// bounds are computed.
+func (fb *firebase) BetweenExclusive(order string, lo, hi interface{}) Firebase {
+	return fb.OrderBy(order).StartAfter(lo).EndBefore(hi)
+}
+
+// StartAfter creates a new Firebase reference that only includes the
+// children ordered strictly after value, which startAt, being inclusive,
+// does not express. It sends as startAt the first value ordered after
+// value, which makes it fit for paging from the last child of a page:
+//
+//   - a number is followed by the next number a float64 can represent
+//   - a string is followed by itself with a "\x00" appended, ordered
+//     before any other string starting with it
+//   - an integer key, when ordering by "$key", is followed by the next
+//     integer
+//   - null is followed by false, false by true and true by the smallest
+//     number
+//
+// Any other value is sent as is, which includes it. StartAfter must be
+// called after OrderBy, or it cannot tell whether keys are ordered.
+func (fb *firebase) StartAfter(value interface{}) Firebase {
+	c := fb.copy()
+	c.params.Set(startAtParam, encodeBound(adjacentValue(value, c.params.Get(orderByParam) == `"$key"`, true)))
+	return c
+}
+
+// EndBefore creates a new Firebase reference that only includes the
+// children ordered strictly before value. It sends as endAt the last value
+// ordered before value, mirroring StartAfter:
+//
+//   - a number is preceded by the previous number a float64 can represent
+//   - a non-empty string is preceded by the string with its last
+//     character decremented and followed by U+FFFF, which leaves out
+//     the strings that extend that bound with characters past U+FFFF
+//     and is therefore the only approximate bound; the empty string is
+//     preceded by the largest number, or by the largest integer key when
+//     ordering by "$key"
+//   - an integer key, when ordering by "$key", is preceded by the
+//     previous integer
+//   - true is preceded by false and false by null
+//
+// Any other value, null included, is sent as is, which includes it.
+// EndBefore must be called after OrderBy, or it cannot tell whether keys
+// are ordered.
+func (fb *firebase) EndBefore(value interface{}) Firebase {
+	c := fb.copy()
+	c.params.Set(endAtParam, encodeBound(adjacentValue(value, c.params.Get(orderByParam) == `"$key"`, false)))
+	return c
+}
+
+// adjacentValue returns the value ordered right after v, or right before
+// it if after is false, among the values or, if byKey is set, the keys the
+// database orders.
+func adjacentValue(v interface{}, byKey, after bool) interface{} {
+	direction := math.Inf(-1)
+	if after {
+		direction = math.Inf(1)
+	}
+
+	switch val := v.(type) {
+	case nil:
+		if after {
+			return false
+		}
+	case bool:
+		switch {
+		case after && val:
+			return -math.MaxFloat64
+		case after:
+			return true
+		case val:
+			return false
+		}
+		return nil
+	case string:
+		if byKey {
+			if n, err := strconv.ParseInt(val, 10, 32); err == nil {
+				switch {
+				case after && n < math.MaxInt32:
+					return strconv.FormatInt(n+1, 10)
+				case !after && n > math.MinInt32:
+					return strconv.FormatInt(n-1, 10)
+				case after:
+					// the other keys are ordered after the integers
+					return ""
+				}
+				return val
+			}
+		}
+		if after {
+			return val + "\x00"
+		}
+		if val == "" {
+			if byKey {
+				return strconv.Itoa(math.MaxInt32)
+			}
+			return math.MaxFloat64
+		}
+		runes := []rune(val)
+		last := runes[len(runes)-1]
+		if last == 0 {
+			return string(runes[:len(runes)-1])
+		}
+		return string(runes[:len(runes)-1]) + string(last-1) + "\uffff"
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return math.Nextafter(float64(rv.Int()), direction)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return math.Nextafter(float64(rv.Uint()), direction)
+	case reflect.Float32, reflect.Float64:
+		return math.Nextafter(rv.Float(), direction)
+	}
+	return v
+}
+
+// encodeBound encodes a query bound as JSON, unlike escapeParameter,
+// strings are sent exactly as given.
+func encodeBound(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return escapeParameter(v)
+	}
+	return string(b)
+}
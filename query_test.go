@@ -1,10 +1,15 @@
 package firego
 
 import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
 )
 
 func TestShallow(t *testing.T) {
@@ -30,6 +35,53 @@ func TestShallow(t *testing.T) {
 	assert.Equal(t, "", req.URL.Query().Encode())
 }
 
+func TestSilent(t *testing.T) {
+	t.Parallel()
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		if req.URL.Query().Get(printParam) == silentVal {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"name":"-server-key"}`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	child := fb.Child("child")
+	fb.Silent(true)
+	require.NoError(t, fb.Set(1))
+	require.NoError(t, fb.Update(map[string]int{"a": 1}))
+	ref, err := fb.Push(1)
+	require.NoError(t, err)
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	require.Len(t, requests, 4)
+	for _, req := range requests[:3] {
+		assert.Equal(t, printParam+"="+silentVal, req.URL.Query().Encode(), req.Method)
+	}
+	assert.Empty(t, requests[3].URL.Query().Get(printParam))
+
+	// the key of a silent push is generated locally
+	assert.Equal(t, "PUT", requests[2].Method)
+	key := ref.Key()
+	assert.Len(t, key, 20)
+	assert.Equal(t, "/"+key+"/.json", requests[2].URL.Path)
+
+	// scoped to the reference
+	require.NoError(t, child.Set(1))
+	require.Len(t, requests, 5)
+	assert.Empty(t, requests[4].URL.Query().Get(printParam))
+
+	fb.Silent(false)
+	ref, err = fb.Push(1)
+	require.NoError(t, err)
+	assert.Equal(t, "-server-key", ref.Key())
+	assert.Equal(t, "POST", requests[5].Method)
+	assert.Empty(t, requests[5].URL.Query().Encode())
+}
+
 func TestOrderBy(t *testing.T) {
 	t.Parallel()
 	var (
@@ -282,3 +334,160 @@ func TestEscapeParameter(t *testing.T) {
 		assert.Equal(t, testCase.expected, escapeParameter(testCase.value))
 	}
 }
+
+func TestAdjacentValue(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		value  interface{}
+		byKey  bool
+		after  interface{}
+		before interface{}
+	}{
+		{nil, false, false, nil},
+		{false, false, true, nil},
+		{true, false, -math.MaxFloat64, false},
+		{10, false, math.Nextafter(10, 11), math.Nextafter(10, 9)},
+		{2.5, false, math.Nextafter(2.5, 3), math.Nextafter(2.5, 2)},
+		{"b", false, "b\x00", "a\uffff"},
+		{"", false, "\x00", math.MaxFloat64},
+		{"7", true, "8", "6"},
+		{"2147483647", true, "", "2147483646"},
+		{"b", true, "b\x00", "a\uffff"},
+		{"", true, "\x00", "2147483647"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.after, adjacentValue(testCase.value, testCase.byKey, true), "%v", testCase.value)
+		assert.Equal(t, testCase.before, adjacentValue(testCase.value, testCase.byKey, false), "%v", testCase.value)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("scores", map[string]interface{}{
+		"a": map[string]interface{}{"score": 1, "name": "ann"},
+		"b": map[string]interface{}{"score": 2, "name": "bob"},
+		"c": map[string]interface{}{"score": 2.5, "name": "bo"},
+		"d": map[string]interface{}{"score": 3, "name": "dan"},
+		"e": map[string]interface{}{"name": "eve"},
+	})
+	fb := New(server.URL+"/scores", nil)
+
+	keys := func(ref Firebase) []string {
+		var v map[string]interface{}
+		require.NoError(t, ref.Value(&v))
+		return orderChildren(v, "$key")
+	}
+
+	for _, test := range []struct {
+		ref      Firebase
+		expected []string
+	}{
+		{fb.Between("score", 2, 3), []string{"b", "c", "d"}},
+		{fb.BetweenExclusive("score", 2, 3), []string{"c"}},
+		{fb.BetweenExclusive("score", 1, 2.5), []string{"b"}},
+		{fb.OrderBy("score").StartAfter(2.5), []string{"d"}},
+		{fb.OrderBy("score").EndBefore(2), []string{"a", "e"}},
+		{fb.OrderBy("score").StartAfter(nil), []string{"a", "b", "c", "d"}},
+		{fb.Between("name", "bo", "bob"), []string{"b", "c"}},
+		{fb.BetweenExclusive("name", "ann", "bob"), []string{"c"}},
+		{fb.OrderBy("name").StartAfter("bo"), []string{"b", "d", "e"}},
+		{fb.OrderBy("name").EndBefore("bob"), []string{"a", "c"}},
+		{fb.Between("$key", "b", "d"), []string{"b", "c", "d"}},
+		{fb.BetweenExclusive("$key", "b", "d"), []string{"c"}},
+		{fb.OrderBy("$key").StartAfter("c").LimitToFirst(1), []string{"d"}},
+	} {
+		assert.Equal(t, test.expected, keys(test.ref), test.ref.String())
+	}
+}
+
+func TestBetweenIntegerKeys(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("pages", map[string]interface{}{"1": true, "9": true, "10": true, "11": true, "x": true})
+	fb := New(server.URL+"/pages", nil)
+
+	var v map[string]interface{}
+	require.NoError(t, fb.OrderBy("$key").StartAfter("9").Value(&v))
+	assert.Equal(t, []string{"10", "11", "x"}, orderChildren(v, "$key"))
+	v = nil
+	require.NoError(t, fb.BetweenExclusive("$key", "1", "11").Value(&v))
+	assert.Equal(t, []string{"9", "10"}, orderChildren(v, "$key"))
+}
+
+func TestOrderedQueries(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("scores", map[string]interface{}{"a": 30, "b": 10, "c": 20, "d": 40})
+	server.Set("users", map[string]interface{}{
+		"1": map[string]interface{}{"name": "ann"},
+		"2": map[string]interface{}{"name": "bob"},
+		"3": map[string]interface{}{"name": "cat"},
+	})
+	scores := New(server.URL+"/scores", nil)
+	users := New(server.URL+"/users", nil)
+	keys := func(ref Firebase) []string {
+		var v map[string]interface{}
+		require.NoError(t, ref.Value(&v), ref.String())
+		return orderChildren(v, "$key")
+	}
+
+	for _, test := range []struct {
+		ref      Firebase
+		query    string
+		expected []string
+	}{
+		{scores.OrderByKey().LimitToFirst(2), `limitToFirst=2&orderBy=%22%24key%22`, []string{"a", "b"}},
+		{scores.OrderByKey().StartAt("b").EndAt("c"), `endAt=%22c%22&orderBy=%22%24key%22&startAt=%22b%22`, []string{"b", "c"}},
+		{scores.OrderByValue().LimitToLast(2), `limitToLast=2&orderBy=%22%24value%22`, []string{"a", "d"}},
+		{scores.OrderByValue().StartAtValue(15).EndAtValue(30), `endAt=30&orderBy=%22%24value%22&startAt=15`, []string{"a", "c"}},
+		{scores.OrderByValue().EqualToValue(10), `equalTo=10&orderBy=%22%24value%22`, []string{"b"}},
+		{users.OrderBy("name").StartAtValue("b"), `orderBy=%22name%22&startAt=%22b%22`, []string{"2", "3"}},
+		{users.OrderBy("name").EqualToValue("ann"), `equalTo=%22ann%22&orderBy=%22name%22`, []string{"1"}},
+	} {
+		u, err := url.Parse(test.ref.String())
+		require.NoError(t, err)
+		assert.Equal(t, test.query, u.RawQuery)
+		assert.Equal(t, test.expected, keys(test.ref), test.ref.String())
+	}
+
+	// Firebase only filters ordered children
+	var v interface{}
+	err := scores.StartAtValue(20).Value(&v)
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, http.StatusBadRequest, err.(ErrHTTP).StatusCode)
+	assert.Equal(t, "orderBy must be defined when other query parameters are defined", err.(ErrHTTP).Message)
+}
+
+func TestQueryNotInherited(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("scores", map[string]interface{}{"a": map[string]interface{}{"x": 1, "y": 2}})
+	query := New(server.URL, nil).Child("scores").OrderByKey().LimitToFirst(1)
+	query.Shallow(true)
+	query.Auth("token")
+
+	child := query.Child("a")
+	assert.Equal(t, server.URL+"/scores/a/.json?auth=token&shallow=true", child.String())
+	ref, err := query.Ref("scores/a")
+	require.NoError(t, err)
+	assert.Equal(t, child.String(), ref.String())
+
+	var v map[string]interface{}
+	require.NoError(t, query.Child("a").Value(&v))
+	assert.Equal(t, map[string]interface{}{"x": true, "y": true}, v)
+	assert.Equal(t, server.URL+`/scores/.json?auth=token&limitToFirst=1&orderBy=%22%24key%22&shallow=true`, query.String())
+}
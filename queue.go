@@ -0,0 +1,359 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrQueued is returned by writes made on a reference configured with
+// WithWriteQueue when Firebase could not be reached and the write was
+// queued instead. The write is sent the next time Flush is called.
+var ErrQueued = errors.New("write queued")
+
+// ErrNotIdempotent is returned by a write holding an Increment, made
+// through a reference configured with WithWriteQueue, instead of queueing
+// it behind the writes already queued: replaying it after a crash during
+// Flush would increment the value twice.
+var ErrNotIdempotent = errors.New("write not idempotent, it can not be queued")
+
+// ErrQueueClosed is returned by a WriteQueue that was closed, such as a
+// FileWriteQueue after Close. It stops the flushing of WithAutoFlush.
+var ErrQueueClosed = errors.New("write queue closed")
+
+// QueuedWrite is a write operation that is waiting to be sent to Firebase.
+type QueuedWrite struct {
+	// Method is the HTTP method of the write: PUT, PATCH or DELETE.
+	Method string
+	// URL is the location the write is made to.
+	URL string
+	// Body is the JSON payload of the write.
+	Body []byte
+}
+
+// WriteQueue persists writes that could not be sent to Firebase so they
+// can be replayed later, in order, by Flush. Implementations are free to
+// store the writes anywhere, e.g. on disk to survive restarts.
+//
+// A write is only dequeued after it has been successfully sent, so a
+// crash during Flush can cause the write at the front of the queue to be
+// sent twice. Every queued write is idempotent for that reason: the writes
+// holding an Increment are never queued, see ErrNotIdempotent. A queue
+// that can be closed returns ErrQueueClosed once it is.
+type WriteQueue interface {
+	// Enqueue appends a write to the back of the queue.
+	Enqueue(w QueuedWrite) error
+	// Peek returns the write at the front of the queue
+	// without removing it. ok is false if the queue is empty.
+	Peek() (w QueuedWrite, ok bool, err error)
+	// Dequeue removes the write at the front of the queue.
+	Dequeue() error
+	// Len returns the number of writes in the queue.
+	Len() (int, error)
+}
+
+// WithWriteQueue makes writes that fail because Firebase cannot be reached
+// be stored in q and return ErrQueued instead of failing. Once a write has
+// been queued, every following write is queued behind it until the queue is
+// flushed, so that a write made after another one returned, ErrQueued
+// included, is applied after it. Writes made concurrently, by goroutines
+// that do not wait for each other, are applied in no particular order: a
+// write sent while another one is failing may be applied before the other
+// one is queued.
+//
+// Since POST requests are not idempotent, Push generates the key of the new
+// child itself and writes it using a PUT when a write queue is configured.
+// SetJSON is never queued, nor are the writes holding an Increment: one
+// that can not be sent fails with the error it was sent with, or with
+// ErrNotIdempotent when writes are queued ahead of it. WithDedupe applies
+// those writes at most once, without queueing them.
+func WithWriteQueue(q WriteQueue) Option {
+	return func(fb *firebase) {
+		fb.writeQueue = &writeQueue{WriteQueue: q, stopFlush: make(chan struct{})}
+	}
+}
+
+// WithAutoFlush makes a reference configured with WithWriteQueue flush its
+// queue on its own, the way Flush does, every interval while it holds
+// writes, so that they are sent once Firebase can be reached again without
+// the application having to call Flush. The flushing starts when a write
+// is queued and stops once the queue is empty, once the queue returns
+// ErrQueueClosed, or for good with StopAutoFlush.
+func WithAutoFlush(interval time.Duration) Option {
+	return func(fb *firebase) {
+		fb.flushInterval = interval
+	}
+}
+
+// WithWriteConflict sets the function Flush calls with a queued write that
+// Firebase rejected, for instance because the security rules changed while
+// it was queued, and the error it was rejected with. The write is dropped
+// from the queue, and Flush goes on with the next one when fn returns nil,
+// or returns the error fn returned. Without it, Flush returns the error of
+// the write at once. fn is called without holding the queue, so it can
+// write the value resolving the conflict through the reference, which is
+// queued behind the writes still queued if any, but it must not call
+// Flush.
+func WithWriteConflict(fn func(w QueuedWrite, err error) error) Option {
+	return func(fb *firebase) {
+		fb.writeConflict = fn
+	}
+}
+
+// writeQueue serializes access to a WriteQueue shared by
+// every reference derived from the one it was configured on.
+type writeQueue struct {
+	sync.Mutex
+	WriteQueue
+	// flushMtx is held by Flush, so that a single flush sends the writes
+	// at the front of the queue
+	flushMtx sync.Mutex
+	// flushing is set while the queue is flushed with WithAutoFlush
+	flushing bool
+	// stopFlush is closed by StopAutoFlush
+	stopFlush chan struct{}
+}
+
+// NewMemoryWriteQueue creates a WriteQueue that keeps writes in memory.
+// Queued writes are lost when the process exits.
+func NewMemoryWriteQueue() WriteQueue {
+	return &memoryWriteQueue{}
+}
+
+type memoryWriteQueue struct {
+	mtx    sync.Mutex
+	writes []QueuedWrite
+}
+
+func (q *memoryWriteQueue) Enqueue(w QueuedWrite) error {
+	q.mtx.Lock()
+	q.writes = append(q.writes, w)
+	q.mtx.Unlock()
+	return nil
+}
+
+func (q *memoryWriteQueue) Peek() (QueuedWrite, bool, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.writes) == 0 {
+		return QueuedWrite{}, false, nil
+	}
+	return q.writes[0], true, nil
+}
+
+func (q *memoryWriteQueue) Dequeue() error {
+	q.mtx.Lock()
+	if len(q.writes) > 0 {
+		q.writes = q.writes[1:]
+	}
+	q.mtx.Unlock()
+	return nil
+}
+
+func (q *memoryWriteQueue) Len() (int, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.writes), nil
+}
+
+// write sends a write to Firebase, queueing it
+// if the reference has a write queue configured.
+func (fb *firebase) write(ctx context.Context, method string, body []byte) ([]byte, error) {
+	if fb.dedupePath != "" && (method == "PUT" || method == "PATCH") {
+		return fb.dedupeWrite(ctx, method, body)
+	}
+
+	q := fb.writeQueue
+	if q == nil {
+		return fb.doRequest(ctx, method, body)
+	}
+
+	increments := holdsIncrement(body)
+	q.Lock()
+	n, err := q.Len()
+	if err == nil && n > 0 {
+		// keep the writes in order
+		err = ErrNotIdempotent
+		if !increments {
+			err = fb.enqueue(method, body)
+		}
+	}
+	q.Unlock()
+	if err != nil || n > 0 {
+		return nil, err
+	}
+
+	ctx, cancel := fb.requestContext(ctx)
+	defer cancel()
+	resp, err := fb.doRequest(ctx, method, body)
+	if !isNetworkError(ctx, err) || increments {
+		return resp, err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	return nil, fb.enqueue(method, body)
+}
+
+// enqueue must be called while holding the queue's lock.
+func (fb *firebase) enqueue(method string, body []byte) error {
+	w := QueuedWrite{Method: method, URL: fb.url, Body: body}
+	if err := fb.writeQueue.Enqueue(w); err != nil {
+		return err
+	}
+	fb.startAutoFlush()
+	return ErrQueued
+}
+
+// startAutoFlush starts flushing the queue every flushInterval until it is
+// empty or closed, unless it is already being flushed or the flushing was
+// stopped. It must be called while holding the queue's lock.
+func (fb *firebase) startAutoFlush() {
+	q := fb.writeQueue
+	if fb.flushInterval <= 0 || q.flushing || isClosed(q.stopFlush) {
+		return
+	}
+	q.flushing = true
+
+	ref := fb.copy()
+	go func() {
+		t := time.NewTicker(ref.flushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-q.stopFlush:
+				q.Lock()
+				q.flushing = false
+				q.Unlock()
+				return
+			}
+
+			err := ref.Flush(context.Background())
+			q.Lock()
+			n, lenErr := q.Len()
+			closed := errors.Is(err, ErrQueueClosed) || errors.Is(lenErr, ErrQueueClosed)
+			if closed || (err == nil && lenErr == nil && n == 0) {
+				q.flushing = false
+				q.Unlock()
+				return
+			}
+			q.Unlock()
+		}
+	}()
+}
+
+// StopAutoFlush stops the flushing WithAutoFlush does for the queue of the
+// reference, shared by every reference derived from the one it was
+// configured on, for good: the writes queued afterwards are only sent by
+// Flush. A flush in progress completes first. It does nothing for
+// references without a write queue.
+func (fb *firebase) StopAutoFlush() {
+	q := fb.writeQueue
+	if q == nil {
+		return
+	}
+	q.Lock()
+	defer q.Unlock()
+	if !isClosed(q.stopFlush) {
+		close(q.stopFlush)
+	}
+}
+
+// isClosed reports whether ch is closed.
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending returns the number of writes queued by a reference configured
+// with WithWriteQueue that have not been sent yet, 0 for references
+// without a write queue.
+func (fb *firebase) Pending() (int, error) {
+	q := fb.writeQueue
+	if q == nil {
+		return 0, nil
+	}
+	q.Lock()
+	defer q.Unlock()
+	return q.Len()
+}
+
+// Flush sends the writes queued by a reference configured with
+// WithWriteQueue in the order they were made, one at a time, a single
+// flush of the queue running at once. It stops at the first write that
+// fails; if Firebase could not be reached the write stays queued,
+// otherwise it is removed from the queue since it can never succeed, and
+// handed to the function set with WithWriteConflict, if any.
+// The writes are authenticated the same way the reference is. The queue
+// is not held while a write is sent, the writes made during a flush are
+// queued behind the ones it sends rather than waiting for it.
+//
+// Flush does nothing for references without a write queue.
+func (fb *firebase) Flush(ctx context.Context) error {
+	q := fb.writeQueue
+	if q == nil {
+		return nil
+	}
+
+	ctx, cancel := fb.requestContext(ctx)
+	defer cancel()
+	q.flushMtx.Lock()
+	defer q.flushMtx.Unlock()
+	for {
+		q.Lock()
+		w, ok, err := q.Peek()
+		q.Unlock()
+		if err != nil || !ok {
+			return err
+		}
+
+		// the write stays at the front of the queue while it is sent, the
+		// writes made meanwhile are queued behind it
+		ref := fb.copy()
+		ref.url = w.URL
+		_, err = ref.doRequest(ctx, w.Method, w.Body)
+		if isNetworkError(ctx, err) || (err != nil && ctx.Err() != nil) {
+			// the write is sent again by the next flush
+			return err
+		}
+
+		q.Lock()
+		dErr := q.Dequeue()
+		q.Unlock()
+		if dErr != nil {
+			return dErr
+		}
+		if err != nil && fb.writeConflict != nil {
+			err = fb.writeConflict(w, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isNetworkError reports whether err, returned by a request made with ctx,
+// means Firebase could not be reached, as opposed to Firebase rejecting the
+// request or the caller giving up. The caller gave up when ctx is done,
+// whatever err is: a deadline of ctx passing is reported as an ErrTimeout,
+// like the timeouts of the client.
+func isNetworkError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if _, ok := err.(ErrTimeout); ok {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
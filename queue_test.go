@@ -0,0 +1,355 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// newFlakyServer proxies requests to a firetest server and
+// drops every connection while offline is set.
+func newFlakyServer(t *testing.T, ft *firetest.Firetest, offline *int32) *httptest.Server {
+	return newFaultServer(t, ft, func(w http.ResponseWriter, req *http.Request, proxy http.Handler) {
+		if atomic.LoadInt32(offline) == 1 {
+			dropConnection(t, w)
+			return
+		}
+		proxy.ServeHTTP(w, req)
+	})
+}
+
+// dropConnection closes the connection of the request w answers without
+// responding, the way an unreachable server would.
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	if conn, _, err := w.(http.Hijacker).Hijack(); assert.NoError(t, err) {
+		conn.Close()
+	}
+}
+
+func TestWriteQueue(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	q := NewMemoryWriteQueue()
+	fb := New(server.URL, nil, WithWriteQueue(q))
+
+	ft.Set("c", "to be removed")
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(2))
+	assert.Equal(t, ErrQueued, fb.Update(map[string]interface{}{"b": true}))
+	assert.Equal(t, ErrQueued, fb.Child("c").Remove())
+	pushed, err := fb.Push("pushed")
+	assert.Equal(t, ErrQueued, err)
+	require.NotNil(t, pushed)
+
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// increments are not idempotent, they are never queued
+	assert.Equal(t, ErrNotIdempotent, fb.Update(map[string]interface{}{"views": Increment(1)}))
+	n, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// still offline, nothing gets flushed
+	assert.Error(t, fb.Flush(context.Background()))
+	n, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	atomic.StoreInt32(offline, 0)
+	require.NoError(t, fb.Flush(context.Background()))
+
+	n, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.EqualValues(t, 2, ft.Get("a"))
+	assert.Equal(t, true, ft.Get("b"))
+	assert.Nil(t, ft.Get("c"))
+	assert.Equal(t, "pushed", ft.Get(strings.TrimPrefix(pushed.(*firebase).url, server.URL)))
+
+	// once flushed, writes go straight through
+	require.NoError(t, fb.Child("a").Set(3))
+	assert.EqualValues(t, 3, ft.Get("a"))
+}
+
+func TestWriteQueueIncrement(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	q := NewMemoryWriteQueue()
+	fb := New(server.URL, nil, WithWriteQueue(q))
+	err := fb.Child("views").Set(Increment(1))
+	require.Error(t, err)
+	assert.NotEqual(t, ErrQueued, err)
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	atomic.StoreInt32(offline, 0)
+	require.NoError(t, fb.Child("views").Set(Increment(1)))
+	assert.EqualValues(t, 1, ft.Get("views"))
+}
+
+func TestWriteQueueDeadline(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		ioutil.ReadAll(req.Body)
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	// the caller giving up is neither queued nor retried
+	q := NewMemoryWriteQueue()
+	fb := New(server.URL, nil, WithWriteQueue(q), WithRetry(3, time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := fb.SetWithContext(ctx, 1)
+	require.True(t, errors.As(err, &ErrTimeout{}), "%v", err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestFlushConcurrentWrites(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	received, release := make(chan struct{}), make(chan struct{})
+	var flushed int32
+	server := newFaultServer(t, ft, func(w http.ResponseWriter, req *http.Request, proxy http.Handler) {
+		if atomic.LoadInt32(offline) == 1 {
+			dropConnection(t, w)
+			return
+		}
+		if atomic.AddInt32(&flushed, 1) == 1 {
+			// the first queued write is held until released
+			close(received)
+			<-release
+		}
+		proxy.ServeHTTP(w, req)
+	})
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithWriteQueue(NewMemoryWriteQueue()))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	atomic.StoreInt32(offline, 0)
+	flush := make(chan error)
+	go func() { flush <- fb.Flush(context.Background()) }()
+	select {
+	case <-received:
+	case err := <-flush:
+		require.FailNow(t, "the flush did not send the queued write", "%v", err)
+	}
+
+	// the writes made during the flush are queued behind the one it sends
+	queued := make(chan error)
+	go func() { queued <- fb.Child("a").Set(2) }()
+	select {
+	case err := <-queued:
+		assert.Equal(t, ErrQueued, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "the write waited for the flush")
+	}
+
+	close(release)
+	require.NoError(t, <-flush)
+	n, err := fb.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.EqualValues(t, 2, ft.Get("a"))
+}
+
+func TestWriteQueueRejectedWrite(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	q := NewMemoryWriteQueue()
+	fb := New(server.URL, nil, WithWriteQueue(q))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	assert.Equal(t, ErrQueued, fb.Child("b").Set(2))
+
+	atomic.StoreInt32(offline, 0)
+	ft.RequireAuth(true)
+
+	// the rejected write is dropped from the queue
+	assert.Error(t, fb.Flush(context.Background()))
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	fb.Auth(ft.Secret)
+	require.NoError(t, fb.Flush(context.Background()))
+	assert.Nil(t, ft.Get("a"))
+	assert.EqualValues(t, 2, ft.Get("b"))
+}
+
+func TestWriteConflict(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	var conflicts []QueuedWrite
+	var fb Firebase
+	fb = New(server.URL, nil, WithWriteQueue(NewMemoryWriteQueue()), WithWriteConflict(func(w QueuedWrite, err error) error {
+		assert.IsType(t, ErrHTTP{}, err)
+		conflicts = append(conflicts, w)
+		// resolve the conflict with a write of its own, queued behind b
+		if err := fb.Child("conflicts").Set(len(conflicts)); err != ErrQueued {
+			return err
+		}
+		return nil
+	}))
+	assert.Equal(t, ErrQueued, fb.Child("denied").Set(1))
+	assert.Equal(t, ErrQueued, fb.Child("b").Set(2))
+	n, err := fb.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	atomic.StoreInt32(offline, 0)
+	require.NoError(t, ft.SetRules([]byte(`{"rules": {"b": {".write": true}, "conflicts": {".write": true}}}`)))
+	require.NoError(t, fb.Flush(context.Background()))
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, server.URL+"/denied", conflicts[0].URL)
+	assert.Nil(t, ft.Get("denied"))
+	assert.EqualValues(t, 2, ft.Get("b"))
+	assert.EqualValues(t, 1, ft.Get("conflicts"))
+	n, err = fb.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = New(server.URL, nil).Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestWithAutoFlush(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithWriteQueue(NewMemoryWriteQueue()), WithAutoFlush(10*time.Millisecond))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(2))
+	time.Sleep(50 * time.Millisecond)
+	n, err := fb.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	atomic.StoreInt32(offline, 0)
+	require.Eventually(t, func() bool {
+		n, err := fb.Pending()
+		return err == nil && n == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 2, ft.Get("a"))
+}
+
+func TestStopAutoFlush(t *testing.T) {
+	// not parallel, it counts the goroutines flushing queues
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+	const flushing = "firego.(*firebase).startAutoFlush.func"
+	before := goroutines(flushing)
+
+	fb := New(server.URL, nil, WithWriteQueue(NewMemoryWriteQueue()), WithAutoFlush(10*time.Millisecond))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	assert.True(t, goroutines(flushing) > before)
+	fb.Child("b").StopAutoFlush()
+	assertGoroutinesExit(t, before, flushing)
+
+	// for good
+	atomic.StoreInt32(offline, 0)
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(2))
+	time.Sleep(50 * time.Millisecond)
+	n, err := fb.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, fb.Flush(context.Background()))
+	assert.EqualValues(t, 2, ft.Get("a"))
+}
+
+func TestAutoFlushClosedQueue(t *testing.T) {
+	// not parallel, it counts the goroutines flushing queues
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q, err := NewFileWriteQueue(filepath.Join(dir, "queue"))
+	require.NoError(t, err)
+
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+	const flushing = "firego.(*firebase).startAutoFlush.func"
+	before := goroutines(flushing)
+
+	fb := New(server.URL, nil, WithWriteQueue(q), WithAutoFlush(10*time.Millisecond))
+	assert.Equal(t, ErrQueued, fb.Child("a").Set(1))
+	assert.True(t, goroutines(flushing) > before)
+	require.NoError(t, q.Close())
+	assertGoroutinesExit(t, before, flushing)
+}
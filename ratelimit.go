@@ -0,0 +1,110 @@
+package firego
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// WatchRateLimited watches the reference like Watch does but passes at
+// most maxPerSec put and patch events a second over to the given chan.
+// The rate is enforced with a token bucket holding up to a second's worth
+// of events, at least one: events are passed over as they arrive while
+// there are tokens left, and once the bucket is empty, the events received
+// are coalesced into a single put event replacing the whole value of the
+// reference with its latest value, passed over as soon as a token is
+// available again.
+//
+// Unlike WatchDebounced, which waits for the changes to stop, the latest
+// value is delivered within 1/maxPerSec of being received however long the
+// changes keep coming, which protects slow consumers, such as a UI, from
+// bursts of changes without ever starving them of the latest value. Other
+// events, such as errors, are passed over immediately, after the held back
+// changes. The watch is stopped with StopWatching, the same way it is for
+// Watch.
+func (fb *firebase) WatchRateLimited(ch chan Event, maxPerSec float64) error {
+	if maxPerSec <= 0 || math.IsInf(maxPerSec, 0) || math.IsNaN(maxPerSec) {
+		return errors.New("the rate of events must be a positive number")
+	}
+
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return err
+	}
+
+	go rateLimit(events, ch, fb.watchStopped(), maxPerSec, time.Now, time.After)
+	return nil
+}
+
+// rateLimit implements WatchRateLimited, passing the events received on
+// events over to out, reading the time with now and waiting for tokens
+// with after. out is closed once events is, or once stop is, whether or
+// not the events held back could be passed over.
+func rateLimit(events <-chan Event, out chan Event, stop <-chan struct{}, maxPerSec float64, now func() time.Time, after func(time.Duration) <-chan time.Time) {
+	defer close(out)
+
+	capacity := math.Max(1, math.Floor(maxPerSec))
+	tokens, last := capacity, now()
+	refill := func() {
+		t := now()
+		tokens = math.Min(capacity, tokens+t.Sub(last).Seconds()*maxPerSec)
+		last = t
+	}
+
+	m := &Mirror{}
+	var (
+		// timer is set while changes are held back
+		timer   <-chan time.Time
+		pending bool
+	)
+	send := func(event Event) bool {
+		return sendOrStop(out, event, stop)
+	}
+	flush := func() bool {
+		timer = nil
+		if !pending {
+			return true
+		}
+		// a flush ahead of another event may take a token in advance
+		tokens--
+		pending = false
+		return send(newEvent(EventTypePut, "/", normalize(m.value)))
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				flush()
+				return
+			}
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				if !flush() || !send(event) {
+					return
+				}
+				continue
+			}
+
+			m.Apply(event)
+			refill()
+			if !pending && tokens >= 1 {
+				tokens--
+				if !send(event) {
+					return
+				}
+				continue
+			}
+			pending = true
+			if timer == nil {
+				wait := time.Duration((1 - tokens) / maxPerSec * float64(time.Second))
+				timer = after(wait)
+			}
+
+		case <-timer:
+			refill()
+			if !flush() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package firego
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// fakeClock tells a time that only moves when told to.
+type fakeClock struct {
+	mtx sync.Mutex
+	t   time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mtx.Lock()
+	c.t = c.t.Add(d)
+	c.mtx.Unlock()
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	clock := &fakeClock{t: time.Now()}
+	timers := &fakeTimers{timers: make(chan chan time.Time, 10)}
+	events, out := make(chan Event), make(chan Event, 10)
+	go rateLimit(events, out, nil, 2, clock.now, timers.after)
+
+	received := func() Event {
+		select {
+		case event := <-out:
+			return event
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive an event")
+		}
+		return Event{}
+	}
+	nothing := func() {
+		select {
+		case event := <-out:
+			assert.Fail(t, "the event was not held back", "%v", event)
+		default:
+		}
+	}
+	fire := func() {
+		select {
+		case timer := <-timers.timers:
+			timer <- clock.now()
+		case <-time.After(time.Second):
+			require.FailNow(t, "no timer was set")
+		}
+	}
+
+	// a second's worth of events is delivered right away
+	events <- newEvent(EventTypePut, "/", map[string]interface{}{"a": 1.0})
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, received().Data)
+	events <- newEvent(EventTypePut, "/a", 2.0)
+	assert.Equal(t, 2.0, received().Data)
+
+	// the excess is coalesced
+	events <- newEvent(EventTypePatch, "/", map[string]interface{}{"b": 3.0})
+	events <- newEvent(EventTypePut, "/a", 4.0)
+	nothing()
+	clock.advance(500 * time.Millisecond)
+	fire()
+	event := received()
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"a": 4.0, "b": 3.0}, event.Data)
+
+	// under sustained load, the latest value keeps being delivered
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			events <- newEvent(EventTypePut, "/a", float64(i*5+j))
+		}
+		nothing()
+		clock.advance(500 * time.Millisecond)
+		fire()
+		assert.Equal(t, map[string]interface{}{"a": float64(i*5 + 4), "b": 3.0}, received().Data)
+	}
+
+	// once the tokens are back, events are delivered right away again
+	clock.advance(time.Second)
+	events <- newEvent(EventTypePut, "/b", nil)
+	assert.Equal(t, Event{Type: EventTypePut, Path: "/b", rawData: []byte(`{"data":null,"path":"/b"}`)}, received())
+
+	// other events flush the held back ones
+	events <- newEvent(EventTypePut, "/c", 5.0)
+	events <- newEvent(EventTypePut, "/c", 6.0)
+	assert.Equal(t, 5.0, received().Data)
+	boom := errors.New("boom")
+	events <- Event{Type: EventTypeError, Data: boom}
+	assert.Equal(t, map[string]interface{}{"a": 99.0, "c": 6.0}, received().Data)
+	assert.Equal(t, boom, received().Data)
+
+	close(events)
+	_, ok := <-out
+	assert.False(t, ok, "out should be closed")
+}
+
+func TestRateLimitStopped(t *testing.T) {
+	t.Parallel()
+	assertRelayStops(t, func(events <-chan Event, out chan Event, stop <-chan struct{}) {
+		rateLimit(events, out, stop, 2, time.Now, time.After)
+	})
+}
+
+func TestWatchRateLimited(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("foo", "bar")
+	fb := New(server.URL+"/foo", nil)
+	assert.Error(t, fb.WatchRateLimited(make(chan Event), 0))
+
+	events := make(chan Event, 100)
+	require.NoError(t, fb.WatchRateLimited(events, 10))
+	assert.Equal(t, "bar", (<-events).Data)
+	for i := 0; i < 50; i++ {
+		// applied in order, unlike Set
+		server.Apply(firetest.Mutation{Type: "put", Path: "/foo", Data: float64(i)})
+	}
+
+	var received []interface{}
+	for len(received) == 0 || received[len(received)-1] != 49.0 {
+		select {
+		case event := <-events:
+			received = append(received, event.Data)
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive the latest value", "%v", received)
+		}
+	}
+	assert.True(t, len(received) < 50, "the changes were not coalesced: %v", received)
+
+	fb.StopWatching()
+	for range events {
+	}
+}
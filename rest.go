@@ -0,0 +1,310 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// restTag is the value of the firego struct tag marking the map field
+// of a struct that collects the keys no other field is decoded from, as
+// in
+//
+//	type User struct {
+//		Name  string                 `json:"name"`
+//		Extra map[string]interface{} `json:"-" firego:"rest"`
+//	}
+const restTag = "rest"
+
+// WithUnknownKeyWarnings determines whether or not Value reports the keys
+// of the value read that no field of the struct they are decoded into
+// takes, such as the keys holding characters that a json tag can not
+// name, instead of ignoring them silently. The value is decoded as usual
+// and the keys found are listed in the DecodeWarnings returned, with
+// Unknown set. Keys collected by a field tagged `firego:"rest"` are not
+// reported.
+//
+// A reference created with WithDisallowUnknownFields fails the read on
+// the first of these keys instead.
+func WithUnknownKeyWarnings(v bool) Option {
+	return func(fb *firebase) {
+		fb.unknownKeyWarnings = v
+	}
+}
+
+// restTypes caches whether the types decoded into have a field tagged, at
+// any depth, `firego:"rest"`.
+var restTypes sync.Map
+
+// restFieldIndex returns the index of the map field of the struct type t
+// tagged `firego:"rest"`, -1 if there is none.
+func restFieldIndex(t reflect.Type) int {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("firego") == restTag && f.PkgPath == "" && f.Type.Kind() == reflect.Map && f.Type.Key().Kind() == reflect.String {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasRestField reports whether values of type t hold a struct with a
+// field tagged `firego:"rest"`.
+func hasRestField(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if has, ok := restTypes.Load(t); ok {
+		return has.(bool)
+	}
+	has := findRestField(t, map[reflect.Type]bool{})
+	restTypes.Store(t, has)
+	return has
+}
+
+func findRestField(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Array:
+		return findRestField(t.Elem(), seen)
+	case reflect.Struct:
+		if restFieldIndex(t) >= 0 {
+			return true
+		}
+		for _, f := range jsonFields(t) {
+			if findRestField(f.typ, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// structFields returns the fields of the struct type t that keys are
+// decoded into by encoding/json, leaving out the one tagged
+// `firego:"rest"`, whose index is returned, -1 if there is none.
+func structFields(t reflect.Type) (map[string]jsonField, int) {
+	fields := jsonFields(t)
+	rest := restFieldIndex(t)
+	for name, f := range fields {
+		if len(f.index) == 1 && f.index[0] == rest {
+			delete(fields, name)
+		}
+	}
+	return fields, rest
+}
+
+// decodedType follows the pointers of t and reports whether values of the
+// resulting type are decoded by encoding/json as objects, field by field or
+// element by element, rather than by the type itself.
+func decodedType(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return t, false
+	}
+	return t, true
+}
+
+// collectUnknownKeys removes, from the objects of tree decoded into a
+// struct with a field tagged `firego:"rest"`, the keys no other field
+// takes, and returns a DecodeWarning for each of those keys found in the
+// objects of other structs when warn is set. tree was decoded with
+// decodeTree from a value to decode into a value of type t, and path is
+// its dot separated location.
+func collectUnknownKeys(tree interface{}, t reflect.Type, path []string, warn bool) DecodeWarnings {
+	t, ok := decodedType(t)
+	if !ok {
+		return nil
+	}
+
+	var warnings DecodeWarnings
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields, rest := structFields(t)
+		for k, child := range obj {
+			f, ok := fieldByName(fields, k)
+			switch {
+			case ok:
+				warnings = append(warnings, collectUnknownKeys(child, f.typ, append(path[:len(path):len(path)], k), warn)...)
+			case rest >= 0:
+				delete(obj, k)
+			case warn:
+				warnings = append(warnings, DecodeWarning{
+					Field:   strings.Join(append(path[:len(path):len(path)], k), "."),
+					Value:   jsonKind(child),
+					Type:    t,
+					Unknown: true,
+				})
+			}
+		}
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k, child := range obj {
+			warnings = append(warnings, collectUnknownKeys(child, t.Elem(), append(path[:len(path):len(path)], k), warn)...)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, child := range arr {
+			warnings = append(warnings, collectUnknownKeys(child, t.Elem(), append(path[:len(path):len(path)], strconv.Itoa(i)), warn)...)
+		}
+	}
+	return warnings
+}
+
+// fillRestFields stores, in the fields of the structs held by v tagged
+// `firego:"rest"`, the keys of the matching objects of tree that no other
+// field takes. tree was decoded with decodeTree from the value decoded
+// into v.
+func fillRestFields(tree interface{}, v reflect.Value) error {
+	if !hasRestField(v.Type()) {
+		return nil
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if _, ok := decodedType(v.Type()); !ok {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields, rest := structFields(v.Type())
+		unknown := map[string]interface{}{}
+		for k, child := range obj {
+			f, ok := fieldByName(fields, k)
+			if !ok {
+				unknown[k] = child
+				continue
+			}
+			// an error leaves fv invalid, for a nil embedded pointer
+			if fv, err := v.FieldByIndexErr(f.index); err == nil {
+				if err := fillRestFields(child, fv); err != nil {
+					return err
+				}
+			}
+		}
+		if rest < 0 || len(unknown) == 0 || !v.Field(rest).CanSet() {
+			return nil
+		}
+		b, err := json.Marshal(unknown)
+		if err != nil {
+			return err
+		}
+		m := reflect.New(v.Field(rest).Type())
+		if err := json.Unmarshal(b, m.Interface()); err != nil {
+			return err
+		}
+		v.Field(rest).Set(m.Elem())
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok || v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for k, child := range obj {
+			key := reflect.ValueOf(k).Convert(v.Type().Key())
+			ev := v.MapIndex(key)
+			if !ev.IsValid() {
+				continue
+			}
+			// the values of maps are not addressable
+			elem := reflect.New(ev.Type()).Elem()
+			elem.Set(ev)
+			if err := fillRestFields(child, elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, child := range arr {
+			if i >= v.Len() {
+				break
+			}
+			if err := fillRestFields(child, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeUnknownKeys decodes data into v with decode, after removing the
+// keys collected by the fields tagged `firego:"rest"`, which are filled
+// once v is decoded, and adds a DecodeWarning for every key no field
+// takes when warn is set.
+func decodeUnknownKeys(data []byte, v interface{}, warn bool, decode func([]byte, interface{}) error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return decode(data, v)
+	}
+	original, err := decodeTree(data)
+	if err != nil {
+		return decode(data, v)
+	}
+	tree, _ := decodeTree(data)
+	warnings := collectUnknownKeys(tree, rv.Type(), nil, warn)
+	if data, err = json.Marshal(tree); err != nil {
+		return err
+	}
+
+	err = decode(data, v)
+	if w, ok := err.(DecodeWarnings); ok {
+		warnings = append(warnings, w...)
+	} else if err != nil {
+		return err
+	}
+	if err := fillRestFields(original, rv); err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		sort.Slice(warnings, func(i, j int) bool { return warnings[i].Field < warnings[j].Field })
+		return warnings
+	}
+	return nil
+}
+
+// jsonKind returns the kind of JSON value of v, decoded with decodeTree,
+// the way json.UnmarshalTypeError names it.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return "null"
+}
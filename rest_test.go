@@ -0,0 +1,114 @@
+package firego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+type restProfile struct {
+	Bio   string                 `json:"bio"`
+	Extra map[string]interface{} `json:"-" firego:"rest"`
+}
+
+type restUser struct {
+	Name     string                 `json:"name"`
+	Profile  restProfile            `json:"profile"`
+	Pets     []restProfile          `json:"pets"`
+	Accounts map[string]restProfile `json:"accounts"`
+	Extra    map[string]interface{} `json:"-" firego:"rest"`
+}
+
+type plainUser struct {
+	Name    string `json:"name"`
+	Profile struct {
+		Bio string `json:"bio"`
+	} `json:"profile"`
+	Pets []struct {
+		Name string `json:"name"`
+	} `json:"pets"`
+}
+
+const unmappedUser = `{
+	"name": "alice",
+	"display name": "Alice",
+	"e-mail,primary": "alice@example.com",
+	"profile": {"bio": "hi", "nick\"name": "al"},
+	"pets": [{"bio": "cat", "name": "Tom"}],
+	"accounts": {"github": {"bio": "dev", "stars": 3}}
+}`
+
+func TestRestField(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	require.NoError(t, New(server.URL+"/users/alice", nil).SetJSON(strings.NewReader(unmappedUser)))
+
+	var user restUser
+	require.NoError(t, New(server.URL+"/users/alice", nil).Value(&user))
+	assert.Equal(t, "alice", user.Name)
+	assert.Equal(t, map[string]interface{}{
+		"display name":   "Alice",
+		"e-mail,primary": "alice@example.com",
+	}, user.Extra)
+	assert.Equal(t, restProfile{Bio: "hi", Extra: map[string]interface{}{`nick"name`: "al"}}, user.Profile)
+	assert.Equal(t, []restProfile{{Bio: "cat", Extra: map[string]interface{}{"name": "Tom"}}}, user.Pets)
+	assert.Equal(t, map[string]restProfile{"github": {Bio: "dev", Extra: map[string]interface{}{"stars": 3.0}}}, user.Accounts)
+
+	// nothing is left to reject
+	user = restUser{}
+	fb := New(server.URL+"/users/alice", nil, WithDisallowUnknownFields(true), WithUnknownKeyWarnings(true))
+	require.NoError(t, fb.Value(&user))
+	assert.Equal(t, "Alice", user.Extra["display name"])
+
+	// slices of records get them too
+	var users []restUser
+	require.NoError(t, New(server.URL+"/users", nil).ValueSlice(&users))
+	require.Len(t, users, 1)
+	assert.Equal(t, "Alice", users[0].Extra["display name"])
+}
+
+func TestUnknownKeyWarnings(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	require.NoError(t, New(server.URL+"/users/alice", nil).SetJSON(strings.NewReader(unmappedUser)))
+
+	// ignored silently by default
+	var user plainUser
+	require.NoError(t, New(server.URL+"/users/alice", nil).Value(&user))
+
+	user = plainUser{}
+	err := New(server.URL+"/users/alice", nil, WithUnknownKeyWarnings(true)).Value(&user)
+	require.IsType(t, DecodeWarnings{}, err)
+	assert.Equal(t, "alice", user.Name)
+	assert.Equal(t, "hi", user.Profile.Bio)
+	assert.Equal(t, "Tom", user.Pets[0].Name)
+
+	warnings := err.(DecodeWarnings)
+	fields := make([]string, len(warnings))
+	for i, w := range warnings {
+		fields[i] = w.Field
+		assert.True(t, w.Unknown)
+	}
+	assert.Equal(t, []string{"accounts", "display name", "e-mail,primary", "pets.0.bio", `profile.nick"name`}, fields)
+	assert.Equal(t, DecodeWarning{Field: "display name", Value: "string", Type: reflect.TypeOf(user), Unknown: true}, warnings[1])
+	assert.Equal(t, "display name: no field of firego.plainUser takes the string", warnings[1].String())
+
+	// along with the fields a lenient decode skips
+	var lenient struct {
+		Name int `json:"name"`
+	}
+	err = New(server.URL+"/users/alice", nil, WithUnknownKeyWarnings(true), WithLenientDecode(true)).Value(&lenient)
+	require.IsType(t, DecodeWarnings{}, err)
+	warnings = err.(DecodeWarnings)
+	require.Len(t, warnings, 6)
+	assert.Equal(t, "name", warnings[3].Field)
+	assert.False(t, warnings[3].Unknown)
+}
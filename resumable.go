@@ -0,0 +1,137 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// ResumablePageSize is the number of children ValueResumable reads with
+// each of its requests.
+var ResumablePageSize = 1000
+
+const (
+	// resumableRetries is the least number of times ValueResumable
+	// retries the read of a page.
+	resumableRetries = 3
+	// resumableRetryDelay is the delay before the first retry of a page
+	// when the reference has none set with WithRetry or WithBackoff.
+	resumableRetryDelay = 250 * time.Millisecond
+)
+
+// ValueResumable reads the value of the reference into v like Value does,
+// for nodes too large to be read in one request before it times out. The
+// children of the node are read ResumablePageSize at a time, ordered by
+// key, and a page that fails because Firebase could not be reached or
+// responded with a server error is retried on its own, the way WithRetry
+// retries requests, at least 3 times, so that a transient failure only
+// costs the page it happened on instead of the whole read. Once every page
+// has been read, the children are decoded into v together.
+//
+// Unlike Value, the value read is not a snapshot: the pages are read one
+// after the other, and the changes made while they are read are only seen
+// for the children not read yet. A child moved from a page not read yet to
+// one already read is missed, and one moved the other way is read twice,
+// the last read value being kept. The queries of the reference are
+// ignored. A node holding a single value, rather than children, is read
+// with the first request, and children keyed by integers are read as an
+// array the way Firebase reads them.
+func (fb *firebase) ValueResumable(v interface{}) error {
+	return fb.valueResumable(v, ResumablePageSize)
+}
+
+// resumablePages returns the reference reading the first page of size
+// children of the reference, ordered by key, without its queries and with
+// the retries of ValueResumable. The following pages are read with
+// StartAfter the last key read.
+func (fb *firebase) resumablePages(size int) *firebase {
+	c := fb.copy()
+	for _, param := range []string{orderByParam, limitToFirstParam, limitToLastParam, startAtParam, endAtParam, equalToParam} {
+		c.params.Del(param)
+	}
+	if c.maxRetries < resumableRetries {
+		c.maxRetries = resumableRetries
+		if c.retryDelay == 0 {
+			c.retryDelay = resumableRetryDelay
+		}
+	}
+	return c.OrderBy("$key").LimitToFirst(int64(size)).(*firebase)
+}
+
+// valueResumable implements ValueResumable, reading size children a page.
+func (fb *firebase) valueResumable(v interface{}, size int) error {
+	if size < 1 {
+		size = 1
+	}
+	pages := fb.resumablePages(size)
+
+	children := map[string]json.RawMessage{}
+	page := pages
+	for {
+		body, err := page.doRequest(context.Background(), "GET", nil)
+		if err != nil {
+			return err
+		}
+		var read map[string]json.RawMessage
+		if err := json.Unmarshal(body, &read); err != nil {
+			if page == pages {
+				// the node is a single value
+				return fb.unmarshal(body, v)
+			}
+			return err
+		}
+		if read == nil && page == pages {
+			return fb.unmarshal(body, v)
+		}
+
+		keys := make(map[string]interface{}, len(read))
+		for key, child := range read {
+			children[key], keys[key] = child, nil
+		}
+		if len(read) < size {
+			break
+		}
+		ordered := orderChildren(keys, "$key")
+		page = pages.StartAfter(ordered[len(ordered)-1]).(*firebase)
+	}
+
+	var all interface{} = children
+	if elems, ok := asArray(children); ok {
+		all = elems
+	}
+	b, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return fb.unmarshal(b, v)
+}
+
+// asArray returns children as the array Firebase reads them as when their
+// keys are integers and more than half of the keys between 0 and the
+// largest of them are used.
+func asArray(children map[string]json.RawMessage) ([]json.RawMessage, bool) {
+	max := -1
+	for key := range children {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || strconv.Itoa(i) != key {
+			return nil, false
+		}
+		if i > max {
+			max = i
+		}
+	}
+	if max < 0 || 2*len(children) <= max+1 {
+		return nil, false
+	}
+
+	elems := make([]json.RawMessage, max+1)
+	for i := range elems {
+		elems[i] = json.RawMessage("null")
+	}
+	for key, child := range children {
+		i, _ := strconv.Atoi(key)
+		elems[i] = child
+	}
+	return elems, true
+}
@@ -0,0 +1,92 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestValueResumable(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	users := map[string]interface{}{}
+	for i := 0; i < 25; i++ {
+		users[fmt.Sprintf("user-%02d", i)] = map[string]interface{}{"age": i}
+	}
+	server.Set("users", users)
+	server.Set("count", 25)
+	server.Set("list", []interface{}{"a", "b", "c"})
+
+	var requests, failures int32
+	proxy := newFaultServer(t, server, func(w http.ResponseWriter, req *http.Request, forward http.Handler) {
+		n := atomic.AddInt32(&requests, 1)
+		if n <= atomic.LoadInt32(&failures) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		forward.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	// the queries of the reference are ignored
+	fb := New(proxy.URL, nil, WithRetry(0, time.Millisecond)).Child("users").OrderBy("age").LimitToLast(1).(*firebase)
+	var read map[string]struct{ Age int }
+	require.NoError(t, fb.valueResumable(&read, 10))
+	require.Len(t, read, 25)
+	assert.Equal(t, 24, read["user-24"].Age)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// a failing page is retried on its own
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 2)
+	read = nil
+	require.NoError(t, fb.valueResumable(&read, 25))
+	require.Len(t, read, 25)
+	// two failures, the first page and the second one, empty
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+
+	var count int
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 0)
+	require.NoError(t, New(proxy.URL+"/count", nil).ValueResumable(&count))
+	assert.Equal(t, 25, count)
+
+	var list []string
+	require.NoError(t, New(proxy.URL+"/list", nil).(*firebase).valueResumable(&list, 2))
+	assert.Equal(t, []string{"a", "b", "c"}, list)
+
+	var missing map[string]interface{}
+	require.NoError(t, New(proxy.URL+"/missing", nil).ValueResumable(&missing))
+	assert.Nil(t, missing)
+}
+
+func TestValueResumableFailure(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			http.Error(w, `{"error":"Internal server error."}`, http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"a":1,"b":2}`)
+	}))
+	defer server.Close()
+
+	var v map[string]int
+	err := New(server.URL, nil, WithRetry(0, time.Millisecond)).(*firebase).valueResumable(&v, 2)
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, http.StatusInternalServerError, err.(ErrHTTP).StatusCode)
+	// the first page and 3 retries of the second
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+	assert.Nil(t, v)
+}
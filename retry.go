@@ -0,0 +1,207 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithRetry makes requests that fail because Firebase could not be
+// reached or responded with a server error be retried up to maxRetries
+// times. The first retry is made after baseDelay and the delay doubles
+// before every following one, unless the delays are set with WithBackoff,
+// and lasts at least as long as the Retry-After header of the response
+// asks. A maxRetries of 0, the default, disables the retries, WithRetry(0,
+// 0) turns them off for a reference derived from one retrying.
+//
+// Only idempotent requests are retried. A Push is made with a POST, which
+// would create a new child every time it is retried, so it is not retried
+// unless the reference was also created with WithIdempotentPush, and a
+// write holding an Increment is never retried.
+func WithRetry(maxRetries int, baseDelay time.Duration) Option {
+	return func(fb *firebase) {
+		fb.maxRetries = maxRetries
+		fb.retryDelay = baseDelay
+	}
+}
+
+// SetRetryPolicy makes the requests of the reference, and of the
+// references derived from it from then on, that fail because Firebase
+// could not be reached or responded with a server error be retried up to
+// maxRetries times, the way WithRetry does, waiting a random delay
+// between 0 and a ceiling of baseDelay doubling after every retry, with
+// FullJitterBackoff, so that clients failing together do not retry
+// together. A Backoff set with WithBackoff still takes precedence, and a
+// maxRetries of 0 disables the retries.
+//
+// The requests retried are the idempotent ones, those of Value, Exists,
+// Set, Update and Remove among others, the ones Firebase rejected with a
+// 4xx never are, and a Push is not retried unless the reference was
+// created with WithIdempotentPush. The wait before a retry ends early
+// with the error of the context once the context of the operation, see
+// WithContext and ValueWithContext, is done, an ErrTimeout when its
+// deadline passed. A request that still fails returns the error of its
+// last attempt, an ErrTimeout for a timeout.
+func (fb *firebase) SetRetryPolicy(maxRetries int, baseDelay time.Duration) {
+	fb.maxRetries = maxRetries
+	fb.retryDelay = baseDelay
+	fb.retryJitter = true
+}
+
+// WithIdempotentPush determines whether or not Push generates the key of
+// the new child locally and sets the value at that key with a PUT instead
+// of letting Firebase generate the key with a POST. Retrying such a Push
+// writes the same child again instead of creating a duplicate, which makes
+// it safe to retry with WithRetry.
+func WithIdempotentPush(v bool) Option {
+	return func(fb *firebase) {
+		fb.idempotentPush = v
+	}
+}
+
+// WithMaxReconnects makes the event functions set with ChildAdded,
+// ChildChanged and ChildRemoved give up on their stream after n
+// consecutive reconnect attempts that failed or ended before receiving an
+// event, for example because Firebase could not be reached. The event
+// function is then removed and ErrMaxReconnects is logged. A value of 0,
+// the default, keeps reconnecting forever, except for a database that is
+// gone: the event function is removed at once when Firebase responds with
+// an ErrDatabaseUnavailable, which is logged instead. It caps the
+// reconnects of GetAndWatch, and of Watch with WithWatchReconnect, the
+// same way: they pass over an error event holding ErrMaxReconnects and
+// close their chan.
+func WithMaxReconnects(n int) Option {
+	return func(fb *firebase) {
+		fb.maxReconnects = n
+	}
+}
+
+// WithRetryStatusCodes sets the status codes of the responses the
+// requests are retried for with WithRetry, in place of the server errors,
+// the 5xx ones, by default. Listing http.StatusTooManyRequests retries the
+// requests Firebase throttled, after the delay its Retry-After header
+// asks for. The requests Firebase could not be reached for are always
+// retried.
+func WithRetryStatusCodes(codes ...int) Option {
+	return func(fb *firebase) {
+		fb.retryStatuses = map[int]bool{}
+		for _, code := range codes {
+			fb.retryStatuses[code] = true
+		}
+	}
+}
+
+// RetryInfo describes a failed request about to be retried.
+type RetryInfo struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// URL is the location the request was made to,
+	// without its query parameters.
+	URL string
+	// Operation is the name set on the context of the request with
+	// WithOperationName, if any.
+	Operation string
+	// Attempt is the number of the retry, 1 for the first one.
+	Attempt int
+	// Delay is how long the retry waits before being sent.
+	Delay time.Duration
+	// Err is the error of the attempt that failed.
+	Err error
+}
+
+// WithRetryHook sets a function called with every retry WithRetry makes,
+// before waiting for its delay, for logging or counting them. It is
+// called from the goroutine making the request and must not block.
+func WithRetryHook(fn func(RetryInfo)) Option {
+	return func(fb *firebase) {
+		fb.retryHook = fn
+	}
+}
+
+// shouldRetry reports whether a request made with ctx that failed
+// with err after the given number of attempts is retried.
+func (fb *firebase) shouldRetry(ctx context.Context, method string, body io.Reader, attempt, status int, err error) bool {
+	if attempt >= fb.maxRetries || method == "POST" {
+		return false
+	}
+	switch body.(type) {
+	case nil, *bytes.Reader:
+	default:
+		// the body can not be sent again
+		return false
+	}
+	if ctx.Err() != nil {
+		// the caller gave up
+		return false
+	}
+	if isNetworkError(ctx, err) {
+		return true
+	}
+	if _, ok := err.(ErrDatabaseUnavailable); ok {
+		return false
+	}
+	if fb.retryStatuses != nil {
+		return fb.retryStatuses[status]
+	}
+	return status >= 500
+}
+
+// waitRetry waits before the retry following the given attempt of req,
+// which failed with err. A deadline of ctx passing during the wait ends it
+// with an ErrTimeout, err itself when the attempt timed out too.
+func (fb *firebase) waitRetry(ctx context.Context, req *http.Request, attempt int, err error) error {
+	delay := fb.retryBackoff().NextDelay(attempt)
+	var e ErrHTTP
+	if errors.As(err, &e) && e.RetryAfter > delay {
+		delay = e.RetryAfter
+	}
+	if fb.retryHook != nil {
+		fb.retryHook(RetryInfo{
+			Method:    req.Method,
+			URL:       req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+			Operation: fb.operationName(req.Context()),
+			Attempt:   attempt + 1,
+			Delay:     delay,
+			Err:       err,
+		})
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return ctx.Err()
+		}
+		if _, ok := err.(ErrTimeout); ok {
+			return err
+		}
+		return ErrTimeout{ctx.Err()}
+	}
+}
+
+// retryAfter returns the delay a Retry-After header asks for, either a
+// number of seconds or a date, 0 when it is empty or invalid.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
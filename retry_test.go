@@ -0,0 +1,227 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// newFailingServer returns a server that responds with a server
+// error to the first failures requests it receives.
+func newFailingServer(t *testing.T, failures int32) (*httptest.Server, *[]*http.Request) {
+	var (
+		count    int32
+		requests []*http.Request
+	)
+	server := newFaultServer(t, nil, func(w http.ResponseWriter, req *http.Request, _ http.Handler) {
+		requests = append(requests, req)
+		if atomic.AddInt32(&count, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"name":"-server-key"}`))
+	})
+	return server, &requests
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 2)
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithRetry(2, time.Millisecond))
+	require.NoError(t, fb.Set(true))
+	assert.Len(t, *requests, 3)
+}
+
+func TestWithRetryExhausted(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 5)
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithRetry(2, time.Millisecond))
+	assert.Error(t, fb.Set(true))
+	assert.Len(t, *requests, 3)
+}
+
+func TestWithRetryIncrement(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 5)
+	defer server.Close()
+
+	// sending an increment again would apply it twice
+	fb := New(server.URL, nil, WithRetry(2, time.Millisecond))
+	assert.Error(t, fb.Update(map[string]interface{}{"views": Increment(1)}))
+	assert.Len(t, *requests, 1)
+	assert.Error(t, fb.Child("views").Set(Increment(1)))
+	assert.Len(t, *requests, 2)
+}
+
+func TestWithRetryInjectedFault(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/flag", nil, WithRetry(2, time.Millisecond))
+	server.InjectFault(firetest.FaultSpec{Method: "PUT", Status: http.StatusInternalServerError, Times: 2})
+	require.NoError(t, fb.Set(true))
+	assert.Equal(t, true, server.Get("flag"))
+
+	server.InjectFault(firetest.FaultSpec{Method: "PUT", Status: http.StatusInternalServerError, Times: 3})
+	assert.Error(t, fb.Set(false))
+	assert.Equal(t, true, server.Get("flag"))
+}
+
+func TestWithRetryPush(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 1)
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithRetry(2, time.Millisecond))
+	_, err := fb.Push(true)
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+}
+
+func TestWithIdempotentPush(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 2)
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithRetry(2, time.Millisecond), WithIdempotentPush(true))
+	ref, err := fb.Push(true)
+	require.NoError(t, err)
+
+	require.Len(t, *requests, 3)
+	path := (*requests)[0].URL.Path
+	for _, req := range *requests {
+		assert.Equal(t, "PUT", req.Method)
+		assert.Equal(t, path, req.URL.Path)
+	}
+	assert.Equal(t, server.URL+path, ref.String())
+	assert.Len(t, path, len("/")+20+len("/.json"))
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("flag", true)
+	fb := New(server.URL+"/flag", nil)
+	fb.SetRetryPolicy(2, time.Millisecond)
+	assert.Equal(t, FullJitterBackoff{Base: time.Millisecond}, fb.(*firebase).retryBackoff())
+
+	// server errors are retried
+	server.InjectFault(firetest.FaultSpec{Status: http.StatusServiceUnavailable, Times: 2})
+	var v interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, true, v)
+	server.InjectFault(firetest.FaultSpec{Status: http.StatusInternalServerError, Times: 2})
+	require.NoError(t, fb.Child("other").Update(map[string]bool{"a": true}))
+	assert.Equal(t, map[string]interface{}{"a": true}, server.Get("flag/other"))
+
+	// client errors and pushes are not
+	server.InjectFault(firetest.FaultSpec{Status: http.StatusUnauthorized, Times: 2})
+	assert.Error(t, fb.Value(&v))
+	assert.Error(t, fb.Value(&v))
+	require.NoError(t, fb.Value(&v))
+	server.InjectFault(firetest.FaultSpec{Method: "POST", Status: http.StatusInternalServerError, Times: 1})
+	_, err := fb.Push(true)
+	assert.Error(t, err)
+	_, err = fb.Push(true)
+	assert.NoError(t, err)
+}
+
+func TestSetRetryPolicyContext(t *testing.T) {
+	t.Parallel()
+	server, requests := newFailingServer(t, 5)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(3, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := fb.SetWithContext(ctx, true)
+	assert.Equal(t, ErrTimeout{context.DeadlineExceeded}, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Minute)
+	assert.NotEmpty(t, *requests)
+
+	// a cancel is not a timeout
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = fb.SetWithContext(ctx, true)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.As(err, &ErrTimeout{}))
+}
+
+func TestWithRetryStatusCodes(t *testing.T) {
+	t.Parallel()
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&count, 1)%2 == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"too many requests"}`))
+			return
+		}
+		w.Write([]byte(`true`))
+	}))
+	defer server.Close()
+
+	// throttled requests are not retried by default
+	var v bool
+	fb := New(server.URL, nil, WithRetry(1, time.Millisecond))
+	err := fb.Value(&v)
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, time.Second, err.(ErrHTTP).RetryAfter)
+
+	var retries []RetryInfo
+	fb = New(server.URL, nil,
+		WithRetry(1, time.Millisecond),
+		WithRetryStatusCodes(http.StatusTooManyRequests),
+		WithRetryHook(func(info RetryInfo) { retries = append(retries, info) }),
+	)
+	atomic.StoreInt32(&count, 0)
+	start := time.Now()
+	require.NoError(t, fb.Value(&v))
+	assert.True(t, v)
+	assert.True(t, time.Since(start) >= time.Second, "waited %s", time.Since(start))
+	require.Len(t, retries, 1)
+	assert.Equal(t, "GET", retries[0].Method)
+	assert.Equal(t, server.URL+"/.json", retries[0].URL)
+	assert.Equal(t, 1, retries[0].Attempt)
+	assert.Equal(t, time.Second, retries[0].Delay)
+	assert.Equal(t, http.StatusTooManyRequests, retries[0].Err.(ErrHTTP).StatusCode)
+
+	// server errors are no longer retried
+	failing, requests := newFailingServer(t, 1)
+	defer failing.Close()
+	fb = New(failing.URL, nil, WithRetry(1, time.Millisecond), WithRetryStatusCodes(http.StatusTooManyRequests))
+	assert.Error(t, fb.Set(true))
+	assert.Len(t, *requests, 1)
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, time.Duration(0), retryAfter("soon"))
+	assert.Equal(t, time.Duration(0), retryAfter("-3"))
+	assert.Equal(t, 3*time.Second, retryAfter("3"))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	d := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 59*time.Minute && d <= time.Hour, "%s", d)
+}
@@ -0,0 +1,117 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+)
+
+// ServerValue is a placeholder written in place of a value that
+// Firebase computes on its servers when the write is applied.
+//
+// Reference https://firebase.google.com/docs/reference/rest/database#section-server-values
+type ServerValue struct {
+	sv interface{}
+}
+
+// ServerTimestamp is replaced by the time, in milliseconds since the
+// Unix epoch, at which Firebase applied the write.
+var ServerTimestamp = ServerValue{sv: "timestamp"}
+
+// Increment returns the placeholder replaced by the current value of its
+// location plus delta, or by delta when the location holds no number,
+// computed atomically by Firebase, making counters safe to update from
+// several clients without a transaction:
+//
+//	ref.Update(map[string]interface{}{"views": firego.Increment(1)})
+//
+// A write holding an Increment is neither queued by WithWriteQueue nor
+// retried by WithRetry or SetRetryPolicy, since sending it again would
+// apply it twice.
+func Increment(delta float64) ServerValue {
+	return ServerValue{sv: map[string]interface{}{"increment": delta}}
+}
+
+// holdsIncrement reports whether the JSON payload body holds an
+// Increment placeholder.
+func holdsIncrement(body []byte) bool {
+	if !bytes.Contains(body, []byte(`"increment"`)) {
+		return false
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return false
+	}
+	return findIncrement(v)
+}
+
+// findIncrement reports whether v, a decoded payload, holds an Increment
+// placeholder.
+func findIncrement(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if sv, ok := v[".sv"].(map[string]interface{}); ok {
+			if _, ok := sv["increment"]; ok {
+				return true
+			}
+		}
+		for _, child := range v {
+			if findIncrement(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if findIncrement(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the placeholder the way Firebase expects it.
+func (v ServerValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{".sv": v.sv})
+}
+
+// Touch sets the given child, typically an updatedAt field, to the time
+// at which Firebase applies the write, leaving every other child of the
+// reference untouched.
+func (fb *firebase) Touch(field string) error {
+	return fb.Update(map[string]interface{}{field: ServerTimestamp})
+}
+
+// PushOrdered pushes v like Push does and sets the priority of the new
+// child to the time at which Firebase applies the write, in the same
+// write, returning the key of the new child. Reading the children ordered
+// by priority, with OrderBy("$priority"), then lists them in the order
+// Firebase received them regardless of the clocks of the clients that
+// pushed them.
+//
+// Objects get the priority under a ".priority" key next to their
+// children, other values are wrapped the way Firebase stores primitives
+// with a priority, so v should not already hold a priority.
+func (fb *firebase) PushOrdered(v interface{}) (string, error) {
+	b, err := fb.marshalPayload(v)
+	if err != nil {
+		return "", err
+	}
+
+	payload := map[string]interface{}{}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil || obj == nil {
+		// not an object
+		payload[valueKey] = json.RawMessage(b)
+	}
+	for k, child := range obj {
+		payload[k] = child
+	}
+	payload[priorityKey] = ServerTimestamp
+
+	ref, err := fb.Push(payload)
+	if ref == nil {
+		return "", err
+	}
+	return path.Base(ref.(*firebase).url), err
+}
@@ -0,0 +1,83 @@
+package firego
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestServerTimestamp(t *testing.T) {
+	t.Parallel()
+	b, err := json.Marshal(map[string]interface{}{"at": ServerTimestamp})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"at":{".sv":"timestamp"}}`, string(b))
+}
+
+func TestTouch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("user", map[string]interface{}{"name": "bob", "updatedAt": 1})
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	require.NoError(t, New(server.URL, nil).Child("user").Touch("updatedAt"))
+
+	updatedAt, ok := server.Get("user/updatedAt").(int64)
+	require.True(t, ok, "server timestamp was not resolved")
+	assert.True(t, updatedAt >= before)
+	assert.Equal(t, "bob", server.Get("user/name"))
+}
+
+func TestPushOrdered(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	fb := New(server.URL+"/items", nil)
+	key, err := fb.PushOrdered(map[string]interface{}{"name": "first", ".priority": 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, key)
+	priority, ok := server.Get("items/" + key + "/.priority").(int64)
+	require.True(t, ok, "priority was not set to the server timestamp")
+	assert.True(t, priority >= before)
+	assert.Equal(t, "first", server.Get("items/"+key+"/name"))
+
+	key, err = fb.PushOrdered("second")
+	require.NoError(t, err)
+	priority, ok = server.Get("items/" + key + "/.priority").(int64)
+	require.True(t, ok, "priority was not set to the server timestamp")
+	assert.True(t, priority >= before)
+	assert.Equal(t, "second", server.Get("items/"+key+"/.value"))
+
+	_, err = fb.PushOrdered(func() {})
+	assert.IsType(t, ErrInvalidPayload{}, err)
+}
+
+func TestIncrement(t *testing.T) {
+	t.Parallel()
+	b, err := json.Marshal(Increment(2))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{".sv":{"increment":2}}`, string(b))
+	assert.True(t, holdsIncrement([]byte(`{"a":[1,{"b":{".sv":{"increment":2}}}]}`)))
+	assert.False(t, holdsIncrement([]byte(`{"increment":{".sv":"timestamp"}}`)))
+
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("post", map[string]interface{}{"views": 1})
+
+	fb := New(server.URL, nil).Child("post")
+	require.NoError(t, fb.Update(map[string]interface{}{"views": Increment(2), "likes": Increment(1)}))
+	require.NoError(t, fb.Child("views").Set(Increment(-0.5)))
+
+	var post map[string]float64
+	require.NoError(t, fb.Value(&post))
+	assert.Equal(t, map[string]float64{"views": 2.5, "likes": 1}, post)
+}
@@ -0,0 +1,147 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+// googleTokenURL is the endpoint Google issues OAuth2 access tokens from,
+// for the credentials that do not name one.
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// credentialsEnv is the environment variable naming the file of the
+// Application Default Credentials.
+const credentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// databaseScopes are the OAuth2 scopes the access tokens sent to Firebase
+// are requested with.
+//
+// Reference https://firebase.google.com/docs/database/rest/auth#authenticate_with_an_access_token
+var databaseScopes = []string{
+	"https://www.googleapis.com/auth/firebase.database",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// NewWithServiceAccount creates a Firebase reference like New does,
+// authenticated as the Google service account whose JSON key, as
+// downloaded from the Google Cloud console, is credsJSON. Every request
+// is sent with an OAuth2 access token obtained for the account, which is
+// refreshed before it expires, see ServiceAccountTokenSource. It is the
+// way to authenticate now that legacy database secrets are deprecated.
+func NewWithServiceAccount(url string, credsJSON []byte, opts ...Option) (Firebase, error) {
+	ts, err := ServiceAccountTokenSource(credsJSON)
+	if err != nil {
+		return nil, err
+	}
+	fb := New(url, nil, opts...)
+	fb.AuthWithTokenSource(ts)
+	return fb, nil
+}
+
+// ServiceAccountTokenSource returns a token source obtaining the OAuth2
+// access tokens of the Google service account whose JSON key is credsJSON,
+// with the firebase.database and userinfo.email scopes Firebase requires,
+// for AuthWithTokenSource. The credentials of a user, of type
+// "authorized_user", as written by "gcloud auth application-default
+// login", are accepted too. Tokens are reused until shortly before they
+// expire, a new one is obtained then.
+func ServiceAccountTokenSource(credsJSON []byte) (oauth2.TokenSource, error) {
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(credsJSON, &creds); err != nil {
+		return nil, fmt.Errorf("invalid credentials: %v", err)
+	}
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+
+	ctx := context.Background()
+	switch creds.Type {
+	case "service_account":
+		if creds.ClientEmail == "" || creds.PrivateKey == "" {
+			return nil, errors.New("invalid credentials: client_email and private_key are required")
+		}
+		conf := &jwt.Config{
+			Email:        creds.ClientEmail,
+			PrivateKey:   []byte(creds.PrivateKey),
+			PrivateKeyID: creds.PrivateKeyID,
+			Scopes:       databaseScopes,
+			TokenURL:     tokenURL,
+		}
+		return conf.TokenSource(ctx), nil
+	case "authorized_user":
+		if creds.RefreshToken == "" {
+			return nil, errors.New("invalid credentials: refresh_token is required")
+		}
+		conf := &oauth2.Config{
+			ClientID:     creds.ClientID,
+			ClientSecret: creds.ClientSecret,
+			Scopes:       databaseScopes,
+			Endpoint:     oauth2.Endpoint{TokenURL: tokenURL},
+		}
+		return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: creds.RefreshToken}), nil
+	}
+	return nil, fmt.Errorf("invalid credentials: unsupported type %q", creds.Type)
+}
+
+// DefaultTokenSource returns the token source of the Application Default
+// Credentials, for AuthWithTokenSource: the credentials in the file named
+// by the GOOGLE_APPLICATION_CREDENTIALS environment variable or, when it
+// is not set, the ones "gcloud auth application-default login" writes,
+// read as ServiceAccountTokenSource reads them.
+//
+// The credentials of the metadata server of Google Cloud environments,
+// such as Compute Engine, are not looked up: use AuthWithTokenSource with
+// the token source of golang.org/x/oauth2/google there.
+func DefaultTokenSource() (oauth2.TokenSource, error) {
+	path := os.Getenv(credentialsEnv)
+	if path == "" {
+		path = wellKnownCredentials()
+	}
+	if path == "" {
+		return nil, errors.New("no default credentials found, set " + credentialsEnv)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ServiceAccountTokenSource(b)
+}
+
+// wellKnownCredentials returns the path of the file gcloud writes the
+// Application Default Credentials to, empty if it does not exist.
+func wellKnownCredentials() string {
+	var dir string
+	if runtime.GOOS == "windows" {
+		dir = filepath.Join(os.Getenv("APPDATA"), "gcloud")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config", "gcloud")
+	}
+	path := filepath.Join(dir, "application_default_credentials.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,131 @@
+package firego
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// newTokenServer returns a server issuing the access token given for the
+// service accounts and refresh tokens exchanged with it, along with the
+// number of tokens it issued and the scopes of the last JWT it received.
+func newTokenServer(t *testing.T, token string) (*httptest.Server, *int32, *atomic.Value) {
+	var issued int32
+	var scopes atomic.Value
+	// the handler runs in the goroutine of the server, it can not stop the
+	// test, it fails it and rejects the request instead
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !assert.NoError(t, req.ParseForm()) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if assertion := req.PostForm.Get("assertion"); assertion != "" {
+			parts := strings.Split(assertion, ".")
+			if !assert.Len(t, parts, 3) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, err := base64.RawURLEncoding.DecodeString(parts[1])
+			var claims struct {
+				Scope string `json:"scope"`
+			}
+			if !assert.NoError(t, err) || !assert.NoError(t, json.Unmarshal(b, &claims)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			scopes.Store(claims.Scope)
+		}
+		atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":3600}`, token)
+	}))
+	return server, &issued, &scopes
+}
+
+func serviceAccountKey(t *testing.T, tokenURL string) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	b, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "firego@example.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":      tokenURL,
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func TestNewWithServiceAccount(t *testing.T) {
+	t.Parallel()
+	tokens, issued, scopes := newTokenServer(t, "account-token")
+	defer tokens.Close()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireBearerToken("account-token")
+	server.Set("a", 1)
+
+	fb, err := NewWithServiceAccount(server.URL, serviceAccountKey(t, tokens.URL))
+	require.NoError(t, err)
+	var v interface{}
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, 1.0, v)
+	require.NoError(t, fb.Child("b").Set(2))
+	assert.EqualValues(t, 2, server.Get("b"))
+
+	// the token is reused until it expires
+	assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+	assert.Equal(t, strings.Join(databaseScopes, " "), scopes.Load())
+
+	for _, creds := range []string{
+		`not json`,
+		`{"type":"service_account"}`,
+		`{"type":"authorized_user"}`,
+		`{"type":"external_account"}`,
+	} {
+		_, err := NewWithServiceAccount(server.URL, []byte(creds))
+		assert.Error(t, err, creds)
+	}
+}
+
+func TestDefaultTokenSource(t *testing.T) {
+	tokens, issued, _ := newTokenServer(t, "user-token")
+	defer tokens.Close()
+
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	creds := fmt.Sprintf(`{"type":"authorized_user","client_id":"id","client_secret":"secret","refresh_token":"refresh","token_uri":%q}`, tokens.URL)
+	require.NoError(t, ioutil.WriteFile(path, []byte(creds), 0600))
+
+	defer os.Setenv(credentialsEnv, os.Getenv(credentialsEnv))
+	require.NoError(t, os.Setenv(credentialsEnv, path))
+	ts, err := DefaultTokenSource()
+	require.NoError(t, err)
+	token, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "user-token", token.AccessToken)
+	assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+
+	require.NoError(t, os.Setenv(credentialsEnv, filepath.Join(dir, "missing.json")))
+	_, err = DefaultTokenSource()
+	assert.Error(t, err)
+}
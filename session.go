@@ -0,0 +1,64 @@
+package firego
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// sessionIdleTimeout is how long a session keeps an idle connection open.
+const sessionIdleTimeout = 90 * time.Second
+
+// Session returns a reference to the same location that makes its reads
+// and writes, and those of every reference derived from it, as a session
+// meant to read its own writes:
+//
+//   - reads ask every HTTP cache between the client and Firebase not to
+//     serve them from a cached response, the way FreshValue does;
+//   - writes are never queued by WithWriteQueue, a write that returns
+//     without an error has been acknowledged by Firebase, even if it
+//     overtook writes still waiting in the queue of the reference;
+//   - if the reference uses the client created by New, the session uses
+//     its own client that keeps connections alive, so consecutive
+//     operations reuse the same connection instead of dialing again.
+//
+// Firebase serves REST reads consistently with the writes it has
+// acknowledged and returns no session or consistency token to carry from
+// one request to the next, so a read made by the session after one of its
+// writes returns reflects that write, as long as no proxy in between
+// ignores the cache headers. Writes made by other clients in the meantime
+// are seen as well; a session does not provide a snapshot of the database
+// and does not order its operations with those of other clients.
+func (fb *firebase) Session() Firebase {
+	c := fb.copy()
+	c.noCache = true
+	c.writeQueue = nil
+	if fb.defaultClient {
+		c.client = fb.keepAliveClient()
+		c.client.Transport.(*http.Transport).IdleConnTimeout = sessionIdleTimeout
+	}
+	return c
+}
+
+// Warmup opens a connection to Firebase ahead of the first real request,
+// so that the DNS lookup, the TCP and TLS handshakes and the validation of
+// the credentials of the reference are paid up front, for example when a
+// service starts or after it has been idle. It reads the reference
+// shallowly, without its query parameters, and discards what it reads.
+// The error of the read, such as an ErrHTTP for credentials that are not
+// accepted, is returned.
+//
+// The connection is kept for the next request only by a client that keeps
+// connections alive, such as the one of a Session or a client given to New
+// whose transport does; the client New creates closes every connection
+// once its request completes, so warming it up only warms the DNS cache of
+// the system, if any. The connection stays open as long as the transport
+// keeps idle connections, 90 seconds for a Session.
+func (fb *firebase) Warmup(ctx context.Context) error {
+	c := fb.copy()
+	c.noCache = true
+	c.clearReadParams()
+	c.params.Set(shallowParam, "true")
+	_, err := c.doRequest(ctx, "GET", nil)
+	return err
+}
@@ -0,0 +1,143 @@
+package firego
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+	var (
+		conns int32
+		reqs  []*http.Request
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req)
+		w.Write([]byte(`"value"`))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	session := New(server.URL, nil).Session()
+	var v string
+	require.NoError(t, session.Value(&v))
+	require.NoError(t, session.Child("foo").Value(&v))
+	require.NoError(t, session.Child("foo").Set("bar"))
+
+	require.Len(t, reqs, 3)
+	assert.Equal(t, "no-cache", reqs[0].Header.Get("Cache-Control"))
+	assert.Equal(t, "no-cache", reqs[1].Header.Get("Pragma"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns), "the connection should be reused")
+}
+
+func TestSessionWriteQueue(t *testing.T) {
+	t.Parallel()
+	ft := firetest.New()
+	ft.Start()
+	defer ft.Close()
+
+	offline := new(int32)
+	*offline = 1
+	server := newFlakyServer(t, ft, offline)
+	defer server.Close()
+
+	q := NewMemoryWriteQueue()
+	session := New(server.URL, nil, WithWriteQueue(q)).Session()
+	err := session.Child("a").Set(1)
+	require.Error(t, err)
+	assert.NotEqual(t, ErrQueued, err)
+
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestWarmup(t *testing.T) {
+	t.Parallel()
+	var conns int32
+	var queries []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		queries = append(queries, req.URL.RawQuery)
+		if req.URL.Path == "/denied/.json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Permission denied"}`))
+			return
+		}
+		w.Write([]byte(`{"a":true}`))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	session := New(server.URL, nil).Session().LimitToFirst(1)
+	require.NoError(t, session.Warmup(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+	var v interface{}
+	require.NoError(t, session.Value(&v))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns), "the warmed up connection should be reused")
+	assert.Equal(t, []string{shallowParam + "=true", limitToFirstParam + "=1"}, queries)
+
+	// the parameters other than the query are kept
+	queries = nil
+	emulated := New(server.URL, nil, WithEmulator(server.Listener.Addr().String(), "db")).OrderBy("$key")
+	emulated.IncludePriority(true)
+	require.NoError(t, emulated.Warmup(context.Background()))
+	assert.Equal(t, []string{namespaceParam + "=db&" + shallowParam + "=true"}, queries)
+
+	err := session.Child("denied").Warmup(context.Background())
+	assert.IsType(t, ErrHTTP{}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, session.Warmup(ctx))
+}
+
+func BenchmarkFirstRequest(b *testing.B) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`true`))
+	}))
+	defer server.Close()
+	config := &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	for _, warm := range []bool{false, true} {
+		name := "cold"
+		if warm {
+			name = "warm"
+		}
+		b.Run(name, func(b *testing.B) {
+			var v bool
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				// a new session dials a new connection
+				session := New(server.URL, nil, WithTLSConfig(config)).Session()
+				if warm {
+					if err := session.Warmup(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+				if err := session.Value(&v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// keyTag is the value of the firego struct tag marking the field
+// ValueSlice stores the key of each element in.
+const keyTag = "key"
+
+// ValueSlice reads the children of the reference, typically the results
+// of a query, into the slice v points to, one element per child in the
+// order of the query. Children are ordered the same way ChildEvents orders
+// them; ordering by priority keeps the order in which Firebase returned
+// them instead. The children of an array are keyed by their index.
+//
+// A string field of the element type tagged with `firego:"key"` is set to
+// the key of each child, which decoding into a slice would otherwise lose:
+//
+//	type Player struct {
+//		ID    string `json:"-" firego:"key"`
+//		Score int    `json:"score"`
+//	}
+//
+// Elements are decoded the way Value decodes values, and a reference
+// created with WithLenientDecode returns the DecodeWarnings of every
+// element, named after its key, once the slice has been filled.
+func (fb *firebase) ValueSlice(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ValueSlice needs a pointer to a slice, not %T", v)
+	}
+
+	entries, err := fb.Run()
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(rv.Elem().Type(), len(entries), len(entries))
+	var warnings DecodeWarnings
+	for i, entry := range entries {
+		elem := slice.Index(i)
+		err := fb.unmarshal(entry.Value, elem.Addr().Interface())
+		if w, ok := err.(DecodeWarnings); ok {
+			for _, warning := range w {
+				warning.Field = entry.Key + "." + warning.Field
+				warnings = append(warnings, warning)
+			}
+		} else if err != nil {
+			return err
+		}
+		setKey(elem, entry.Key)
+	}
+	rv.Elem().Set(slice)
+
+	if len(warnings) > 0 {
+		sort.Slice(warnings, func(i, j int) bool { return warnings[i].Field < warnings[j].Field })
+		return warnings
+	}
+	return nil
+}
+
+// Run runs the query of the reference and returns its results, the
+// children of the reference, in the order of the query: the REST API
+// returns them as an object, whose keys a map does not keep in any order,
+// so they are sorted the way Firebase sorts them, as ValueSlice sorts
+// them. A query is built by chaining the query methods, whose values are
+// encoded for Firebase, strings quoted and numbers as is:
+//
+//	entries, err := players.OrderBy("score").StartAtValue(10).LimitToLast(25).Run()
+//	for _, entry := range entries {
+//		var p Player
+//		if err := entry.Unmarshal(&p); err != nil {
+//			return err
+//		}
+//		fmt.Println(entry.Key, p.Score)
+//	}
+//
+// Without OrderBy the children are ordered by key; ordering by priority
+// keeps the order in which Firebase returned them instead.
+func (fb *firebase) Run() ([]OrderedEntry, error) {
+	body, err := fb.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []OrderedEntry
+	err = streamChildren(json.NewDecoder(bytes.NewReader(body)), func(entry OrderedEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if orderBy := strings.Trim(fb.params.Get(orderByParam), `"`); orderBy != "$priority" {
+		children := make(map[string]interface{}, len(entries))
+		byKey := make(map[string]OrderedEntry, len(entries))
+		for _, entry := range entries {
+			var child interface{}
+			if err := json.Unmarshal(entry.Value, &child); err != nil {
+				return nil, err
+			}
+			children[entry.Key], byKey[entry.Key] = child, entry
+		}
+		for i, key := range orderChildren(children, orderBy) {
+			entries[i] = byKey[key]
+		}
+	}
+	return entries, nil
+}
+
+// setKey stores key in the string field of v tagged as the key, if any.
+func setKey(v reflect.Value, key string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("firego") == keyTag && f.PkgPath == "" && f.Type.Kind() == reflect.String {
+			v.Field(i).SetString(key)
+			return
+		}
+	}
+}
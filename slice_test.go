@@ -0,0 +1,103 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+type slicePlayer struct {
+	ID    string `json:"-" firego:"key"`
+	Score int    `json:"score"`
+}
+
+func TestValueSlice(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("players", map[string]interface{}{
+		"carol": map[string]interface{}{"score": 2},
+		"alice": map[string]interface{}{"score": 3},
+		"bob":   map[string]interface{}{"score": 1},
+	})
+	fb := New(server.URL+"/players", nil)
+
+	var byScore []slicePlayer
+	require.NoError(t, fb.OrderBy("score").ValueSlice(&byScore))
+	assert.Equal(t, []slicePlayer{{"bob", 1}, {"carol", 2}, {"alice", 3}}, byScore)
+
+	var byKey []*slicePlayer
+	require.NoError(t, fb.OrderBy("$key").ValueSlice(&byKey))
+	require.Len(t, byKey, 3)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, []string{byKey[0].ID, byKey[1].ID, byKey[2].ID})
+
+	var scores []int
+	require.NoError(t, fb.Child("alice").ValueSlice(&scores))
+	assert.Equal(t, []int{3}, scores)
+
+	var missing []slicePlayer
+	require.NoError(t, fb.Child("missing").ValueSlice(&missing))
+	assert.Empty(t, missing)
+
+	assert.Error(t, fb.ValueSlice(byScore))
+	assert.Error(t, fb.ValueSlice(&map[string]slicePlayer{}))
+}
+
+func TestValueSlicePriorityOrder(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"b":{"score":1},"a":{"score":"high"},"c":{"score":2}}`))
+	}))
+	defer server.Close()
+
+	// ordering by priority keeps the order of the response
+	var players []slicePlayer
+	fb := New(server.URL, nil, WithLenientDecode(true)).OrderBy("$priority")
+	err := fb.ValueSlice(&players)
+	require.IsType(t, DecodeWarnings{}, err)
+	assert.Equal(t, "a.score", err.(DecodeWarnings)[0].Field)
+	assert.Equal(t, []slicePlayer{{"b", 1}, {"a", 0}, {"c", 2}}, players)
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("players", map[string]interface{}{
+		"alice": map[string]interface{}{"score": 30},
+		"bob":   map[string]interface{}{"score": 10},
+		"carol": map[string]interface{}{"score": 20},
+		"dave":  map[string]interface{}{"score": 5},
+	})
+	fb := New(server.URL+"/players", nil)
+	keys := func(entries []OrderedEntry) []string {
+		var keys []string
+		for _, entry := range entries {
+			keys = append(keys, entry.Key)
+		}
+		return keys
+	}
+
+	entries, err := fb.OrderBy("score").StartAtValue(10).LimitToLast(2).Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol", "alice"}, keys(entries))
+	var p slicePlayer
+	require.NoError(t, entries[1].Unmarshal(&p))
+	assert.Equal(t, 30, p.Score)
+
+	entries, err = fb.Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob", "carol", "dave"}, keys(entries))
+
+	entries, err = fb.Child("missing").Run()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
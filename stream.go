@@ -0,0 +1,171 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// OrderedEntry is a child of a node read by ValueStream, which sends
+// entries in the order Firebase returned them, or by Run.
+type OrderedEntry struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// Unmarshal decodes the value of the entry into v.
+func (e OrderedEntry) Unmarshal(v interface{}) error {
+	return json.Unmarshal(e.Value, v)
+}
+
+// ValueStream reads the value of the reference and sends its children to
+// ch one at a time as they are decoded from the response, so that nodes
+// too large to hold in memory can be processed. The children of an array
+// are keyed by their index. ch is closed once every child has been sent
+// or the read failed, the error of the read is returned by ValueStream.
+//
+// The read is aborted once ctx is done. Values that are neither objects
+// nor arrays have no children and can not be streamed.
+func (fb *firebase) ValueStream(ctx context.Context, ch chan<- OrderedEntry) error {
+	defer close(ch)
+
+	return fb.readStream(ctx, func(ctx context.Context, body io.Reader) error {
+		if fb.lastBody != nil {
+			var captured bytes.Buffer
+			body = io.TeeReader(body, &captured)
+			defer func() { fb.lastBody.set(captured.Bytes()) }()
+		}
+		return streamChildren(json.NewDecoder(body), func(entry OrderedEntry) error {
+			select {
+			case ch <- entry:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+}
+
+// readStream reads the value of the reference and calls fn with the body
+// of the response, to be consumed as it is received, and the context the
+// read is bound to. The error returned by fn is that of the read.
+func (fb *firebase) readStream(ctx context.Context, fn func(ctx context.Context, body io.Reader) error) (err error) {
+	ctx, cancel := fb.requestContext(ctx)
+	defer cancel()
+
+	req, err := fb.newRequest(ctx, "GET", nil)
+	if err != nil {
+		return err
+	}
+	if err := fb.requests.acquire(ctx); err != nil {
+		return err
+	}
+	defer fb.requests.release()
+
+	info := RequestInfo{
+		Method:    req.Method,
+		URL:       req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		Operation: fb.operationName(req.Context()),
+	}
+	in := &countingReader{}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		info.BytesIn = in.count()
+		info.Err = err
+		fb.logRequest(info)
+	}()
+
+	resp, err := fb.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	info.StatusCode = resp.StatusCode
+	in.r = resp.Body
+
+	if resp.StatusCode/200 != 1 {
+		var body []byte
+		if body, err = ioutil.ReadAll(io.LimitReader(in, maxErrorBodyLength+1)); err == nil {
+			fb.lastBody.set(body)
+			body, _ = fb.decodeBody(resp, body)
+			err = databaseUnavailable(newHTTPError(resp.StatusCode, body))
+		}
+		return err
+	}
+	if err = fb.checkContentType(req, resp); err != nil {
+		return err
+	}
+	fb.lastETag.set(resp.Header.Get("ETag"))
+
+	var body io.Reader = in
+	if fb.codec != nil {
+		// codecs decode whole values
+		b, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		if b, err = fb.decodeBody(resp, b); err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	if fb.maxDepth > 0 {
+		body = &depthReader{r: body, max: fb.maxDepth}
+	}
+	return fn(ctx, body)
+}
+
+// streamChildren decodes the children of the value read from dec one at a
+// time and calls fn with each of them, stopping at the first error.
+func streamChildren(dec *json.Decoder, fn func(OrderedEntry) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	var isArray bool
+	switch tok {
+	case json.Delim('{'):
+	case json.Delim('['):
+		isArray = true
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("can not stream the children of %v", tok)
+	}
+
+	for i := 0; dec.More(); i++ {
+		var key string
+		if isArray {
+			key = strconv.Itoa(i)
+		} else {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key = tok.(string)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if isArray && string(value) == "null" {
+			// missing index of a sparse array
+			continue
+		}
+
+		if err := fn(OrderedEntry{Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token()
+	return err
+}
@@ -0,0 +1,116 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func collect(fb Firebase) ([]OrderedEntry, error) {
+	ch := make(chan OrderedEntry)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- fb.ValueStream(context.Background(), ch)
+	}()
+
+	var entries []OrderedEntry
+	for entry := range ch {
+		entries = append(entries, entry)
+	}
+	return entries, <-errc
+}
+
+func TestValueStream(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"age": 30},
+		"bob":   map[string]interface{}{"age": 40},
+	})
+
+	entries, err := collect(New(server.URL, nil).Child("users"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	ages := map[string]float64{}
+	for _, entry := range entries {
+		var v struct{ Age float64 }
+		require.NoError(t, entry.Unmarshal(&v))
+		ages[entry.Key] = v.Age
+	}
+	assert.Equal(t, map[string]float64{"alice": 30, "bob": 40}, ages)
+
+	entries, err = collect(New(server.URL, nil).Child("missing"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestValueStreamArray(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`["a",null,"c"]`)
+	defer server.Close()
+
+	entries, err := collect(New(server.URL, nil))
+	require.NoError(t, err)
+	assert.Equal(t, []OrderedEntry{
+		{Key: "0", Value: []byte(`"a"`)},
+		{Key: "2", Value: []byte(`"c"`)},
+	}, entries)
+}
+
+func TestValueStreamErrors(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/truncated/.json":
+			fmt.Fprint(w, `{"a":1,"b":`)
+		case "/leaf/.json":
+			fmt.Fprint(w, `"leaf"`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":"Permission denied"}`)
+		}
+	}))
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	entries, err := collect(fb.Child("truncated"))
+	assert.Error(t, err)
+	assert.Equal(t, []OrderedEntry{{Key: "a", Value: []byte("1")}}, entries)
+
+	_, err = collect(fb.Child("leaf"))
+	assert.Error(t, err)
+
+	_, err = collect(fb.Child("denied"))
+	require.IsType(t, ErrHTTP{}, err)
+	assert.Equal(t, "Permission denied", err.(ErrHTTP).Message)
+}
+
+func TestValueStreamCancel(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`{"a":1,"b":2}`)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan OrderedEntry)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- New(server.URL, nil).ValueStream(ctx, ch)
+	}()
+
+	entry := <-ch
+	assert.Equal(t, "a", entry.Key)
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-errc)
+	_, ok := <-ch
+	assert.False(t, ok)
+}
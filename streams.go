@@ -0,0 +1,49 @@
+package firego
+
+import "errors"
+
+// ErrTooManyStreams is returned when opening a stream on a reference
+// created with WithMaxConcurrentStreams would exceed the limit.
+var ErrTooManyStreams = errors.New("too many concurrent streams")
+
+// WithMaxConcurrentStreams limits the number of streams, opened by Watch,
+// WatchRaw and everything built on them, that the reference and every
+// reference derived from it may have open at the same time to n. Opening
+// one more fails with ErrTooManyStreams until one of them is closed.
+//
+// Firebase limits the number of concurrent connections to a database, the
+// limit makes an application exceeding its share fail early and clearly.
+// A value of 0, the default, does not limit the streams.
+func WithMaxConcurrentStreams(n int) Option {
+	return func(fb *firebase) {
+		fb.streams = nil
+		if n > 0 {
+			fb.streams = &streamLimiter{slots: make(chan struct{}, n)}
+		}
+	}
+}
+
+// streamLimiter bounds the number of open streams,
+// a nil streamLimiter does not.
+type streamLimiter struct {
+	slots chan struct{}
+}
+
+func (l *streamLimiter) acquire() error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+		return ErrTooManyStreams
+	}
+}
+
+func (l *streamLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,49 @@
+package firego
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	root := New(server.URL, nil, WithMaxConcurrentStreams(2))
+	a, b, c := root.Child("a"), root.Child("b"), root.Child("c")
+
+	require.NoError(t, a.Watch(make(chan Event, 10)))
+	defer a.StopWatching()
+	raw, err := b.WatchRaw(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrTooManyStreams, c.Watch(make(chan Event, 10)))
+	assert.False(t, c.IsWatching())
+	_, err = root.WatchRaw(context.Background())
+	assert.Equal(t, ErrTooManyStreams, err)
+
+	// closing a stream frees its slot, only once
+	require.NoError(t, raw.Close())
+	raw.Close()
+	assert.Eventually(t, func() bool {
+		if err := c.Watch(make(chan Event, 10)); err != nil {
+			return false
+		}
+		c.StopWatching()
+		return true
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return len(root.(*firebase).streams.slots) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// references with no limit are not affected
+	unlimited := New(server.URL, nil)
+	require.NoError(t, unlimited.Watch(make(chan Event, 10)))
+	unlimited.StopWatching()
+}
@@ -0,0 +1,215 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// SubscribeTyped watches the children of the reference. It first calls
+// onChange once per child of the current value, in key order, and then
+// once per child that is added, changed or removed by every later put or
+// patch event, however deep in the child the change was made.
+//
+// The value given to onChange is the child decoded as JSON into a new
+// value obtained from factory, which should return a pointer. For a
+// removed child deleted is set and the value is the child as it was
+// before being removed. Children that cannot be decoded are skipped and
+// logged.
+//
+// The watch is stopped with StopWatching, the same way it is for Watch.
+func (fb *firebase) SubscribeTyped(factory func() interface{}, onChange func(key string, v interface{}, deleted bool)) error {
+	events := make(chan Event)
+	if err := fb.Watch(events); err != nil {
+		return err
+	}
+
+	go func() {
+		m := &Mirror{}
+		for event := range events {
+			applyChildren(m, event, func(key string, old, current interface{}) {
+				fb.deliverChild(key, old, current, factory, onChange)
+			})
+		}
+	}()
+	return nil
+}
+
+// removedTag is the value of the firego struct tag marking the bool field
+// StreamInto sets on the records of removed children.
+const removedTag = "removed"
+
+// StreamInto watches the children of the reference the way SubscribeTyped
+// does, reconnecting the way GetAndWatch does, and sends every child that
+// is added, changed or removed to ch, which must be a chan of the values
+// factory returns, pointers to a new value, as for SubscribeTyped:
+//
+//	type Player struct {
+//		ID      string `json:"-" firego:"key"`
+//		Removed bool   `json:"-" firego:"removed"`
+//		Score   int    `json:"score"`
+//	}
+//
+//	players := make(chan *Player)
+//	err := ref.StreamInto(players, func() interface{} { return &Player{} })
+//
+// Every record is decoded as JSON into a new value obtained from factory,
+// its string field tagged with `firego:"key"`, if any, is set to the key
+// of the child, and the bool field tagged with `firego:"removed"`, if any,
+// is set for a removed child, whose record holds the child as it was
+// before being removed. Children that cannot be decoded, or whose record
+// is not of the element type of ch, are skipped and logged.
+//
+// Delivery is at least once: the current value of every child is sent when
+// the stream opens, and when a broken connection is established again the
+// fresh snapshot of the value, rather than being sent as a whole, is
+// compared with the children already sent, so that only the children added,
+// changed or removed while it was disconnected are sent again. Changes made
+// in the meantime are coalesced into the last of them, and a record may be
+// sent again unchanged when a child changes in a way its decoded value does
+// not reflect, so consumers should apply records by key, idempotently.
+//
+// ch is closed when the watch ends, which is done with StopWatching the
+// same way it is for GetAndWatch; WatchErr reports why it ended.
+func (fb *firebase) StreamInto(ch interface{}, factory func() interface{}) error {
+	cv := reflect.ValueOf(ch)
+	if cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.SendDir == 0 {
+		return fmt.Errorf("StreamInto needs a chan to send to, not %T", ch)
+	}
+
+	events := make(chan Event)
+	if err := fb.GetAndWatch(events); err != nil {
+		return err
+	}
+
+	stop := fb.watchStopped()
+	go func() {
+		defer cv.Close()
+		m := &Mirror{}
+		var stopped bool
+		for event := range events {
+			applyChildren(m, event, func(key string, old, current interface{}) {
+				if stopped {
+					return
+				}
+				fb.deliverChild(key, old, current, factory, func(key string, v interface{}, deleted bool) {
+					rv := reflect.ValueOf(v)
+					if !rv.IsValid() || !rv.Type().AssignableTo(cv.Type().Elem()) {
+						err := fmt.Errorf("record of type %T can not be sent to %s", v, cv.Type())
+						fb.logStream(LogLevelError, StreamEvent{Type: StreamEventReceived, Err: err})
+						return
+					}
+					setKey(rv, key)
+					if deleted {
+						setRemoved(rv)
+					}
+					stopped = !sendOrStop(ch, rv.Interface(), stop)
+				})
+			})
+			if stopped {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// applyChildren applies a put or patch event to m and calls fn for every
+// child directly below the root the event may have changed, with its
+// value before and after the change.
+func applyChildren(m *Mirror, event Event, fn func(key string, old, current interface{})) {
+	if event.Type != EventTypePut && event.Type != EventTypePatch {
+		return
+	}
+
+	keys := changedKeys(event, m.value)
+	before := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		// the mirror updates its value in place
+		before[key] = normalize(lookup(m.value, []string{key}))
+	}
+	if !m.Apply(event) {
+		return
+	}
+
+	for _, key := range keys {
+		fn(key, before[key], lookup(m.value, []string{key}))
+	}
+}
+
+// setRemoved sets the bool field of v tagged as removed, if any.
+func setRemoved(v reflect.Value) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("firego") == removedTag && f.PkgPath == "" && f.Type.Kind() == reflect.Bool {
+			v.Field(i).SetBool(true)
+			return
+		}
+	}
+}
+
+// deliverChild calls onChange for the child named key if its value
+// changed from old to current.
+func (fb *firebase) deliverChild(key string, old, current interface{}, factory func() interface{}, onChange func(key string, v interface{}, deleted bool)) {
+	if reflect.DeepEqual(old, current) {
+		return
+	}
+
+	deleted := current == nil
+	if deleted {
+		current = old
+	}
+	v := factory()
+	if err := decodeValue(current, v); err != nil {
+		fb.logStream(LogLevelError, StreamEvent{Type: StreamEventReceived, Err: err})
+		return
+	}
+	onChange(key, v, deleted)
+}
+
+// changedKeys returns, in order, the children directly below the root
+// that event may change given the current value.
+func changedKeys(event Event, current interface{}) []string {
+	path := splitPath(event.Path)
+	if len(path) > 0 {
+		return path[:1]
+	}
+
+	keys := map[string]interface{}{}
+	data := event.Data
+	if event.Type == EventTypePut {
+		// the whole value is replaced, existing children may be removed
+		existing, _ := current.(map[string]interface{})
+		for k := range existing {
+			keys[k] = true
+		}
+		data = normalize(data)
+	}
+
+	children, _ := data.(map[string]interface{})
+	for k := range children {
+		if p := splitPath(k); len(p) > 0 {
+			keys[p[0]] = true
+		}
+	}
+	return sortedKeys(keys)
+}
+
+func decodeValue(data interface{}, v interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,203 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestChangedKeys(t *testing.T) {
+	t.Parallel()
+	current := map[string]interface{}{"a": 1.0, "b": 2.0}
+
+	for _, tt := range []struct {
+		event    Event
+		expected []string
+	}{
+		{
+			event:    Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{"c": 3.0, "a": 1.0}},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			event:    Event{Type: EventTypePut, Path: "/", Data: []interface{}{"x"}},
+			expected: []string{"0", "a", "b"},
+		},
+		{
+			event:    Event{Type: EventTypePut, Path: "/b/c", Data: 3.0},
+			expected: []string{"b"},
+		},
+		{
+			event:    Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"c/d": 3.0, "a": nil}},
+			expected: []string{"a", "c"},
+		},
+		{
+			event:    Event{Type: EventTypePatch, Path: "/a", Data: map[string]interface{}{"x": 1.0}},
+			expected: []string{"a"},
+		},
+	} {
+		assert.Equal(t, tt.expected, changedKeys(tt.event, current), "%#v", tt.event)
+	}
+}
+
+func TestSubscribeTyped(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type item struct {
+		Name string `json:"name"`
+	}
+	type change struct {
+		key     string
+		name    string
+		deleted bool
+	}
+
+	server.Set("items", map[string]interface{}{
+		"b": map[string]interface{}{"name": "second"},
+		"a": map[string]interface{}{"name": "first"},
+	})
+
+	fb := New(server.URL+"/items", nil)
+	changes := make(chan change, 10)
+	err := fb.SubscribeTyped(func() interface{} { return &item{} }, func(key string, v interface{}, deleted bool) {
+		changes <- change{key: key, name: v.(*item).Name, deleted: deleted}
+	})
+	require.NoError(t, err)
+	defer fb.StopWatching()
+
+	next := func() change {
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(250 * time.Millisecond):
+			require.FailNow(t, "did not receive a change")
+		}
+		return change{}
+	}
+
+	// the current collection is delivered in key order
+	assert.Equal(t, change{key: "a", name: "first"}, next())
+	assert.Equal(t, change{key: "b", name: "second"}, next())
+
+	server.Set("items/c", map[string]interface{}{"name": "third"})
+	assert.Equal(t, change{key: "c", name: "third"}, next())
+
+	server.Update("items/a", map[string]interface{}{"name": "renamed"})
+	assert.Equal(t, change{key: "a", name: "renamed"}, next())
+
+	// writes that do not change a child are not delivered
+	server.Update("items/c", map[string]interface{}{"name": "third"})
+	server.Delete("items/b")
+	assert.Equal(t, change{key: "b", name: "second", deleted: true}, next())
+
+	select {
+	case c := <-changes:
+		assert.FailNow(t, "unexpected change", "%#v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamInto(t *testing.T) {
+	t.Parallel()
+	snapshots := []string{
+		`{"a":{"name":"first"},"b":{"name":"second"}}`,
+		`{"a":{"name":"first","ignored":true},"b":{"name":"renamed"},"c":{"name":"third"}}`,
+		`{"b":{"name":"renamed"},"c":{"name":"third"}}`,
+	}
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := int(atomic.AddInt32(&connections, 1))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if n > len(snapshots) {
+			// the database is unreachable
+			return
+		}
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%s}\n\n", snapshots[n-1])
+		if n == 1 {
+			fmt.Fprint(w, "event: put\ndata: {\"path\":\"/b/name\",\"data\":\"renamed\"}\n\n")
+		}
+		// the connection breaks
+	}))
+	defer server.Close()
+
+	type player struct {
+		ID      string `json:"-" firego:"key"`
+		Removed bool   `json:"-" firego:"removed"`
+		Name    string `json:"name"`
+	}
+	fb := New(server.URL, nil, WithBackoff(constantBackoff(time.Millisecond)), WithMaxReconnects(1))
+	players := make(chan *player)
+	require.NoError(t, fb.StreamInto(players, func() interface{} { return &player{} }))
+	defer fb.StopWatching()
+
+	var records []player
+	for p := range players {
+		records = append(records, *p)
+	}
+	assert.Equal(t, []player{
+		{ID: "a", Name: "first"},
+		{ID: "b", Name: "second"},
+		{ID: "b", Name: "renamed"},
+		// the snapshots of the reconnects only send what changed, a
+		// change that is not decoded included
+		{ID: "a", Name: "first"},
+		{ID: "c", Name: "third"},
+		{ID: "a", Name: "first", Removed: true},
+	}, records)
+	assert.IsType(t, ErrServerClosed{}, fb.WatchErr())
+
+	assert.Error(t, fb.StreamInto(make(<-chan *player), func() interface{} { return &player{} }))
+	assert.Error(t, fb.StreamInto(player{}, func() interface{} { return &player{} }))
+}
+
+func TestStreamIntoMismatchedRecord(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type item struct {
+		Name string `json:"name"`
+	}
+	server.Set("a", map[string]interface{}{"name": "first"})
+	fb := New(server.URL, nil)
+	items := make(chan *item)
+	// the records are not of the element type of the chan
+	require.NoError(t, fb.StreamInto(items, func() interface{} { return &struct{ Name string }{} }))
+
+	select {
+	case i := <-items:
+		assert.FailNow(t, "unexpected record", "%#v", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fb.StopWatching()
+	for range items {
+	}
+}
+
+func TestStreamIntoStopWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a", map[string]interface{}{"name": "first"})
+	fns := []string{"firego.(*firebase).StreamInto.func", "firego.(*firebase).reconnectWatch", "firego.(*firebase).watch.func"}
+
+	type record struct {
+		Name string `json:"name"`
+	}
+	assertStopWithoutReceiving(t, fns, func() (Firebase, interface{}) {
+		fb := New(server.URL, nil)
+		ch := make(chan *record)
+		require.NoError(t, fb.StreamInto(ch, func() interface{} { return &record{} }))
+		return fb, ch
+	})
+}
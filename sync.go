@@ -0,0 +1,104 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Sync makes the value of the reference equal to local, the declarative
+// "make the database hold this" write of configuration tools. It reads
+// the current value, compares it with local encoded the way Set would
+// encode it, and writes only what differs, in a single multi-path update:
+// the children local adds or changes are set, recursively within the
+// objects both hold, and the ones it does not hold are removed. Nothing
+// is written when the values are already equal, and a Sync that has to
+// replace the value of the reference itself, for instance when either one
+// is not an object, sets it whole, or removes it for a nil local.
+//
+// The update is atomic once sent, every location it writes is written or
+// none is, but the read it was computed from is not part of it: the REST
+// API only offers conditional writes of whole locations, not of
+// multi-path updates. A concurrent write made between the read and the
+// update is overwritten when it touched a location the update writes, and
+// kept otherwise, leaving the value different from local. Use ReplaceIf
+// with a predicate always true to replace the whole value conditionally
+// instead, at the cost of always writing all of it.
+//
+// An update larger than the REST API accepts in a single write is not
+// sent, an ErrPayloadTooLarge is returned instead. With a write queue, see
+// WithWriteQueue, an update that could not reach Firebase is queued and
+// ErrQueued returned: it is written once flushed, after the concurrent
+// writes made in the meantime, which it may overwrite.
+func (fb *firebase) Sync(local interface{}) error {
+	b, err := fb.marshalPayload(local)
+	if err != nil {
+		return err
+	}
+	want, err := decodeTree(b)
+	if err != nil {
+		return ErrInvalidPayload{err}
+	}
+
+	c := fb.copy()
+	c.noCache = true
+	body, err := c.doRequest(context.Background(), "GET", nil)
+	if err != nil {
+		return err
+	}
+	current, err := decodeTree(body)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	syncPaths("", normalize(current), normalize(want), updates)
+	if v, ok := updates[""]; ok {
+		if v == nil {
+			return fb.Remove()
+		}
+		return fb.Set(v)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return fb.BulkImport(updates)
+}
+
+// syncPaths adds to updates the locations, relative to the reference and
+// keyed by their path, to write to turn current into want, both normalized.
+func syncPaths(path string, current, want interface{}, updates map[string]interface{}) {
+	currentObj, ok := current.(map[string]interface{})
+	wantObj, isObj := want.(map[string]interface{})
+	if !ok || !isObj {
+		if !sameValue(current, want) {
+			updates[path] = want
+		}
+		return
+	}
+
+	for k, v := range wantObj {
+		syncPaths(joinPath(path, k), currentObj[k], v, updates)
+	}
+	for k := range currentObj {
+		if _, ok := wantObj[k]; !ok {
+			updates[joinPath(path, k)] = nil
+		}
+	}
+}
+
+// sameValue reports whether a and b, decoded with decodeTree, hold the
+// same value, comparing numbers by value rather than by their JSON text.
+func sameValue(a, b interface{}) bool {
+	an, ok := a.(json.Number)
+	bn, isNum := b.(json.Number)
+	if !ok || !isNum || an == bn {
+		return reflect.DeepEqual(a, b)
+	}
+	af, err := an.Float64()
+	if err != nil {
+		return false
+	}
+	bf, err := bn.Float64()
+	return err == nil && af == bf
+}
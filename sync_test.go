@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("config", map[string]interface{}{
+		"name":    "app",
+		"version": 1,
+		"flags":   map[string]interface{}{"beta": true, "legacy": true},
+		"limits":  map[string]interface{}{"rate": 10, "burst": 20},
+		"owners":  map[string]interface{}{"alice": true},
+	})
+	server.DrainHistory()
+
+	type config struct {
+		Name    string                 `json:"name"`
+		Version int                    `json:"version"`
+		Flags   map[string]bool        `json:"flags"`
+		Limits  map[string]interface{} `json:"limits,omitempty"`
+		Region  string                 `json:"region"`
+	}
+	local := config{
+		Name:    "app",
+		Version: 2,
+		Flags:   map[string]bool{"beta": true, "dark": true},
+		Region:  "eu",
+	}
+	fb := New(server.URL+"/config", nil)
+	require.NoError(t, fb.Sync(local))
+
+	// only what differs is written, in a single update
+	history := server.DrainHistory()
+	var paths []string
+	for _, m := range history {
+		paths = append(paths, m.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"/config/version",
+		"/config/flags/dark",
+		"/config/flags/legacy",
+		"/config/limits",
+		"/config/owners",
+		"/config/region",
+	}, paths)
+
+	var synced config
+	require.NoError(t, fb.Value(&synced))
+	assert.Equal(t, local, synced)
+	assert.Nil(t, server.Get("config/owners"))
+
+	// nothing to write
+	require.NoError(t, fb.Sync(local))
+	assert.Empty(t, server.DrainHistory())
+
+	// the whole value is replaced when it is not an object
+	require.NoError(t, fb.Sync("off"))
+	assert.Equal(t, "off", server.Get("config"))
+	require.NoError(t, fb.Sync(nil))
+	assert.Nil(t, server.Get("config"))
+}
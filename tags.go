@@ -0,0 +1,208 @@
+package firego
+
+import (
+	"reflect"
+	"strings"
+)
+
+// WithTagName makes the writes of Go values and Value name the fields of
+// structs after the struct tag name instead of the json tag, such as
+//
+//	type User struct {
+//		DisplayName string `fb:"display_name"`
+//		Email       string `fb:"email,omitempty"`
+//		Password    string `fb:"-"`
+//	}
+//
+// with WithTagName("fb"). A field without the tag is named the way
+// encoding/json names it, after its json tag or else after the field. The
+// tag supports the "-" and omitempty options of the json tag, and is
+// otherwise encoded and decoded by encoding/json, so that the fields a json
+// tag leaves out with "-" stay left out. An empty name, the default, or
+// "json" uses the json tag only.
+//
+// The tag applies to values written with Set, Update, Push and the other
+// writes of Go values, and to the values decoded by Value and the reads
+// built on it. Values held by Events, Snapshots and Mirrors are encoded
+// with their json tags.
+func WithTagName(name string) Option {
+	return func(fb *firebase) {
+		fb.tagName = name
+		if name == "json" {
+			fb.tagName = ""
+		}
+	}
+}
+
+type taggedField struct {
+	jsonField
+	// name is the key of the field given by the tag
+	name string
+	// jsonName is the key of the field used by encoding/json
+	jsonName  string
+	omit      bool
+	omitEmpty bool
+}
+
+// taggedFields returns the fields of the struct type t by the name
+// encoding/json uses for them, along with the name given by tag.
+func taggedFields(t reflect.Type, tag string) map[string]taggedField {
+	fields := map[string]taggedField{}
+	for jsonName, f := range jsonFields(t) {
+		field := taggedField{jsonField: f, name: jsonName, jsonName: jsonName}
+		if value, ok := t.FieldByIndex(f.index).Tag.Lookup(tag); ok {
+			opts := strings.Split(value, ",")
+			switch {
+			case value == "-":
+				field.omit = true
+			case opts[0] != "":
+				field.name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				field.omitEmpty = field.omitEmpty || opt == "omitempty"
+			}
+		}
+		fields[jsonName] = field
+	}
+	return fields
+}
+
+// fieldByTagName finds the field a key named by the tag is decoded into,
+// matching keys to names case-insensitively the way encoding/json does.
+func fieldByTagName(fields map[string]taggedField, key string) (taggedField, bool) {
+	for _, f := range fields {
+		if !f.omit && f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if !f.omit && strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return taggedField{}, false
+}
+
+// shadowsField reports whether encoding/json would decode key into one of
+// fields, whose names are given by the tag instead.
+func shadowsField(fields map[string]taggedField, key string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(f.jsonName, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameFields renames the keys of the structs found in tree, decoded
+// with decodeTree, from the names encoding/json uses to the ones given by
+// tag when encode is set, and back otherwise. The Go type of tree is t,
+// or the type of v when v is valid, the way convertTimes follows it.
+func renameFields(tree interface{}, t reflect.Type, v reflect.Value, tag string, encode bool) interface{} {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			t, v = v.Type(), reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() {
+		t = v.Type()
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == nil:
+		return tree
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType):
+		// the type decides how it is encoded
+		return tree
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return tree
+		}
+		fields := taggedFields(t, tag)
+		renamed := make(map[string]interface{}, len(obj))
+		for k, child := range obj {
+			field, ok := fields[k]
+			if !encode {
+				field, ok = fieldByTagName(fields, k)
+			}
+			if !ok {
+				if !encode && shadowsField(fields, k) {
+					// the field is named or left out by the tag
+					continue
+				}
+				if _, ok := renamed[k]; !ok {
+					renamed[k] = child
+				}
+				continue
+			}
+			var fv reflect.Value
+			if v.IsValid() {
+				// an error leaves fv invalid, for a nil embedded pointer
+				fv, _ = v.FieldByIndexErr(field.index)
+			}
+			if field.omit || (field.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			key := field.name
+			if !encode {
+				key = field.jsonName
+			}
+			renamed[key] = renameFields(child, field.typ, fv, tag, encode)
+		}
+		return renamed
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return tree
+		}
+		for k, child := range obj {
+			var ev reflect.Value
+			if v.IsValid() && t.Key().Kind() == reflect.String {
+				ev = v.MapIndex(reflect.ValueOf(k).Convert(t.Key()))
+			}
+			obj[k] = renameFields(child, t.Elem(), ev, tag, encode)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return tree
+		}
+		for i, child := range arr {
+			var ev reflect.Value
+			if v.IsValid() && i < v.Len() {
+				ev = v.Index(i)
+			}
+			arr[i] = renameFields(child, t.Elem(), ev, tag, encode)
+		}
+	}
+	return tree
+}
+
+// isEmptyValue reports whether v is empty the way the omitempty option of
+// encoding/json defines it. An invalid v, whose value is unknown, is not.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
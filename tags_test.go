@@ -0,0 +1,74 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+type taggedAddress struct {
+	City string `fb:"city"`
+}
+
+type taggedUser struct {
+	DisplayName string `fb:"display_name" json:"displayName"`
+	Email       string `fb:"email,omitempty"`
+	Password    string `fb:"-"`
+	Age         int    `json:"age"`
+	Plain       string
+	Address     *taggedAddress           `fb:"address"`
+	Previous    []taggedAddress          `fb:"previous"`
+	ByName      map[string]taggedAddress `fb:"by_name"`
+	Joined      time.Time                `fb:"joined"`
+}
+
+func TestWithTagName(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	joined := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fb := New(server.URL, nil, WithTagName("fb"), WithEpochTimes(time.Second)).Child("user")
+	user := taggedUser{
+		DisplayName: "Alice",
+		Password:    "secret",
+		Age:         30,
+		Plain:       "plain",
+		Address:     &taggedAddress{City: "Oslo"},
+		Previous:    []taggedAddress{{City: "Bergen"}},
+		ByName:      map[string]taggedAddress{"home": {City: "Oslo"}},
+		Joined:      joined,
+	}
+	require.NoError(t, fb.Set(user))
+
+	assert.Equal(t, map[string]interface{}{
+		"display_name": "Alice",
+		"age":          30.0,
+		"Plain":        "plain",
+		"address":      map[string]interface{}{"city": "Oslo"},
+		"previous":     []interface{}{map[string]interface{}{"city": "Bergen"}},
+		"by_name":      map[string]interface{}{"home": map[string]interface{}{"city": "Oslo"}},
+		"joined":       float64(joined.Unix()),
+	}, server.Get("user"))
+
+	var read taggedUser
+	require.NoError(t, fb.Value(&read))
+	user.Password = ""
+	assert.Equal(t, user, read)
+
+	// keys named after the json tag or left out by the tag are not decoded
+	server.Set("other", map[string]interface{}{"displayName": "Bob", "Password": "secret", "email": "bob@example.com"})
+	read = taggedUser{}
+	require.NoError(t, New(server.URL, nil, WithTagName("fb")).Child("other").Value(&read))
+	assert.Equal(t, taggedUser{Email: "bob@example.com"}, read)
+
+	// without the option, the json tags apply
+	require.NoError(t, New(server.URL, nil).Child("json").Set(taggedAddress{City: "Oslo"}))
+	assert.Equal(t, map[string]interface{}{"City": "Oslo"}, server.Get("json"))
+	require.NoError(t, New(server.URL, nil, WithTagName("json")).Child("json").Set(taggedAddress{City: "Oslo"}))
+	assert.Equal(t, map[string]interface{}{"City": "Oslo"}, server.Get("json"))
+}
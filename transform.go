@@ -0,0 +1,218 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// WithFieldTransform transforms the values stored at path, such as
+// "users/$uid/ssn", when they are written and read, for example to encrypt
+// personal data on the client. path is relative to the root the way Path
+// is, and its segments starting with a $ match any key. The option can be
+// given once for every path to transform, the other values are untouched.
+//
+// Before being written by Set, Update, Push and the other writes, the
+// serialized JSON of each value at path is passed to enc and the bytes it
+// returns are stored base64 encoded as a string. Once read by Value and the
+// other reads, each value at path is decoded and passed to dec, which must
+// return the serialized JSON enc was given. Removing a value, by writing
+// null, is not transformed.
+//
+// The stored values are opaque to Firebase: queries can not order by or
+// filter on them, server values held in them are not resolved and security
+// rules can only validate that they are strings. Writes and reads inside
+// a transformed value fail, as do reads of a transformed value that is not
+// a string. The events of streams, such as Watch, and the reads of
+// ValueStream and ExportTo are not transformed.
+func WithFieldTransform(path string, enc, dec func([]byte) ([]byte, error)) Option {
+	return func(fb *firebase) {
+		fb.transforms = append(fb.transforms, fieldTransform{
+			pattern: splitPath(path),
+			enc:     enc,
+			dec:     dec,
+		})
+	}
+}
+
+// fieldTransform is a transform set with WithFieldTransform.
+type fieldTransform struct {
+	pattern  []string
+	enc, dec func([]byte) ([]byte, error)
+}
+
+// transformWrite applies the transforms of the reference to the body of
+// a write made with method.
+func (fb *firebase) transformWrite(method string, body io.Reader) (io.Reader, error) {
+	if len(fb.transforms) == 0 || body == nil || (method != "PUT" && method != "PATCH" && method != "POST") {
+		return body, nil
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeTree(b)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+
+	path := splitPath(fb.path())
+	switch method {
+	case "POST":
+		// the value is written under a key chosen by Firebase
+		tree, err = fb.transformTree(append(path, ""), tree, encryptField)
+	case "PUT":
+		tree, err = fb.transformTree(path, tree, encryptField)
+	case "PATCH":
+		children, ok := tree.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, v := range children {
+			if children[k], err = fb.transformTree(splitPath(joinPath(fb.path(), k)), v, encryptField); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err = json.Marshal(tree)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	return bytes.NewReader(b), nil
+}
+
+// transformRead applies the transforms of the reference to the body of a
+// response holding its value.
+func (fb *firebase) transformRead(body []byte) ([]byte, error) {
+	if len(fb.transforms) == 0 || fb.params.Get(shallowParam) != "" {
+		return body, nil
+	}
+	tree, err := decodeTree(body)
+	if err != nil {
+		return nil, err
+	}
+	if tree, err = fb.transformTree(splitPath(fb.path()), tree, decryptField); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// transformTree replaces the values of tree, the value at path, that
+// match the pattern of a transform with the result of convert.
+func (fb *firebase) transformTree(path []string, tree interface{}, convert func(fieldTransform, interface{}) (interface{}, error)) (interface{}, error) {
+	var err error
+	for _, t := range fb.transforms {
+		if len(t.pattern) < len(path) && matchSegments(t.pattern, path[:len(t.pattern)]) {
+			return nil, fmt.Errorf("/%s is inside the transformed value /%s", strings.Join(path, "/"), strings.Join(t.pattern, "/"))
+		}
+		if len(t.pattern) >= len(path) && matchSegments(t.pattern[:len(path)], path) {
+			if tree, err = walkPattern(tree, t.pattern[len(path):], func(v interface{}) (interface{}, error) {
+				return convert(t, v)
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tree, nil
+}
+
+// matchSegments reports whether the segments of path match those of
+// pattern, where the segments starting with a $ match any key, including
+// the empty key standing for the key of a pushed value.
+func matchSegments(pattern, path []string) bool {
+	for i, segment := range pattern {
+		if segment != path[i] && !strings.HasPrefix(segment, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// walkPattern replaces the values of tree found at pattern with the result
+// of convert, except for the missing ones.
+func walkPattern(tree interface{}, pattern []string, convert func(interface{}) (interface{}, error)) (interface{}, error) {
+	if tree == nil {
+		return nil, nil
+	}
+	if len(pattern) == 0 {
+		return convert(tree)
+	}
+
+	var err error
+	wildcard := strings.HasPrefix(pattern[0], "$")
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		for k, v := range node {
+			if (wildcard && !strings.HasPrefix(k, ".")) || k == pattern[0] {
+				if node[k], err = walkPattern(v, pattern[1:], convert); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case []interface{}:
+		for i, v := range node {
+			if wildcard || strconv.Itoa(i) == pattern[0] {
+				if node[i], err = walkPattern(v, pattern[1:], convert); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return tree, nil
+}
+
+// encryptField replaces v with the base64 encoded result of the enc of t.
+func encryptField(t fieldTransform, v interface{}) (interface{}, error) {
+	return withPriority(v, func(v interface{}) (interface{}, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, ErrInvalidPayload{err}
+		}
+		if b, err = t.enc(b); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	})
+}
+
+// decryptField replaces v with the value returned by the dec of t.
+func decryptField(t fieldTransform, v interface{}) (interface{}, error) {
+	return withPriority(v, func(v interface{}) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("the transformed value is a %T, not a string", v)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = t.dec(b); err != nil {
+			return nil, err
+		}
+		return decodeTree(b)
+	})
+}
+
+// withPriority applies convert to v, or to the value of v if v is a value
+// with a priority.
+func withPriority(v interface{}, convert func(interface{}) (interface{}, error)) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	value, hasValue := m[".value"]
+	if !ok || !hasValue {
+		return convert(v)
+	}
+	value, err := convert(value)
+	if err != nil {
+		return nil, err
+	}
+	m[".value"] = value
+	return m, nil
+}
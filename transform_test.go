@@ -0,0 +1,100 @@
+package firego
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+// xor is a reversible transform standing for an encryption.
+func xor(b []byte) ([]byte, error) {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		out[i] = c ^ 0x5a
+	}
+	return out, nil
+}
+
+func encrypted(t *testing.T, v string) string {
+	b, err := xor([]byte(v))
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestWithFieldTransform(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithFieldTransform("users/$uid/ssn", xor, xor))
+	users := fb.Child("users")
+
+	// writes
+	require.NoError(t, users.Child("alice").Set(map[string]interface{}{"name": "alice", "ssn": "123-45-6789"}))
+	require.NoError(t, users.Update(map[string]interface{}{"bob/ssn": 987654321, "bob/name": "bob"}))
+	carol, err := users.Push(map[string]interface{}{"ssn": map[string]interface{}{"area": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"alice":     map[string]interface{}{"name": "alice", "ssn": encrypted(t, `"123-45-6789"`)},
+		"bob":       map[string]interface{}{"name": "bob", "ssn": encrypted(t, `987654321`)},
+		carol.Key(): map[string]interface{}{"ssn": encrypted(t, `{"area":1}`)},
+	}, server.Get("users"))
+
+	// reads
+	var v interface{}
+	require.NoError(t, users.Value(&v))
+	assert.Equal(t, map[string]interface{}{
+		"alice":     map[string]interface{}{"name": "alice", "ssn": "123-45-6789"},
+		"bob":       map[string]interface{}{"name": "bob", "ssn": 987654321.0},
+		carol.Key(): map[string]interface{}{"ssn": map[string]interface{}{"area": 1.0}},
+	}, v)
+	var ssn string
+	require.NoError(t, users.Child("alice/ssn").Value(&ssn))
+	assert.Equal(t, "123-45-6789", ssn)
+
+	// conditional writes see the values read
+	ok, err := users.Child("alice/ssn").ReplaceIf(func(current interface{}) bool {
+		return current == "123-45-6789"
+	}, "000-00-0000")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, encrypted(t, `"000-00-0000"`), server.Get("users/alice/ssn"))
+
+	// removals are not transformed
+	require.NoError(t, users.Child("bob/ssn").Remove())
+	assert.Nil(t, server.Get("users/bob/ssn"))
+
+	// other locations are untouched
+	require.NoError(t, fb.Child("ssn").Set("public"))
+	assert.Equal(t, "public", server.Get("ssn"))
+}
+
+func TestWithFieldTransformErrors(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	errDecrypt := errors.New("wrong key")
+	fb := New(server.URL, nil, WithFieldTransform("secret", xor, func([]byte) ([]byte, error) {
+		return nil, errDecrypt
+	}))
+
+	// the transformed value can not be partially written or read
+	assert.Error(t, fb.Child("secret/part").Set(1))
+	assert.Error(t, fb.Update(map[string]interface{}{"secret/part": 1}))
+	var v interface{}
+	assert.Error(t, fb.Child("secret/part").Value(&v))
+
+	require.NoError(t, fb.Child("secret").Set("value"))
+	assert.Equal(t, errDecrypt, fb.Value(&v))
+
+	// values that were not transformed fail to be read
+	server.Set("secret", 42)
+	assert.Error(t, fb.Child("secret").Value(&v))
+}
@@ -0,0 +1,43 @@
+package firego
+
+// TypedRef reads the value of a reference into a new value obtained from
+// its factory every time, so that call sites reading the same shape
+// repeatedly do not allocate the value to decode into themselves:
+//
+//	alice := ref.Child("users/alice").Typed(func() interface{} { return &User{} })
+//	v, err := alice.Get()
+//	user := v.(*User)
+//
+// A TypedRef is safe for concurrent use as long as its factory is.
+type TypedRef struct {
+	ref     *firebase
+	factory func() interface{}
+}
+
+// Typed returns a TypedRef reading the value of the reference into the
+// values made by factory, which must return a new non-nil pointer every
+// time it is called. The reads are made with the options of the
+// reference, such as WithTagName or WithLenientDecode.
+func (fb *firebase) Typed(factory func() interface{}) *TypedRef {
+	return &TypedRef{ref: fb, factory: factory}
+}
+
+// Ref returns the reference the TypedRef reads.
+func (r *TypedRef) Ref() Firebase {
+	return r.ref
+}
+
+// Get reads the value of the reference, like Value does, into a new value
+// obtained from the factory and returns it. A reference holding no value
+// decodes as null, leaving the new value as the factory made it; use
+// ValueOr on the reference to tell a missing value apart. The value is
+// returned along with the error when the error is DecodeWarnings, which
+// leaves it decoded apart from the fields listed, and is nil otherwise.
+func (r *TypedRef) Get() (interface{}, error) {
+	v := r.factory()
+	err := r.ref.Value(v)
+	if _, ok := err.(DecodeWarnings); err != nil && !ok {
+		return nil, err
+	}
+	return v, err
+}
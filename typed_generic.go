@@ -0,0 +1,104 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+// Ref is a reference whose value is of type T: its reads decode into a T
+// and its writes only accept one, so that the applications with a fixed
+// schema have the compiler check what TypedRef and the interface{} methods
+// of Firebase leave to runtime:
+//
+//	alice := firego.Typed[User](ref.Child("users/alice"))
+//	user, err := alice.Value()
+//
+// The requests are made with the reference and its options, such as
+// WithTagName or WithLenientDecode. It requires Go 1.18.
+type Ref[T any] struct {
+	fb Firebase
+}
+
+// TypedEvent is the value of a reference watched with Ref.Watch after an
+// event changed it.
+type TypedEvent[T any] struct {
+	// Value is the whole value of the reference, decoded into a T.
+	Value T
+	// Err is the error decoding the value, which is then decoded as far as
+	// it could be.
+	Err error
+}
+
+// Typed returns the Ref of type T for fb.
+func Typed[T any](fb Firebase) Ref[T] {
+	return Ref[T]{fb: fb}
+}
+
+// Firebase returns the reference the Ref reads and writes, for the
+// operations, such as Child or StopWatching, Ref does not offer.
+func (r Ref[T]) Firebase() Firebase {
+	return r.fb
+}
+
+// Value reads the value of the reference, like Firebase.Value does. A
+// reference holding no value decodes as null, into the zero T. The value
+// is returned along with the error when the error is DecodeWarnings, and
+// is the zero T otherwise.
+func (r Ref[T]) Value() (T, error) {
+	var v T
+	err := r.fb.Value(&v)
+	if _, ok := err.(DecodeWarnings); err != nil && !ok {
+		var zero T
+		return zero, err
+	}
+	return v, err
+}
+
+// Set sets the value of the reference to v, like Firebase.Set does.
+func (r Ref[T]) Set(v T) error {
+	return r.fb.Set(v)
+}
+
+// Push creates a new child of the reference holding v, like Firebase.Push
+// does, and returns the Ref of type T of the child.
+func (r Ref[T]) Push(v T) (Ref[T], error) {
+	child, err := r.fb.Push(v)
+	if child == nil {
+		return Ref[T]{}, err
+	}
+	return Ref[T]{fb: child}, err
+}
+
+// Watch watches the reference and sends its whole value, decoded into a T,
+// to values every time an event changes it, starting with the initial
+// value, until the watch is stopped with StopWatching on the reference
+// returned by Firebase, at which point values is closed. The value is kept
+// up to date locally with a Mirror, so an event changing a single child
+// does not read the whole value again, and it is decoded the way
+// json.Unmarshal does, without the decoding options of the reference.
+// Events that change nothing, and the events not about the value, such as
+// EventTypeAuthRevoked, are not sent.
+func (r Ref[T]) Watch(values chan TypedEvent[T]) error {
+	notifications := make(chan Event)
+	m, err := r.fb.Mirror(notifications, true)
+	if err != nil {
+		return err
+	}
+
+	var stop <-chan struct{}
+	if fb, ok := r.fb.(*firebase); ok {
+		stop = fb.watchStopped()
+	}
+	go func() {
+		defer close(values)
+		for event := range notifications {
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				continue
+			}
+			var v T
+			err := m.Value(&v)
+			if !sendOrStop(values, TypedEvent[T]{Value: v, Err: err}, stop) {
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,102 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestGenericRef(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	fb := New(server.URL, nil)
+	ref := fb.Child("users/alice")
+	alice := Typed[user](ref)
+	assert.Equal(t, ref, alice.Firebase())
+
+	require.NoError(t, alice.Set(user{Name: "alice", Age: 30}))
+	v, err := alice.Value()
+	require.NoError(t, err)
+	assert.Equal(t, user{Name: "alice", Age: 30}, v)
+
+	v, err = Typed[user](fb.Child("users/bob")).Value()
+	require.NoError(t, err)
+	assert.Equal(t, user{}, v)
+
+	server.Set("users/carol", "not a user")
+	_, err = Typed[user](fb.Child("users/carol")).Value()
+	assert.Error(t, err)
+
+	bob, err := Typed[user](fb.Child("users")).Push(user{Name: "bob"})
+	require.NoError(t, err)
+	v, err = bob.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "bob", v.Name)
+}
+
+func TestGenericRefWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{"name": "alice", "age": 30})
+
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	alice := Typed[user](New(server.URL, nil).Child("users/alice"))
+	values := make(chan TypedEvent[user])
+	require.NoError(t, alice.Watch(values))
+
+	next := func() TypedEvent[user] {
+		select {
+		case e := <-values:
+			return e
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no value received")
+		}
+		return TypedEvent[user]{}
+	}
+	assert.Equal(t, TypedEvent[user]{Value: user{Name: "alice", Age: 30}}, next())
+	server.Set("users/alice/age", 31)
+	assert.Equal(t, TypedEvent[user]{Value: user{Name: "alice", Age: 31}}, next())
+	server.Set("users/alice/age", "old")
+	assert.Error(t, next().Err)
+
+	alice.Firebase().StopWatching()
+	for range values {
+	}
+}
+
+func TestGenericRefStopWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("alice", map[string]interface{}{"name": "Alice"})
+	fns := []string{"firego.Ref[...].Watch.func", "firego.(*firebase).startMirror.func", "firego.(*firebase).watch.func"}
+
+	type user struct {
+		Name string `json:"name"`
+	}
+	assertStopWithoutReceiving(t, fns, func() (Firebase, interface{}) {
+		alice := Typed[user](New(server.URL+"/alice", nil))
+		values := make(chan TypedEvent[user])
+		require.NoError(t, alice.Watch(values))
+		return alice.Firebase(), values
+	})
+}
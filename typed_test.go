@@ -0,0 +1,53 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestTypedRef(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	server.Set("users/alice", map[string]interface{}{"name": "alice", "age": 30})
+	ref := New(server.URL, nil).Child("users/alice")
+	alice := ref.Typed(func() interface{} { return &user{} })
+	assert.Equal(t, ref, alice.Ref())
+
+	v, err := alice.Get()
+	require.NoError(t, err)
+	assert.Equal(t, &user{Name: "alice", Age: 30}, v)
+
+	// every read gets a new value
+	first := v.(*user)
+	server.Set("users/alice/age", 31)
+	v, err = alice.Get()
+	require.NoError(t, err)
+	assert.Equal(t, 31, v.(*user).Age)
+	assert.Equal(t, 30, first.Age)
+
+	// a missing value leaves the value as made
+	v, err = New(server.URL, nil).Child("users/bob").Typed(func() interface{} { return &user{Age: -1} }).Get()
+	require.NoError(t, err)
+	assert.Equal(t, &user{Age: -1}, v)
+
+	// with the options of the reference
+	server.Set("users/carol", map[string]interface{}{"name": "carol", "age": "old"})
+	lenient := New(server.URL, nil, WithLenientDecode(true)).Child("users/carol")
+	v, err = lenient.Typed(func() interface{} { return &user{} }).Get()
+	assert.IsType(t, DecodeWarnings{}, err)
+	assert.Equal(t, &user{Name: "carol"}, v)
+
+	v, err = New(server.URL, nil).Child("users/carol").Typed(func() interface{} { return &user{} }).Get()
+	assert.Error(t, err)
+	assert.Nil(t, v)
+}
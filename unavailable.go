@@ -0,0 +1,58 @@
+package firego
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// ErrDatabaseUnavailable is the error returned when Firebase responds that
+// the database does not exist, because it was deleted or its URL is wrong,
+// or that it was disabled by its owner. Unlike other failures, it is not
+// worth retrying: the requests are not retried with WithRetry and the
+// watches reconnecting on their own, such as GetAndWatch and the event
+// functions set with ChildAdded, give up on it.
+type ErrDatabaseUnavailable struct {
+	// Err is the ErrHTTP of the response.
+	Err error
+}
+
+func (e ErrDatabaseUnavailable) Error() string {
+	return "database unavailable, it was deleted or disabled or its URL is wrong: " + e.Err.Error()
+}
+
+// Unwrap returns the ErrHTTP of the response.
+func (e ErrDatabaseUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// databaseUnavailablePattern matches the messages of the responses for a
+// database that is gone, such as "Firebase error. Please ensure that you
+// have the URL of your Firebase Realtime Database instance configured
+// correctly." or "The Firebase database 'acme' has been disabled by a
+// database owner."
+var databaseUnavailablePattern = regexp.MustCompile(`(?i)URL of your Firebase Realtime Database|database.*\b(not found|disabled|deactivated|deleted)\b`)
+
+// databaseUnavailable returns the ErrDatabaseUnavailable for err when it
+// is Firebase responding that the database is gone, err otherwise.
+// Firebase reports unknown databases with a 404 and disabled ones with a
+// 423, explaining so in the message of the response: both are required,
+// since the error stops the watches for good.
+func databaseUnavailable(err error) error {
+	e, ok := err.(ErrHTTP)
+	if !ok {
+		return err
+	}
+	if e.StatusCode != http.StatusNotFound && e.StatusCode != http.StatusLocked {
+		return err
+	}
+	if !databaseUnavailablePattern.MatchString(e.Message) {
+		return err
+	}
+	return ErrDatabaseUnavailable{Err: e}
+}
+
+// isDatabaseUnavailable reports whether err is an ErrDatabaseUnavailable.
+func isDatabaseUnavailable(err error) bool {
+	_, ok := err.(ErrDatabaseUnavailable)
+	return ok
+}
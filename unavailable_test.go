@@ -0,0 +1,139 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	deletedDatabase  = `{"error":"Firebase error. Please ensure that you have the URL of your Firebase Realtime Database instance configured correctly."}`
+	disabledDatabase = `{"error":"The Firebase database 'acme' has been disabled by a database owner."}`
+)
+
+func TestDatabaseUnavailable(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		status      int
+		body        string
+		unavailable bool
+	}{
+		{http.StatusNotFound, deletedDatabase, true},
+		{http.StatusLocked, disabledDatabase, true},
+		{http.StatusLocked, ``, false},
+		{http.StatusLocked, `{"error":"Locked"}`, false},
+		{http.StatusInternalServerError, disabledDatabase, false},
+		{http.StatusNotFound, `{"error":"Database not found"}`, true},
+		{http.StatusNotFound, `404 page not found`, false},
+		{http.StatusUnauthorized, `{"error":"Permission denied"}`, false},
+		{http.StatusInternalServerError, `{"error":"Internal server error."}`, false},
+	} {
+		err := databaseUnavailable(newHTTPError(test.status, []byte(test.body)))
+		if !test.unavailable {
+			assert.IsType(t, ErrHTTP{}, err, "%d %s", test.status, test.body)
+			continue
+		}
+		require.IsType(t, ErrDatabaseUnavailable{}, err, "%d %s", test.status, test.body)
+		var httpErr ErrHTTP
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, test.status, httpErr.StatusCode)
+	}
+
+	boom := errors.New("boom")
+	assert.Equal(t, boom, databaseUnavailable(boom))
+}
+
+func TestDatabaseUnavailableResponse(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, deletedDatabase, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithRetry(3, time.Millisecond))
+	var v interface{}
+	err := fb.Value(&v)
+	assert.IsType(t, ErrDatabaseUnavailable{}, err)
+	assert.EqualError(t, err, "database unavailable, it was deleted or disabled or its URL is wrong: 404 Not Found: Firebase error. Please ensure that you have the URL of your Firebase Realtime Database instance configured correctly.")
+	assert.IsType(t, ErrDatabaseUnavailable{}, fb.Set(true))
+	// never retried
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	assert.IsType(t, ErrDatabaseUnavailable{}, fb.Watch(make(chan Event)))
+	assert.False(t, fb.IsWatching())
+}
+
+// deletedAfterFirstStream is a server streaming a single put event, after
+// which the database is deleted.
+func deletedAfterFirstStream(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(requests, 1) > 1 {
+			http.Error(w, deletedDatabase, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		w.(http.Flusher).Flush()
+	}))
+}
+
+func TestGetAndWatchDatabaseUnavailable(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := deletedAfterFirstStream(&requests)
+	defer server.Close()
+
+	// reconnects are not limited
+	fb := New(server.URL, nil, WithBackoff(&recordingBackoff{}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.GetAndWatch(notifications))
+	defer fb.StopWatching()
+
+	var events []Event
+	for event := range notifications {
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, EventTypeError, events[1].Type)
+	assert.IsType(t, ErrDatabaseUnavailable{}, events[1].Data)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestEventFuncDatabaseUnavailable(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := deletedAfterFirstStream(&requests)
+	defer server.Close()
+
+	l := &testLogger{}
+	fb := New(server.URL, nil, WithLogger(l), WithBackoff(&recordingBackoff{}))
+	fb.(*firebase).watchHeartbeat = time.Millisecond
+
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, fb.ChildAdded(fn))
+	defer fb.RemoveEventFunc(fn)
+
+	assert.Eventually(t, func() bool {
+		for _, e := range l.streamEvents() {
+			if e.event.Type == StreamClosed && isDatabaseUnavailable(e.event.Err) {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	fb.(*firebase).eventMtx.Lock()
+	assert.Empty(t, fb.(*firebase).eventFuncs)
+	fb.(*firebase).eventMtx.Unlock()
+}
@@ -0,0 +1,91 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrURLTooLong is the error returned for a request whose URL, query
+// parameters included, is longer than the limit set with
+// WithMaxURLLength, before it is sent, or longer than Firebase or a proxy
+// on the way accepts, when it responded with a 414. Long URLs typically
+// come from large EqualTo, StartAt or EndAt values or from deep OrderBy
+// paths, which have to be shortened since queries can only be sent in the
+// URL.
+type ErrURLTooLong struct {
+	// Length is the length of the URL, in bytes.
+	Length int
+	// Limit is the limit set with WithMaxURLLength, 0 when the URL was
+	// rejected by the server.
+	Limit int
+	// Err is the ErrHTTP of the response rejecting the URL, nil when
+	// the request was not sent.
+	Err error
+}
+
+func (e ErrURLTooLong) Error() string {
+	if e.Limit == 0 {
+		return fmt.Sprintf("URL of %d bytes rejected as too long, shorten the query parameters", e.Length)
+	}
+	return fmt.Sprintf("URL of %d bytes exceeds the limit of %d bytes, shorten the query parameters", e.Length, e.Limit)
+}
+
+// Unwrap returns the ErrHTTP of the response rejecting the URL.
+func (e ErrURLTooLong) Unwrap() error {
+	return e.Err
+}
+
+// WithMaxURLLength sets the longest URL, in bytes and query parameters
+// included, of the requests made, which fail with an ErrURLTooLong
+// instead of being sent when their URL is longer, the way servers and
+// proxies limiting URLs reject them with an opaque 414. A limit of 0, the
+// default, sends every request.
+//
+// A URL that is too long only because of the access token sent in the
+// access_token query parameter is sent with the token in an
+// "Authorization: Bearer" header instead, as WithAuthInHeader sends it.
+// The query parameters themselves can not be moved: the REST API only
+// reads queries from the URL, an X-HTTP-Method-Override header only
+// changes the method of a POST.
+func WithMaxURLLength(n int) Option {
+	return func(fb *firebase) {
+		fb.maxURLLength = n
+	}
+}
+
+// checkURLLength returns an ErrURLTooLong for req, once authorized, when
+// its URL is longer than the limit of the reference, moving the access
+// token into a header first if that is enough to shorten it.
+func (fb *firebase) checkURLLength(req *http.Request) error {
+	if fb.maxURLLength <= 0 {
+		return nil
+	}
+	length := len(req.URL.String())
+	if length <= fb.maxURLLength {
+		return nil
+	}
+
+	q := req.URL.Query()
+	if token := q.Get(accessTokenParam); token != "" {
+		q.Del(accessTokenParam)
+		u := *req.URL
+		u.RawQuery = q.Encode()
+		if len(u.String()) <= fb.maxURLLength {
+			req.URL = &u
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		}
+	}
+	return ErrURLTooLong{Length: length, Limit: fb.maxURLLength}
+}
+
+// urlTooLong returns the ErrURLTooLong of a request whose URL is length
+// bytes long for err when it is the server rejecting the URL with a 414,
+// err otherwise.
+func urlTooLong(err error, length int) error {
+	e, ok := err.(ErrHTTP)
+	if !ok || e.StatusCode != http.StatusRequestURITooLong {
+		return err
+	}
+	return ErrURLTooLong{Length: length, Err: e}
+}
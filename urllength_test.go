@@ -0,0 +1,96 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestWithMaxURLLength(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`{}`)
+	defer server.Close()
+
+	const limit = 2048
+	fb := New(server.URL, nil, WithMaxURLLength(limit))
+	query := func(n int) Firebase {
+		return fb.Child("users").OrderBy("name").EqualTo(strings.Repeat("x", n))
+	}
+	sent := func(i int) string {
+		req := server.receivedReqs[i]
+		return "http://" + req.Host + req.URL.String()
+	}
+	var v map[string]interface{}
+	require.NoError(t, query(1).Value(&v))
+	base := len(sent(0)) - 1
+
+	// right at the limit
+	require.NoError(t, query(limit-base).Value(&v))
+	require.Len(t, server.receivedReqs, 2)
+	assert.Len(t, sent(1), limit)
+
+	// one byte over
+	err := query(limit - base + 1).Value(&v)
+	require.IsType(t, ErrURLTooLong{}, err)
+	assert.Equal(t, ErrURLTooLong{Length: limit + 1, Limit: limit}, err)
+	assert.EqualError(t, err, "URL of 2049 bytes exceeds the limit of 2048 bytes, shorten the query parameters")
+	assert.Len(t, server.receivedReqs, 2)
+
+	// no limit by default
+	require.NoError(t, New(server.URL, nil).Child("users").OrderBy("name").EqualTo(strings.Repeat("x", 2*limit)).Value(&v))
+	assert.Len(t, server.receivedReqs, 3)
+}
+
+func TestWithMaxURLLengthAccessToken(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(`{}`)
+	defer server.Close()
+
+	token := strings.Repeat("t", 500)
+	fb := New(server.URL, nil, WithMaxURLLength(len(server.URL)+300))
+	fb.AuthWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+
+	// short enough with the token
+	require.NoError(t, fb.Child("a").Set(true))
+	require.NoError(t, fb.Child("b").Set(true))
+	require.Len(t, server.receivedReqs, 2)
+
+	// the token is moved into a header
+	var v map[string]interface{}
+	require.NoError(t, fb.OrderBy("name").EqualTo("alice").Value(&v))
+	require.Len(t, server.receivedReqs, 3)
+	req := server.receivedReqs[2]
+	assert.Equal(t, "Bearer "+token, req.Header.Get("Authorization"))
+	assert.Empty(t, req.URL.Query().Get(accessTokenParam))
+	assert.Equal(t, `"alice"`, req.URL.Query().Get(equalToParam))
+
+	// unless moving it is not enough
+	err := fb.OrderBy("name").EqualTo(strings.Repeat("x", 300)).Value(&v)
+	assert.IsType(t, ErrURLTooLong{}, err)
+	assert.Len(t, server.receivedReqs, 3)
+}
+
+func TestURLTooLongResponse(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusRequestURITooLong)
+		w.Write([]byte("<html>414 Request-URI Too Large</html>"))
+	}))
+	defer server.Close()
+
+	var v interface{}
+	fb := New(server.URL, nil).EqualTo(strings.Repeat("x", 100))
+	err := fb.Value(&v)
+	require.IsType(t, ErrURLTooLong{}, err)
+	assert.Greater(t, err.(ErrURLTooLong).Length, 100)
+	assert.Zero(t, err.(ErrURLTooLong).Limit)
+	var httpErr ErrHTTP
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusRequestURITooLong, httpErr.StatusCode)
+}
@@ -0,0 +1,168 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Snapshot is an immutable value read from Firebase, which can be shared
+// among goroutines without being copied or guarded. Its accessors decode
+// a new copy of the value every time they are called, so that modifying
+// what they return leaves the Snapshot untouched. The zero Snapshot holds
+// no value.
+//
+// The children of a Snapshot are kept in the order of the document they
+// were decoded from, and ValueSnapshot orders those of the reference the
+// way ValueSlice does, so that enumerating them with Keys is stable.
+type Snapshot struct {
+	key  string
+	node *snapshotNode
+}
+
+// snapshotNode is a value of a Snapshot, along with its children
+// when it is an object or an array.
+type snapshotNode struct {
+	raw      json.RawMessage
+	keys     []string
+	children map[string]*snapshotNode
+}
+
+// ValueSnapshot reads the value of the reference into a Snapshot.
+func (fb *firebase) ValueSnapshot() (Snapshot, error) {
+	body, err := fb.cachedValue(context.Background())
+	if err != nil {
+		return Snapshot{}, err
+	}
+	node, err := newSnapshotNode(body)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := orderSnapshotNode(node, strings.Trim(fb.params.Get(orderByParam), `"`)); err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{key: fb.Key(), node: node}, nil
+}
+
+// Snapshot returns the data of a put or patch event as a Snapshot keyed by
+// the last segment of the Path of the event.
+func (e Event) Snapshot() (Snapshot, error) {
+	raw := append([]byte(nil), e.snapshot...)
+	if e.snapshot == nil {
+		var data struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(e.rawData, &data); err != nil {
+			return Snapshot{}, err
+		}
+		raw = data.Data
+	}
+	node, err := newSnapshotNode(raw)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{key: e.Path[strings.LastIndex(e.Path, "/")+1:], node: node}, nil
+}
+
+// newSnapshotNode decodes the value raw holds, keeping the order of its
+// children. raw is retained and must not be modified.
+func newSnapshotNode(raw []byte) (*snapshotNode, error) {
+	node := &snapshotNode{raw: bytes.TrimSpace(raw)}
+	if len(node.raw) == 0 || (node.raw[0] != '{' && node.raw[0] != '[') {
+		var v json.RawMessage
+		if err := json.Unmarshal(node.raw, &v); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	node.children = map[string]*snapshotNode{}
+	err := streamChildren(json.NewDecoder(bytes.NewReader(node.raw)), func(entry OrderedEntry) error {
+		child, err := newSnapshotNode(entry.Value)
+		if err != nil {
+			return err
+		}
+		if string(child.raw) != "null" {
+			node.keys = append(node.keys, entry.Key)
+			node.children[entry.Key] = child
+		}
+		return nil
+	})
+	return node, err
+}
+
+// orderSnapshotNode orders the children of node the way the database
+// orders query results ordered by orderBy, keeping the order they were
+// returned in when they are ordered by priority.
+func orderSnapshotNode(node *snapshotNode, orderBy string) error {
+	if orderBy == "$priority" || node.children == nil {
+		return nil
+	}
+	children := make(map[string]interface{}, len(node.keys))
+	for _, key := range node.keys {
+		var child interface{}
+		if err := json.Unmarshal(node.children[key].raw, &child); err != nil {
+			return err
+		}
+		children[key] = child
+	}
+	node.keys = orderChildren(children, orderBy)
+	return nil
+}
+
+// Key returns the key of the location the Snapshot was read from, empty
+// for the root.
+func (s Snapshot) Key() string {
+	return s.key
+}
+
+// Exists reports whether the Snapshot holds a value.
+func (s Snapshot) Exists() bool {
+	return s.node != nil && string(s.node.raw) != "null"
+}
+
+// Value decodes the value of the Snapshot into v the way json.Unmarshal
+// does. A Snapshot holding no value decodes as null.
+func (s Snapshot) Value(v interface{}) error {
+	if !s.Exists() {
+		return json.Unmarshal([]byte("null"), v)
+	}
+	return json.Unmarshal(s.node.raw, v)
+}
+
+// Get returns the value found at the slash separated path relative to the
+// Snapshot, decoded into an interface{}, and whether there is one.
+func (s Snapshot) Get(path string) (interface{}, bool) {
+	child := s.Child(path)
+	if !child.Exists() {
+		return nil, false
+	}
+	var v interface{}
+	if err := child.Value(&v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// Child returns the Snapshot of the value found at the slash separated
+// path relative to the Snapshot, which holds no value if there is none.
+func (s Snapshot) Child(path string) Snapshot {
+	node, key := s.node, s.key
+	for _, segment := range splitPath(path) {
+		if node != nil {
+			node = node.children[segment]
+		}
+		key = segment
+	}
+	return Snapshot{key: key, node: node}
+}
+
+// Keys returns the keys of the children of the Snapshot in order, none
+// if it is not an object or an array.
+func (s Snapshot) Keys() []string {
+	if s.node == nil {
+		return nil
+	}
+	return append([]string(nil), s.node.keys...)
+}
@@ -0,0 +1,115 @@
+package firego
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestValueSnapshot(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("scores", map[string]interface{}{
+		"carol": map[string]interface{}{"score": 3, "name": "Carol"},
+		"alice": map[string]interface{}{"score": 7, "name": "Alice"},
+		"bob":   map[string]interface{}{"score": 5, "name": "Bob"},
+	})
+	fb := New(server.URL+"/scores", nil)
+
+	snapshot, err := fb.ValueSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, "scores", snapshot.Key())
+	assert.True(t, snapshot.Exists())
+	assert.Equal(t, []string{"alice", "bob", "carol"}, snapshot.Keys())
+
+	v, ok := snapshot.Get("bob/name")
+	assert.True(t, ok)
+	assert.Equal(t, "Bob", v)
+	_, ok = snapshot.Get("dave/name")
+	assert.False(t, ok)
+
+	bob := snapshot.Child("bob")
+	assert.Equal(t, "bob", bob.Key())
+	var player struct {
+		Score int    `json:"score"`
+		Name  string `json:"name"`
+	}
+	require.NoError(t, bob.Value(&player))
+	assert.Equal(t, 5, player.Score)
+
+	missing := snapshot.Child("dave/name")
+	assert.Equal(t, "name", missing.Key())
+	assert.False(t, missing.Exists())
+	assert.Empty(t, missing.Keys())
+
+	// the children of queries are kept in order
+	snapshot, err = fb.OrderBy("score").ValueSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol", "bob", "alice"}, snapshot.Keys())
+
+	// modifying what is returned leaves the snapshot untouched
+	v, _ = snapshot.Get("alice")
+	v.(map[string]interface{})["score"] = 0
+	keys := snapshot.Keys()
+	keys[0] = "changed"
+	v, _ = snapshot.Get("alice/score")
+	assert.Equal(t, 7.0, v)
+	assert.Equal(t, []string{"carol", "bob", "alice"}, snapshot.Keys())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range snapshot.Keys() {
+				_, ok := snapshot.Child(key).Get("score")
+				assert.True(t, ok)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// a missing value
+	snapshot, err = fb.Child("missing").ValueSnapshot()
+	require.NoError(t, err)
+	assert.False(t, snapshot.Exists())
+	assert.False(t, Snapshot{}.Exists())
+	var s *string
+	require.NoError(t, Snapshot{}.Value(&s))
+	assert.Nil(t, s)
+}
+
+func TestEventSnapshot(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", map[string]interface{}{"b": 1, "c": []interface{}{"x", "y"}})
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	snapshot, err := (<-notifications).Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, "", snapshot.Key())
+	v, ok := snapshot.Get("a/c/1")
+	assert.True(t, ok)
+	assert.Equal(t, "y", v)
+	assert.Equal(t, []string{"0", "1"}, snapshot.Child("a/c").Keys())
+
+	server.Set("a/b", 2)
+	snapshot, err = (<-notifications).Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, "b", snapshot.Key())
+	var b int
+	require.NoError(t, snapshot.Value(&b))
+	assert.Equal(t, 2, b)
+}
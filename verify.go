@@ -0,0 +1,160 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrWriteMismatch is returned by AssertWritten when the value read back
+// differs from the value written.
+type ErrWriteMismatch struct {
+	// Path is the location of the first difference found, relative to
+	// the reference, empty for the reference itself.
+	Path string
+	// Written is the value written at Path, nil for none.
+	Written interface{}
+	// Read is the value read back at Path, nil for none.
+	Read interface{}
+}
+
+func (e ErrWriteMismatch) Error() string {
+	return fmt.Sprintf("value read back at /%s differs from the value written: wrote %s, read %s",
+		e.Path, describeValue(e.Written), describeValue(e.Read))
+}
+
+// describeValue formats v, decoded with decodeTree, as JSON.
+func describeValue(v interface{}) string {
+	if v == nil {
+		return "no value"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// AssertWritten sets the value of the reference to v like Set does, then
+// reads it back, bypassing the read cache and asking HTTP caches not to
+// answer, and compares what was read with what was written. It returns
+// the error of the write or of the read, or an ErrWriteMismatch describing
+// the first difference found.
+//
+// The comparison is that of the values Firebase stores: numbers compare
+// as the doubles they are stored as, arrays as objects keyed by index, and
+// null values and empty objects, which Firebase does not store, as no
+// value. Placeholders of values computed by Firebase, such as
+// ServerTimestamp, only need a value to have been stored in their place,
+// whatever it is.
+//
+// AssertWritten is a verification helper for integration tests and
+// critical writes, such as those of configuration: it costs a read of the
+// whole value on top of the write and should not be used on hot paths. A
+// concurrent write to the reference between the two requests is reported
+// as a mismatch.
+func (fb *firebase) AssertWritten(v interface{}) error {
+	written, err := fb.marshalPayload(v)
+	if err != nil {
+		return err
+	}
+	if err := fb.Set(v); err != nil {
+		return err
+	}
+
+	c := fb.copy()
+	c.noCache = true
+	c.lastBody, c.lastETag = fb.lastBody, fb.lastETag
+	read, err := c.cachedValue(context.Background())
+	if err != nil {
+		return err
+	}
+
+	want, err := decodeTree(written)
+	if err != nil {
+		return ErrInvalidPayload{err}
+	}
+	got, err := decodeTree(read)
+	if err != nil {
+		return err
+	}
+	if path, ok := compareWritten(normalize(want), normalize(got), nil); !ok {
+		return ErrWriteMismatch{
+			Path:    strings.Join(path, "/"),
+			Written: lookup(normalize(want), path),
+			Read:    lookup(normalize(got), path),
+		}
+	}
+	return nil
+}
+
+// SetVerified sets the value of the reference to v and confirms that the
+// value stored is the one written, for critical writes that must not be
+// silently truncated or corrupted on the way, by a faulty proxy for
+// instance. It works the way AssertWritten does, reading the value back
+// after the write and comparing it with v, placeholders of values computed
+// by Firebase only needing a value in their place, and writes v once more
+// when they differ. The ErrWriteMismatch of the second attempt is
+// returned if the value still differs, the error of the write or of the
+// read if either fails.
+//
+// Every attempt costs a write and a read of the whole value: SetVerified
+// takes twice the round trips of Set when the value matches, and four when
+// it is written again, and should be kept for the writes worth it.
+func (fb *firebase) SetVerified(v interface{}) error {
+	err := fb.AssertWritten(v)
+	if _, ok := err.(ErrWriteMismatch); ok {
+		err = fb.AssertWritten(v)
+	}
+	return err
+}
+
+// compareWritten compares the value written, want, with the value read
+// back, got, both normalized, returning the path of the first difference
+// found.
+func compareWritten(want, got interface{}, path []string) ([]string, bool) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		if isServerValue(w) {
+			return path, got != nil
+		}
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := compareWritten(w[k], g[k], append(path[:len(path):len(path)], k)); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	case json.Number:
+		g, ok := got.(json.Number)
+		if !ok {
+			return path, false
+		}
+		wf, werr := w.Float64()
+		gf, gerr := g.Float64()
+		return path, werr == nil && gerr == nil && wf == gf
+	}
+	return path, want == got
+}
+
+// isServerValue reports whether v, an object decoded with decodeTree, is
+// the placeholder of a value Firebase computes, such as ServerTimestamp.
+func isServerValue(v map[string]interface{}) bool {
+	_, ok := v[".sv"]
+	return ok && len(v) == 1
+}
@@ -0,0 +1,113 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestAssertWritten(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/config", nil)
+	require.NoError(t, fb.AssertWritten(map[string]interface{}{
+		"name":      "prod",
+		"ratio":     1.0,
+		"hosts":     []string{"a", "b"},
+		"updatedAt": ServerTimestamp,
+		"empty":     map[string]interface{}{},
+		"missing":   nil,
+	}))
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "prod", v["name"])
+	assert.NotNil(t, v["updatedAt"])
+
+	require.NoError(t, fb.Child("name").AssertWritten("staging"))
+}
+
+func TestAssertWrittenMismatch(t *testing.T) {
+	t.Parallel()
+	var gets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		gets++
+		assert.Equal(t, "no-cache", req.Header.Get("Cache-Control"))
+		// a concurrent write changed the value
+		w.Write([]byte(`{"name":"prod","limits":{"rate":5},"hosts":{"0":"a"},"updatedAt":1}`))
+	}))
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	err := fb.AssertWritten(map[string]interface{}{
+		"name":      "prod",
+		"limits":    map[string]interface{}{"rate": 10},
+		"hosts":     []string{"a"},
+		"updatedAt": ServerTimestamp,
+	})
+	require.IsType(t, ErrWriteMismatch{}, err)
+	mismatch := err.(ErrWriteMismatch)
+	assert.Equal(t, "limits/rate", mismatch.Path)
+	assert.EqualError(t, err, "value read back at /limits/rate differs from the value written: wrote 10, read 5")
+
+	err = fb.AssertWritten(map[string]interface{}{
+		"name":      "prod",
+		"limits":    map[string]interface{}{"rate": 5.0},
+		"hosts":     []string{"a"},
+		"updatedAt": ServerTimestamp,
+	})
+	assert.NoError(t, err)
+
+	// children that were not written are reported
+	err = fb.AssertWritten(map[string]interface{}{
+		"name":   "prod",
+		"limits": map[string]interface{}{"rate": 5},
+		"hosts":  []string{"a"},
+	})
+	assert.EqualError(t, err, "value read back at /updatedAt differs from the value written: wrote no value, read 1")
+
+	// a placeholder needs a value
+	err = fb.AssertWritten(map[string]interface{}{
+		"name":      "prod",
+		"limits":    map[string]interface{}{"rate": 5},
+		"hosts":     []string{"a"},
+		"updatedAt": ServerTimestamp,
+		"createdAt": ServerTimestamp,
+	})
+	assert.EqualError(t, err, `value read back at /createdAt differs from the value written: wrote {".sv":"timestamp"}, read no value`)
+	assert.Equal(t, 4, gets)
+}
+
+func TestSetVerified(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	value := map[string]interface{}{"name": "prod", "updatedAt": ServerTimestamp}
+	fb := New(server.URL+"/config", nil)
+	require.NoError(t, fb.SetVerified(value))
+	assert.Len(t, server.DrainHistory(), 1)
+
+	// a corrupted read once, the value is written again
+	server.InjectFault(firetest.FaultSpec{Method: "GET", Status: http.StatusOK, Body: `{"name":"pr","updatedAt":1}`, Times: 1})
+	require.NoError(t, fb.SetVerified(value))
+	assert.Len(t, server.DrainHistory(), 2)
+
+	// every time, the mismatch is returned after the second write
+	server.InjectFault(firetest.FaultSpec{Method: "GET", Status: http.StatusOK, Body: `{"name":"pr","updatedAt":1}`})
+	err := fb.SetVerified(value)
+	require.IsType(t, ErrWriteMismatch{}, err)
+	assert.Equal(t, "name", err.(ErrWriteMismatch).Path)
+	assert.Len(t, server.DrainHistory(), 2)
+}
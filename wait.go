@@ -0,0 +1,48 @@
+package firego
+
+import "context"
+
+// WaitForValue watches the reference until pred returns true for its
+// value, starting with its current value, so that a condition that is
+// already met returns right away, and then with the value following every
+// change. The value is the one a Mirror of the reference holds, with
+// arrays as objects keyed by their index and nil for no value. It returns
+// ctx.Err() if ctx is done first, or the reason the watch ended, such as
+// ErrServerClosed, if it ended first.
+//
+// The watch is independent of the one started by Watch on the reference
+// and is stopped before WaitForValue returns.
+func (fb *firebase) WaitForValue(ctx context.Context, pred func(current interface{}) bool) error {
+	c := fb.copy()
+	events := make(chan Event)
+	if err := c.Watch(events); err != nil {
+		return err
+	}
+	defer func() {
+		c.StopWatching()
+		for range events {
+		}
+	}()
+
+	m := &Mirror{}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return c.WatchErr()
+			}
+			if err := closeReason(event); err != nil {
+				return err
+			}
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				continue
+			}
+			m.Apply(event)
+			if pred(m.value) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package firego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestWaitForValue(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("jobs/1", map[string]interface{}{"status": "pending"})
+	fb := New(server.URL+"/jobs/1", nil)
+	done := func(current interface{}) bool {
+		job, _ := current.(map[string]interface{})
+		return job["status"] == "DONE"
+	}
+
+	// a change meets the condition, the changes are made once the current
+	// value has been received
+	var once sync.Once
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, fb.WaitForValue(ctx, func(current interface{}) bool {
+		once.Do(func() {
+			go func() {
+				server.Set("jobs/1/progress", 50)
+				server.Set("jobs/1/status", "DONE")
+			}()
+		})
+		return done(current)
+	}))
+
+	// the current value meets the condition
+	require.NoError(t, fb.WaitForValue(context.Background(), done))
+	assert.Empty(t, fb.ActiveWatchers())
+
+	// the condition is never met
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, fb.WaitForValue(ctx, func(current interface{}) bool {
+		return current == nil
+	}))
+	assert.Empty(t, fb.ActiveWatchers())
+	assert.False(t, fb.IsWatching())
+}
+
+func TestWaitForValueStreamClosed(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: put\ndata: {\"path\":\"/\",\"data\":null}\n\nevent: cancel\ndata: null\n\n"))
+	}))
+	defer server.Close()
+
+	err := New(server.URL, nil).WaitForValue(context.Background(), func(interface{}) bool { return false })
+	assert.Equal(t, ErrStreamCanceled, err)
+}
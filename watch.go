@@ -3,10 +3,17 @@ package firego
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,23 +29,88 @@ const (
 	// EventTypeAuthRevoked is the event type sent when the supplied auth parameter
 	// is no longer valid.
 	EventTypeAuthRevoked = "auth_revoked"
+	// EventTypeReconnected is the event type Watch sends, with
+	// WithWatchReconnect, once it has reconnected, right before the put
+	// holding the whole value the new connection starts with. The Data of
+	// the event is the error the previous connection broke with.
+	EventTypeReconnected = "reconnected"
 
 	eventTypeKeepAlive  = "keep-alive"
 	eventTypeCancel     = "cancel"
 	eventTypeRulesDebug = "rules_debug"
 )
 
+var (
+	// ErrStreamCanceled is the reason a watch ended when the security
+	// rules of the database stopped allowing the read of the reference.
+	ErrStreamCanceled = errors.New("stream canceled, the read is no longer allowed")
+	// ErrAuthRevoked is the reason a watch ended when the credentials of
+	// the stream expired or were revoked.
+	ErrAuthRevoked = errors.New("stream closed, the credentials were revoked")
+)
+
+// ErrServerClosed is the reason a watch ended when its connection was
+// closed by Firebase or broke, it wraps the error the connection failed
+// with, such as io.EOF, or the error the read of a Poll failed with.
+type ErrServerClosed struct {
+	error
+}
+
+func (e ErrServerClosed) Error() string {
+	return "stream closed: " + e.error.Error()
+}
+
+// Unwrap returns the error the connection failed with.
+func (e ErrServerClosed) Unwrap() error {
+	return e.error
+}
+
+// closeReason returns the reason a watch ends with if event is the last
+// event sent by the watch, nil if event does not end it.
+func closeReason(event Event) error {
+	switch event.Type {
+	case EventTypeError:
+		err, ok := event.Data.(error)
+		if !ok {
+			err = fmt.Errorf("%v", event.Data)
+		}
+		return ErrServerClosed{err}
+	case eventTypeCancel:
+		return ErrStreamCanceled
+	case EventTypeAuthRevoked:
+		return ErrAuthRevoked
+	}
+	return nil
+}
+
+// isPermanentStreamError reports whether a stream refused with the given
+// status code would be refused again, the request being denied.
+func isPermanentStreamError(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
 // Event represents a notification received when watching a
 // firebase reference.
+//
+// The Data of a put event replaces the value at Path, with nil meaning the
+// value was removed. The Data of a patch event is a map to merge into the
+// value at Path instead: each of its keys, which may be a slash separated
+// path, replaces the value at that path relative to Path, and the values
+// not named in it are left untouched. Treating a patch as a replacement
+// discards those values. Mirror applies both kinds of events correctly.
 type Event struct {
 	// Type of event that was received
 	Type string
-	// Path to the data that changed
+	// Path to the data that changed, always starting with a slash and
+	// without empty segments, "/" for the root. Its keys are the keys as
+	// stored, Firebase does not escape them, a "%" being part of the key
 	Path string
-	// Data that changed
+	// Data that changed, see the type documentation for how it
+	// applies to the value at Path
 	Data interface{}
 
-	rawData []byte
+	rawData  []byte
+	snapshot json.RawMessage
 }
 
 // Value converts the raw payload of the event into the given interface.
@@ -50,8 +122,57 @@ func (e Event) Value(v interface{}) error {
 	return json.Unmarshal(e.rawData, &tmp)
 }
 
+// PathSegments returns the keys that make up the Path of the event,
+// none for the root.
+func (e Event) PathSegments() []string {
+	return splitPath(e.Path)
+}
+
+// cleanPath normalizes a path received from Firebase into the form
+// documented on Event.Path.
+func cleanPath(path string) string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
 // StopWatching stops tears down all connections that are watching.
 func (fb *firebase) StopWatching() {
+	fb.stopWatch()
+}
+
+// StopWatchingContext stops watching like StopWatching does and waits for
+// the connection to be torn down and the chan given to Watch to be closed.
+// If ctx is done first, the connection is closed forcibly, without waiting
+// any further, and ctx.Err() is returned. This bounds the time a graceful
+// shutdown spends on a stream that is wedged.
+//
+// Only the watch started by Watch, or by Poll, Mirror, SubscribeTyped and
+// ChildEvents, is waited for; event functions are stopped with
+// RemoveEventFunc.
+func (fb *firebase) StopWatchingContext(ctx context.Context) error {
+	done, abort := fb.stopWatch()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		abort()
+		return ctx.Err()
+	}
+}
+
+// stopWatch stops watching and returns the chan closed once the last watch
+// has been torn down along with the func that aborts its connection, or
+// nil if the reference never watched.
+func (fb *firebase) stopWatch() (chan struct{}, context.CancelFunc) {
 	fb.watchMtx.Lock()
 	defer fb.watchMtx.Unlock()
 
@@ -59,8 +180,66 @@ func (fb *firebase) StopWatching() {
 		// flip the bit back to not watching
 		fb.watching = false
 		// signal connection to terminal
-		fb.stopWatching <- struct{}{}
+		close(fb.watchStop)
+	}
+	return fb.watchDone, fb.watchAbort
+}
+
+// watchStopped returns the chan closed once the last watch started on the
+// reference is stopped, for the goroutines passing its events over to
+// another chan to select on: the consumer of a stopped watch may not be
+// receiving anymore.
+func (fb *firebase) watchStopped() <-chan struct{} {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	return fb.watchStop
+}
+
+// sendOrStop sends v over ch, a chan of any type, unless stop, as returned
+// by watchStopped, is closed first, and reports whether v was sent. The
+// goroutines passing the events of a watch over to another chan send with
+// it, so that none of them outlives a watch whose consumer stopped
+// receiving.
+func sendOrStop(ch, v interface{}, stop <-chan struct{}) bool {
+	cv := reflect.ValueOf(ch)
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		// a nil interface
+		rv = reflect.Zero(cv.Type().Elem())
 	}
+	i, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: cv, Send: rv},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+	})
+	return i == 0
+}
+
+// WatchErr returns why the last watch of the reference, started by Watch,
+// Poll, Mirror, SubscribeTyped or ChildEvents, ended once the chan it
+// passes its events to has been closed: ErrServerClosed if the connection
+// was closed by Firebase or broke, ErrStreamCanceled or ErrAuthRevoked if
+// Firebase ended the stream with a cancel or an auth_revoked event. It is
+// nil while the watch runs and if the watch was stopped with StopWatching,
+// which tells a clean shutdown apart from a failure.
+//
+// The event functions set with ChildAdded, ChildChanged and ChildRemoved
+// reconnect on their own and report giving up, with ErrMaxReconnects,
+// through the Logger of the reference instead.
+func (fb *firebase) WatchErr() error {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	return fb.watchErr
+}
+
+// IsWatching reports whether the reference has an active Watch, that is
+// Watch has been called, StopWatching has not been called since and the
+// watch did not end on its own, closing its chan, because the connection
+// broke or Firebase ended the stream. It is safe to call concurrently with
+// Watch and StopWatching.
+func (fb *firebase) IsWatching() bool {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	return fb.watching
 }
 
 func (fb *firebase) setWatching(v bool) {
@@ -75,45 +254,237 @@ func (fb *firebase) setWatching(v bool) {
 // Only one connection can be established at a time. The
 // second call to this function without a call to fb.StopWatching
 // will close the channel given and return nil immediately.
+//
+// By default the chan is closed as soon as the connection breaks, with
+// WatchErr telling why. With WithWatchReconnect, Watch reconnects instead
+// and keeps passing the events of the new connection over to the same
+// chan, the way GetAndWatch does.
 func (fb *firebase) Watch(notifications chan Event) error {
+	return fb.WatchWithContext(context.Background(), notifications)
+}
+
+// WatchWithContext watches the reference the way Watch does, for as long
+// as ctx is not done. Once it is, the watch is stopped as StopWatching
+// stops it, the chan is closed and WatchErr returns the error of ctx,
+// which tells a watch ended by its context apart from one stopped with
+// StopWatching. A ctx that is already done makes WatchWithContext fail
+// with the error the request failed with.
+func (fb *firebase) WatchWithContext(ctx context.Context, notifications chan Event) error {
+	if fb.watchReconnect {
+		return fb.startEventsContext(ctx, notifications, fb.reconnectingWatch(true))
+	}
+	return fb.startEventsContext(ctx, notifications, func(ctx context.Context, stop chan struct{}) (chan Event, error) {
+		return fb.watch(ctx, stop, false)
+	})
+}
+
+// WithWatchReconnect determines whether or not Watch reconnects when its
+// connection breaks, an idle connection closed by a proxy or Firebase
+// closing the stream for instance, instead of closing its chan.
+//
+// Watch then reconnects after the delays of WithBackoff, or twice the
+// heartbeat doubling after every failed attempt, and passes the events of
+// the new connection over to the same chan, after a reconnected event
+// telling why the previous one broke. The first event of every
+// connection is a put at "/" holding the whole value of the reference,
+// which tells the consumer to replace the value it holds, along with the
+// changes it missed while disconnected. The keep-alive events Firebase
+// sends are never passed over, they only keep the connection from being
+// considered dead by the heartbeat.
+//
+// An auth_revoked event, sent when the token the stream was opened with
+// expires, is followed by a reconnect with a new token on a reference
+// authenticated with AuthWithTokenSource, once the token source gives
+// one. Watch gives up after the number of consecutive failed reconnects
+// set with WithMaxReconnects, if any, or at once when the error cannot be
+// fixed by reconnecting: a 401 or a 403 response, an
+// ErrDatabaseUnavailable, a cancel event, or an auth_revoked event with
+// no new token to reconnect with. The chan is then closed and WatchErr
+// returns the error the last connection failed with, wrapped in an
+// ErrMaxReconnects when the reconnects were exhausted.
+func WithWatchReconnect(v bool) Option {
+	return func(fb *firebase) {
+		fb.watchReconnect = v
+	}
+}
+
+// startWatch implements Watch, with the initial snapshot left undecoded
+// in the first event if rawSnapshot is set.
+func (fb *firebase) startWatch(notifications chan Event, rawSnapshot bool) error {
+	return fb.startEvents(notifications, func(ctx context.Context, stop chan struct{}) (chan Event, error) {
+		return fb.watch(ctx, stop, rawSnapshot)
+	})
+}
+
+// eventSource starts producing the events of a watch, bound to ctx, the
+// way watch does.
+type eventSource func(ctx context.Context, stop chan struct{}) (chan Event, error)
+
+// startEvents passes the events of source over to notifications until
+// StopWatching is called, as the watch of the reference.
+func (fb *firebase) startEvents(notifications chan Event, source eventSource) error {
+	return fb.startEventsContext(context.Background(), notifications, source)
+}
+
+// startEventsContext is startEvents with the watch also stopped once
+// parent is done, recording the error of parent as its WatchErr.
+func (fb *firebase) startEventsContext(parent context.Context, notifications chan Event, source eventSource) error {
 	fb.watchMtx.Lock()
 	if fb.watching {
 		fb.watchMtx.Unlock()
 		close(notifications)
 		return nil
 	}
+	stop := make(chan struct{})
 	fb.watching = true
+	fb.watchErr = nil
+	fb.watchStop = stop
 	fb.watchMtx.Unlock()
 
-	stop := make(chan struct{})
-	events, err := fb.watch(stop)
+	conn := &connState{}
+	base, cancelBase := fb.requestContext(parent)
+	ctx, cancel := context.WithCancel(withConnState(base, conn))
+	abort := func() {
+		cancel()
+		cancelBase()
+	}
+	events, err := source(ctx, stop)
 	if err != nil {
+		abort()
+		fb.setWatching(false)
 		return err
 	}
 
-	var closedManually bool
+	done := make(chan struct{})
+	fb.watchMtx.Lock()
+	fb.watchDone, fb.watchAbort = done, abort
+	fb.watchMtx.Unlock()
 
-	go func() {
-		<-fb.stopWatching
-		closedManually = true
-		stop <- struct{}{}
-	}()
+	current := func() bool {
+		fb.watchMtx.Lock()
+		defer fb.watchMtx.Unlock()
+		return fb.watchDone == done
+	}
+	w := fb.watchers.register(fb.Path(), conn, func() {
+		if current() {
+			fb.StopWatching()
+		}
+	})
+	if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+			case <-done:
+				return
+			}
+			if current() {
+				fb.StopWatching()
+			}
+		}()
+	}
 
 	go func() {
-		defer close(notifications)
+		var reason error
+		defer func() {
+			fb.watchers.unregister(w)
+			if err := parent.Err(); err != nil {
+				// ended by its context
+				reason = err
+			}
+			fb.watchMtx.Lock()
+			if fb.watchStop == stop {
+				// no other watch started since
+				fb.watchErr = reason
+				fb.watching = false
+			}
+			fb.watchMtx.Unlock()
+			close(notifications)
+			// wait for the connection to be torn down
+			for range events {
+			}
+			abort()
+			close(done)
+		}()
 
 		for event := range events {
-			if closedManually {
+			w.received(event)
+			select {
+			case <-stop:
+				// stopped manually, drop the pending event
 				return
+			default:
 			}
 
-			notifications <- event
+			select {
+			case notifications <- event:
+				reason = closeReason(event)
+			case <-stop:
+				// nobody may be receiving anymore
+				return
+			}
 		}
 	}()
 
 	return nil
 }
 
+// WatchRaw opens a streaming connection to the reference and returns the
+// undecoded text/event-stream body, for callers that need to parse the
+// events themselves or pass them on to another consumer. Authentication and
+// redirects are handled the same way they are for Watch.
+//
+// The caller is responsible for closing the returned stream; StopWatching
+// does not manage raw streams. The stream is also closed when ctx is done.
+func (fb *firebase) WatchRaw(ctx context.Context) (io.ReadCloser, error) {
+	if err := fb.streams.acquire(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := fb.requestContext(ctx)
+	closed := func() {
+		cancel()
+		fb.streams.release()
+	}
+
+	req, err := fb.newRequest(ctx, "GET", nil)
+	if err != nil {
+		closed()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if err := fb.sign(req); err != nil {
+		closed()
+		return nil, err
+	}
+
+	resp, err := fb.doer().Do(req)
+	if err != nil {
+		closed()
+		return nil, err
+	}
+
+	if resp.StatusCode/200 != 1 {
+		defer closed()
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, databaseUnavailable(newHTTPError(resp.StatusCode, body))
+	}
+	return &rawStream{ReadCloser: resp.Body, closed: closed}, nil
+}
+
+type rawStream struct {
+	io.ReadCloser
+	closed    func()
+	closeOnce sync.Once
+}
+
+func (s *rawStream) Close() error {
+	defer s.closeOnce.Do(s.closed)
+	return s.ReadCloser.Close()
+}
+
 func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 	// read event: line
 	line, err := rdr.ReadBytes('\n')
@@ -140,27 +511,76 @@ func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 	return bytes.TrimSpace(line), nil
 }
 
-func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
+// watch opens a streaming connection to the reference, bound to ctx, and
+// passes its events over to the returned chan until the connection ends or
+// stop is closed. The chan is closed once the connection has been torn
+// down, none of the goroutines it starts outlive it even if nobody
+// receives from it.
+//
+// If rawSnapshot is set, the data of the first event, the initial
+// snapshot, is not decoded into Data but kept in snapshot.
+func (fb *firebase) watch(ctx context.Context, stop chan struct{}, rawSnapshot bool) (chan Event, error) {
+	if err := fb.streams.acquire(); err != nil {
+		return nil, err
+	}
+
 	// build SSE request
-	req, err := http.NewRequest("GET", fb.String(), nil)
+	req, err := fb.newRequest(ctx, "GET", nil)
 	if err != nil {
-		fb.setWatching(false)
+		fb.streams.release()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if err := fb.sign(req); err != nil {
+		fb.streams.release()
 		return nil, err
 	}
-	req.Header.Add("Accept", "text/event-stream")
 
 	// do request
-	resp, err := fb.client.Do(req)
+	resp, err := fb.doer().Do(req)
 	if err != nil {
-		fb.setWatching(false)
+		fb.streams.release()
 		return nil, err
 	}
+	var refused error
+	if resp.StatusCode/200 != 1 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength+1))
+		if err := databaseUnavailable(newHTTPError(resp.StatusCode, body)); isDatabaseUnavailable(err) {
+			resp.Body.Close()
+			fb.streams.release()
+			return nil, err
+		}
+		if isPermanentStreamError(resp.StatusCode) {
+			// ends the stream with the error Firebase responded with
+			refused = newHTTPError(resp.StatusCode, body)
+		}
+		// anything else ends the stream once its body is read
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	}
+	fb.logStream(LogLevelInfo, StreamEvent{Type: StreamOpened})
+	conn := connStateOf(ctx)
+	conn.set(resp.StatusCode/200 == 1)
 
 	notifications := make(chan Event)
+	done := make(chan struct{})
+	send := func(event Event) bool {
+		select {
+		case notifications <- event:
+			return true
+		case <-stop:
+			return false
+		}
+	}
 
 	go func() {
-		<-stop
-		resp.Body.Close()
+		select {
+		case <-stop:
+			resp.Body.Close()
+		case <-done:
+		}
 	}()
 
 	heartbeat := make(chan struct{})
@@ -169,6 +589,8 @@ func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
 			select {
 			case <-heartbeat:
 				// do nothing
+			case <-done:
+				return
 			case <-time.After(fb.watchHeartbeat):
 				resp.Body.Close()
 				return
@@ -178,18 +600,39 @@ func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
 
 	// start parsing response body
 	go func() {
+		var streamErr error
 		defer func() {
 			resp.Body.Close()
+			fb.streams.release()
+			conn.set(false)
+			close(done)
 			close(notifications)
+
+			level := LogLevelInfo
+			if streamErr != nil {
+				level = LogLevelError
+			}
+			fb.logStream(level, StreamEvent{Type: StreamClosed, Err: streamErr})
 		}()
 
 		// build scanner for response body
 		scanner := bufio.NewReader(resp.Body)
 		sendError := func(err error) {
-			notifications <- Event{
+			select {
+			case <-stop:
+				// the connection was torn down on purpose
+				return
+			default:
+			}
+			streamErr = err
+			send(Event{
 				Type: EventTypeError,
 				Data: err,
-			}
+			})
+		}
+		if refused != nil {
+			sendError(refused)
+			return
 		}
 		for {
 			select {
@@ -224,9 +667,34 @@ func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
 				rawData: dat,
 			}
 
+			if event.Type == eventTypeKeepAlive {
+				fb.logStream(LogLevelTrace, StreamEvent{Type: StreamKeepAlive})
+			} else {
+				fb.logStream(LogLevelDebug, StreamEvent{Type: StreamEventReceived, EventType: event.Type})
+			}
+
 			// should be reacting differently based off the type of event
 			switch event.Type {
 			case EventTypePut, EventTypePatch:
+				if rawSnapshot {
+					// only the first event is the initial snapshot
+					rawSnapshot = false
+
+					var data struct {
+						Path string          `json:"path"`
+						Data json.RawMessage `json:"data"`
+					}
+					if err := json.Unmarshal(event.rawData, &data); err != nil {
+						sendError(err)
+						return
+					}
+					event.Path, event.Data, event.snapshot = cleanPath(data.Path), nil, data.Data
+					if !send(event) {
+						return
+					}
+					continue
+				}
+
 				// we've got extra data we've got to parse
 				var data map[string]interface{}
 				if err := json.Unmarshal(event.rawData, &data); err != nil {
@@ -235,11 +703,14 @@ func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
 				}
 
 				// set the extra fields
-				event.Path = data["path"].(string)
+				path, _ := data["path"].(string)
+				event.Path = cleanPath(path)
 				event.Data = data["data"]
 
 				// ship it
-				notifications <- event
+				if !send(event) {
+					return
+				}
 			case eventTypeKeepAlive:
 				// received ping - nothing to do here
 			case eventTypeCancel:
@@ -248,12 +719,12 @@ func (fb *firebase) watch(stop chan struct{}) (chan Event, error) {
 				// cause a read at the requested location to no longer be allowed
 
 				// send the cancel event
-				notifications <- event
+				send(event)
 				return
 			case EventTypeAuthRevoked:
 				// The data for this event is a string indicating that a the credential has expired
 				// This event will be sent when the supplied auth parameter is no longer valid
-				notifications <- event
+				send(event)
 				return
 			case eventTypeRulesDebug:
 				log.Printf("Rules-Debug: %s\n%s\n", evt, dat)
@@ -0,0 +1,296 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrWatchManagerClosed is returned when subscribing to a closed WatchManager.
+var ErrWatchManagerClosed = errors.New("watch manager closed")
+
+// WatchManager multiplexes the watches of many paths over a single
+// streaming connection. The connection is opened on the closest common
+// ancestor of the subscribed paths and its events are routed to the
+// subscribers of the paths they affect, with their Path made relative to
+// the subscribed path the same way it would be had the path been watched
+// on its own.
+//
+// Subscribing to a path outside of the current ancestor moves the
+// connection up to the new common ancestor, every subscriber then receives
+// a put event with the current value of its path again. Since a single
+// connection serves every subscriber, a subscriber that does not receive
+// its events holds back the others.
+type WatchManager struct {
+	root *firebase
+
+	mtx      sync.Mutex
+	subs     map[string][]chan Event
+	closed   bool
+	ancestor string
+	stream   *firebase
+	gen      int
+	mirror   *Mirror
+	ready    bool
+
+	// sendMtx is held while events are delivered,
+	// so that they are delivered in order
+	sendMtx sync.Mutex
+	done    chan struct{}
+}
+
+type delivery struct {
+	ch    chan Event
+	event Event
+}
+
+// WatchManager creates a WatchManager for paths relative to the reference.
+func (fb *firebase) WatchManager() *WatchManager {
+	return &WatchManager{
+		root: fb.copy(),
+		subs: map[string][]chan Event{},
+		done: make(chan struct{}),
+	}
+}
+
+// Subscribe passes the events affecting path over to ch, starting with a
+// put event carrying its current value. The same chan may be subscribed
+// to several paths. The chan is closed by Close or once the connection is
+// lost, it must not be closed by the caller.
+//
+// Subscribe must not be called from a goroutine the WatchManager is
+// delivering an event to.
+func (m *WatchManager) Subscribe(path string, ch chan Event) error {
+	path = strings.Trim(path, "/")
+
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return ErrWatchManagerClosed
+	}
+	m.subs[path] = append(m.subs[path], ch)
+
+	ancestor := path
+	if m.stream != nil {
+		ancestor = commonAncestor(m.ancestor, path)
+	}
+	if m.stream == nil || ancestor != m.ancestor {
+		// the initial put of the new connection reaches every subscriber
+		err := m.open(ancestor)
+		if err != nil {
+			m.remove(path, ch)
+		}
+		m.mtx.Unlock()
+		return err
+	}
+	if !m.ready {
+		// the initial put of the connection has yet to arrive
+		m.mtx.Unlock()
+		return nil
+	}
+
+	value := lookup(m.mirror.value, splitPath(relativePath(m.ancestor, path)))
+	m.deliver([]delivery{{ch: ch, event: newEvent(EventTypePut, "/", value)}})
+	return nil
+}
+
+// Unsubscribe stops passing the events affecting path over to ch, the
+// connection is closed once there are no subscribers left. An event being
+// delivered while Unsubscribe is called may still be received.
+func (m *WatchManager) Unsubscribe(path string, ch chan Event) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.remove(strings.Trim(path, "/"), ch)
+	if len(m.subs) == 0 && m.stream != nil {
+		m.stream.StopWatching()
+		m.stream = nil
+		m.gen++
+	}
+}
+
+// Close closes the connection of the WatchManager and every subscribed chan.
+func (m *WatchManager) Close() {
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return
+	}
+	m.closed = true
+	if m.stream != nil {
+		m.stream.StopWatching()
+		m.stream = nil
+	}
+	m.gen++
+	close(m.done)
+	subs := m.subs
+	m.subs = map[string][]chan Event{}
+	m.mtx.Unlock()
+
+	// wait for the event being delivered, if any
+	m.sendMtx.Lock()
+	defer m.sendMtx.Unlock()
+	closeAll(subs)
+}
+
+// open must be called while holding the lock.
+func (m *WatchManager) open(ancestor string) error {
+	stream := m.root.copy()
+	if ancestor != "" {
+		stream.url += "/" + ancestor
+	}
+	events := make(chan Event)
+	if err := stream.Watch(events); err != nil {
+		return err
+	}
+
+	if m.stream != nil {
+		m.stream.StopWatching()
+	}
+	m.gen++
+	m.stream, m.ancestor = stream, ancestor
+	m.mirror, m.ready = &Mirror{}, false
+
+	go func(gen int) {
+		for event := range events {
+			m.route(gen, event)
+		}
+		m.lost(gen)
+	}(m.gen)
+	return nil
+}
+
+// remove must be called while holding the lock.
+func (m *WatchManager) remove(path string, ch chan Event) {
+	subs := m.subs[path]
+	for i, c := range subs {
+		if c == ch {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(m.subs, path)
+	} else {
+		m.subs[path] = subs
+	}
+}
+
+// route delivers an event of the connection of the given generation.
+func (m *WatchManager) route(gen int, event Event) {
+	m.mtx.Lock()
+	if gen != m.gen {
+		m.mtx.Unlock()
+		return
+	}
+
+	var deliveries []delivery
+	if event.Type != EventTypePut && event.Type != EventTypePatch {
+		for _, subs := range m.subs {
+			for _, ch := range subs {
+				deliveries = append(deliveries, delivery{ch: ch, event: event})
+			}
+		}
+		m.deliver(deliveries)
+		return
+	}
+
+	eventPath := joinPath(m.ancestor, event.Path)
+	before := map[string]interface{}{}
+	for path := range m.subs {
+		before[path] = lookup(m.mirror.value, splitPath(relativePath(m.ancestor, path)))
+	}
+	m.mirror.Apply(event)
+	initial := !m.ready
+	m.ready = true
+
+	for path, subs := range m.subs {
+		var e Event
+		switch {
+		case isWithin(eventPath, path):
+			// the change is in the subscribed path, pass it on as is
+			e = newEvent(event.Type, "/"+relativePath(path, eventPath), event.Data)
+		case isWithin(path, eventPath):
+			// the change is above the subscribed path, send its new value
+			value := lookup(m.mirror.value, splitPath(relativePath(m.ancestor, path)))
+			if !initial && reflect.DeepEqual(before[path], value) {
+				continue
+			}
+			e = newEvent(EventTypePut, "/", value)
+		default:
+			continue
+		}
+		for _, ch := range subs {
+			deliveries = append(deliveries, delivery{ch: ch, event: e})
+		}
+	}
+	m.deliver(deliveries)
+}
+
+// deliver must be called while holding the lock, which it releases.
+func (m *WatchManager) deliver(deliveries []delivery) {
+	m.sendMtx.Lock()
+	defer m.sendMtx.Unlock()
+	m.mtx.Unlock()
+
+	for _, d := range deliveries {
+		select {
+		case d.ch <- d.event:
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// lost closes the subscribers once the connection of
+// the given generation ends without being stopped.
+func (m *WatchManager) lost(gen int) {
+	m.mtx.Lock()
+	if gen != m.gen {
+		m.mtx.Unlock()
+		return
+	}
+	m.mtx.Unlock()
+	m.Close()
+}
+
+func newEvent(typ, path string, data interface{}) Event {
+	raw, _ := json.Marshal(map[string]interface{}{"path": path, "data": data})
+	return Event{Type: typ, Path: path, Data: data, rawData: raw}
+}
+
+func closeAll(subs map[string][]chan Event) {
+	closed := map[chan Event]bool{}
+	for _, chans := range subs {
+		for _, ch := range chans {
+			if !closed[ch] {
+				closed[ch] = true
+				close(ch)
+			}
+		}
+	}
+}
+
+// joinPath joins a path and the path of an event relative to it.
+func joinPath(base, path string) string {
+	path = strings.Trim(path, "/")
+	switch {
+	case base == "":
+		return path
+	case path == "":
+		return base
+	}
+	return base + "/" + path
+}
+
+// isWithin reports whether path is ancestor or one of its descendants.
+func isWithin(path, ancestor string) bool {
+	return ancestor == "" || path == ancestor || strings.HasPrefix(path, ancestor+"/")
+}
+
+// relativePath returns path relative to its ancestor.
+func relativePath(ancestor, path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, ancestor), "/")
+}
@@ -0,0 +1,118 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func receive(t *testing.T, ch chan Event) Event {
+	select {
+	case event, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive a notification")
+	}
+	return Event{}
+}
+
+func assertNoEvent(t *testing.T, ch chan Event) {
+	select {
+	case event := <-ch:
+		assert.Fail(t, "unexpected notification", "%#v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchManager(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{"age": 30.0})
+	server.Set("users/bob", map[string]interface{}{"age": 40.0})
+
+	m := New(server.URL, nil).WatchManager()
+	defer m.Close()
+
+	alice, bob := make(chan Event), make(chan Event)
+	require.NoError(t, m.Subscribe("users/alice", alice))
+	event := receive(t, alice)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"age": 30.0}, event.Data)
+
+	// the connection moves up to users, every subscriber gets its value
+	go func() { assert.NoError(t, m.Subscribe("/users/bob/", bob)) }()
+	for i := 0; i < 2; i++ {
+		var event Event
+		select {
+		case event = <-alice:
+		case event = <-bob:
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive a notification")
+		}
+		assert.Equal(t, EventTypePut, event.Type)
+		assert.Equal(t, "/", event.Path)
+	}
+	assert.Equal(t, "users", m.ancestor)
+
+	server.Set("users/alice/age", 31.0)
+	event = receive(t, alice)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/age", event.Path)
+	assert.Equal(t, 31.0, event.Data)
+	var age int
+	require.NoError(t, event.Value(&age))
+	assert.Equal(t, 31, age)
+	assertNoEvent(t, bob)
+
+	server.Update("users/bob", map[string]interface{}{"name": "bob"})
+	event = receive(t, bob)
+	assert.Equal(t, EventTypePatch, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"name": "bob"}, event.Data)
+	assertNoEvent(t, alice)
+
+	// a put above the subscribed paths is narrowed down to each of them
+	server.Set("users", map[string]interface{}{"alice": map[string]interface{}{"age": 31.0}})
+	event = receive(t, bob)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Nil(t, event.Data)
+	assertNoEvent(t, alice)
+
+	m.Unsubscribe("users/bob", bob)
+	server.Set("users/bob", "back")
+	assertNoEvent(t, bob)
+
+	m.Close()
+	_, ok := <-alice
+	assert.False(t, ok)
+	assert.Equal(t, ErrWatchManagerClosed, m.Subscribe("users", make(chan Event)))
+}
+
+func TestWatchManagerSharedStream(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", "alice")
+
+	m := New(server.URL, nil).WatchManager()
+	defer m.Close()
+
+	all, alice := make(chan Event), make(chan Event)
+	require.NoError(t, m.Subscribe("users", all))
+	receive(t, all)
+
+	// subscribing below the ancestor reuses the connection
+	stream := m.stream
+	go func() { assert.NoError(t, m.Subscribe("users/alice", alice)) }()
+	event := receive(t, alice)
+	assert.Equal(t, "alice", event.Data)
+	assert.True(t, stream == m.stream)
+	assertNoEvent(t, all)
+}
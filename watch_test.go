@@ -1,16 +1,23 @@
 package firego
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/zabawaba99/firego/internal/firetest"
+	"golang.org/x/oauth2"
 )
 
 func setupLargeResult() string {
@@ -78,6 +85,42 @@ func TestWatchRedirectPreservesHeader(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestWatchCleansPaths(t *testing.T) {
+	t.Parallel()
+	paths := []struct {
+		raw      string
+		expected string
+		segments []string
+	}{
+		{raw: "/", expected: "/"},
+		{raw: "", expected: "/"},
+		{raw: "a//b/", expected: "/a/b", segments: []string{"a", "b"}},
+		// keys are sent as they are stored, not escaped
+		{raw: "/users/first%20name", expected: "/users/first%20name", segments: []string{"users", "first%20name"}},
+		{raw: "/bad%zz", expected: "/bad%zz", segments: []string{"bad%zz"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, p := range paths {
+			fmt.Fprintf(w, "event: put\ndata: {\"path\":%q,\"data\":null}\n\n", p.raw)
+		}
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	for _, p := range paths {
+		event := <-notifications
+		assert.Equal(t, p.expected, event.Path, p.raw)
+		assert.Equal(t, p.segments, event.PathSegments(), p.raw)
+	}
+}
+
 func TestWatchHeartbeatTimeout(t *testing.T) {
 	var fb Firebase
 
@@ -230,3 +273,432 @@ func TestStopWatch(t *testing.T) {
 	_, ok := <-notifications
 	assert.False(t, ok, "notifications should be closed")
 }
+
+func TestStopWatchingContext(t *testing.T) {
+	t.Parallel()
+
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	assert.NoError(t, fb.StopWatchingContext(context.Background()))
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications // get initial notification
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, fb.StopWatchingContext(ctx))
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+// wedgedBody is a stream that only gives up when its request is canceled,
+// closing it included.
+type wedgedBody struct {
+	ctx context.Context
+}
+
+func (b wedgedBody) Read(p []byte) (int, error) {
+	<-b.ctx.Done()
+	return 0, b.ctx.Err()
+}
+
+func (b wedgedBody) Close() error {
+	<-b.ctx.Done()
+	return nil
+}
+
+type wedgedTransport struct{}
+
+func (wedgedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: wedgedBody{req.Context()}}, nil
+}
+
+func TestStopWatchingContextWedged(t *testing.T) {
+	t.Parallel()
+
+	fb := New(URL, &http.Client{Transport: wedgedTransport{}})
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, fb.StopWatchingContext(ctx))
+
+	// the connection was closed forcibly
+	select {
+	case <-fb.(*firebase).watchDone:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the watch was not torn down")
+	}
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+func TestWatchErr(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name     string
+		last     string
+		expected error
+	}{
+		{name: "closed", expected: ErrServerClosed{io.EOF}},
+		{name: "canceled", last: "event: cancel\ndata: null\n\n", expected: ErrStreamCanceled},
+		{name: "revoked", last: "event: auth_revoked\ndata: \"token expired\"\n\n", expected: ErrAuthRevoked},
+	} {
+		running := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+			w.(http.Flusher).Flush()
+			<-running
+			fmt.Fprint(w, test.last)
+		}))
+
+		fb := New(server.URL, nil)
+		notifications := make(chan Event)
+		require.NoError(t, fb.Watch(notifications), test.name)
+		<-notifications
+		assert.NoError(t, fb.WatchErr(), test.name)
+		close(running)
+		for range notifications {
+		}
+		assert.Equal(t, test.expected, fb.WatchErr(), test.name)
+		fb.StopWatching()
+		server.Close()
+	}
+}
+
+func TestWatchReconnect(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a", 1)
+	server.InjectFault(firetest.FaultSpec{DropAfter: 1, Times: 1})
+
+	fb := New(server.URL, nil, WithWatchReconnect(true), WithBackoff(&recordingBackoff{}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	event := <-notifications
+	assert.Equal(t, "/", event.Path)
+	server.Set("b", 2)
+	event = <-notifications
+	assert.Equal(t, "/b", event.Path)
+
+	// the stream is dropped, the new one starts with the whole value
+	event = <-notifications
+	assert.Equal(t, EventTypeReconnected, event.Type)
+	assert.Equal(t, io.EOF, event.Data)
+	event = <-notifications
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"a": 1.0, "b": 2.0}, event.Data)
+	server.Set("c", 3)
+	event = <-notifications
+	assert.Equal(t, "/c", event.Path)
+	assert.NoError(t, fb.WatchErr())
+}
+
+// expiringTokenSource gives a first token expiring right away, shortly
+// after the expiry delta of oauth2, and a second one never expiring.
+type expiringTokenSource struct {
+	calls int32
+}
+
+func (ts *expiringTokenSource) Token() (*oauth2.Token, error) {
+	if atomic.AddInt32(&ts.calls, 1) == 1 {
+		return &oauth2.Token{AccessToken: "first", Expiry: time.Now().Add(10*time.Second + 100*time.Millisecond)}, nil
+	}
+	return &oauth2.Token{AccessToken: "second"}, nil
+}
+
+func TestWatchReconnectAuthRevoked(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		token := req.URL.Query().Get(accessTokenParam)
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%q}\n\n", token)
+		fmt.Fprint(w, "event: keep-alive\ndata: null\n\n")
+		w.(http.Flusher).Flush()
+		if token == "first" {
+			// revoked once expired
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Fprint(w, "event: auth_revoked\ndata: \"token expired\"\n\n")
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithWatchReconnect(true), WithBackoff(&recordingBackoff{}))
+	fb.AuthWithTokenSource(&expiringTokenSource{})
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	var events []Event
+	for event := range notifications {
+		events = append(events, event)
+	}
+	require.Len(t, events, 4)
+	assert.Equal(t, "first", events[0].Data)
+	// the revoked token is replaced
+	assert.Equal(t, EventTypeReconnected, events[1].Type)
+	assert.Equal(t, ErrAuthRevoked, events[1].Data)
+	assert.Equal(t, "second", events[2].Data)
+	// the new token is revoked too, with none to replace it
+	assert.Equal(t, EventTypeAuthRevoked, events[3].Type)
+	assert.Equal(t, ErrAuthRevoked, fb.WatchErr())
+}
+
+func TestWatchReconnectDenied(t *testing.T) {
+	t.Parallel()
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&connections, 1) > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"Permission denied"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil, WithWatchReconnect(true), WithBackoff(&recordingBackoff{}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	var events []Event
+	for event := range notifications {
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypeError, events[1].Type)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&connections))
+	err, ok := fb.WatchErr().(ErrServerClosed)
+	require.True(t, ok, "unexpected error %v", fb.WatchErr())
+	require.IsType(t, ErrHTTP{}, err.error)
+	assert.Equal(t, http.StatusUnauthorized, err.error.(ErrHTTP).StatusCode)
+}
+
+func TestWatchErrStopped(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications // get initial notification
+
+	fb.StopWatching()
+	for range notifications {
+	}
+	assert.NoError(t, fb.WatchErr())
+}
+
+// watchGoroutines returns the number of goroutines started by watches.
+func watchGoroutines() int {
+	return goroutines("firego.(*firebase).Watch.func", "firego.(*firebase).watch.func")
+}
+
+// goroutines returns the number of goroutines running one of the funcs
+// fns.
+func goroutines(fns ...string) int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+
+	var n int
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		for _, fn := range fns {
+			if strings.Contains(g, fn) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// assertClosed asserts that ch, a chan of any type, is closed within a
+// second, receiving the values still sent to it until then.
+func assertClosed(t *testing.T, ch interface{}) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(time.Second))},
+	}
+	for {
+		i, _, ok := reflect.Select(cases)
+		if i == 1 {
+			t.Error("chan should be closed")
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// assertGoroutinesExit asserts that the number of goroutines running one
+// of the funcs fns goes back to before within a second. Goroutines of
+// earlier tests may exit in the meantime.
+func assertGoroutinesExit(t *testing.T, before int, fns ...string) {
+	deadline := time.Now().Add(time.Second)
+	for goroutines(fns...) > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, goroutines(fns...) <= before, "goroutines are still running")
+}
+
+// assertStopWithoutReceiving calls start, which watches a reference and
+// returns it along with the chan the events are passed over to, then
+// stops the watch while nobody receives from the chan. It asserts that the
+// goroutines running one of the funcs fns exit and that the chan is
+// closed. The tests calling it are not parallel, since it counts the
+// goroutines of every watch.
+func assertStopWithoutReceiving(t *testing.T, fns []string, start func() (Firebase, interface{})) {
+	before := goroutines(fns...)
+	fb, ch := start()
+
+	// nobody receives the events
+	time.Sleep(50 * time.Millisecond)
+	fb.StopWatching()
+	assertGoroutinesExit(t, before, fns...)
+	assertClosed(t, ch)
+}
+
+func TestStopWatchWithoutReceiving(t *testing.T) {
+	// not parallel, it counts the goroutines of every watch
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	before := watchGoroutines()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	// nobody receives the initial notification nor this one
+	server.Set("foo", "bar")
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, watchGoroutines() > before)
+	fb.StopWatching()
+
+	deadline := time.Now().Add(time.Second)
+	for watchGoroutines() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, before, watchGoroutines(), "watch goroutines are still running")
+
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+func TestIsWatching(t *testing.T) {
+	t.Parallel()
+
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	assert.False(t, fb.IsWatching())
+
+	notifications := make(chan Event)
+	err := fb.Watch(notifications)
+	require.NoError(t, err)
+	assert.True(t, fb.IsWatching())
+
+	<-notifications // get initial notification
+	fb.StopWatching()
+	assert.False(t, fb.IsWatching())
+
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+func TestIsWatchingEnded(t *testing.T) {
+	t.Parallel()
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":null}`)
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			// the stream ends with the response
+		case 2:
+			fmt.Fprint(w, "event: cancel\ndata: null\n\n")
+		default:
+			w.(http.Flusher).Flush()
+			<-req.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	for _, reason := range []string{"closed", "canceled"} {
+		notifications := make(chan Event)
+		require.NoError(t, fb.Watch(notifications), reason)
+		for range notifications {
+		}
+		assert.False(t, fb.IsWatching(), reason)
+		assert.Error(t, fb.WatchErr(), reason)
+	}
+
+	// the watch can be started again, and stopped
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	assert.True(t, fb.IsWatching())
+	<-notifications
+	fb.StopWatching()
+	assertClosed(t, notifications)
+	assert.False(t, fb.IsWatching())
+	assert.NoError(t, fb.WatchErr())
+}
+
+func TestWatchRaw(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireAuth(true)
+	server.Set("foo", "bar")
+
+	fb := New(server.URL, nil)
+	fb.Auth(server.Secret)
+
+	stream, err := fb.WatchRaw(context.Background())
+	require.NoError(t, err)
+	defer stream.Close()
+
+	rdr := bufio.NewReader(stream)
+	line, err := rdr.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: put\n", line)
+
+	line, err = rdr.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, `data: {"path":"/","data":{"foo":"bar"}}`+"\n", line)
+}
+
+func TestWatchRawError(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireAuth(true)
+	fb := New(server.URL, nil)
+
+	stream, err := fb.WatchRaw(context.Background())
+	assert.Nil(t, stream)
+	assert.Error(t, err)
+}
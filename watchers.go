@@ -0,0 +1,219 @@
+package firego
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WatcherInfo describes a watch that is running, as listed by
+// ActiveWatchers.
+type WatcherInfo struct {
+	// ID identifies the watch among those listed by ActiveWatchers.
+	ID int64
+	// Path is the path of the reference being watched, as returned by Path.
+	Path string
+	// Started is when the watch started.
+	Started time.Time
+	// Events is the number of events the watch received, errors excluded.
+	Events int64
+	// LastEvent is when the watch received its last event, zero if none.
+	LastEvent time.Time
+
+	stop func()
+	conn *connState
+}
+
+// Connected reports whether the stream of the watch is connected to
+// Firebase, that is whether it has been opened and has not been closed or
+// lost since. It is false while a watch that lost its connection, such as
+// one started by GetAndWatch or an event function, is reconnecting, and
+// once the watch has ended. The watches started by Poll have no stream
+// and are never connected.
+//
+// The state is that of the stream of the watch, as the Logger of the
+// reference sees StreamOpened and StreamClosed, not the one the SDKs read
+// from .info/connected: a stream whose connection silently broke is only
+// seen as lost once no keep-alive arrived for the heartbeat.
+func (w WatcherInfo) Connected() bool {
+	return w.conn.get()
+}
+
+// OnConnectionChange calls fn with the new state every time the stream of
+// the watch gets connected or disconnected, see Connected, until the watch
+// ends, for example to show an online indicator. fn is not called with the
+// current state and must not block, the events of the watch are held back
+// while it runs.
+func (w WatcherInfo) OnConnectionChange(fn func(connected bool)) {
+	w.conn.onChange(fn)
+}
+
+// Stop stops the watch the way StopWatching does, or the way
+// RemoveEventFunc does for an event function. The chan of a watch started
+// by Watch is closed and WatchErr reports no error.
+func (w WatcherInfo) Stop() {
+	if w.stop != nil {
+		w.stop()
+	}
+}
+
+// ActiveWatchers returns the watches running on the reference and on every
+// reference derived from the same reference created by New, ordered by the
+// time they started: those started by Watch, GetAndWatch, Poll, Mirror,
+// SubscribeTyped, ChildEvents and the functions built on them, and the event
+// functions set with ChildAdded, ChildChanged and ChildRemoved, which are
+// listed once however many times they reconnect. The streams opened by
+// WatchRaw are not listed. A watch is listed until its chan is closed or
+// its event function removed.
+func (fb *firebase) ActiveWatchers() []WatcherInfo {
+	return fb.watchers.list()
+}
+
+// watcherRegistry tracks the running watches, a nil watcherRegistry
+// does not.
+type watcherRegistry struct {
+	mtx      sync.Mutex
+	nextID   int64
+	watchers map[int64]*watcher
+}
+
+type watcher struct {
+	id      int64
+	path    string
+	started time.Time
+	stop    func()
+	conn    *connState
+
+	events    int64
+	lastEvent int64
+}
+
+func (r *watcherRegistry) register(path string, conn *connState, stop func()) *watcher {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.nextID++
+	w := &watcher{id: r.nextID, path: path, started: time.Now(), stop: stop, conn: conn}
+	if r.watchers == nil {
+		r.watchers = map[int64]*watcher{}
+	}
+	r.watchers[w.id] = w
+	return w
+}
+
+func (r *watcherRegistry) unregister(w *watcher) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	delete(r.watchers, w.id)
+	r.mtx.Unlock()
+}
+
+func (r *watcherRegistry) list() []WatcherInfo {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	infos := make([]WatcherInfo, 0, len(r.watchers))
+	for _, w := range r.watchers {
+		info := WatcherInfo{
+			ID:      w.id,
+			Path:    w.path,
+			Started: w.started,
+			Events:  atomic.LoadInt64(&w.events),
+			stop:    w.stop,
+			conn:    w.conn,
+		}
+		if last := atomic.LoadInt64(&w.lastEvent); last != 0 {
+			info.LastEvent = time.Unix(0, last)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// received counts an event received by the watch.
+func (w *watcher) received(event Event) {
+	if w == nil || event.Type == EventTypeError {
+		return
+	}
+	atomic.AddInt64(&w.events, 1)
+	atomic.StoreInt64(&w.lastEvent, time.Now().UnixNano())
+}
+
+// connState is the connection state of the stream of a watch, a nil
+// connState is never connected.
+type connState struct {
+	mtx       sync.Mutex
+	connected bool
+	funcs     []func(bool)
+	// notifyMtx keeps the changes notified in order
+	notifyMtx sync.Mutex
+}
+
+// connStateKey is the context key of the connState the streams opened with
+// the context report to.
+type connStateKey struct{}
+
+// withConnState returns a copy of ctx whose streams report their state to
+// conn.
+func withConnState(ctx context.Context, conn *connState) context.Context {
+	return context.WithValue(ctx, connStateKey{}, conn)
+}
+
+// connStateOf returns the connState the streams opened with ctx report to,
+// nil if there is none.
+func connStateOf(ctx context.Context) *connState {
+	conn, _ := ctx.Value(connStateKey{}).(*connState)
+	return conn
+}
+
+func (c *connState) get() bool {
+	if c == nil {
+		return false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.connected
+}
+
+func (c *connState) onChange(fn func(bool)) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	c.funcs = append(c.funcs, fn)
+	c.mtx.Unlock()
+}
+
+// set sets the state and notifies the funcs if it changed.
+func (c *connState) set(connected bool) {
+	if c == nil {
+		return
+	}
+	c.notifyMtx.Lock()
+	defer c.notifyMtx.Unlock()
+
+	c.mtx.Lock()
+	changed := c.connected != connected
+	c.connected = connected
+	funcs := c.funcs
+	c.mtx.Unlock()
+	if !changed {
+		return
+	}
+	for _, fn := range funcs {
+		fn(connected)
+	}
+}
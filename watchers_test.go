@@ -0,0 +1,180 @@
+package firego
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestActiveWatchers(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("a", 1)
+	root := New(server.URL, nil)
+	assert.Empty(t, root.ActiveWatchers())
+
+	a := root.Child("a")
+	notifications := make(chan Event)
+	require.NoError(t, a.Watch(notifications))
+	<-notifications
+
+	b := root.Child("b")
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, b.ChildAdded(fn))
+	defer b.RemoveEventFunc(fn)
+
+	// every reference derived from the same root lists them
+	watchers := b.ActiveWatchers()
+	require.Len(t, watchers, 2)
+	assert.Equal(t, "/a", watchers[0].Path)
+	assert.EqualValues(t, 1, watchers[0].Events)
+	assert.False(t, watchers[0].LastEvent.IsZero())
+	assert.False(t, watchers[0].Started.After(watchers[1].Started))
+	assert.Equal(t, "/b", watchers[1].Path)
+
+	// stopping a watcher closes its chan
+	watchers[0].Stop()
+	select {
+	case _, ok := <-notifications:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		require.FailNow(t, "the watch was not stopped")
+	}
+	assert.False(t, a.IsWatching())
+	assert.NoError(t, a.WatchErr())
+	require.Len(t, root.ActiveWatchers(), 1)
+
+	// and removes event functions
+	root.ActiveWatchers()[0].Stop()
+	assert.Eventually(t, func() bool {
+		return len(root.ActiveWatchers()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// references created apart are tracked apart
+	other := New(server.URL, nil)
+	require.NoError(t, other.Watch(make(chan Event, 10)))
+	defer other.StopWatching()
+	assert.Len(t, other.ActiveWatchers(), 1)
+	assert.Empty(t, root.ActiveWatchers())
+}
+
+func TestActiveWatchersConcurrent(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	root := New(server.URL, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ref := root.Child("a")
+			notifications := make(chan Event)
+			if !assert.NoError(t, ref.Watch(notifications)) {
+				return
+			}
+			<-notifications
+			root.ActiveWatchers()
+			ref.StopWatching()
+			for range notifications {
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return len(root.ActiveWatchers()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatcherConnected(t *testing.T) {
+	t.Parallel()
+	drop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/","data":1}`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-drop:
+			// the connection breaks
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, &http.Client{}, WithBackoff(&recordingBackoff{}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.GetAndWatch(notifications))
+	watchers := fb.ActiveWatchers()
+	require.Len(t, watchers, 1)
+	watcher := watchers[0]
+	assert.True(t, watcher.Connected())
+
+	changes := make(chan bool, 10)
+	watcher.OnConnectionChange(func(connected bool) {
+		changes <- connected
+	})
+	changed := func() bool {
+		select {
+		case connected := <-changes:
+			return connected
+		case <-time.After(time.Second):
+			require.FailNow(t, "the connection state did not change")
+		}
+		return false
+	}
+	<-notifications
+
+	// a simulated disconnect, followed by a reconnect
+	for i := 0; i < 2; i++ {
+		drop <- struct{}{}
+		assert.False(t, changed())
+		assert.True(t, changed())
+		assert.True(t, watcher.Connected())
+		<-notifications
+	}
+
+	fb.StopWatching()
+	assert.False(t, changed())
+	assert.False(t, watcher.Connected())
+	for range notifications {
+	}
+	assert.Empty(t, changes)
+}
+
+func TestWatcherConnectedEventFunc(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fn := func(snapshot DataSnapshot, previousChildKey string) {}
+	require.NoError(t, fb.ChildAdded(fn))
+	watchers := fb.ActiveWatchers()
+	require.Len(t, watchers, 1)
+	assert.True(t, watchers[0].Connected())
+
+	fb.RemoveEventFunc(fn)
+	assert.Eventually(t, func() bool {
+		return !watchers[0].Connected()
+	}, time.Second, 5*time.Millisecond)
+
+	// watches without a stream are never connected
+	var zero WatcherInfo
+	assert.False(t, zero.Connected())
+	zero.OnConnectionChange(func(bool) {})
+}
@@ -0,0 +1,140 @@
+package firego
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WriteBatch buffers writes to the descendants of a reference and sends
+// them together, in a single multi-path update, when committed. This
+// saves a request per write and makes the group atomic: either every
+// buffered write is applied or none is.
+//
+// Writes to the same path, or to a path and one of its descendants, are
+// resolved when they are buffered so that committing the batch has the
+// same result as making the writes one after another in the order they
+// were buffered: a write replaces the buffered writes to its descendants
+// and is merged into a buffered write to one of its ancestors.
+//
+// A WriteBatch is safe for concurrent use.
+type WriteBatch struct {
+	ref *firebase
+
+	mtx    sync.Mutex
+	writes map[string]interface{}
+}
+
+// Batch creates an empty WriteBatch for the reference.
+func (fb *firebase) Batch() *WriteBatch {
+	return &WriteBatch{ref: fb.copy(), writes: map[string]interface{}{}}
+}
+
+// Set buffers setting the value of the given descendant of the reference
+// to v, the way Child(path).Set(v) does.
+func (b *WriteBatch) Set(path string, v interface{}) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
+	tree, err := b.decode(v)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.buffer(strings.Trim(path, "/"), tree)
+	return nil
+}
+
+// Update buffers updating the given descendant of the reference with the
+// children of v, the way Child(path).Update(v) does.
+func (b *WriteBatch) Update(path string, v interface{}) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
+	tree, err := b.decode(v)
+	if err != nil {
+		return err
+	}
+	children, ok := tree.(map[string]interface{})
+	if !ok && tree != nil {
+		return fmt.Errorf("update of %q is not an object", path)
+	}
+
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		if err := validatePath(key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, key := range keys {
+		b.buffer(joinPath(strings.Trim(path, "/"), key), children[key])
+	}
+	return nil
+}
+
+// Remove buffers removing the given descendant of the reference.
+func (b *WriteBatch) Remove(path string) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.buffer(strings.Trim(path, "/"), nil)
+	return nil
+}
+
+// Commit sends the buffered writes in a single update and empties the
+// batch, whether or not the update succeeds. Committing an empty batch
+// sends nothing.
+func (b *WriteBatch) Commit() error {
+	b.mtx.Lock()
+	writes := b.writes
+	b.writes = map[string]interface{}{}
+	b.mtx.Unlock()
+
+	if len(writes) == 0 {
+		return nil
+	}
+	return b.ref.BulkImport(writes)
+}
+
+// decode serializes v the way a write would and decodes it back into the
+// representation the batch merges writes in.
+func (b *WriteBatch) decode(v interface{}) (interface{}, error) {
+	bytes, err := b.ref.marshalPayload(v)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeTree(bytes)
+	if err != nil {
+		return nil, ErrInvalidPayload{err}
+	}
+	return normalize(tree), nil
+}
+
+// buffer must be called while holding the batch's lock.
+func (b *WriteBatch) buffer(path string, v interface{}) {
+	for buffered := range b.writes {
+		if isWithin(buffered, path) {
+			// replaced by this write
+			delete(b.writes, buffered)
+		}
+	}
+	for buffered, value := range b.writes {
+		if isWithin(path, buffered) {
+			rel := splitPath(strings.TrimPrefix(path, buffered))
+			b.writes[buffered] = setPath(value, rel, v)
+			return
+		}
+	}
+	b.writes[path] = v
+}
@@ -0,0 +1,105 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/internal/firetest"
+)
+
+func TestWriteBatchCommit(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "PATCH", req.Method)
+		assert.Equal(t, "/users/.json", req.URL.Path)
+		b, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	b := New(server.URL+"/users", nil).Batch()
+	const n = 10
+	for i := 0; i < n; i++ {
+		require.NoError(t, b.Set(fmt.Sprintf("user%d/name", i), fmt.Sprint("name", i)))
+	}
+	require.NoError(t, b.Commit())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Len(t, body, n)
+	assert.Equal(t, "name3", body["user3/name"])
+
+	// the batch was emptied
+	require.NoError(t, b.Commit())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestWriteBatchConflicts(t *testing.T) {
+	t.Parallel()
+	b := New(URL, nil).Batch()
+
+	// last write wins
+	require.NoError(t, b.Set("a", 1))
+	require.NoError(t, b.Set("a", 2))
+
+	// writes to descendants are replaced
+	require.NoError(t, b.Set("b/c", 1))
+	require.NoError(t, b.Set("b/d/e", 1))
+	require.NoError(t, b.Set("b", map[string]int{"f": 1}))
+
+	// writes to descendants of a buffered write are merged into it
+	require.NoError(t, b.Set("b/g", 2))
+	require.NoError(t, b.Remove("b/f"))
+	require.NoError(t, b.Update("b", map[string]interface{}{"h": 3, "i/j": true}))
+
+	// removing the last child removes the parent
+	require.NoError(t, b.Set("k", map[string]int{"l": 1}))
+	require.NoError(t, b.Remove("k/l"))
+
+	assert.Equal(t, map[string]interface{}{
+		"a": json.Number("2"),
+		"b": map[string]interface{}{
+			"g": json.Number("2"),
+			"h": json.Number("3"),
+			"i": map[string]interface{}{"j": true},
+		},
+		"k": nil,
+	}, b.writes)
+
+	assert.Error(t, b.Set("", 1))
+	assert.Error(t, b.Set("a.b", 1))
+	assert.Error(t, b.Update("a", 1))
+}
+
+func TestWriteBatchFiretest(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"age": 30.0},
+		"bob":   map[string]interface{}{"age": 40.0},
+	})
+
+	b := New(server.URL+"/users", nil).Batch()
+	require.NoError(t, b.Set("alice/age", 31))
+	require.NoError(t, b.Remove("bob"))
+	require.NoError(t, b.Set("carol", map[string]int{"age": 20}))
+	require.NoError(t, b.Commit())
+
+	assert.Equal(t, map[string]interface{}{
+		"alice": map[string]interface{}{"age": 31.0},
+		"carol": map[string]interface{}{"age": 20.0},
+	}, server.Get("users"))
+}